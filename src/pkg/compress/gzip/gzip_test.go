@@ -7,6 +7,7 @@ package gzip
 import (
 	"bufio"
 	"bytes"
+	"io"
 	"io/ioutil"
 	"testing"
 	"time"
@@ -157,3 +158,39 @@ func TestLatin1RoundTrip(t *testing.T) {
 		}
 	}
 }
+
+// TestWriterFlush tests that data written before a Flush can be read
+// back before the Writer is closed.
+func TestWriterFlush(t *testing.T) {
+	buf := new(bytes.Buffer)
+
+	w := NewWriter(buf)
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	r, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	b := make([]byte, 5)
+	if _, err := io.ReadFull(r, b); err != nil || string(b) != "hello" {
+		t.Fatalf("ReadFull = %q, %v; want %q", b, err, "hello")
+	}
+
+	w.Write([]byte(", world"))
+	if err := w.Close(); err != nil {
+		t.Fatalf("Writer.Close: %v", err)
+	}
+	r, err = NewReader(buf)
+	if err != nil {
+		t.Fatalf("NewReader: %v", err)
+	}
+	all, err := ioutil.ReadAll(r)
+	if err != nil || string(all) != "hello, world" {
+		t.Fatalf("ReadAll = %q, %v; want %q", all, err, "hello, world")
+	}
+}
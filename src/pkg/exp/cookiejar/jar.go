@@ -4,13 +4,25 @@
 
 // Package cookiejar implements an RFC 6265-compliant http.CookieJar.
 //
-// TODO: example code to create a memory-backed cookie jar with the default
-// public suffix list.
+// A jar that keeps cookies in memory and uses the embedded public suffix
+// table is created with:
+//
+//	jar := cookiejar.New(&cookiejar.Options{
+//		Storage:          cookiejar.NewMemoryStorage(),
+//		PublicSuffixList: cookiejar.DefaultPublicSuffixList,
+//	})
+//	client := &http.Client{Jar: jar}
 package cookiejar
 
 import (
+	"encoding/hex"
+	"net"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // PublicSuffixList provides the public suffix of a domain. For example:
@@ -27,9 +39,9 @@ import (
 type PublicSuffixList interface {
 	// PublicSuffix returns the public suffix of domain.
 	//
-	// TODO: specify which of the caller and callee is responsible for IP
-	// addresses, for leading and trailing dots, for case sensitivity, and
-	// for IDN/Punycode.
+	// A Jar only passes domain names, never IP addresses, in lower case
+	// and without leading or trailing dots. Internationalized domain
+	// names are passed as they appear in URLs, typically in Punycode.
 	PublicSuffix(domain string) string
 
 	// String returns a description of the source of this public suffix list.
@@ -53,37 +65,383 @@ type Options struct {
 }
 
 // Jar implements the http.CookieJar interface from the net/http package.
+// It is safe for concurrent use by multiple goroutines; it holds its
+// Storage's lock while it uses the storage.
+//
+// Cookies are stored under the registered domain, the public suffix plus
+// one label, of their domain, or under the host name if that is itself a
+// public suffix or an IP address. Errors returned by the Storage are
+// ignored.
 type Jar struct {
 	storage Storage
 	psList  PublicSuffixList
 }
 
-// New returns a new cookie jar.
+// metadataKey is the storage key of the entries that describe the
+// jar's storage itself. It cannot collide with a domain.
+const metadataKey = ".metadata"
+
+// pslSubkey is the subkey of the metadata entry that holds the
+// description of the public suffix list used to compute the storage
+// keys.
+const pslSubkey = "psl"
+
+// New returns a new cookie jar. If the description of the public suffix
+// list differs from the one recorded in the storage, the stored cookies
+// are moved to the keys computed with the new list, and those set for a
+// domain that has become a public suffix are deleted.
 func New(o *Options) *Jar {
-	return &Jar{
+	j := &Jar{
 		storage: o.Storage,
 		psList:  o.PublicSuffixList,
 	}
+	j.storage.Lock()
+	defer j.storage.Unlock()
+	j.rekey()
+	return j
 }
 
-// TODO(nigeltao): how do we reject HttpOnly cookies? Do we post-process the
-// return value from Jar.Cookies?
-//
-// HttpOnly cookies are those for regular HTTP(S) requests but should not be
-// visible from JavaScript. The HttpOnly bit mitigates XSS attacks; it's not
-// for HTTP vs HTTPS vs FTP transports.
+// rekey updates the stored cookies after a change of public suffix list.
+// The storage must be locked.
+func (j *Jar) rekey() {
+	desc := "list " + j.psList.String()
+	current := false
+	j.storage.Entries(metadataKey, func(e Entry) (Action, time.Time, error) {
+		if e.Subkey == pslSubkey && e.Data == desc {
+			current = true
+		}
+		return Pass, time.Time{}, nil
+	})
+	if current {
+		return
+	}
+	j.storage.Keys(func(key string) error {
+		if key == metadataKey {
+			return nil
+		}
+		return j.storage.Entries(key, func(e Entry) (Action, time.Time, error) {
+			c, ok := decodeEntry(e)
+			if !ok {
+				return Delete, time.Time{}, nil
+			}
+			if !c.hostOnly && j.isPublicSuffix(c.domain) {
+				return Delete, time.Time{}, nil
+			}
+			if k := j.key(c.domain); k != key {
+				j.storage.Add(k, e)
+				return Delete, time.Time{}, nil
+			}
+			return Pass, time.Time{}, nil
+		})
+	})
+	now := time.Now()
+	j.storage.Add(metadataKey, Entry{Subkey: pslSubkey, Data: desc, Creation: now, LastAccess: now})
+}
+
+// HttpOnly cookies are those for regular HTTP(S) requests that should not
+// be visible from JavaScript. A Jar only serves HTTP requests, so it sends
+// HttpOnly cookies like the others.
 
 // Cookies implements the Cookies method of the http.CookieJar interface.
 //
 // It returns an empty slice if the URL's scheme is not HTTP or HTTPS.
+// Cookies are ordered with longer paths first and, among those with equal
+// paths, earlier creation times first.
 func (j *Jar) Cookies(u *url.URL) []*http.Cookie {
-	// TODO.
-	return nil
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil
+	}
+	host, ok := canonicalHost(u.Host)
+	if !ok {
+		return nil
+	}
+	https := u.Scheme == "https"
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	j.storage.Lock()
+	defer j.storage.Unlock()
+	now := time.Now()
+	var selected []*cookie
+	j.storage.Entries(j.key(host), func(e Entry) (Action, time.Time, error) {
+		c, ok := decodeEntry(e)
+		if !ok || c.expired(now) {
+			return Delete, time.Time{}, nil
+		}
+		if !c.shouldSend(https, host, path) {
+			return Pass, time.Time{}, nil
+		}
+		c.creation = e.Creation
+		selected = append(selected, c)
+		return Update, now, nil
+	})
+
+	sort.Sort(byPathLength(selected))
+	cookies := make([]*http.Cookie, len(selected))
+	for i, c := range selected {
+		cookies[i] = &http.Cookie{Name: c.name, Value: c.value}
+	}
+	return cookies
 }
 
 // SetCookies implements the SetCookies method of the http.CookieJar interface.
 //
 // It does nothing if the URL's scheme is not HTTP or HTTPS.
 func (j *Jar) SetCookies(u *url.URL, cookies []*http.Cookie) {
-	// TODO.
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return
+	}
+	host, ok := canonicalHost(u.Host)
+	if !ok {
+		return
+	}
+	defPath := defaultPath(u.Path)
+
+	j.storage.Lock()
+	defer j.storage.Unlock()
+	now := time.Now()
+	for i, hc := range cookies {
+		// Give the cookies distinct creation times, in order, so that
+		// Cookies sorts them deterministically.
+		now := now.Add(time.Duration(i))
+		c, ok := j.newCookie(hc, host, defPath, now)
+		if !ok {
+			continue
+		}
+		key, subkey := j.key(c.domain), c.subkey()
+		if c.expired(now) {
+			j.storage.Entries(key, func(e Entry) (Action, time.Time, error) {
+				if e.Subkey == subkey {
+					return Delete, time.Time{}, nil
+				}
+				return Pass, time.Time{}, nil
+			})
+			continue
+		}
+		j.storage.Add(key, Entry{Subkey: subkey, Data: c.data(), Creation: now, LastAccess: now})
+	}
+}
+
+// cookie is a cookie as stored in a Jar.
+type cookie struct {
+	name, value  string
+	domain, path string
+	hostOnly     bool
+	secure       bool
+	httpOnly     bool
+	expires      time.Time // zero for a session cookie
+	creation     time.Time
+}
+
+// newCookie returns the cookie to store for hc, received from host in a
+// response to a request for a URL whose default path is defPath, following
+// RFC 6265 section 5.3. It reports false if hc must be ignored.
+func (j *Jar) newCookie(hc *http.Cookie, host, defPath string, now time.Time) (*cookie, bool) {
+	if hc.Name == "" || strings.Contains(hc.Name, ";") {
+		return nil, false
+	}
+	c := &cookie{
+		name:     hc.Name,
+		value:    hc.Value,
+		path:     hc.Path,
+		secure:   hc.Secure,
+		httpOnly: hc.HttpOnly,
+	}
+
+	domain := strings.ToLower(hc.Domain)
+	if strings.HasPrefix(domain, ".") {
+		domain = domain[1:]
+	}
+	switch {
+	case domain == "":
+		c.domain, c.hostOnly = host, true
+	case domain == host && (isIP(host) || j.isPublicSuffix(host)):
+		// A domain attribute naming the host itself is ignored if the
+		// cookie could not be shared with other hosts anyway.
+		c.domain, c.hostOnly = host, true
+	case isIP(host) || j.isPublicSuffix(domain) || !domainMatch(host, domain):
+		return nil, false
+	default:
+		c.domain = domain
+	}
+
+	if c.path == "" || c.path[0] != '/' {
+		c.path = defPath
+	}
+
+	switch {
+	case hc.MaxAge < 0:
+		c.expires = now.Add(-time.Second)
+	case hc.MaxAge > 0:
+		c.expires = now.Add(time.Duration(hc.MaxAge) * time.Second)
+	case !hc.Expires.IsZero():
+		c.expires = hc.Expires
+		if !c.expires.After(now) {
+			c.expires = now.Add(-time.Second)
+		}
+	}
+	return c, true
+}
+
+func (c *cookie) expired(now time.Time) bool {
+	return !c.expires.IsZero() && !c.expires.After(now)
+}
+
+// shouldSend reports whether c should be sent in a request for path on
+// host, over HTTPS if https is set (RFC 6265 section 5.4).
+func (c *cookie) shouldSend(https bool, host, path string) bool {
+	if c.secure && !https {
+		return false
+	}
+	if c.hostOnly {
+		if host != c.domain {
+			return false
+		}
+	} else if !domainMatch(host, c.domain) {
+		return false
+	}
+	return pathMatch(path, c.path)
+}
+
+// subkey returns the storage subkey identifying c: its name, domain and
+// path.
+func (c *cookie) subkey() string {
+	return c.name + ";" + c.domain + ";" + c.path
+}
+
+// data returns the storage data of c: its flags, expiry time and value.
+func (c *cookie) data() string {
+	flags := "-"
+	if c.hostOnly {
+		flags += "h"
+	}
+	if c.secure {
+		flags += "s"
+	}
+	if c.httpOnly {
+		flags += "o"
+	}
+	expires := "-"
+	if !c.expires.IsZero() {
+		expires = strconv.FormatInt(c.expires.Unix(), 10)
+	}
+	return flags + " " + expires + " " + c.value
+}
+
+// decodeEntry returns the cookie stored in e.
+func decodeEntry(e Entry) (*cookie, bool) {
+	key := strings.SplitN(e.Subkey, ";", 3)
+	data := strings.SplitN(e.Data, " ", 3)
+	if len(key) != 3 || len(data) != 3 || !strings.HasPrefix(data[0], "-") {
+		return nil, false
+	}
+	c := &cookie{
+		name:     key[0],
+		domain:   key[1],
+		path:     key[2],
+		hostOnly: strings.Contains(data[0], "h"),
+		secure:   strings.Contains(data[0], "s"),
+		httpOnly: strings.Contains(data[0], "o"),
+		value:    data[2],
+	}
+	if data[1] != "-" {
+		sec, err := strconv.ParseInt(data[1], 10, 64)
+		if err != nil {
+			return nil, false
+		}
+		c.expires = time.Unix(sec, 0)
+	}
+	return c, true
+}
+
+// byPathLength sorts cookies as RFC 6265 section 5.4 recommends.
+type byPathLength []*cookie
+
+func (s byPathLength) Len() int      { return len(s) }
+func (s byPathLength) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byPathLength) Less(i, j int) bool {
+	if len(s[i].path) != len(s[j].path) {
+		return len(s[i].path) > len(s[j].path)
+	}
+	return s[i].creation.Before(s[j].creation)
+}
+
+// key returns the storage key for cookies of domain. Keys cannot hold
+// the colons of an IPv6 address, which is stored under a dot followed
+// by the address in hexadecimal; like metadataKey, that cannot collide
+// with a domain.
+func (j *Jar) key(domain string) string {
+	if ip := net.ParseIP(domain); ip != nil {
+		if strings.Contains(domain, ":") {
+			return "." + hex.EncodeToString(ip.To16())
+		}
+		return domain
+	}
+	ps := j.psList.PublicSuffix(domain)
+	if len(ps) >= len(domain) || !strings.HasSuffix(domain, "."+ps) {
+		return domain
+	}
+	i := strings.LastIndex(domain[:len(domain)-len(ps)-1], ".")
+	return domain[i+1:]
+}
+
+func (j *Jar) isPublicSuffix(domain string) bool {
+	return !isIP(domain) && j.psList.PublicSuffix(domain) == domain
+}
+
+// canonicalHost returns the lower-case host name of hostport, without
+// port or trailing dot, or its IP address in standard form, and reports
+// whether it is usable: a valid storage key or an IP address.
+func canonicalHost(hostport string) (string, bool) {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	} else if strings.HasPrefix(hostport, "[") && strings.HasSuffix(hostport, "]") {
+		host = hostport[1 : len(hostport)-1]
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.String(), true
+	}
+	host = strings.ToLower(host)
+	if strings.HasSuffix(host, ".") {
+		host = host[:len(host)-1]
+	}
+	return host, ValidStorageKey(host)
+}
+
+func isIP(host string) bool {
+	return net.ParseIP(host) != nil
+}
+
+// domainMatch reports whether host domain-matches domain (RFC 6265
+// section 5.1.3).
+func domainMatch(host, domain string) bool {
+	if host == domain {
+		return true
+	}
+	return !isIP(host) && strings.HasSuffix(host, "."+domain)
+}
+
+// pathMatch reports whether the request path path-matches the cookie path
+// cpath (RFC 6265 section 5.1.4).
+func pathMatch(path, cpath string) bool {
+	if !strings.HasPrefix(path, cpath) {
+		return false
+	}
+	return len(path) == len(cpath) || cpath[len(cpath)-1] == '/' || path[len(cpath)] == '/'
+}
+
+// defaultPath returns the default cookie path for the request path path
+// (RFC 6265 section 5.1.4).
+func defaultPath(path string) string {
+	if path == "" || path[0] != '/' {
+		return "/"
+	}
+	i := strings.LastIndex(path, "/")
+	if i == 0 {
+		return "/"
+	}
+	return path[:i]
 }
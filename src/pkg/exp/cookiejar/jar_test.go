@@ -0,0 +1,332 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookiejar
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestJar() *Jar {
+	return New(&Options{
+		Storage:          NewMemoryStorage(),
+		PublicSuffixList: DefaultPublicSuffixList,
+	})
+}
+
+func mustParseURL(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// cookieString returns the cookies sent by j for rawurl, as
+// space-separated name=value pairs.
+func cookieString(j *Jar, rawurl string) string {
+	var s []string
+	for _, c := range j.Cookies(mustParseURL(rawurl)) {
+		s = append(s, c.Name+"="+c.Value)
+	}
+	return strings.Join(s, " ")
+}
+
+// jarTest is a sequence of SetCookies calls followed by Cookies
+// queries.
+type jarTest struct {
+	description string
+	fromURL     string
+	setCookies  []*http.Cookie
+	queries     map[string]string // URL to expected cookieString
+}
+
+var past = time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var jarTests = []jarTest{
+	{
+		"host-only and domain cookies",
+		"http://www.example.com/",
+		[]*http.Cookie{
+			{Name: "a", Value: "1"},
+			{Name: "b", Value: "2", Domain: "example.com"},
+			{Name: "c", Value: "3", Domain: ".EXAMPLE.com"},
+			{Name: "d", Value: "4", Domain: "www.example.com"},
+		},
+		map[string]string{
+			"http://www.example.com":          "a=1 b=2 c=3 d=4",
+			"http://WWW.example.com.:8080/x":  "a=1 b=2 c=3 d=4",
+			"http://sub.www.example.com":      "b=2 c=3 d=4",
+			"http://example.com/":             "b=2 c=3",
+			"http://other.example.com/":       "b=2 c=3",
+			"http://www.example.com.evil.org": "",
+			"http://notexample.com/":          "",
+			"ftp://www.example.com/":          "",
+		},
+	},
+	{
+		"domain must cover the host and not be a public suffix",
+		"http://www.example.co.uk/",
+		[]*http.Cookie{
+			{Name: "a", Value: "1", Domain: "co.uk"},
+			{Name: "b", Value: "2", Domain: "uk"},
+			{Name: "c", Value: "3", Domain: "other.co.uk"},
+			{Name: "d", Value: "4", Domain: "sub.www.example.co.uk"},
+			{Name: "e", Value: "5", Domain: "example.co.uk"},
+		},
+		map[string]string{
+			"http://www.example.co.uk": "e=5",
+			"http://other.co.uk":       "",
+			"http://co.uk":             "",
+		},
+	},
+	{
+		"no supercookies on a second-level registry",
+		"http://evil.co.th/",
+		[]*http.Cookie{
+			{Name: "sid", Value: "attacker", Domain: "co.th"},
+			{Name: "a", Value: "1", Domain: "evil.co.th"},
+		},
+		map[string]string{
+			"http://bank.co.th": "",
+			"http://evil.co.th": "a=1",
+		},
+	},
+	{
+		"a public suffix host gets host-only cookies",
+		"http://co.uk/",
+		[]*http.Cookie{
+			{Name: "a", Value: "1"},
+			{Name: "b", Value: "2", Domain: "co.uk"},
+		},
+		map[string]string{
+			"http://co.uk":             "a=1 b=2",
+			"http://www.example.co.uk": "",
+		},
+	},
+	{
+		"IP address hosts",
+		"http://127.0.0.1:8080/",
+		[]*http.Cookie{
+			{Name: "a", Value: "1"},
+			{Name: "b", Value: "2", Domain: "127.0.0.1"},
+			{Name: "c", Value: "3", Domain: "0.0.1"},
+		},
+		map[string]string{
+			"http://127.0.0.1/": "a=1 b=2",
+			"http://227.0.0.1/": "",
+		},
+	},
+	{
+		"IPv6 address hosts",
+		"http://[::1]:8080/",
+		[]*http.Cookie{
+			{Name: "a", Value: "1"},
+			{Name: "b", Value: "2", Domain: "::1"},
+			{Name: "c", Value: "3", Domain: "1"},
+		},
+		map[string]string{
+			"http://[::1]:8080/":    "a=1 b=2",
+			"http://[0:0::1]/":      "a=1 b=2",
+			"http://[::2]/":         "",
+			"http://localhost:8080": "",
+		},
+	},
+	{
+		"paths and ordering",
+		"http://example.com/dir/page",
+		[]*http.Cookie{
+			{Name: "root", Value: "1", Path: "/"},
+			{Name: "foo", Value: "2", Path: "/foo"},
+			{Name: "foobar", Value: "3", Path: "/foo/bar"},
+			{Name: "def", Value: "4"},
+			{Name: "rel", Value: "5", Path: "relative"},
+			{Name: "slash", Value: "6", Path: "/foo/"},
+		},
+		map[string]string{
+			"http://example.com/foo/bar/baz": "foobar=3 slash=6 foo=2 root=1",
+			"http://example.com/foo":         "foo=2 root=1",
+			"http://example.com/foobar":      "root=1",
+			"http://example.com/dir":         "def=4 rel=5 root=1",
+			"http://example.com/dir/x":       "def=4 rel=5 root=1",
+			"http://example.com/directory":   "root=1",
+			"http://example.com":             "root=1",
+		},
+	},
+	{
+		"secure cookies",
+		"https://example.com/",
+		[]*http.Cookie{
+			{Name: "s", Value: "1", Secure: true},
+			{Name: "p", Value: "2", HttpOnly: true},
+		},
+		map[string]string{
+			"https://example.com/": "s=1 p=2",
+			"http://example.com/":  "p=2",
+		},
+	},
+	{
+		"expired cookies are not stored",
+		"http://example.com/",
+		[]*http.Cookie{
+			{Name: "a", Value: "1", MaxAge: -1},
+			{Name: "b", Value: "2", Expires: past},
+			{Name: "c", Value: "3", MaxAge: 3600},
+			{Name: "d", Value: "4", Expires: time.Now().Add(time.Hour)},
+		},
+		map[string]string{
+			"http://example.com/": "c=3 d=4",
+		},
+	},
+}
+
+func TestJar(t *testing.T) {
+	for _, test := range jarTests {
+		j := newTestJar()
+		j.SetCookies(mustParseURL(test.fromURL), test.setCookies)
+		for u, want := range test.queries {
+			if got := cookieString(j, u); got != want {
+				t.Errorf("%s: Cookies(%q) = %q; want %q", test.description, u, got, want)
+			}
+		}
+	}
+}
+
+func TestJarReplaceAndDelete(t *testing.T) {
+	j := newTestJar()
+	u := mustParseURL("http://www.example.com/")
+	j.SetCookies(u, []*http.Cookie{{Name: "a", Value: "1"}, {Name: "b", Value: "1", Domain: "example.com"}})
+	j.SetCookies(u, []*http.Cookie{{Name: "a", Value: "2"}})
+	if got := cookieString(j, "http://www.example.com/"); got != "a=2 b=1" {
+		t.Errorf("after replacing: %q", got)
+	}
+
+	// The host-only and domain cookies named b are distinct.
+	j.SetCookies(u, []*http.Cookie{{Name: "b", Value: "2"}})
+	if got := cookieString(j, "http://www.example.com/"); got != "a=2 b=1 b=2" {
+		t.Errorf("after adding host-only b: %q", got)
+	}
+
+	j.SetCookies(u, []*http.Cookie{
+		{Name: "a", Value: "", MaxAge: -1},
+		{Name: "b", Value: "", Domain: "example.com", Expires: past},
+	})
+	if got := cookieString(j, "http://www.example.com/"); got != "b=2" {
+		t.Errorf("after deleting: %q", got)
+	}
+	j.SetCookies(mustParseURL("ftp://www.example.com/"), []*http.Cookie{{Name: "f", Value: "1"}})
+	if got := cookieString(j, "http://www.example.com/"); got != "b=2" {
+		t.Errorf("after setting over ftp: %q", got)
+	}
+}
+
+func TestJarExpiry(t *testing.T) {
+	s := NewMemoryStorage()
+	j := New(&Options{Storage: s, PublicSuffixList: DefaultPublicSuffixList})
+	u := mustParseURL("http://example.com/")
+	j.SetCookies(u, []*http.Cookie{{Name: "a", Value: "1"}, {Name: "b", Value: "2", MaxAge: 3600}})
+
+	// Make b expire by rewriting its stored data.
+	s.Lock()
+	s.Entries("example.com", func(e Entry) (Action, time.Time, error) {
+		if strings.HasPrefix(e.Subkey, "b;") {
+			c, _ := decodeEntry(e)
+			c.expires = past
+			e.Data = c.data()
+			s.Add("example.com", e)
+		}
+		return Pass, time.Time{}, nil
+	})
+	s.Unlock()
+
+	if got := cookieString(j, "http://example.com/"); got != "a=1" {
+		t.Errorf("Cookies = %q; want a=1", got)
+	}
+	n := 0
+	s.Lock()
+	s.Entries("example.com", func(e Entry) (Action, time.Time, error) {
+		n++
+		return Pass, time.Time{}, nil
+	})
+	s.Unlock()
+	if n != 1 {
+		t.Errorf("%d stored entries; want the expired one deleted", n)
+	}
+}
+
+// testPSL is a PublicSuffixList with the given public suffixes.
+type testPSL []string
+
+func (l testPSL) PublicSuffix(domain string) string {
+	best := domain[strings.LastIndex(domain, ".")+1:]
+	for _, s := range l {
+		if (domain == s || strings.HasSuffix(domain, "."+s)) && len(s) > len(best) {
+			best = s
+		}
+	}
+	return best
+}
+
+func (l testPSL) String() string {
+	return fmt.Sprint([]string(l))
+}
+
+func TestJarPublicSuffixListChange(t *testing.T) {
+	s := NewMemoryStorage()
+	j := New(&Options{Storage: s, PublicSuffixList: testPSL{}})
+	j.SetCookies(mustParseURL("http://a.foo.example.com/"), []*http.Cookie{
+		{Name: "host", Value: "1"},
+		{Name: "dom", Value: "2", Domain: "foo.example.com"},
+	})
+
+	// With example.com public, the cookies move to foo.example.com.
+	j = New(&Options{Storage: s, PublicSuffixList: testPSL{"example.com"}})
+	if got := cookieString(j, "http://a.foo.example.com/"); got != "host=1 dom=2" {
+		t.Errorf("after first change: %q", got)
+	}
+	var keys []string
+	s.Lock()
+	s.Keys(func(key string) error {
+		if key != metadataKey {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	s.Unlock()
+	if len(keys) != 1 || keys[0] != "foo.example.com" {
+		t.Errorf("storage keys = %v; want [foo.example.com]", keys)
+	}
+
+	// With foo.example.com public, the domain cookie is dropped.
+	j = New(&Options{Storage: s, PublicSuffixList: testPSL{"foo.example.com"}})
+	if got := cookieString(j, "http://a.foo.example.com/"); got != "host=1" {
+		t.Errorf("after second change: %q", got)
+	}
+}
+
+func TestJarConcurrency(t *testing.T) {
+	j := newTestJar()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			u := mustParseURL(fmt.Sprintf("http://h%d.example.com/", i%3))
+			for k := 0; k < 50; k++ {
+				j.SetCookies(u, []*http.Cookie{{Name: fmt.Sprint("c", i), Value: fmt.Sprint(k), Domain: "example.com"}})
+				j.Cookies(u)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if n := len(j.Cookies(mustParseURL("http://example.com/"))); n != 10 {
+		t.Errorf("got %d cookies; want 10", n)
+	}
+}
@@ -0,0 +1,247 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build ignore
+
+// Public suffix table generator.
+// Reads the list published at http://publicsuffix.org/ and writes
+// the rules of its ICANN section, with internationalized labels in
+// their Punycode form, as a Go source file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	url     = flag.String("url", "https://publicsuffix.org/list/public_suffix_list.dat", "URL of the public suffix list")
+	file    = flag.String("file", "", "read the list from this file instead of url")
+	version = flag.String("version", "", "version of the list, by default from its VERSION comment or modification time")
+)
+
+func main() {
+	flag.Parse()
+	r, ver, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer r.Close()
+	if *version != "" {
+		ver = *version
+	}
+	rules, listVer, err := readICANN(r)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *version == "" && listVer != "" {
+		ver = listVer
+	}
+	src := "--url=" + *url
+	if *file != "" {
+		src = "--file=" + *file
+	}
+	if *version != "" {
+		src += " --version=" + *version
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	fmt.Fprintf(w, "// Generated by running\n//\tmaketables %s\n// DO NOT EDIT\n\n", src)
+	fmt.Fprintf(w, "package cookiejar\n\n")
+	fmt.Fprintf(w, "// publicSuffixVersion identifies the list from which publicSuffixRules\n// is derived.\n")
+	fmt.Fprintf(w, "const publicSuffixVersion = %q\n\n", ver)
+	fmt.Fprintf(w, "// publicSuffixRules holds the %d rules of the ICANN section of the list,\n// one per line.\n", len(rules))
+	fmt.Fprintf(w, "const publicSuffixRules = `\n")
+	for _, rule := range rules {
+		fmt.Fprintln(w, rule)
+	}
+	fmt.Fprintf(w, "`\n")
+	if err := w.Flush(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// open opens the list and returns a version derived from its
+// modification time.
+func open() (io.ReadCloser, string, error) {
+	const layout = "2006-01-02"
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return nil, "", err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, "", err
+		}
+		return f, fi.ModTime().UTC().Format(layout), nil
+	}
+	res, err := http.Get(*url)
+	if err != nil {
+		return nil, "", err
+	}
+	if res.StatusCode != 200 {
+		res.Body.Close()
+		return nil, "", fmt.Errorf("GET %s: %s", *url, res.Status)
+	}
+	ver := time.Now().UTC().Format(layout)
+	if t, err := time.Parse(http.TimeFormat, res.Header.Get("Last-Modified")); err == nil {
+		ver = t.UTC().Format(layout)
+	}
+	return res.Body, ver, nil
+}
+
+// readICANN returns the rules between the list's BEGIN and END ICANN
+// DOMAINS markers, and the version given in a VERSION comment, if any.
+func readICANN(r io.Reader) (rules []string, ver string, err error) {
+	br := bufio.NewReader(r)
+	in := false
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, "", err
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "// VERSION: "):
+			ver = line[len("// VERSION: "):]
+		case strings.Contains(line, "===BEGIN ICANN DOMAINS==="):
+			in = true
+		case strings.Contains(line, "===END ICANN DOMAINS==="):
+			if len(rules) == 0 {
+				return nil, "", fmt.Errorf("no rules in ICANN section")
+			}
+			return rules, ver, nil
+		case in && line != "" && !strings.HasPrefix(line, "//"):
+			// Only the first field of a line is the rule.
+			if i := strings.IndexAny(line, " \t"); i >= 0 {
+				line = line[:i]
+			}
+			rules = append(rules, toASCII(line))
+		}
+		if err == io.EOF {
+			return nil, "", fmt.Errorf("missing end of ICANN section")
+		}
+	}
+	panic("unreachable")
+}
+
+// toASCII converts the labels of rule that are not ASCII to their
+// Punycode form, as used in host names.
+func toASCII(rule string) string {
+	labels := strings.Split(strings.ToLower(rule), ".")
+	for i, label := range labels {
+		prefix := ""
+		if i == 0 && strings.HasPrefix(label, "!") {
+			prefix, label = "!", label[1:]
+		}
+		for _, c := range label {
+			if c >= 0x80 {
+				labels[i] = prefix + "xn--" + punycode(label)
+				break
+			}
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// Parameters of the Punycode encoding, from RFC 3492.
+const (
+	base        = 36
+	tmin        = 1
+	tmax        = 26
+	skew        = 38
+	damp        = 700
+	initialBias = 72
+	initialN    = 128
+)
+
+// punycode returns the Punycode encoding of s, as defined by RFC 3492,
+// without the "xn--" prefix.
+func punycode(s string) string {
+	runes := []rune(s)
+	var out bytes.Buffer
+	for _, r := range runes {
+		if r < 0x80 {
+			out.WriteByte(byte(r))
+		}
+	}
+	b := out.Len()
+	h := b
+	if b > 0 {
+		out.WriteByte('-')
+	}
+	n, delta, bias := rune(initialN), 0, initialBias
+	for h < len(runes) {
+		m := rune(0x7fffffff)
+		for _, r := range runes {
+			if r >= n && r < m {
+				m = r
+			}
+		}
+		delta += int(m-n) * (h + 1)
+		n = m
+		for _, r := range runes {
+			if r < n {
+				delta++
+			}
+			if r != n {
+				continue
+			}
+			q := delta
+			for k := base; ; k += base {
+				t := k - bias
+				if t < tmin {
+					t = tmin
+				} else if t > tmax {
+					t = tmax
+				}
+				if q < t {
+					break
+				}
+				out.WriteByte(digit(t + (q-t)%(base-t)))
+				q = (q - t) / (base - t)
+			}
+			out.WriteByte(digit(q))
+			bias = adapt(delta, h+1, h == b)
+			delta = 0
+			h++
+		}
+		delta++
+		n++
+	}
+	return out.String()
+}
+
+func adapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= damp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > (base-tmin)*tmax/2 {
+		delta /= base - tmin
+		k += base
+	}
+	return k + (base-tmin+1)*delta/(delta+skew)
+}
+
+func digit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
@@ -0,0 +1,96 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookiejar
+
+import (
+	"strings"
+	"sync"
+)
+
+// DefaultPublicSuffixList is a PublicSuffixList built from a table
+// embedded in this package. The table holds all the rules of the
+// ICANN section of the list published at http://publicsuffix.org/,
+// with internationalized labels in their Punycode ("xn--") form;
+// it is generated by maketables.go. Domains that match no rule have
+// their last label as public suffix, as the list's algorithm
+// prescribes.
+var DefaultPublicSuffixList PublicSuffixList = &ruleList{
+	name: "publicsuffix.org ICANN section, " + publicSuffixVersion,
+	src:  publicSuffixRules,
+}
+
+// ruleKind is the kind of a public suffix rule.
+type ruleKind int
+
+const (
+	normalRule    ruleKind = iota + 1 // "a.b"
+	wildcardRule                      // "*.a.b", stored as "a.b"
+	exceptionRule                     // "!a.b"
+)
+
+// ruleList is a PublicSuffixList that implements the algorithm of
+// http://publicsuffix.org/list/ over rules in the list's format: one
+// rule per line, with comments starting with "//".
+type ruleList struct {
+	name string
+	src  string
+
+	once      sync.Once
+	normal    map[string]bool
+	wildcard  map[string]bool
+	exception map[string]bool
+}
+
+func (l *ruleList) parse() {
+	l.normal = make(map[string]bool)
+	l.wildcard = make(map[string]bool)
+	l.exception = make(map[string]bool)
+	for _, line := range strings.Split(l.src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "//") {
+			continue
+		}
+		for _, rule := range strings.Fields(line) {
+			switch {
+			case strings.HasPrefix(rule, "!"):
+				l.exception[rule[1:]] = true
+			case strings.HasPrefix(rule, "*."):
+				l.wildcard[rule[2:]] = true
+			default:
+				l.normal[rule] = true
+			}
+		}
+	}
+}
+
+// PublicSuffix returns the public suffix of domain, which must be in
+// lower case, without leading or trailing dots.
+func (l *ruleList) PublicSuffix(domain string) string {
+	l.once.Do(func() { l.parse() })
+	// Try the suffixes of domain from the longest to the shortest;
+	// the first rule to match is the longest one.
+	for s := domain; ; {
+		parent := ""
+		if i := strings.Index(s, "."); i >= 0 {
+			parent = s[i+1:]
+		}
+		switch {
+		case l.exception[s]:
+			return parent
+		case l.normal[s], parent != "" && l.wildcard[parent]:
+			return s
+		}
+		if parent == "" {
+			// The implicit rule "*".
+			return s
+		}
+		s = parent
+	}
+	panic("unreachable")
+}
+
+func (l *ruleList) String() string {
+	return l.name
+}
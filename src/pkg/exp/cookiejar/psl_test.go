@@ -0,0 +1,51 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cookiejar
+
+import (
+	"testing"
+)
+
+var publicSuffixTests = map[string]string{
+	"com":                       "com",
+	"example.com":               "com",
+	"www.example.com":           "com",
+	"foo1.foo2.foo3.co.uk":      "co.uk",
+	"co.uk":                     "co.uk",
+	"bar.pvt.k12.wy.us":         "k12.wy.us",
+	"example.unknowntld":        "unknowntld",
+	"www.ck":                    "ck",
+	"foo.www.ck":                "ck",
+	"other.ck":                  "other.ck",
+	"foo.other.ck":              "other.ck",
+	"example.kawasaki.jp":       "example.kawasaki.jp",
+	"www.example.kawasaki.jp":   "example.kawasaki.jp",
+	"city.kawasaki.jp":          "kawasaki.jp",
+	"www.city.kawasaki.jp":      "kawasaki.jp",
+	"school.sch.uk":             "school.sch.uk",
+	"www.school.sch.uk":         "school.sch.uk",
+	"www.example.com.au":        "com.au",
+	"github.io":                 "io",
+	"1.0.168.192.in-addr.arpa":  "in-addr.arpa",
+	"www.example.gov.au":        "gov.au",
+	"www.example.nsw.gov.au":    "gov.au",
+	"www.example.k12.ma.us":     "k12.ma.us",
+	"www.example.pvt.k12.ma.us": "pvt.k12.ma.us",
+	"evil.co.th":                "co.th",
+	"www.example.co.ke":         "co.ke",
+	"www.example.co.hu":         "co.hu",
+	"www.example.ac.th":         "ac.th",
+	"www.example.co.ir":         "co.ir",
+	"school.k12.ak.us":          "k12.ak.us",
+	"www.example.xn--55qx5d.cn": "xn--55qx5d.cn", // 公司.cn
+}
+
+func TestDefaultPublicSuffixList(t *testing.T) {
+	for domain, want := range publicSuffixTests {
+		if got := DefaultPublicSuffixList.PublicSuffix(domain); got != want {
+			t.Errorf("PublicSuffix(%q) = %q; want %q", domain, got, want)
+		}
+	}
+}
@@ -5,6 +5,8 @@
 package cookiejar
 
 import (
+	"errors"
+	"sync"
 	"time"
 )
 
@@ -99,3 +101,87 @@ func ValidStorageKey(key string) bool {
 	}
 	return hasNonDot
 }
+
+// NewMemoryStorage returns a Storage that keeps its entries in memory.
+// It has no storage constraint: entries are only deleted on request.
+func NewMemoryStorage() Storage {
+	return &memoryStorage{m: make(map[string]map[string]Entry)}
+}
+
+// memoryStorage is a Storage backed by a map from keys to entries,
+// themselves keyed by subkey.
+type memoryStorage struct {
+	sync.Mutex
+	m map[string]map[string]Entry
+}
+
+var errEmptyEntry = errors.New("cookiejar: entry has empty subkey or data")
+
+func (s *memoryStorage) Add(key string, entries ...Entry) error {
+	for _, e := range entries {
+		if e.Subkey == "" || e.Data == "" {
+			return errEmptyEntry
+		}
+	}
+	submap := s.m[key]
+	if submap == nil {
+		submap = make(map[string]Entry)
+		s.m[key] = submap
+	}
+	for _, e := range entries {
+		if old, ok := submap[e.Subkey]; ok {
+			e.Creation = old.Creation
+		}
+		submap[e.Subkey] = e
+	}
+	return nil
+}
+
+func (s *memoryStorage) Delete(key string) error {
+	delete(s.m, key)
+	return nil
+}
+
+func (s *memoryStorage) Entries(key string, f func(entry Entry) (Action, time.Time, error)) error {
+	submap := s.m[key]
+	entries := make([]Entry, 0, len(submap))
+	for _, e := range submap {
+		entries = append(entries, e)
+	}
+	for _, e := range entries {
+		action, t, err := f(e)
+		if err != nil {
+			return err
+		}
+		// f may have modified the storage.
+		submap := s.m[key]
+		switch action {
+		case Update:
+			if cur, ok := submap[e.Subkey]; ok {
+				cur.LastAccess = t
+				submap[e.Subkey] = cur
+			}
+		case Delete:
+			delete(submap, e.Subkey)
+			if len(submap) == 0 {
+				delete(s.m, key)
+			}
+		}
+	}
+	return nil
+}
+
+func (s *memoryStorage) Keys(f func(key string) error) error {
+	keys := make([]string, 0, len(s.m))
+	for key, submap := range s.m {
+		if len(submap) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		if err := f(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
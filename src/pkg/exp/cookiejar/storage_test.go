@@ -6,6 +6,7 @@ package cookiejar
 
 import (
 	"testing"
+	"time"
 )
 
 var validStorageKeyTests = map[string]bool{
@@ -46,3 +47,59 @@ func TestValidStorageKey(t *testing.T) {
 		}
 	}
 }
+
+func TestMemoryStorage(t *testing.T) {
+	s := NewMemoryStorage()
+	s.Lock()
+	defer s.Unlock()
+
+	t0 := time.Unix(1000, 0)
+	t1 := time.Unix(2000, 0)
+	if err := s.Add("example.com", Entry{Subkey: "a", Data: "1", Creation: t0}, Entry{Subkey: "b", Data: "2", Creation: t0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("example.com", Entry{Subkey: "a", Data: "3", Creation: t1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add("example.org", Entry{Subkey: "", Data: "x"}); err == nil {
+		t.Errorf("Add with empty subkey succeeded")
+	}
+	if err := s.Add("example.org", Entry{Subkey: "c", Data: "4"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]Entry)
+	s.Entries("example.com", func(e Entry) (Action, time.Time, error) {
+		got[e.Subkey] = e
+		switch e.Subkey {
+		case "a":
+			return Update, t1, nil
+		case "b":
+			return Delete, time.Time{}, nil
+		}
+		return Pass, time.Time{}, nil
+	})
+	if len(got) != 2 || got["a"].Data != "3" || !got["a"].Creation.Equal(t0) {
+		t.Errorf("entries = %v; want a replaced with its creation time kept", got)
+	}
+	s.Entries("example.com", func(e Entry) (Action, time.Time, error) {
+		if e.Subkey != "a" || !e.LastAccess.Equal(t1) {
+			t.Errorf("after update and delete, got entry %+v", e)
+		}
+		return Pass, time.Time{}, nil
+	})
+
+	keys := make(map[string]bool)
+	s.Keys(func(key string) error {
+		keys[key] = true
+		return nil
+	})
+	if len(keys) != 2 || !keys["example.com"] || !keys["example.org"] {
+		t.Errorf("keys = %v", keys)
+	}
+	s.Delete("example.org")
+	s.Entries("example.org", func(e Entry) (Action, time.Time, error) {
+		t.Errorf("entry %+v left after Delete", e)
+		return Pass, time.Time{}, nil
+	})
+}
@@ -246,7 +246,10 @@ var pkgDeps = map[string][]string{
 
 	// Uses of networking.
 	"log/syslog":    {"L4", "OS", "net"},
+	"net/dns":       {"L4", "OS", "net"},
+	"net/icmp":      {"L4", "OS", "net", "syscall"},
 	"net/mail":      {"L4", "NET", "OS"},
+	"net/netutil":   {"L4", "OS", "net"},
 	"net/textproto": {"L4", "OS", "net"},
 
 	// Support libraries for crypto that aren't L2.
@@ -317,18 +320,21 @@ var pkgDeps = map[string][]string{
 	// HTTP, kingpin of dependencies.
 	"net/http": {
 		"L4", "NET", "OS",
-		"compress/gzip", "crypto/tls", "mime/multipart", "runtime/debug",
+		"compress/gzip", "compress/zlib", "container/list", "crypto/md5",
+		"crypto/rand", "crypto/sha1", "crypto/sha256", "crypto/tls",
+		"encoding/hex", "mime/multipart", "runtime/debug", "syscall",
 	},
 
 	// HTTP-using packages.
-	"expvar":            {"L4", "OS", "encoding/json", "net/http"},
-	"net/http/cgi":      {"L4", "NET", "OS", "crypto/tls", "net/http", "regexp"},
-	"net/http/fcgi":     {"L4", "NET", "OS", "net/http", "net/http/cgi"},
-	"net/http/httptest": {"L4", "NET", "OS", "crypto/tls", "flag", "net/http"},
-	"net/http/httputil": {"L4", "NET", "OS", "net/http"},
-	"net/http/pprof":    {"L4", "OS", "html/template", "net/http", "runtime/pprof"},
-	"net/rpc":           {"L4", "NET", "encoding/gob", "net/http", "text/template"},
-	"net/rpc/jsonrpc":   {"L4", "NET", "encoding/json", "net/rpc"},
+	"expvar":             {"L4", "OS", "encoding/json", "net/http"},
+	"net/http/cgi":       {"L4", "NET", "OS", "crypto/tls", "net/http", "regexp"},
+	"net/http/fcgi":      {"L4", "NET", "OS", "net/http", "net/http/cgi"},
+	"net/http/httptest":  {"L4", "NET", "OS", "crypto/tls", "flag", "net/http"},
+	"net/http/httputil":  {"L4", "NET", "OS", "container/list", "crypto/sha1", "crypto/tls", "encoding/hex", "net/http"},
+	"net/http/pprof":     {"L4", "OS", "html/template", "net/http", "runtime/pprof"},
+	"net/http/websocket": {"L4", "CRYPTO", "NET", "OS", "crypto/rand", "crypto/tls", "net/http"},
+	"net/rpc":            {"L4", "NET", "encoding/gob", "net/http", "text/template"},
+	"net/rpc/jsonrpc":    {"L4", "NET", "encoding/json", "net/rpc"},
 }
 
 // isMacro reports whether p is a package dependency macro
@@ -63,6 +63,220 @@ func resolveAfnetAddr(afnet, addr string, deadline time.Time) (Addr, error) {
 	return nil, nil
 }
 
+// A Dialer contains options for connecting to an address.
+//
+// The zero value for each field is equivalent to dialing without
+// that option, so dialing with the zero value of Dialer is the same
+// as calling Dial.
+type Dialer struct {
+	// Timeout is the maximum amount of time a dial will wait for
+	// a connect to complete, including name resolution.  If
+	// Deadline is also set, the dial may fail earlier.
+	// If zero, there is no timeout, though the operating system
+	// may impose its own.
+	Timeout time.Duration
+
+	// Deadline is the absolute point in time after which dials
+	// fail.  If Timeout is also set, the dial may fail earlier.
+	// If zero, there is no deadline.
+	Deadline time.Time
+
+	// LocalAddr is the local address to use when dialing.  It
+	// must be of the address type of the network dialed, such as
+	// *TCPAddr for "tcp".  If nil, a local address is chosen
+	// automatically.
+	LocalAddr Addr
+
+	// DualStack enables Happy Eyeballs (RFC 6555) dialing for
+	// the "tcp" network.  When the host of the address is a name
+	// with both IPv4 and IPv6 addresses, the addresses returned by
+	// LookupIP are dialed in parallel, with staggered starts,
+	// alternating between the two families; the first connection
+	// established is returned and the others are closed.
+	DualStack bool
+
+	// FallbackDelay is the time a DualStack dial waits for an
+	// attempt before starting the next one.  If zero,
+	// DefaultFallbackDelay is used.
+	FallbackDelay time.Duration
+
+	// KeepAlive, if positive, enables TCP keep-alives on the
+	// connection, probing it after it has been idle for this long
+	// where the operating system allows setting the period.
+	KeepAlive time.Duration
+}
+
+// DefaultFallbackDelay is the default value of Dialer.FallbackDelay,
+// the delay suggested by RFC 6555.
+const DefaultFallbackDelay = 300 * time.Millisecond
+
+// deadline returns the earlier of d.Deadline and the time
+// d.Timeout from now, or the zero time if neither is set.
+func (d *Dialer) deadline() time.Time {
+	if d.Timeout == 0 {
+		return d.Deadline
+	}
+	timeoutDeadline := time.Now().Add(d.Timeout)
+	if d.Deadline.IsZero() || timeoutDeadline.Before(d.Deadline) {
+		return timeoutDeadline
+	}
+	return d.Deadline
+}
+
+// Dial connects to the address addr on the network net, as the Dial
+// function does, using the options of d.
+func (d *Dialer) Dial(net, addr string) (Conn, error) {
+	deadline := d.deadline()
+	if useDialTimeoutRace && !deadline.IsZero() {
+		// On windows and plan9, use the relatively inefficient
+		// goroutine-racing implementation that doesn't push
+		// down deadlines to the pollster.
+		// TODO: remove this once those are implemented.
+		return d.dialTimeoutRace(net, addr, deadline)
+	}
+	ras, err := d.resolveAddrs(net, addr, deadline)
+	if err != nil {
+		return nil, err
+	}
+	return d.dialAddrs(net, addr, ras, deadline)
+}
+
+// resolveAddrs resolves addr on the network net, returning the
+// addresses to dial in order of preference.  There is more than one
+// only for a DualStack dial of a host name.
+func (d *Dialer) resolveAddrs(net, addr string, deadline time.Time) ([]Addr, error) {
+	if d.DualStack && net == "tcp" {
+		host, port, err := SplitHostPort(addr)
+		if err == nil && host != "" && ParseIP(host) == nil {
+			return d.resolveDualStack(net, host, port, deadline)
+		}
+	}
+	_, ra, err := resolveNetAddr("dial", net, addr, deadline)
+	if err != nil {
+		return nil, err
+	}
+	return []Addr{ra}, nil
+}
+
+// resolveDualStack looks up all the addresses of host and returns
+// them alternating between the families, starting with the family of
+// the first address returned.
+func (d *Dialer) resolveDualStack(net, host, port string, deadline time.Time) ([]Addr, error) {
+	portnum, err := parsePort(net, port)
+	if err != nil {
+		return nil, &OpError{"dial", net, nil, err}
+	}
+	ips, err := lookupIPDeadline(host, deadline)
+	if err != nil {
+		return nil, &OpError{"dial", net, nil, err}
+	}
+	// A local address of one family rules out the other.
+	if la, ok := d.LocalAddr.(*TCPAddr); ok && la != nil && la.IP != nil && !la.IP.IsUnspecified() {
+		var same []IP
+		for _, ip := range ips {
+			if (ip.To4() != nil) == (la.IP.To4() != nil) {
+				same = append(same, ip)
+			}
+		}
+		if len(same) > 0 {
+			ips = same
+		}
+	}
+	var primaries, fallbacks []IP
+	for _, ip := range ips {
+		if (ip.To4() != nil) == (ips[0].To4() != nil) {
+			primaries = append(primaries, ip)
+		} else {
+			fallbacks = append(fallbacks, ip)
+		}
+	}
+	ras := make([]Addr, 0, len(ips))
+	for i := 0; i < len(primaries) || i < len(fallbacks); i++ {
+		if i < len(primaries) {
+			ras = append(ras, &TCPAddr{IP: primaries[i], Port: portnum})
+		}
+		if i < len(fallbacks) {
+			ras = append(ras, &TCPAddr{IP: fallbacks[i], Port: portnum})
+		}
+	}
+	return ras, nil
+}
+
+// dialAddrs dials the addresses ras, in parallel if there are several.
+func (d *Dialer) dialAddrs(net, addr string, ras []Addr, deadline time.Time) (Conn, error) {
+	if len(ras) == 1 {
+		return d.dialAddr(net, addr, ras[0], deadline)
+	}
+	delay := d.FallbackDelay
+	if delay <= 0 {
+		delay = DefaultFallbackDelay
+	}
+	type dialResult struct {
+		Conn
+		error
+	}
+	// Buffered so that the losing attempts never block.
+	results := make(chan dialResult, len(ras))
+	start := func(ra Addr) <-chan time.Time {
+		go func() {
+			c, err := d.dialAddr(net, addr, ra, deadline)
+			results <- dialResult{c, err}
+		}()
+		return time.After(delay)
+	}
+	fallback := start(ras[0])
+	next, pending := 1, 1
+	var firstErr error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.error == nil {
+				go func(n int) {
+					for ; n > 0; n-- {
+						if r := <-results; r.Conn != nil {
+							r.Conn.Close()
+						}
+					}
+				}(pending)
+				return r.Conn, nil
+			}
+			if firstErr == nil {
+				firstErr = r.error
+			}
+			if next < len(ras) {
+				// Don't wait for the delay after a failure.
+				fallback = start(ras[next])
+				next++
+				pending++
+			}
+		case <-fallback:
+			fallback = nil
+			if next < len(ras) {
+				fallback = start(ras[next])
+				next++
+				pending++
+			}
+		}
+	}
+	return nil, firstErr
+}
+
+// dialAddr dials the single address ra and applies the options of d
+// to the connection.
+func (d *Dialer) dialAddr(net, addr string, ra Addr, deadline time.Time) (Conn, error) {
+	c, err := dialAddr(net, addr, d.LocalAddr, ra, deadline)
+	if err != nil {
+		return nil, err
+	}
+	if tc, ok := c.(*TCPConn); ok && d.KeepAlive > 0 {
+		tc.SetKeepAlive(true)
+		// Not every operating system can set the period.
+		setKeepAlivePeriod(tc.fd, d.KeepAlive)
+	}
+	return c, nil
+}
+
 // Dial connects to the address addr on the network net.
 //
 // Known networks are "tcp", "tcp4" (IPv4-only), "tcp6" (IPv6-only),
@@ -86,24 +300,39 @@ func resolveAfnetAddr(afnet, addr string, deadline time.Time) (Addr, error) {
 //	Dial("ip4:1", "127.0.0.1")
 //	Dial("ip6:ospf", "::1")
 //
+// To set a local address, a deadline or keep-alives, use a Dialer.
 func Dial(net, addr string) (Conn, error) {
-	_, addri, err := resolveNetAddr("dial", net, addr, noDeadline)
-	if err != nil {
-		return nil, err
-	}
-	return dialAddr(net, addr, addri, noDeadline)
+	var d Dialer
+	return d.Dial(net, addr)
 }
 
-func dialAddr(net, addr string, addri Addr, deadline time.Time) (c Conn, err error) {
-	switch ra := addri.(type) {
+// dialAddr dials raddr, from laddr if it is not nil.
+func dialAddr(net, addr string, laddr, raddr Addr, deadline time.Time) (c Conn, err error) {
+	switch ra := raddr.(type) {
 	case *TCPAddr:
-		c, err = dialTCP(net, nil, ra, deadline)
+		la, ok := laddr.(*TCPAddr)
+		if laddr != nil && !ok {
+			return nil, localAddrError(net, laddr, raddr)
+		}
+		c, err = dialTCP(net, la, ra, deadline)
 	case *UDPAddr:
-		c, err = dialUDP(net, nil, ra, deadline)
+		la, ok := laddr.(*UDPAddr)
+		if laddr != nil && !ok {
+			return nil, localAddrError(net, laddr, raddr)
+		}
+		c, err = dialUDP(net, la, ra, deadline)
 	case *IPAddr:
-		c, err = dialIP(net, nil, ra, deadline)
+		la, ok := laddr.(*IPAddr)
+		if laddr != nil && !ok {
+			return nil, localAddrError(net, laddr, raddr)
+		}
+		c, err = dialIP(net, la, ra, deadline)
 	case *UnixAddr:
-		c, err = dialUnix(net, nil, ra, deadline)
+		la, ok := laddr.(*UnixAddr)
+		if laddr != nil && !ok {
+			return nil, localAddrError(net, laddr, raddr)
+		}
+		c, err = dialUnix(net, la, ra, deadline)
 	default:
 		err = &OpError{"dial", net + " " + addr, nil, UnknownNetworkError(net)}
 	}
@@ -113,32 +342,25 @@ func dialAddr(net, addr string, addri Addr, deadline time.Time) (c Conn, err err
 	return
 }
 
+func localAddrError(net string, laddr, raddr Addr) error {
+	return &OpError{"dial", net, raddr, &AddrError{"mismatched local address type", laddr.String()}}
+}
+
 const useDialTimeoutRace = runtime.GOOS == "windows" || runtime.GOOS == "plan9"
 
 // DialTimeout acts like Dial but takes a timeout.
 // The timeout includes name resolution, if required.
 func DialTimeout(net, addr string, timeout time.Duration) (Conn, error) {
-	if useDialTimeoutRace {
-		// On windows and plan9, use the relatively inefficient
-		// goroutine-racing implementation of DialTimeout that
-		// doesn't push down deadlines to the pollster.
-		// TODO: remove this once those are implemented.
-		return dialTimeoutRace(net, addr, timeout)
-	}
-	deadline := time.Now().Add(timeout)
-	_, addri, err := resolveNetAddr("dial", net, addr, deadline)
-	if err != nil {
-		return nil, err
-	}
-	return dialAddr(net, addr, addri, deadline)
+	d := Dialer{Timeout: timeout}
+	return d.Dial(net, addr)
 }
 
 // dialTimeoutRace is the old implementation of DialTimeout, still used
 // on operating systems where the deadline hasn't been pushed down
 // into the pollserver.
 // TODO: fix this on Windows and plan9.
-func dialTimeoutRace(net, addr string, timeout time.Duration) (Conn, error) {
-	t := time.NewTimer(timeout)
+func (d *Dialer) dialTimeoutRace(net, addr string, deadline time.Time) (Conn, error) {
+	t := time.NewTimer(deadline.Sub(time.Now()))
 	defer t.Stop()
 	type pair struct {
 		Conn
@@ -147,13 +369,13 @@ func dialTimeoutRace(net, addr string, timeout time.Duration) (Conn, error) {
 	ch := make(chan pair, 1)
 	resolvedAddr := make(chan Addr, 1)
 	go func() {
-		_, addri, err := resolveNetAddr("dial", net, addr, noDeadline)
+		ras, err := d.resolveAddrs(net, addr, noDeadline)
 		if err != nil {
 			ch <- pair{nil, err}
 			return
 		}
-		resolvedAddr <- addri // in case we need it for OpError
-		c, err := dialAddr(net, addr, addri, noDeadline)
+		resolvedAddr <- ras[0] // in case we need it for OpError
+		c, err := d.dialAddrs(net, addr, ras, noDeadline)
 		ch <- pair{c, err}
 	}()
 	select {
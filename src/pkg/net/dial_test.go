@@ -284,6 +284,135 @@ func TestDialTimeoutFDLeak(t *testing.T) {
 	}
 }
 
+func TestDialerLocalAddr(t *testing.T) {
+	ln, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		c.Close()
+	}()
+
+	d := &Dialer{LocalAddr: &TCPAddr{IP: IPv4(127, 0, 0, 1)}, Timeout: time.Second}
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	la, ok := c.LocalAddr().(*TCPAddr)
+	if !ok || !la.IP.Equal(IPv4(127, 0, 0, 1)) || la.Port == 0 {
+		t.Errorf("LocalAddr = %v; want 127.0.0.1 with a port", c.LocalAddr())
+	}
+
+	d = &Dialer{LocalAddr: &UDPAddr{IP: IPv4(127, 0, 0, 1)}}
+	if c, err := d.Dial("tcp", ln.Addr().String()); err == nil {
+		c.Close()
+		t.Error("Dial with a *UDPAddr local address succeeded")
+	}
+}
+
+func TestDialerDeadline(t *testing.T) {
+	ln := newLocalListener(t)
+	defer ln.Close()
+
+	d := &Dialer{Deadline: time.Now().Add(-time.Second), Timeout: time.Hour}
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err == nil {
+		c.Close()
+		t.Fatal("Dial with an expired deadline succeeded")
+	}
+	if terr, ok := err.(timeout); !ok || !terr.Timeout() {
+		t.Errorf("got %v; want a timeout error", err)
+	}
+}
+
+// closedPortAddr returns an address on the loopback interface that
+// refuses connections.
+func closedPortAddr(t *testing.T) *TCPAddr {
+	ln, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().(*TCPAddr)
+	ln.Close()
+	return addr
+}
+
+func TestDialParallel(t *testing.T) {
+	ln, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			c.Close()
+		}
+	}()
+	refused := closedPortAddr(t)
+
+	// A failed attempt starts the next one without waiting for
+	// the fallback delay.
+	d := &Dialer{FallbackDelay: time.Hour}
+	start := time.Now()
+	c, err := d.dialAddrs("tcp", "", []Addr{refused, ln.Addr()}, noDeadline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if dt := time.Now().Sub(start); dt > 5*time.Second {
+		t.Errorf("fallback after a failure took %v", dt)
+	}
+
+	// When every attempt fails, the first error is returned.
+	c, err = d.dialAddrs("tcp", "", []Addr{refused, closedPortAddr(t)}, noDeadline)
+	if err == nil {
+		c.Close()
+		t.Fatal("dialing closed ports succeeded")
+	}
+	if oe, ok := err.(*OpError); !ok || oe.Addr.String() != refused.String() {
+		t.Errorf("got %v; want the error dialing %v", err, refused)
+	}
+
+	// A DualStack dial of a name tries each of its addresses.
+	_, port, _ := SplitHostPort(ln.Addr().String())
+	d = &Dialer{DualStack: true, FallbackDelay: 10 * time.Millisecond, Timeout: 5 * time.Second}
+	c, err = d.Dial("tcp", JoinHostPort("localhost", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+}
+
+func TestDialerKeepAlive(t *testing.T) {
+	ln := newLocalListener(t)
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		c.Close()
+	}()
+
+	d := &Dialer{KeepAlive: 30 * time.Second}
+	c, err := d.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	testKeepAlive(t, c.(*TCPConn), 30)
+}
+
 func numFD() int {
 	if runtime.GOOS == "linux" {
 		f, err := os.Open("/proc/self/fd")
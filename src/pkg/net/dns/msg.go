@@ -0,0 +1,645 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dns implements the DNS message format, as defined in
+// RFC 1035 and extended by RFC 3596 (AAAA), RFC 2782 (SRV) and
+// RFC 6891 (EDNS0), and a framework for DNS servers.
+//
+// Names are written in the usual text form: fully qualified, ending in
+// a dot, as in "www.example.com.", with the root being ".".  Within a
+// label, a backslash escapes a dot or a backslash, and \DDD stands for
+// the byte with decimal value DDD.
+package dns
+
+import (
+	"errors"
+	"strconv"
+)
+
+// A Type is a resource record type.
+type Type uint16
+
+const (
+	TypeA     Type = 1
+	TypeNS    Type = 2
+	TypeCNAME Type = 5
+	TypeSOA   Type = 6
+	TypePTR   Type = 12
+	TypeMX    Type = 15
+	TypeTXT   Type = 16
+	TypeAAAA  Type = 28
+	TypeSRV   Type = 33
+	TypeOPT   Type = 41
+
+	// Question types only.
+	TypeAXFR Type = 252
+	TypeALL  Type = 255
+)
+
+var typeNames = map[Type]string{
+	TypeA:     "A",
+	TypeNS:    "NS",
+	TypeCNAME: "CNAME",
+	TypeSOA:   "SOA",
+	TypePTR:   "PTR",
+	TypeMX:    "MX",
+	TypeTXT:   "TXT",
+	TypeAAAA:  "AAAA",
+	TypeSRV:   "SRV",
+	TypeOPT:   "OPT",
+	TypeAXFR:  "AXFR",
+	TypeALL:   "ALL",
+}
+
+func (t Type) String() string {
+	if s, ok := typeNames[t]; ok {
+		return s
+	}
+	return "TYPE" + strconv.Itoa(int(t))
+}
+
+// A Class is a resource record class.
+type Class uint16
+
+const (
+	ClassINET  Class = 1
+	ClassCHAOS Class = 3
+	ClassANY   Class = 255
+)
+
+func (c Class) String() string {
+	switch c {
+	case ClassINET:
+		return "IN"
+	case ClassCHAOS:
+		return "CH"
+	case ClassANY:
+		return "ANY"
+	}
+	return "CLASS" + strconv.Itoa(int(c))
+}
+
+// An Opcode is the kind of a query.
+type Opcode uint8
+
+const (
+	OpcodeQuery  Opcode = 0
+	OpcodeStatus Opcode = 2
+	OpcodeNotify Opcode = 4
+	OpcodeUpdate Opcode = 5
+)
+
+// An RCode is a response code.  Codes above 15 are extended codes,
+// which need an OPT record in the message.
+type RCode uint16
+
+const (
+	RCodeSuccess        RCode = 0
+	RCodeFormatError    RCode = 1
+	RCodeServerFailure  RCode = 2
+	RCodeNameError      RCode = 3
+	RCodeNotImplemented RCode = 4
+	RCodeRefused        RCode = 5
+	RCodeBadVersion     RCode = 16
+)
+
+var rcodeNames = map[RCode]string{
+	RCodeSuccess:        "NOERROR",
+	RCodeFormatError:    "FORMERR",
+	RCodeServerFailure:  "SERVFAIL",
+	RCodeNameError:      "NXDOMAIN",
+	RCodeNotImplemented: "NOTIMP",
+	RCodeRefused:        "REFUSED",
+	RCodeBadVersion:     "BADVERS",
+}
+
+func (r RCode) String() string {
+	if s, ok := rcodeNames[r]; ok {
+		return s
+	}
+	return "RCODE" + strconv.Itoa(int(r))
+}
+
+// maxRCode is the largest RCode, 4 bits in the header and 8 in an
+// OPT record.
+const maxRCode = 1<<12 - 1
+
+var (
+	errShort        = errors.New("dns: message too short")
+	errTrailing     = errors.New("dns: trailing data after message")
+	errTooLarge     = errors.New("dns: message too large")
+	errTooMany      = errors.New("dns: too many entries in section")
+	errNotFQDN      = errors.New("dns: name is not fully qualified")
+	errEmptyLabel   = errors.New("dns: empty label in name")
+	errLabelLen     = errors.New("dns: label too long")
+	errNameLen      = errors.New("dns: name too long")
+	errBadEscape    = errors.New("dns: invalid escape in name")
+	errBadPointer   = errors.New("dns: invalid compression pointer")
+	errBadLabelType = errors.New("dns: unsupported label type")
+	errRDLength     = errors.New("dns: resource data length mismatch")
+	errTypeMismatch = errors.New("dns: record type does not match header")
+	errBadOPT       = errors.New("dns: misplaced or malformed OPT record")
+	errRCode        = errors.New("dns: extended RCode needs an OPT record")
+	errBadIP        = errors.New("dns: invalid IP address")
+	errTXTLen       = errors.New("dns: TXT string too long")
+	errNoTXT        = errors.New("dns: TXT record without strings")
+)
+
+// A Header is the header of a DNS message.
+type Header struct {
+	ID                 uint16
+	Response           bool
+	Opcode             Opcode
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	RCode              RCode
+}
+
+const (
+	headerLen = 12
+
+	// Header bits.
+	bitQR = 1 << 15
+	bitAA = 1 << 10
+	bitTC = 1 << 9
+	bitRD = 1 << 8
+	bitRA = 1 << 7
+)
+
+// A Question is an entry in the question section of a message.
+type Question struct {
+	Name  string
+	Type  Type
+	Class Class
+}
+
+// A Message is a DNS message.
+type Message struct {
+	Header
+	Question   []Question
+	Answer     []RR
+	Authority  []RR
+	Additional []RR
+}
+
+// OPT returns the OPT record in the additional section of m, or nil
+// if there is none.
+func (m *Message) OPT() *OPT {
+	for _, rr := range m.Additional {
+		if opt, ok := rr.(*OPT); ok {
+			return opt
+		}
+	}
+	return nil
+}
+
+// checkOPT checks that m has at most one OPT record, in the additional
+// section, and returns it.
+func (m *Message) checkOPT() (*OPT, error) {
+	for _, sec := range [][]RR{m.Answer, m.Authority} {
+		for _, rr := range sec {
+			if _, ok := rr.(*OPT); ok {
+				return nil, errBadOPT
+			}
+		}
+	}
+	var opt *OPT
+	for _, rr := range m.Additional {
+		if o, ok := rr.(*OPT); ok {
+			if opt != nil || o.Hdr.Name != "." {
+				return nil, errBadOPT
+			}
+			opt = o
+		}
+	}
+	return opt, nil
+}
+
+// Pack returns the wire format of m.  Names are compressed where
+// RFC 1035 allows it.
+func (m *Message) Pack() ([]byte, error) {
+	opt, err := m.checkOPT()
+	if err != nil {
+		return nil, err
+	}
+	if m.RCode > maxRCode {
+		return nil, errors.New("dns: invalid RCode " + strconv.Itoa(int(m.RCode)))
+	}
+	if m.RCode > 15 && opt == nil {
+		return nil, errRCode
+	}
+	counts := []int{len(m.Question), len(m.Answer), len(m.Authority), len(m.Additional)}
+	for _, n := range counts {
+		if n > 0xFFFF {
+			return nil, errTooMany
+		}
+	}
+
+	p := &packer{msg: make([]byte, 0, 512), names: make(map[string]int)}
+	p.uint16(m.ID)
+	bits := uint16(m.Opcode&0xF)<<11 | uint16(m.RCode&0xF)
+	if m.Response {
+		bits |= bitQR
+	}
+	if m.Authoritative {
+		bits |= bitAA
+	}
+	if m.Truncated {
+		bits |= bitTC
+	}
+	if m.RecursionDesired {
+		bits |= bitRD
+	}
+	if m.RecursionAvailable {
+		bits |= bitRA
+	}
+	p.uint16(bits)
+	for _, n := range counts {
+		p.uint16(uint16(n))
+	}
+	for _, q := range m.Question {
+		if err := p.name(q.Name, true); err != nil {
+			return nil, err
+		}
+		p.uint16(uint16(q.Type))
+		p.uint16(uint16(q.Class))
+	}
+	for _, sec := range [][]RR{m.Answer, m.Authority, m.Additional} {
+		for _, rr := range sec {
+			if err := p.rr(rr, m.RCode); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(p.msg) > 0xFFFF {
+		return nil, errTooLarge
+	}
+	return p.msg, nil
+}
+
+// Unpack sets m to the message in msg.  It fails unless msg holds
+// exactly one well-formed message.
+func (m *Message) Unpack(msg []byte) error {
+	u := &unpacker{msg: msg}
+	if len(msg) < headerLen {
+		return errShort
+	}
+	id, _ := u.uint16()
+	bits, _ := u.uint16()
+	var counts [4]int
+	for i := range counts {
+		n, _ := u.uint16()
+		counts[i] = int(n)
+	}
+	// A question takes at least 5 bytes and a record 11, so
+	// this bounds the allocations below.
+	if 5*counts[0]+11*(counts[1]+counts[2]+counts[3]) > len(msg)-headerLen {
+		return errShort
+	}
+	*m = Message{
+		Header: Header{
+			ID:                 id,
+			Response:           bits&bitQR != 0,
+			Opcode:             Opcode(bits>>11) & 0xF,
+			Authoritative:      bits&bitAA != 0,
+			Truncated:          bits&bitTC != 0,
+			RecursionDesired:   bits&bitRD != 0,
+			RecursionAvailable: bits&bitRA != 0,
+			RCode:              RCode(bits & 0xF),
+		},
+	}
+	if counts[0] > 0 {
+		m.Question = make([]Question, counts[0])
+	}
+	for i := range m.Question {
+		q := &m.Question[i]
+		var err error
+		if q.Name, err = u.name(); err != nil {
+			return err
+		}
+		t, err := u.uint16()
+		if err != nil {
+			return err
+		}
+		c, err := u.uint16()
+		if err != nil {
+			return err
+		}
+		q.Type, q.Class = Type(t), Class(c)
+	}
+	secs := []*[]RR{&m.Answer, &m.Authority, &m.Additional}
+	for i, sec := range secs {
+		n := counts[i+1]
+		if n > 0 {
+			*sec = make([]RR, n)
+		}
+		for j := range *sec {
+			rr, err := u.rr()
+			if err != nil {
+				return err
+			}
+			(*sec)[j] = rr
+		}
+	}
+	if u.off != len(msg) {
+		return errTrailing
+	}
+	opt, err := m.checkOPT()
+	if err != nil {
+		return err
+	}
+	if opt != nil {
+		m.RCode |= RCode(opt.Hdr.TTL>>24) << 4
+	}
+	return nil
+}
+
+// labels splits name into its unescaped labels and returns them with
+// the length of the name in wire format.
+func labels(name string) (ls []string, n int, err error) {
+	if name == "." {
+		return nil, 1, nil
+	}
+	if name == "" {
+		return nil, 0, errNotFQDN
+	}
+	n = 1 // root label
+	var b []byte
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch c {
+		case '.':
+			if len(b) == 0 {
+				return nil, 0, errEmptyLabel
+			}
+			if len(b) > 63 {
+				return nil, 0, errLabelLen
+			}
+			ls = append(ls, string(b))
+			n += 1 + len(b)
+			b = b[:0]
+			continue
+		case '\\':
+			i++
+			if i == len(name) {
+				return nil, 0, errBadEscape
+			}
+			c = name[i]
+			if isDigit(c) {
+				if i+2 >= len(name) || !isDigit(name[i+1]) || !isDigit(name[i+2]) {
+					return nil, 0, errBadEscape
+				}
+				v := int(c-'0')*100 + int(name[i+1]-'0')*10 + int(name[i+2]-'0')
+				if v > 255 {
+					return nil, 0, errBadEscape
+				}
+				c = byte(v)
+				i += 2
+			}
+		}
+		b = append(b, c)
+	}
+	if len(b) > 0 {
+		return nil, 0, errNotFQDN
+	}
+	if n > 255 {
+		return nil, 0, errNameLen
+	}
+	return ls, n, nil
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+// appendLabel appends label l to s in text form, followed by a dot.
+func appendLabel(s, l []byte) []byte {
+	for _, c := range l {
+		switch {
+		case c == '.' || c == '\\':
+			s = append(s, '\\', c)
+		case c <= ' ' || c > '~':
+			s = append(s, '\\', '0'+c/100, '0'+c/10%10, '0'+c%10)
+		default:
+			s = append(s, c)
+		}
+	}
+	return append(s, '.')
+}
+
+// A packer builds a message in wire format.
+type packer struct {
+	msg []byte
+	// names maps the wire format of each name suffix packed so
+	// far to its offset, for compression.
+	names map[string]int
+}
+
+func (p *packer) uint16(v uint16) {
+	p.msg = append(p.msg, byte(v>>8), byte(v))
+}
+
+func (p *packer) uint32(v uint32) {
+	p.msg = append(p.msg, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// name packs name, replacing its longest suffix already in the
+// message by a pointer if compress is set.
+func (p *packer) name(name string, compress bool) error {
+	ls, n, err := labels(name)
+	if err != nil {
+		return err
+	}
+	wire := make([]byte, 0, n)
+	for _, l := range ls {
+		wire = append(wire, byte(len(l)))
+		wire = append(wire, l...)
+	}
+	start := 0
+	for _, l := range ls {
+		suffix := string(wire[start:])
+		if off, ok := p.names[suffix]; ok && compress {
+			p.uint16(0xC000 | uint16(off))
+			return nil
+		}
+		if _, ok := p.names[suffix]; !ok && len(p.msg) < 0x4000 {
+			p.names[suffix] = len(p.msg)
+		}
+		p.msg = append(p.msg, byte(len(l)))
+		p.msg = append(p.msg, l...)
+		start += 1 + len(l)
+	}
+	p.msg = append(p.msg, 0)
+	return nil
+}
+
+// rr packs rr.  The extended bits of rcode go in an OPT record.
+func (p *packer) rr(rr RR, rcode RCode) error {
+	h := rr.Header()
+	t := rr.rrType()
+	if t == 0 || h.Type != 0 && h.Type != t {
+		return errTypeMismatch
+	}
+	if err := p.name(h.Name, true); err != nil {
+		return err
+	}
+	p.uint16(uint16(t))
+	p.uint16(uint16(h.Class))
+	ttl := h.TTL
+	if t == TypeOPT {
+		ttl = ttl&0x00FFFFFF | uint32(rcode>>4)<<24
+	}
+	p.uint32(ttl)
+	p.uint16(0) // length, filled in below
+	start := len(p.msg)
+	if err := rr.pack(p); err != nil {
+		return err
+	}
+	n := len(p.msg) - start
+	if n > 0xFFFF {
+		return errTooLarge
+	}
+	p.msg[start-2] = byte(n >> 8)
+	p.msg[start-1] = byte(n)
+	return nil
+}
+
+// An unpacker reads a message in wire format.
+type unpacker struct {
+	msg []byte
+	off int
+}
+
+func (u *unpacker) uint8() (uint8, error) {
+	if u.off+1 > len(u.msg) {
+		return 0, errShort
+	}
+	v := u.msg[u.off]
+	u.off++
+	return v, nil
+}
+
+func (u *unpacker) uint16() (uint16, error) {
+	if u.off+2 > len(u.msg) {
+		return 0, errShort
+	}
+	v := uint16(u.msg[u.off])<<8 | uint16(u.msg[u.off+1])
+	u.off += 2
+	return v, nil
+}
+
+func (u *unpacker) uint32() (uint32, error) {
+	if u.off+4 > len(u.msg) {
+		return 0, errShort
+	}
+	b := u.msg[u.off:]
+	u.off += 4
+	return uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3]), nil
+}
+
+func (u *unpacker) bytes(n int) ([]byte, error) {
+	if u.off+n > len(u.msg) {
+		return nil, errShort
+	}
+	b := make([]byte, n)
+	copy(b, u.msg[u.off:])
+	u.off += n
+	return b, nil
+}
+
+// name reads a possibly compressed name.  A pointer must point
+// before the labels that lead to it, which rules out loops.
+func (u *unpacker) name() (string, error) {
+	var s []byte
+	off := u.off
+	start := off // start of the labels being read
+	end := -1    // end of the name in place, once a pointer is followed
+	n := 1       // wire length
+	for {
+		if off >= len(u.msg) {
+			return "", errShort
+		}
+		c := int(u.msg[off])
+		off++
+		switch c & 0xC0 {
+		case 0x00:
+			if c == 0 {
+				if end < 0 {
+					end = off
+				}
+				u.off = end
+				if len(s) == 0 {
+					return ".", nil
+				}
+				return string(s), nil
+			}
+			if off+c > len(u.msg) {
+				return "", errShort
+			}
+			if n += 1 + c; n > 255 {
+				return "", errNameLen
+			}
+			s = appendLabel(s, u.msg[off:off+c])
+			off += c
+		case 0xC0:
+			if off >= len(u.msg) {
+				return "", errShort
+			}
+			ptr := (c&0x3F)<<8 | int(u.msg[off])
+			off++
+			if end < 0 {
+				end = off
+			}
+			if ptr >= start {
+				return "", errBadPointer
+			}
+			off, start = ptr, ptr
+		default:
+			return "", errBadLabelType
+		}
+	}
+	panic("unreachable")
+}
+
+// rr reads a resource record.
+func (u *unpacker) rr() (RR, error) {
+	var h RRHeader
+	var err error
+	if h.Name, err = u.name(); err != nil {
+		return nil, err
+	}
+	t, err := u.uint16()
+	if err != nil {
+		return nil, err
+	}
+	c, err := u.uint16()
+	if err != nil {
+		return nil, err
+	}
+	if h.TTL, err = u.uint32(); err != nil {
+		return nil, err
+	}
+	n, err := u.uint16()
+	if err != nil {
+		return nil, err
+	}
+	h.Type, h.Class = Type(t), Class(c)
+	end := u.off + int(n)
+	if end > len(u.msg) {
+		return nil, errShort
+	}
+	rr := newRR(h)
+	// Limit the record to its data so that it can't read past it.
+	full := u.msg
+	u.msg = u.msg[:end]
+	err = rr.unpack(u, int(n))
+	u.msg = full
+	if err != nil {
+		return nil, err
+	}
+	if u.off != end {
+		return nil, errRDLength
+	}
+	return rr, nil
+}
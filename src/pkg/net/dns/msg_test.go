@@ -0,0 +1,231 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func hdr(name string, t Type, ttl uint32) RRHeader {
+	return RRHeader{Name: name, Type: t, Class: ClassINET, TTL: ttl}
+}
+
+func testMessage() *Message {
+	return &Message{
+		Header: Header{
+			ID:                 0xbeef,
+			Response:           true,
+			Authoritative:      true,
+			RecursionDesired:   true,
+			RecursionAvailable: true,
+			RCode:              RCodeSuccess,
+		},
+		Question: []Question{{"example.com.", TypeALL, ClassINET}},
+		Answer: []RR{
+			&A{hdr("example.com.", TypeA, 300), net.IPv4(192, 0, 2, 1)},
+			&AAAA{hdr("example.com.", TypeAAAA, 300), net.ParseIP("2001:db8::1")},
+			&CNAME{hdr("www.example.com.", TypeCNAME, 60), "example.com."},
+			&MX{hdr("example.com.", TypeMX, 3600), 10, "mail.example.com."},
+			&NS{hdr("example.com.", TypeNS, 86400), "ns1.example.com."},
+			&PTR{hdr("1.2.0.192.in-addr.arpa.", TypePTR, 60), "example.com."},
+			&SOA{hdr("example.com.", TypeSOA, 3600), "ns1.example.com.", "hostmaster.example.com.", 2012121201, 7200, 900, 1209600, 300},
+			&SRV{hdr("_sip._udp.example.com.", TypeSRV, 60), 10, 20, 5060, "sip.example.com."},
+			&TXT{hdr("example.com.", TypeTXT, 60), []string{"v=spf1 -all", "", "second"}},
+			&UnknownRR{hdr("example.com.", Type(99), 60), []byte{1, 2, 3}},
+		},
+		Authority: []RR{
+			&NS{hdr("example.com.", TypeNS, 86400), "ns2.example.com."},
+		},
+		Additional: []RR{
+			&A{hdr("ns1.example.com.", TypeA, 300), net.IPv4(192, 0, 2, 53)},
+			&OPT{RRHeader{Name: ".", Type: TypeOPT, Class: 4096, TTL: 0x8000}, []Option{{10, []byte("cookie!!")}}},
+		},
+	}
+}
+
+func TestPackUnpack(t *testing.T) {
+	m := testMessage()
+	b, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := new(Message)
+	if err := got.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("round trip mismatch:\ngot  %+v\nwant %+v", got, m)
+		for i := range m.Answer {
+			if i < len(got.Answer) && !reflect.DeepEqual(got.Answer[i], m.Answer[i]) {
+				t.Errorf("answer %d = %+v; want %+v", i, got.Answer[i], m.Answer[i])
+			}
+		}
+	}
+	opt := got.OPT()
+	if opt == nil || opt.UDPSize() != 4096 || !opt.DNSSECOK() || opt.Version() != 0 {
+		t.Errorf("OPT = %+v", opt)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	m := &Message{
+		Question: []Question{{"www.example.com.", TypeA, ClassINET}},
+		Answer: []RR{
+			&CNAME{hdr("www.example.com.", TypeCNAME, 60), "example.com."},
+			&SRV{hdr("_x._tcp.example.com.", TypeSRV, 60), 0, 0, 1, "www.example.com."},
+		},
+	}
+	b, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The owner of the CNAME points to the question name (offset 12),
+	// and its target to the "example.com" suffix of it (offset 16).
+	if !bytes.Contains(b, []byte{0xC0, 12, 0, byte(TypeCNAME)}) {
+		t.Errorf("owner name not compressed: % x", b)
+	}
+	if !bytes.Contains(b, []byte{0, 2, 0xC0, 16}) {
+		t.Errorf("CNAME target not compressed: % x", b)
+	}
+	// SRV targets must not be compressed.
+	if !bytes.HasSuffix(b, []byte("\x03www\x07example\x03com\x00")) {
+		t.Errorf("SRV target compressed: % x", b)
+	}
+}
+
+var nameTests = []struct {
+	in, out string
+}{
+	{".", "."},
+	{"Example.COM.", "Example.COM."},
+	{`a\.b.example.`, `a\.b.example.`},
+	{`\065\\.x.`, `A\\.x.`},
+	{"\\032sp.", `\032sp.`},
+}
+
+func TestNames(t *testing.T) {
+	for _, tt := range nameTests {
+		m := &Message{Question: []Question{{tt.in, TypeA, ClassINET}}}
+		b, err := m.Pack()
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		if err := m.Unpack(b); err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		if m.Question[0].Name != tt.out {
+			t.Errorf("%q came back as %q; want %q", tt.in, m.Question[0].Name, tt.out)
+		}
+	}
+}
+
+var packErrorTests = []struct {
+	m   *Message
+	err error
+}{
+	{&Message{Question: []Question{{"example.com", TypeA, ClassINET}}}, errNotFQDN},
+	{&Message{Question: []Question{{"", TypeA, ClassINET}}}, errNotFQDN},
+	{&Message{Question: []Question{{"a..b.", TypeA, ClassINET}}}, errEmptyLabel},
+	{&Message{Question: []Question{{strings.Repeat("x", 64) + ".", TypeA, ClassINET}}}, errLabelLen},
+	{&Message{Question: []Question{{strings.Repeat("abcdefg.", 32), TypeA, ClassINET}}}, errNameLen},
+	{&Message{Question: []Question{{`a\1.`, TypeA, ClassINET}}}, errBadEscape},
+	{&Message{Answer: []RR{&A{hdr("a.", TypeA, 0), net.ParseIP("::1")}}}, errBadIP},
+	{&Message{Answer: []RR{&A{hdr("a.", TypeAAAA, 0), net.IPv4(1, 2, 3, 4)}}}, errTypeMismatch},
+	{&Message{Answer: []RR{&UnknownRR{Hdr: RRHeader{Name: "a."}}}}, errTypeMismatch},
+	{&Message{Answer: []RR{&TXT{hdr("a.", TypeTXT, 0), []string{strings.Repeat("x", 256)}}}}, errTXTLen},
+	{&Message{Answer: []RR{&TXT{hdr("a.", TypeTXT, 0), nil}}}, errNoTXT},
+	{&Message{Answer: []RR{NewOPT(512)}}, errBadOPT},
+	{&Message{Additional: []RR{NewOPT(512), NewOPT(1024)}}, errBadOPT},
+	{&Message{Header: Header{RCode: RCodeBadVersion}}, errRCode},
+}
+
+func TestPackErrors(t *testing.T) {
+	for i, tt := range packErrorTests {
+		if _, err := tt.m.Pack(); err != tt.err {
+			t.Errorf("#%d: got %v; want %v", i, err, tt.err)
+		}
+	}
+}
+
+func TestExtendedRCode(t *testing.T) {
+	m := &Message{Header: Header{Response: true, RCode: RCodeBadVersion}, Additional: []RR{NewOPT(1232)}}
+	b, err := m.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b[3]&0xF != 0 {
+		t.Errorf("header RCode bits = %d; want 0", b[3]&0xF)
+	}
+	got := new(Message)
+	if err := got.Unpack(b); err != nil {
+		t.Fatal(err)
+	}
+	if got.RCode != RCodeBadVersion {
+		t.Errorf("RCode = %v; want %v", got.RCode, RCodeBadVersion)
+	}
+}
+
+// header returns a message header with the given section counts.
+func header(qd, an, ns, ar byte) []byte {
+	return []byte{0, 1, 0x81, 0x80, 0, qd, 0, an, 0, ns, 0, ar}
+}
+
+func cat(bs ...[]byte) []byte {
+	var b []byte
+	for _, s := range bs {
+		b = append(b, s...)
+	}
+	return b
+}
+
+var question = []byte("\x01a\x00\x00\x01\x00\x01")
+
+var unpackErrorTests = []struct {
+	msg []byte
+	err error
+}{
+	{header(0, 0, 0, 0)[:11], errShort},
+	{cat(header(1, 0, 0, 0), question[:5]), errShort},
+	{cat(header(1, 0, 0, 0), question, []byte{0}), errTrailing},
+	{cat(header(2, 0, 0, 0), question), errShort},
+	// A pointer to itself.
+	{cat(header(1, 0, 0, 0), []byte{0xC0, 12, 0, 1, 0, 1}), errBadPointer},
+	// A pointer forward.
+	{cat(header(1, 0, 0, 0), []byte{0xC0, 14, 0, 0, 1, 0, 1}), errBadPointer},
+	{cat(header(1, 0, 0, 0), []byte{0x41, 0, 0, 1, 0, 1}), errBadLabelType},
+	// An A record with 5 bytes of data.
+	{cat(header(0, 1, 0, 0), []byte("\x00\x00\x01\x00\x01\x00\x00\x00\x00\x00\x05\x01\x02\x03\x04\x05")), errRDLength},
+	// An MX record with bytes left after its fields.
+	{cat(header(0, 1, 0, 0), []byte("\x00\x00\x0f\x00\x01\x00\x00\x00\x00\x00\x05\x00\x01\x00\x00\x00")), errRDLength},
+	// An OPT record in the answer section.
+	{cat(header(0, 1, 0, 0), []byte("\x00\x00\x29\x02\x00\x00\x00\x00\x00\x00\x00")), errBadOPT},
+}
+
+func TestUnpackErrors(t *testing.T) {
+	for i, tt := range unpackErrorTests {
+		m := new(Message)
+		if err := m.Unpack(tt.msg); err != tt.err {
+			t.Errorf("#%d: got %v; want %v", i, err, tt.err)
+		}
+	}
+}
+
+func TestUnpackLongName(t *testing.T) {
+	// 128 one-letter labels make a 257-byte name.
+	var name []byte
+	for i := 0; i < 128; i++ {
+		name = append(name, 1, 'x')
+	}
+	msg := cat(header(1, 0, 0, 0), name, []byte{0, 0, 1, 0, 1})
+	if err := new(Message).Unpack(msg); err != errNameLen {
+		t.Errorf("got %v; want %v", err, errNameLen)
+	}
+}
@@ -0,0 +1,293 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// DNS servers over UDP and TCP.
+
+package dns
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"net"
+	"time"
+)
+
+// A ResponseWriter is used by a Handler to send its response.
+type ResponseWriter interface {
+	// LocalAddr returns the address the query was received on.
+	LocalAddr() net.Addr
+
+	// RemoteAddr returns the address of the client.
+	RemoteAddr() net.Addr
+
+	// WriteMsg sends the response m to the client.  Over UDP, a
+	// response larger than the client accepts is replaced by its
+	// header and question with the Truncated bit set, telling the
+	// client to retry over TCP.
+	WriteMsg(m *Message) error
+}
+
+// A Handler responds to a DNS query.  A handler that sends no
+// response leaves the client to time out.
+type Handler interface {
+	ServeDNS(w ResponseWriter, q *Message)
+}
+
+// The HandlerFunc type is an adapter to allow the use of ordinary
+// functions as DNS handlers.
+type HandlerFunc func(ResponseWriter, *Message)
+
+// ServeDNS calls f(w, q).
+func (f HandlerFunc) ServeDNS(w ResponseWriter, q *Message) {
+	f(w, q)
+}
+
+// NewReply returns an empty response to the query q, with its ID,
+// opcode, question and RecursionDesired bit.
+func NewReply(q *Message) *Message {
+	r := &Message{
+		Header: Header{
+			ID:               q.ID,
+			Response:         true,
+			Opcode:           q.Opcode,
+			RecursionDesired: q.RecursionDesired,
+		},
+	}
+	r.Question = append([]Question(nil), q.Question...)
+	return r
+}
+
+// A Server answers DNS queries with its Handler.
+type Server struct {
+	// Handler is called for each query received.
+	Handler Handler
+
+	// IdleTimeout is how long a TCP connection may wait for its
+	// next query before it is closed.  If zero,
+	// DefaultIdleTimeout is used.
+	IdleTimeout time.Duration
+}
+
+// DefaultIdleTimeout is the default value of Server.IdleTimeout,
+// as suggested by RFC 5966.
+const DefaultIdleTimeout = 10 * time.Second
+
+const (
+	// minUDPSize is the size of UDP responses every client
+	// accepts.
+	minUDPSize = 512
+
+	maxMsgSize = 0xFFFF
+)
+
+// ListenAndServe listens on the network address addr, with network
+// "udp", "udp4", "udp6", "tcp", "tcp4" or "tcp6", and answers the
+// queries it receives with handler.
+func ListenAndServe(network, addr string, handler Handler) error {
+	srv := &Server{Handler: handler}
+	switch network {
+	case "udp", "udp4", "udp6":
+		c, err := net.ListenPacket(network, addr)
+		if err != nil {
+			return err
+		}
+		return srv.ServePacket(c)
+	case "tcp", "tcp4", "tcp6":
+		l, err := net.Listen(network, addr)
+		if err != nil {
+			return err
+		}
+		return srv.Serve(l)
+	}
+	return net.UnknownNetworkError(network)
+}
+
+// retry reports whether the error err is temporary, after sleeping
+// for an increasing delay if it is.
+func retry(op string, err error, tempDelay *time.Duration) bool {
+	if ne, ok := err.(net.Error); !ok || !ne.Temporary() {
+		return false
+	}
+	if *tempDelay == 0 {
+		*tempDelay = 5 * time.Millisecond
+	} else {
+		*tempDelay *= 2
+	}
+	if max := 1 * time.Second; *tempDelay > max {
+		*tempDelay = max
+	}
+	log.Printf("dns: %s error: %v; retrying in %v", op, err, *tempDelay)
+	time.Sleep(*tempDelay)
+	return true
+}
+
+// ServePacket reads queries from the packet connection c and answers
+// each in a new goroutine.  It closes c on return.
+func (srv *Server) ServePacket(c net.PacketConn) error {
+	defer c.Close()
+	var tempDelay time.Duration // how long to sleep on read failure
+	buf := make([]byte, maxMsgSize)
+	for {
+		n, addr, err := c.ReadFrom(buf)
+		if err != nil {
+			if retry("ReadFrom", err, &tempDelay) {
+				continue
+			}
+			return err
+		}
+		tempDelay = 0
+		// Each query keeps only its own bytes, not a whole buffer.
+		b := make([]byte, n)
+		copy(b, buf)
+		go srv.servePacket(c, addr, b)
+	}
+	panic("unreachable")
+}
+
+func (srv *Server) servePacket(c net.PacketConn, addr net.Addr, b []byte) {
+	w := &packetWriter{c: c, addr: addr, max: minUDPSize}
+	q := new(Message)
+	if err := q.Unpack(b); err != nil {
+		if r := formatError(b); r != nil {
+			c.WriteTo(r, addr)
+		}
+		return
+	}
+	if q.Response {
+		return
+	}
+	if opt := q.OPT(); opt != nil && opt.UDPSize() > w.max {
+		w.max = opt.UDPSize()
+	}
+	srv.Handler.ServeDNS(w, q)
+}
+
+// Serve accepts TCP connections on the listener l and answers the
+// queries on each in a new goroutine.  It closes l on return.
+func (srv *Server) Serve(l net.Listener) error {
+	defer l.Close()
+	var tempDelay time.Duration // how long to sleep on accept failure
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if retry("Accept", err, &tempDelay) {
+				continue
+			}
+			return err
+		}
+		tempDelay = 0
+		go srv.serveConn(c)
+	}
+	panic("unreachable")
+}
+
+// serveConn answers the queries on c in turn.  Each message is
+// preceded by its length as two bytes, as RFC 1035 requires.
+func (srv *Server) serveConn(c net.Conn) {
+	defer c.Close()
+	idle := srv.IdleTimeout
+	if idle == 0 {
+		idle = DefaultIdleTimeout
+	}
+	w := &connWriter{c: c}
+	br := bufio.NewReader(c)
+	for {
+		c.SetReadDeadline(time.Now().Add(idle))
+		var lb [2]byte
+		if _, err := io.ReadFull(br, lb[:]); err != nil {
+			return
+		}
+		b := make([]byte, int(lb[0])<<8|int(lb[1]))
+		if _, err := io.ReadFull(br, b); err != nil {
+			return
+		}
+		q := new(Message)
+		if err := q.Unpack(b); err != nil {
+			if r := formatError(b); r != nil {
+				w.write(r)
+			}
+			continue
+		}
+		if q.Response {
+			continue
+		}
+		srv.Handler.ServeDNS(w, q)
+	}
+}
+
+// formatError returns the packed FORMERR response to the malformed
+// query b, or nil if b is too short to be answered.
+func formatError(b []byte) []byte {
+	if len(b) < headerLen || b[2]&(bitQR>>8) != 0 {
+		return nil
+	}
+	r := &Message{
+		Header: Header{
+			ID:       uint16(b[0])<<8 | uint16(b[1]),
+			Response: true,
+			Opcode:   Opcode(b[2]>>3) & 0xF,
+			RCode:    RCodeFormatError,
+		},
+	}
+	msg, err := r.Pack()
+	if err != nil {
+		return nil
+	}
+	return msg
+}
+
+// packetWriter sends responses over UDP.
+type packetWriter struct {
+	c    net.PacketConn
+	addr net.Addr
+	max  int // largest response the client accepts
+}
+
+func (w *packetWriter) LocalAddr() net.Addr  { return w.c.LocalAddr() }
+func (w *packetWriter) RemoteAddr() net.Addr { return w.addr }
+
+func (w *packetWriter) WriteMsg(m *Message) error {
+	b, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	if len(b) > w.max {
+		t := &Message{Header: m.Header, Question: m.Question}
+		t.Truncated = true
+		if opt := m.OPT(); opt != nil {
+			t.Additional = []RR{opt}
+		}
+		if b, err = t.Pack(); err != nil {
+			return err
+		}
+	}
+	_, err = w.c.WriteTo(b, w.addr)
+	return err
+}
+
+// connWriter sends responses over TCP.
+type connWriter struct {
+	c net.Conn
+}
+
+func (w *connWriter) LocalAddr() net.Addr  { return w.c.LocalAddr() }
+func (w *connWriter) RemoteAddr() net.Addr { return w.c.RemoteAddr() }
+
+func (w *connWriter) WriteMsg(m *Message) error {
+	b, err := m.Pack()
+	if err != nil {
+		return err
+	}
+	return w.write(b)
+}
+
+// write sends the message b, preceded by its length.
+func (w *connWriter) write(b []byte) error {
+	msg := make([]byte, 2+len(b))
+	msg[0], msg[1] = byte(len(b)>>8), byte(len(b))
+	copy(msg[2:], b)
+	_, err := w.c.Write(msg)
+	return err
+}
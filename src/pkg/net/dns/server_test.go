@@ -0,0 +1,158 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// testHandler answers A queries for names under example.com. and
+// TXT queries with many records, and refuses anything else.
+var testHandler = HandlerFunc(func(w ResponseWriter, q *Message) {
+	r := NewReply(q)
+	if opt := q.OPT(); opt != nil {
+		r.Additional = []RR{NewOPT(4096)}
+	}
+	r.Authoritative = true
+	qq := q.Question[0]
+	switch qq.Type {
+	case TypeA:
+		r.Answer = []RR{&A{hdr(qq.Name, TypeA, 60), net.IPv4(192, 0, 2, 1)}}
+	case TypeTXT:
+		for i := 0; i < 100; i++ {
+			r.Answer = append(r.Answer, &TXT{hdr(qq.Name, TypeTXT, 60), []string{"record " + strconv.Itoa(i)}})
+		}
+	default:
+		r.RCode = RCodeRefused
+	}
+	w.WriteMsg(r)
+})
+
+func query(id uint16, name string, t Type, edns bool) []byte {
+	q := &Message{Header: Header{ID: id, RecursionDesired: true}}
+	q.Question = []Question{{name, t, ClassINET}}
+	if edns {
+		q.Additional = []RR{NewOPT(4096)}
+	}
+	b, err := q.Pack()
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestServePacket(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{Handler: testHandler}
+	go srv.ServePacket(pc)
+	defer pc.Close()
+
+	c, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	roundTrip := func(q []byte) *Message {
+		if _, err := c.Write(q); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 65535)
+		n, err := c.Read(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := new(Message)
+		if err := r.Unpack(b[:n]); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	r := roundTrip(query(1, "www.example.com.", TypeA, false))
+	if r.ID != 1 || !r.Response || r.RCode != RCodeSuccess || len(r.Answer) != 1 {
+		t.Fatalf("A response = %+v", r)
+	}
+	if a, ok := r.Answer[0].(*A); !ok || !a.A.Equal(net.IPv4(192, 0, 2, 1)) {
+		t.Errorf("answer = %+v", r.Answer[0])
+	}
+
+	// Too large for 512 bytes: truncated.
+	r = roundTrip(query(2, "big.example.com.", TypeTXT, false))
+	if !r.Truncated || len(r.Answer) != 0 || len(r.Question) != 1 {
+		t.Errorf("large response without EDNS0 = %+v; want truncated", r)
+	}
+	// But the client can accept 4096 bytes.
+	r = roundTrip(query(3, "big.example.com.", TypeTXT, true))
+	if r.Truncated || len(r.Answer) != 100 {
+		t.Errorf("large response with EDNS0 truncated: %d answers", len(r.Answer))
+	}
+
+	// A malformed query gets FORMERR.
+	bad := query(4, "www.example.com.", TypeA, false)
+	r = roundTrip(bad[:len(bad)-1])
+	if r.ID != 4 || r.RCode != RCodeFormatError {
+		t.Errorf("malformed query response = %+v; want FORMERR", r)
+	}
+}
+
+func TestServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &Server{Handler: testHandler, IdleTimeout: 100 * time.Millisecond}
+	go srv.Serve(l)
+	defer l.Close()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Several queries on one connection, with no truncation.
+	for i, typ := range []Type{TypeA, TypeTXT, TypeMX} {
+		q := query(uint16(i), "www.example.com.", typ, false)
+		if _, err := c.Write(append([]byte{byte(len(q) >> 8), byte(len(q))}, q...)); err != nil {
+			t.Fatal(err)
+		}
+		var lb [2]byte
+		if _, err := io.ReadFull(c, lb[:]); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, int(lb[0])<<8|int(lb[1]))
+		if _, err := io.ReadFull(c, b); err != nil {
+			t.Fatal(err)
+		}
+		r := new(Message)
+		if err := r.Unpack(b); err != nil {
+			t.Fatal(err)
+		}
+		if r.ID != uint16(i) || r.Truncated {
+			t.Errorf("query %d: response %+v", i, r.Header)
+		}
+		if typ == TypeTXT && len(r.Answer) != 100 {
+			t.Errorf("%d TXT answers; want 100", len(r.Answer))
+		}
+		if typ == TypeMX && r.RCode != RCodeRefused {
+			t.Errorf("MX RCode = %v; want %v", r.RCode, RCodeRefused)
+		}
+	}
+
+	// The server closes an idle connection.
+	var b [1]byte
+	if _, err := c.Read(b[:]); err != io.EOF {
+		t.Errorf("read from idle connection: %v; want EOF", err)
+	}
+}
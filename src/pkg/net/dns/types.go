@@ -0,0 +1,380 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dns
+
+import (
+	"net"
+)
+
+// An RRHeader is the header shared by all resource records.
+// When packing, a zero Type stands for the type of the record.
+type RRHeader struct {
+	Name  string
+	Type  Type
+	Class Class
+	TTL   uint32
+}
+
+// An RR is a resource record: one of *A, *AAAA, *CNAME, *MX, *NS,
+// *OPT, *PTR, *SOA, *SRV, *TXT or *UnknownRR.
+type RR interface {
+	Header() *RRHeader
+	rrType() Type
+	pack(p *packer) error
+	unpack(u *unpacker, length int) error
+}
+
+// newRR returns an empty record of the type in h.
+func newRR(h RRHeader) RR {
+	switch h.Type {
+	case TypeA:
+		return &A{Hdr: h}
+	case TypeAAAA:
+		return &AAAA{Hdr: h}
+	case TypeCNAME:
+		return &CNAME{Hdr: h}
+	case TypeMX:
+		return &MX{Hdr: h}
+	case TypeNS:
+		return &NS{Hdr: h}
+	case TypeOPT:
+		return &OPT{Hdr: h}
+	case TypePTR:
+		return &PTR{Hdr: h}
+	case TypeSOA:
+		return &SOA{Hdr: h}
+	case TypeSRV:
+		return &SRV{Hdr: h}
+	case TypeTXT:
+		return &TXT{Hdr: h}
+	}
+	return &UnknownRR{Hdr: h}
+}
+
+// An A record holds an IPv4 address.
+type A struct {
+	Hdr RRHeader
+	A   net.IP
+}
+
+func (rr *A) Header() *RRHeader { return &rr.Hdr }
+func (rr *A) rrType() Type      { return TypeA }
+
+func (rr *A) pack(p *packer) error {
+	ip := rr.A.To4()
+	if ip == nil {
+		return errBadIP
+	}
+	p.msg = append(p.msg, ip...)
+	return nil
+}
+
+func (rr *A) unpack(u *unpacker, length int) error {
+	if length != net.IPv4len {
+		return errRDLength
+	}
+	b, err := u.bytes(net.IPv4len)
+	if err != nil {
+		return err
+	}
+	rr.A = net.IPv4(b[0], b[1], b[2], b[3])
+	return nil
+}
+
+// An AAAA record holds an IPv6 address.
+type AAAA struct {
+	Hdr  RRHeader
+	AAAA net.IP
+}
+
+func (rr *AAAA) Header() *RRHeader { return &rr.Hdr }
+func (rr *AAAA) rrType() Type      { return TypeAAAA }
+
+func (rr *AAAA) pack(p *packer) error {
+	ip := rr.AAAA.To16()
+	if ip == nil {
+		return errBadIP
+	}
+	p.msg = append(p.msg, ip...)
+	return nil
+}
+
+func (rr *AAAA) unpack(u *unpacker, length int) error {
+	if length != net.IPv6len {
+		return errRDLength
+	}
+	b, err := u.bytes(net.IPv6len)
+	rr.AAAA = net.IP(b)
+	return err
+}
+
+// A CNAME record holds the canonical name of an alias.
+type CNAME struct {
+	Hdr   RRHeader
+	Cname string
+}
+
+func (rr *CNAME) Header() *RRHeader { return &rr.Hdr }
+func (rr *CNAME) rrType() Type      { return TypeCNAME }
+
+func (rr *CNAME) pack(p *packer) error { return p.name(rr.Cname, true) }
+
+func (rr *CNAME) unpack(u *unpacker, length int) (err error) {
+	rr.Cname, err = u.name()
+	return
+}
+
+// An MX record names a mail exchange for a domain.
+type MX struct {
+	Hdr  RRHeader
+	Pref uint16
+	Mx   string
+}
+
+func (rr *MX) Header() *RRHeader { return &rr.Hdr }
+func (rr *MX) rrType() Type      { return TypeMX }
+
+func (rr *MX) pack(p *packer) error {
+	p.uint16(rr.Pref)
+	return p.name(rr.Mx, true)
+}
+
+func (rr *MX) unpack(u *unpacker, length int) (err error) {
+	if rr.Pref, err = u.uint16(); err != nil {
+		return
+	}
+	rr.Mx, err = u.name()
+	return
+}
+
+// An NS record names an authoritative name server for a domain.
+type NS struct {
+	Hdr RRHeader
+	Ns  string
+}
+
+func (rr *NS) Header() *RRHeader { return &rr.Hdr }
+func (rr *NS) rrType() Type      { return TypeNS }
+
+func (rr *NS) pack(p *packer) error { return p.name(rr.Ns, true) }
+
+func (rr *NS) unpack(u *unpacker, length int) (err error) {
+	rr.Ns, err = u.name()
+	return
+}
+
+// A PTR record points to another name, as in reverse lookups.
+type PTR struct {
+	Hdr RRHeader
+	Ptr string
+}
+
+func (rr *PTR) Header() *RRHeader { return &rr.Hdr }
+func (rr *PTR) rrType() Type      { return TypePTR }
+
+func (rr *PTR) pack(p *packer) error { return p.name(rr.Ptr, true) }
+
+func (rr *PTR) unpack(u *unpacker, length int) (err error) {
+	rr.Ptr, err = u.name()
+	return
+}
+
+// An SOA record marks the start of a zone of authority.
+type SOA struct {
+	Hdr     RRHeader
+	Ns      string
+	Mbox    string
+	Serial  uint32
+	Refresh uint32
+	Retry   uint32
+	Expire  uint32
+	Minttl  uint32
+}
+
+func (rr *SOA) Header() *RRHeader { return &rr.Hdr }
+func (rr *SOA) rrType() Type      { return TypeSOA }
+
+func (rr *SOA) pack(p *packer) error {
+	if err := p.name(rr.Ns, true); err != nil {
+		return err
+	}
+	if err := p.name(rr.Mbox, true); err != nil {
+		return err
+	}
+	for _, v := range []uint32{rr.Serial, rr.Refresh, rr.Retry, rr.Expire, rr.Minttl} {
+		p.uint32(v)
+	}
+	return nil
+}
+
+func (rr *SOA) unpack(u *unpacker, length int) (err error) {
+	if rr.Ns, err = u.name(); err != nil {
+		return
+	}
+	if rr.Mbox, err = u.name(); err != nil {
+		return
+	}
+	for _, v := range []*uint32{&rr.Serial, &rr.Refresh, &rr.Retry, &rr.Expire, &rr.Minttl} {
+		if *v, err = u.uint32(); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// An SRV record locates a service, as defined in RFC 2782.
+type SRV struct {
+	Hdr      RRHeader
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   string
+}
+
+func (rr *SRV) Header() *RRHeader { return &rr.Hdr }
+func (rr *SRV) rrType() Type      { return TypeSRV }
+
+func (rr *SRV) pack(p *packer) error {
+	p.uint16(rr.Priority)
+	p.uint16(rr.Weight)
+	p.uint16(rr.Port)
+	// RFC 2782 forbids compressing the target.
+	return p.name(rr.Target, false)
+}
+
+func (rr *SRV) unpack(u *unpacker, length int) (err error) {
+	for _, v := range []*uint16{&rr.Priority, &rr.Weight, &rr.Port} {
+		if *v, err = u.uint16(); err != nil {
+			return
+		}
+	}
+	rr.Target, err = u.name()
+	return
+}
+
+// A TXT record holds one or more strings of up to 255 bytes.
+type TXT struct {
+	Hdr RRHeader
+	Txt []string
+}
+
+func (rr *TXT) Header() *RRHeader { return &rr.Hdr }
+func (rr *TXT) rrType() Type      { return TypeTXT }
+
+func (rr *TXT) pack(p *packer) error {
+	if len(rr.Txt) == 0 {
+		return errNoTXT
+	}
+	for _, s := range rr.Txt {
+		if len(s) > 255 {
+			return errTXTLen
+		}
+		p.msg = append(p.msg, byte(len(s)))
+		p.msg = append(p.msg, s...)
+	}
+	return nil
+}
+
+func (rr *TXT) unpack(u *unpacker, length int) error {
+	if length == 0 {
+		return errNoTXT
+	}
+	for end := u.off + length; u.off < end; {
+		n, err := u.uint8()
+		if err != nil {
+			return err
+		}
+		b, err := u.bytes(int(n))
+		if err != nil {
+			return err
+		}
+		rr.Txt = append(rr.Txt, string(b))
+	}
+	return nil
+}
+
+// An OPT record is the EDNS0 pseudo-record of RFC 6891.  Its name is
+// the root, its class is the largest UDP payload the sender accepts,
+// and its TTL holds the EDNS version and flags.  The upper bits of
+// an extended RCode are carried in the message header's RCode; Pack
+// and Unpack move them between the two.
+type OPT struct {
+	Hdr     RRHeader
+	Options []Option
+}
+
+// An Option is an EDNS0 option.
+type Option struct {
+	Code uint16
+	Data []byte
+}
+
+// NewOPT returns an OPT record of EDNS version 0 advertising udpSize.
+func NewOPT(udpSize int) *OPT {
+	return &OPT{Hdr: RRHeader{Name: ".", Type: TypeOPT, Class: Class(udpSize)}}
+}
+
+func (rr *OPT) Header() *RRHeader { return &rr.Hdr }
+func (rr *OPT) rrType() Type      { return TypeOPT }
+
+// UDPSize returns the largest UDP payload the sender accepts.
+func (rr *OPT) UDPSize() int { return int(rr.Hdr.Class) }
+
+// Version returns the EDNS version.
+func (rr *OPT) Version() int { return int(rr.Hdr.TTL >> 16 & 0xFF) }
+
+// DNSSECOK reports whether the DO (DNSSEC OK) flag is set.
+func (rr *OPT) DNSSECOK() bool { return rr.Hdr.TTL&0x8000 != 0 }
+
+func (rr *OPT) pack(p *packer) error {
+	for _, o := range rr.Options {
+		if len(o.Data) > 0xFFFF {
+			return errTooLarge
+		}
+		p.uint16(o.Code)
+		p.uint16(uint16(len(o.Data)))
+		p.msg = append(p.msg, o.Data...)
+	}
+	return nil
+}
+
+func (rr *OPT) unpack(u *unpacker, length int) error {
+	for end := u.off + length; u.off < end; {
+		code, err := u.uint16()
+		if err != nil {
+			return err
+		}
+		n, err := u.uint16()
+		if err != nil {
+			return err
+		}
+		data, err := u.bytes(int(n))
+		if err != nil {
+			return err
+		}
+		rr.Options = append(rr.Options, Option{code, data})
+	}
+	return nil
+}
+
+// An UnknownRR is a record of a type this package doesn't know,
+// kept as its raw data.  Its Type must be set.
+type UnknownRR struct {
+	Hdr  RRHeader
+	Data []byte
+}
+
+func (rr *UnknownRR) Header() *RRHeader { return &rr.Hdr }
+func (rr *UnknownRR) rrType() Type      { return rr.Hdr.Type }
+
+func (rr *UnknownRR) pack(p *packer) error {
+	p.msg = append(p.msg, rr.Data...)
+	return nil
+}
+
+func (rr *UnknownRR) unpack(u *unpacker, length int) (err error) {
+	rr.Data, err = u.bytes(length)
+	return
+}
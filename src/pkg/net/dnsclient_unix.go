@@ -10,7 +10,6 @@
 // TODO(rsc):
 //	Check periodically whether /etc/resolv.conf has changed.
 //	Could potentially handle many outstanding lookups faster.
-//	Could have a small cache.
 //	Random UDP source port (net.Dial should do that for us).
 //	Random request IDs.
 
@@ -48,7 +47,7 @@ func exchange(cfg *dnsConfig, c Conn, name string, qtype uint16) (*dnsMsg, error
 		if cfg.timeout == 0 {
 			c.SetReadDeadline(time.Time{})
 		} else {
-			c.SetReadDeadline(time.Now().Add(time.Duration(cfg.timeout) * time.Second))
+			c.SetReadDeadline(time.Now().Add(cfg.timeout))
 		}
 
 		buf := make([]byte, 2000) // More than enough.
@@ -75,18 +74,21 @@ func exchange(cfg *dnsConfig, c Conn, name string, qtype uint16) (*dnsMsg, error
 
 // Do a lookup for a single name, which must be rooted
 // (otherwise answer will not find the answers).
-func tryOneName(cfg *dnsConfig, name string, qtype uint16) (cname string, addrs []dnsRR, err error) {
+func (r *Resolver) tryOneName(cfg *dnsConfig, name string, qtype uint16) (cname string, addrs []dnsRR, err error) {
 	if len(cfg.servers) == 0 {
 		return "", nil, &DNSError{Err: "no DNS servers", Name: name}
 	}
+	if cname, addrs, ok := r.cacheGet(name, qtype); ok {
+		return cname, addrs, nil
+	}
 	for i := 0; i < len(cfg.servers); i++ {
 		// Calling Dial here is scary -- we have to be sure
 		// not to dial a name that will require a DNS lookup,
 		// or Dial will call back here to translate it.
-		// The DNS config parser has already checked that
-		// all the cfg.servers[i] are IP addresses, which
-		// Dial will use without a DNS lookup.
-		server := cfg.servers[i] + ":53"
+		// The DNS config parser and Resolver.config have
+		// already checked that all the cfg.servers[i] are
+		// IP addresses, which Dial will use without a DNS lookup.
+		server := cfg.servers[i]
 		c, cerr := Dial("udp", server)
 		if cerr != nil {
 			err = cerr
@@ -99,7 +101,11 @@ func tryOneName(cfg *dnsConfig, name string, qtype uint16) (cname string, addrs
 			continue
 		}
 		cname, addrs, err = answer(name, server, msg, qtype)
-		if err == nil || err.(*DNSError).Err == noSuchHost {
+		if err == nil {
+			r.cachePut(name, qtype, cname, addrs, msg)
+			break
+		}
+		if err.(*DNSError).Err == noSuchHost {
 			break
 		}
 	}
@@ -132,13 +138,123 @@ func loadConfig() { cfg, dnserr = dnsReadConfig() }
 
 var onceLoadConfig sync.Once
 
+// defaultResolver is used by the package lookup functions.
+// It does not cache, as the C library resolver doesn't either.
+var defaultResolver = &Resolver{CacheSize: -1}
+
+// config returns the configuration of r: the system one with the
+// fields of r overriding it.
+func (r *Resolver) config() (*dnsConfig, error) {
+	onceLoadConfig.Do(loadConfig)
+	if len(r.Servers) == 0 {
+		if dnserr != nil || cfg == nil {
+			return nil, dnserr
+		}
+		if r.Timeout == 0 && r.Attempts == 0 {
+			return cfg, nil
+		}
+	}
+	conf := defaultDNSConfig()
+	if cfg != nil {
+		*conf = *cfg
+	}
+	if len(r.Servers) > 0 {
+		conf.servers = make([]string, 0, len(r.Servers))
+		for _, s := range r.Servers {
+			if ParseIP(s) != nil {
+				s = JoinHostPort(s, "53")
+			} else if host, _, err := SplitHostPort(s); err != nil || ParseIP(host) == nil {
+				return nil, &DNSConfigError{&AddrError{"DNS server must be an IP address", s}}
+			}
+			conf.servers = append(conf.servers, s)
+		}
+	}
+	if r.Timeout > 0 {
+		conf.timeout = r.Timeout
+	}
+	if r.Attempts > 0 {
+		conf.attempts = r.Attempts
+	}
+	return conf, nil
+}
+
+// cacheGet returns the cached answer for the query, if any.
+func (r *Resolver) cacheGet(name string, qtype uint16) (cname string, addrs []dnsRR, ok bool) {
+	if r.CacheSize < 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := dnsCacheKey{name, qtype}
+	e := r.cache[key]
+	if e == nil {
+		return
+	}
+	if !time.Now().Before(e.expires) {
+		delete(r.cache, key)
+		return
+	}
+	return e.cname, e.addrs, true
+}
+
+// cachePut caches the answer for the query, found in msg, for the
+// smallest time to live of the records answering it.
+func (r *Resolver) cachePut(name string, qtype uint16, cname string, addrs []dnsRR, msg *dnsMsg) {
+	if r.CacheSize < 0 {
+		return
+	}
+	size := r.CacheSize
+	if size == 0 {
+		size = DefaultResolverCacheSize
+	}
+	ttl := ^uint32(0)
+	for _, rr := range msg.answer {
+		if h := rr.Header(); h.Rrtype == qtype || h.Rrtype == dnsTypeCNAME {
+			if h.Ttl < ttl {
+				ttl = h.Ttl
+			}
+		}
+	}
+	if ttl == 0 {
+		return
+	}
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.cache == nil {
+		r.cache = make(map[dnsCacheKey]*dnsCacheEntry)
+	}
+	if len(r.cache) >= size {
+		for k, e := range r.cache {
+			if !now.Before(e.expires) {
+				delete(r.cache, k)
+			}
+		}
+		// Still full: evict arbitrary entries.
+		for k := range r.cache {
+			if len(r.cache) < size {
+				break
+			}
+			delete(r.cache, k)
+		}
+	}
+	r.cache[dnsCacheKey{name, qtype}] = &dnsCacheEntry{
+		cname:   cname,
+		addrs:   addrs,
+		expires: now.Add(time.Duration(ttl) * time.Second),
+	}
+}
+
 func lookup(name string, qtype uint16) (cname string, addrs []dnsRR, err error) {
+	return defaultResolver.lookup(name, qtype)
+}
+
+func (r *Resolver) lookup(name string, qtype uint16) (cname string, addrs []dnsRR, err error) {
 	if !isDomainName(name) {
 		return name, nil, &DNSError{Err: "invalid domain name", Name: name}
 	}
-	onceLoadConfig.Do(loadConfig)
-	if dnserr != nil || cfg == nil {
-		err = dnserr
+	cfg, err := r.config()
+	if err != nil || cfg == nil {
 		return
 	}
 	// If name is rooted (trailing dot) or has enough dots,
@@ -150,7 +266,7 @@ func lookup(name string, qtype uint16) (cname string, addrs []dnsRR, err error)
 			rname += "."
 		}
 		// Can try as ordinary name.
-		cname, addrs, err = tryOneName(cfg, rname, qtype)
+		cname, addrs, err = r.tryOneName(cfg, rname, qtype)
 		if err == nil {
 			return
 		}
@@ -165,7 +281,7 @@ func lookup(name string, qtype uint16) (cname string, addrs []dnsRR, err error)
 		if rname[len(rname)-1] != '.' {
 			rname += "."
 		}
-		cname, addrs, err = tryOneName(cfg, rname, qtype)
+		cname, addrs, err = r.tryOneName(cfg, rname, qtype)
 		if err == nil {
 			return
 		}
@@ -176,13 +292,78 @@ func lookup(name string, qtype uint16) (cname string, addrs []dnsRR, err error)
 	if !rooted {
 		rname += "."
 	}
-	cname, addrs, err = tryOneName(cfg, rname, qtype)
+	cname, addrs, err = r.tryOneName(cfg, rname, qtype)
 	if err == nil {
 		return
 	}
 	return
 }
 
+func (r *Resolver) lookupHost(host string) (addrs []string, err error) {
+	ips, err := r.lookupIP(host)
+	if err != nil {
+		return
+	}
+	addrs = make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, ip.String())
+	}
+	return
+}
+
+func (r *Resolver) lookupIP(host string) (addrs []IP, err error) {
+	if ip := ParseIP(host); ip != nil {
+		return []IP{ip}, nil
+	}
+	var records []dnsRR
+	var cname string
+	var err4, err6 error
+	cname, records, err4 = r.lookup(host, dnsTypeA)
+	addrs = convertRR_A(records)
+	if cname != "" {
+		host = cname
+	}
+	_, records, err6 = r.lookup(host, dnsTypeAAAA)
+	if err4 != nil && err6 == nil {
+		// Ignore A error because AAAA lookup succeeded.
+		err4 = nil
+	}
+	if err6 != nil && len(addrs) > 0 {
+		// Ignore AAAA error because A lookup succeeded.
+		err6 = nil
+	}
+	if err4 != nil {
+		return nil, err4
+	}
+	if err6 != nil {
+		return nil, err6
+	}
+
+	addrs = append(addrs, convertRR_AAAA(records)...)
+	return addrs, nil
+}
+
+func (r *Resolver) lookupSRV(service, proto, name string) (cname string, addrs []*SRV, err error) {
+	var target string
+	if service == "" && proto == "" {
+		target = name
+	} else {
+		target = "_" + service + "._" + proto + "." + name
+	}
+	var records []dnsRR
+	cname, records, err = r.lookup(target, dnsTypeSRV)
+	if err != nil {
+		return
+	}
+	addrs = make([]*SRV, len(records))
+	for i, rr := range records {
+		r := rr.(*dnsRR_SRV)
+		addrs[i] = &SRV{r.Target, r.Port, r.Priority, r.Weight}
+	}
+	byPriorityWeight(addrs).sort()
+	return
+}
+
 // goLookupHost is the native Go implementation of LookupHost.
 // Used only if cgoLookupHost refuses to handle the request
 // (that is, only if cgoLookupHost is the stub in cgo_stub.go).
@@ -235,32 +416,7 @@ func goLookupIP(name string) (addrs []IP, err error) {
 		err = dnserr
 		return
 	}
-	var records []dnsRR
-	var cname string
-	var err4, err6 error
-	cname, records, err4 = lookup(name, dnsTypeA)
-	addrs = convertRR_A(records)
-	if cname != "" {
-		name = cname
-	}
-	_, records, err6 = lookup(name, dnsTypeAAAA)
-	if err4 != nil && err6 == nil {
-		// Ignore A error because AAAA lookup succeeded.
-		err4 = nil
-	}
-	if err6 != nil && len(addrs) > 0 {
-		// Ignore AAAA error because A lookup succeeded.
-		err6 = nil
-	}
-	if err4 != nil {
-		return nil, err4
-	}
-	if err6 != nil {
-		return nil, err6
-	}
-
-	addrs = append(addrs, convertRR_AAAA(records)...)
-	return addrs, nil
+	return defaultResolver.lookupIP(name)
 }
 
 // goLookupCNAME is the native Go implementation of LookupCNAME.
@@ -0,0 +1,208 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin freebsd linux netbsd openbsd
+
+package net
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A fakeDNSServer answers DNS queries over UDP on the loopback
+// interface with the records in zone.
+type fakeDNSServer struct {
+	t    *testing.T
+	conn PacketConn
+	zone map[dnsCacheKey][]dnsRR
+
+	mu      sync.Mutex
+	queries int
+	drop    int // number of queries left to ignore
+}
+
+func newFakeDNSServer(t *testing.T, zone map[dnsCacheKey][]dnsRR) *fakeDNSServer {
+	c, err := ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeDNSServer{t: t, conn: c, zone: zone}
+	go s.serve()
+	return s
+}
+
+func (s *fakeDNSServer) addr() string { return s.conn.LocalAddr().String() }
+
+func (s *fakeDNSServer) numQueries() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries
+}
+
+// dropNext makes the server ignore the next n queries.
+func (s *fakeDNSServer) dropNext(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drop = n
+}
+
+func (s *fakeDNSServer) serve() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		q := new(dnsMsg)
+		if !q.Unpack(buf[:n]) || len(q.question) != 1 {
+			s.t.Errorf("bad query from %v", addr)
+			continue
+		}
+		s.mu.Lock()
+		s.queries++
+		drop := s.drop > 0
+		if drop {
+			s.drop--
+		}
+		s.mu.Unlock()
+		if drop {
+			continue
+		}
+		r := &dnsMsg{question: q.question}
+		r.id = q.id
+		r.response = true
+		r.recursion_available = true
+		qq := q.question[0]
+		r.answer = s.zone[dnsCacheKey{qq.Name, qq.Qtype}]
+		if r.answer == nil {
+			r.rcode = dnsRcodeNameError
+		}
+		msg, ok := r.Pack()
+		if !ok {
+			s.t.Errorf("cannot pack answer to %v", qq)
+			continue
+		}
+		s.conn.WriteTo(msg, addr)
+	}
+}
+
+func (s *fakeDNSServer) close() { s.conn.Close() }
+
+func rrHeader(name string, rrtype uint16, ttl uint32) dnsRR_Header {
+	return dnsRR_Header{Name: name, Rrtype: rrtype, Class: dnsClassINET, Ttl: ttl}
+}
+
+var fakeZone = map[dnsCacheKey][]dnsRR{
+	dnsCacheKey{"www.example.com.", dnsTypeA}: {
+		&dnsRR_A{rrHeader("www.example.com.", dnsTypeA, 300), 0xc0000201},
+	},
+	dnsCacheKey{"www.example.com.", dnsTypeAAAA}: {
+		&dnsRR_AAAA{rrHeader("www.example.com.", dnsTypeAAAA, 300), [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1}},
+	},
+	dnsCacheKey{"alias.example.com.", dnsTypeA}: {
+		&dnsRR_CNAME{rrHeader("alias.example.com.", dnsTypeCNAME, 0), "www.example.com."},
+		&dnsRR_A{rrHeader("www.example.com.", dnsTypeA, 300), 0xc0000201},
+	},
+	dnsCacheKey{"_xmpp._tcp.example.com.", dnsTypeSRV}: {
+		&dnsRR_SRV{rrHeader("_xmpp._tcp.example.com.", dnsTypeSRV, 60), 20, 0, 5222, "backup.example.com."},
+		&dnsRR_SRV{rrHeader("_xmpp._tcp.example.com.", dnsTypeSRV, 60), 10, 0, 5222, "xmpp.example.com."},
+	},
+}
+
+func TestResolverLookupHost(t *testing.T) {
+	s := newFakeDNSServer(t, fakeZone)
+	defer s.close()
+
+	r := &Resolver{Servers: []string{s.addr()}, Timeout: time.Second}
+	want := []string{"192.0.2.1", "2001:db8::1"}
+	for i := 0; i < 2; i++ {
+		addrs, err := r.LookupHost("www.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(addrs, want) {
+			t.Errorf("LookupHost = %v; want %v", addrs, want)
+		}
+	}
+	if n := s.numQueries(); n != 2 {
+		t.Errorf("%d queries; want 2, one for each record type, then the cache", n)
+	}
+
+	// An answer with a zero time to live isn't cached.
+	for i := 0; i < 2; i++ {
+		if _, _, err := r.lookup("alias.example.com.", dnsTypeA); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := s.numQueries(); n != 4 {
+		t.Errorf("%d queries; want 4", n)
+	}
+
+	if _, err := r.LookupHost("missing.example.com"); err == nil {
+		t.Error("LookupHost of a missing name succeeded")
+	} else if de, ok := err.(*DNSError); !ok || de.Err != noSuchHost {
+		t.Errorf("got %v; want %q", err, noSuchHost)
+	}
+
+	// Without a cache every lookup is sent to the server.
+	r = &Resolver{Servers: []string{s.addr()}, CacheSize: -1}
+	n := s.numQueries()
+	for i := 0; i < 2; i++ {
+		if _, err := r.LookupIP("www.example.com"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := s.numQueries() - n; got != 4 {
+		t.Errorf("uncached lookups sent %d queries; want 4", got)
+	}
+}
+
+func TestResolverLookupSRV(t *testing.T) {
+	s := newFakeDNSServer(t, fakeZone)
+	defer s.close()
+
+	r := &Resolver{Servers: []string{s.addr()}}
+	cname, srvs, err := r.LookupSRV("xmpp", "tcp", "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cname != "_xmpp._tcp.example.com." {
+		t.Errorf("cname = %q", cname)
+	}
+	if len(srvs) != 2 || srvs[0].Target != "xmpp.example.com." || srvs[1].Target != "backup.example.com." {
+		t.Errorf("LookupSRV returned %v; want xmpp then backup", srvs)
+	}
+}
+
+func TestResolverAttempts(t *testing.T) {
+	s := newFakeDNSServer(t, fakeZone)
+	defer s.close()
+
+	s.dropNext(1)
+	r := &Resolver{Servers: []string{s.addr()}, Timeout: 100 * time.Millisecond, Attempts: 1}
+	_, _, err := r.lookup("www.example.com.", dnsTypeA)
+	if de, ok := err.(*DNSError); !ok || !de.Timeout() {
+		t.Fatalf("got %v; want a timeout", err)
+	}
+
+	s.dropNext(1)
+	r = &Resolver{Servers: []string{s.addr()}, Timeout: 100 * time.Millisecond, Attempts: 2}
+	if _, _, err := r.lookup("www.example.com.", dnsTypeA); err != nil {
+		t.Fatalf("second attempt failed: %v", err)
+	}
+}
+
+func TestResolverBadServer(t *testing.T) {
+	r := &Resolver{Servers: []string{"ns.example.com:53"}}
+	if _, err := r.LookupHost("www.example.com"); err == nil {
+		t.Fatal("lookup with a named server succeeded")
+	}
+	r = &Resolver{}
+	if addrs, err := r.LookupIP("192.0.2.7"); err != nil || len(addrs) != 1 || !addrs[0].Equal(IPv4(192, 0, 2, 7)) {
+		t.Errorf("LookupIP of an address = %v, %v", addrs, err)
+	}
+}
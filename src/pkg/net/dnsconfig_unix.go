@@ -8,13 +8,27 @@
 
 package net
 
+import "time"
+
 type dnsConfig struct {
-	servers  []string // servers to use
-	search   []string // suffixes to append to local name
-	ndots    int      // number of dots in name to trigger absolute lookup
-	timeout  int      // seconds before giving up on packet
-	attempts int      // lost packets before giving up on server
-	rotate   bool     // round robin among servers
+	servers  []string      // server addresses (host:port) to use
+	search   []string      // suffixes to append to local name
+	ndots    int           // number of dots in name to trigger absolute lookup
+	timeout  time.Duration // wait before giving up on packet
+	attempts int           // lost packets before giving up on server
+	rotate   bool          // round robin among servers
+}
+
+// defaultDNSConfig returns the configuration used in the absence of
+// options in /etc/resolv.conf.
+func defaultDNSConfig() *dnsConfig {
+	return &dnsConfig{
+		servers:  make([]string, 3)[0:0], // small, but the standard limit
+		search:   make([]string, 0),
+		ndots:    1,
+		timeout:  5 * time.Second,
+		attempts: 2,
+	}
 }
 
 // See resolv.conf(5) on a Linux machine.
@@ -26,13 +40,7 @@ func dnsReadConfig() (*dnsConfig, error) {
 	if err != nil {
 		return nil, &DNSConfigError{err}
 	}
-	conf := new(dnsConfig)
-	conf.servers = make([]string, 3)[0:0] // small, but the standard limit
-	conf.search = make([]string, 0)
-	conf.ndots = 1
-	conf.timeout = 5
-	conf.attempts = 2
-	conf.rotate = false
+	conf := defaultDNSConfig()
 	for line, ok := file.readLine(); ok; line, ok = file.readLine() {
 		f := getFields(line)
 		if len(f) < 1 {
@@ -47,13 +55,9 @@ func dnsReadConfig() (*dnsConfig, error) {
 				// just an IP address.  Otherwise we need DNS
 				// to look it up.
 				name := f[1]
-				switch len(ParseIP(name)) {
-				case 16:
-					name = "[" + name + "]"
-					fallthrough
-				case 4:
+				if ParseIP(name) != nil {
 					a = a[0 : n+1]
-					a[n] = name
+					a[n] = JoinHostPort(name, "53")
 					conf.servers = a
 				}
 			}
@@ -87,7 +91,7 @@ func dnsReadConfig() (*dnsConfig, error) {
 					if n < 1 {
 						n = 1
 					}
-					conf.timeout = n
+					conf.timeout = time.Duration(n) * time.Second
 				case len(s) >= 8 && s[0:9] == "attempts:":
 					n, _, _ := dtoi(s, 9)
 					if n < 1 {
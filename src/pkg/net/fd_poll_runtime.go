@@ -0,0 +1,118 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package net
+
+import (
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The network poller is part of the runtime: a goroutine waiting
+// for I/O is parked by the scheduler, which readies it when epoll
+// reports the descriptor ready.  See ../runtime/netpoll.goc.
+
+func runtime_pollServerInit()
+func runtime_pollOpen(fd int) (uintptr, int)
+func runtime_pollClose(ctx uintptr)
+func runtime_pollWait(ctx uintptr, mode int) int
+func runtime_pollReset(ctx uintptr, mode int) int
+func runtime_pollSetDeadline(ctx uintptr, d int64, mode int)
+func runtime_pollUnblock(ctx uintptr)
+
+// A pollDesc is the runtime's poll descriptor of a netFD.
+type pollDesc struct {
+	runtimeCtx uintptr
+}
+
+var serverInit sync.Once
+
+func sysInit() {
+}
+
+func (pd *pollDesc) Init(fd *netFD) error {
+	serverInit.Do(runtime_pollServerInit)
+	ctx, errno := runtime_pollOpen(fd.sysfd)
+	if errno != 0 {
+		return syscall.Errno(errno)
+	}
+	pd.runtimeCtx = ctx
+	return nil
+}
+
+func (pd *pollDesc) Close() {
+	runtime_pollClose(pd.runtimeCtx)
+	pd.runtimeCtx = 0
+}
+
+// Lock and Unlock do nothing: the runtime poll descriptor
+// has its own lock.
+func (pd *pollDesc) Lock() {
+}
+
+func (pd *pollDesc) Unlock() {
+}
+
+// Evict unblocks any I/O waiting on pd.  Later waits
+// return errClosing.
+func (pd *pollDesc) Evict() {
+	runtime_pollUnblock(pd.runtimeCtx)
+}
+
+func (pd *pollDesc) PrepareRead() error {
+	return convertErr(runtime_pollReset(pd.runtimeCtx, 'r'))
+}
+
+func (pd *pollDesc) PrepareWrite() error {
+	return convertErr(runtime_pollReset(pd.runtimeCtx, 'w'))
+}
+
+func (pd *pollDesc) WaitRead() error {
+	return convertErr(runtime_pollWait(pd.runtimeCtx, 'r'))
+}
+
+func (pd *pollDesc) WaitWrite() error {
+	return convertErr(runtime_pollWait(pd.runtimeCtx, 'w'))
+}
+
+func convertErr(res int) error {
+	switch res {
+	case 0:
+		return nil
+	case 1:
+		return errClosing
+	case 2:
+		return errTimeout
+	}
+	println("unreachable: ", res)
+	panic("unreachable")
+}
+
+func setReadDeadline(fd *netFD, t time.Time) error {
+	return setDeadlineImpl(fd, t, 'r')
+}
+
+func setWriteDeadline(fd *netFD, t time.Time) error {
+	return setDeadlineImpl(fd, t, 'w')
+}
+
+func setDeadline(fd *netFD, t time.Time) error {
+	return setDeadlineImpl(fd, t, 'r'+'w')
+}
+
+func setDeadlineImpl(fd *netFD, t time.Time, mode int) error {
+	d := t.UnixNano()
+	if t.IsZero() {
+		d = 0
+	}
+	if err := fd.incref(false); err != nil {
+		return err
+	}
+	runtime_pollSetDeadline(fd.pd.runtimeCtx, d, mode)
+	fd.decref()
+	return nil
+}
@@ -0,0 +1,294 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package net
+
+import (
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// tcpPair returns the two ends of a loopback TCP connection.
+func tcpPair(t *testing.T) (c, s Conn) {
+	ln := newLocalListener(t)
+	defer ln.Close()
+	accepted := make(chan Conn)
+	go func() {
+		s, err := ln.Accept()
+		if err != nil {
+			t.Errorf("Accept: %v", err)
+		}
+		accepted <- s
+	}()
+	c, err := Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	if s = <-accepted; s == nil {
+		c.Close()
+		t.FailNow()
+	}
+	return c, s
+}
+
+// TestGCWhileNetpollWaiting tests that goroutines parked in the
+// network poller survive garbage collections and are still woken
+// by their I/O afterwards.
+func TestGCWhileNetpollWaiting(t *testing.T) {
+	const n = 10
+	var clients, servers [n]Conn
+	for i := range clients {
+		clients[i], servers[i] = tcpPair(t)
+		defer clients[i].Close()
+		defer servers[i].Close()
+	}
+
+	errc := make(chan error, n)
+	for _, c := range clients {
+		go func(c Conn) {
+			var buf [1]byte
+			_, err := c.Read(buf[:])
+			errc <- err
+		}(c)
+	}
+	for i := 0; i < 20; i++ {
+		runtime.GC()
+		time.Sleep(time.Millisecond)
+	}
+	for _, s := range servers {
+		s.Write([]byte{'x'})
+	}
+	for i := 0; i < n; i++ {
+		select {
+		case err := <-errc:
+			if err != nil {
+				t.Errorf("Read: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%d of %d reads did not complete after GC", n-i, n)
+		}
+	}
+}
+
+// TestNetpollGOMAXPROCS1 tests that with a single cpu, a goroutine
+// that keeps the run queue busy does not starve network I/O.
+func TestNetpollGOMAXPROCS1(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+
+	c, s := tcpPair(t)
+	defer c.Close()
+	defer s.Close()
+	go func() {
+		var buf [1]byte
+		for {
+			if _, err := s.Read(buf[:]); err != nil {
+				return
+			}
+			if _, err := s.Write(buf[:]); err != nil {
+				return
+			}
+		}
+	}()
+
+	var stop int32
+	done := make(chan bool)
+	go func() {
+		x := 0
+		for atomic.LoadInt32(&stop) == 0 {
+			for i := 0; i < 1e5; i++ {
+				x += i
+			}
+			runtime.Gosched()
+		}
+		done <- x != 0
+	}()
+	defer func() {
+		atomic.StoreInt32(&stop, 1)
+		<-done
+	}()
+
+	c.SetDeadline(time.Now().Add(10 * time.Second))
+	var buf [1]byte
+	for i := 0; i < 100; i++ {
+		if _, err := c.Write(buf[:]); err != nil {
+			t.Fatalf("Write #%d: %v", i, err)
+		}
+		if _, err := c.Read(buf[:]); err != nil {
+			t.Fatalf("Read #%d: %v", i, err)
+		}
+	}
+}
+
+// The network poller replaced a pollServer goroutine blocked in
+// epoll_wait that woke readers over channels.  That code is gone
+// on Linux, so the pair of benchmarks below compares the runtime
+// poller with oldPollServer, a cut-down copy of it, by passing a
+// byte back and forth over a socketpair.
+
+// oldPollServer waits for read readiness on behalf of goroutines
+// the way the pre-runtime pollServer did.
+type oldPollServer struct {
+	epfd int
+
+	sync.Mutex
+	pending map[int]chan bool
+}
+
+var (
+	oldPollServerOnce sync.Once
+	oldPollServerInst *oldPollServer
+)
+
+// getOldPollServer returns the shared oldPollServer.  Like the
+// original, it runs for the life of the process.
+func getOldPollServer(b *testing.B) *oldPollServer {
+	oldPollServerOnce.Do(func() {
+		epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+		if err != nil {
+			b.Fatalf("epoll_create1: %v", err)
+		}
+		s := &oldPollServer{epfd: epfd, pending: make(map[int]chan bool)}
+		go s.run()
+		oldPollServerInst = s
+	})
+	if oldPollServerInst == nil {
+		b.Fatal("no poll server")
+	}
+	return oldPollServerInst
+}
+
+func (s *oldPollServer) run() {
+	var events [10]syscall.EpollEvent
+	for {
+		n, err := syscall.EpollWait(s.epfd, events[:], -1)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			panic(os.NewSyscallError("epoll_wait", err))
+		}
+		s.Lock()
+		for _, ev := range events[:n] {
+			if c := s.pending[int(ev.Fd)]; c != nil {
+				delete(s.pending, int(ev.Fd))
+				c <- true
+			}
+		}
+		s.Unlock()
+	}
+}
+
+// read reads from the non-blocking fd, waiting on c for
+// the poll server whenever the read would block.
+func (s *oldPollServer) read(fd int, p []byte, c chan bool) (int, error) {
+	for {
+		n, err := syscall.Read(fd, p)
+		if err != syscall.EAGAIN {
+			return n, err
+		}
+		ev := syscall.EpollEvent{Events: syscall.EPOLLIN | syscall.EPOLLONESHOT, Fd: int32(fd)}
+		s.Lock()
+		s.pending[fd] = c
+		err = syscall.EpollCtl(s.epfd, syscall.EPOLL_CTL_MOD, fd, &ev)
+		if err == syscall.ENOENT {
+			err = syscall.EpollCtl(s.epfd, syscall.EPOLL_CTL_ADD, fd, &ev)
+		}
+		s.Unlock()
+		if err != nil {
+			return 0, os.NewSyscallError("epoll_ctl", err)
+		}
+		<-c
+	}
+}
+
+func socketpair(b *testing.B) (int, int) {
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM, 0)
+	if err != nil {
+		b.Fatalf("socketpair: %v", err)
+	}
+	return fds[0], fds[1]
+}
+
+// pingPong passes a byte from ping to pong and back b.N times.
+func pingPong(b *testing.B, ping, pong func(p []byte) error) {
+	go func() {
+		var buf [1]byte
+		for i := 0; i < b.N; i++ {
+			if pong(buf[:]) != nil {
+				return
+			}
+		}
+	}()
+	var buf [1]byte
+	for i := 0; i < b.N; i++ {
+		if err := ping(buf[:]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPingPongRuntimePoller(b *testing.B) {
+	b.StopTimer()
+	fd0, fd1 := socketpair(b)
+	var conns [2]Conn
+	for i, fd := range []int{fd0, fd1} {
+		f := os.NewFile(uintptr(fd), "socketpair")
+		c, err := FileConn(f)
+		f.Close()
+		if err != nil {
+			b.Fatalf("FileConn: %v", err)
+		}
+		defer c.Close()
+		conns[i] = c
+	}
+	b.StartTimer()
+	pingPong(b, func(p []byte) error {
+		if _, err := conns[0].Write(p); err != nil {
+			return err
+		}
+		_, err := conns[0].Read(p)
+		return err
+	}, func(p []byte) error {
+		if _, err := conns[1].Read(p); err != nil {
+			return err
+		}
+		_, err := conns[1].Write(p)
+		return err
+	})
+}
+
+func BenchmarkPingPongPollServer(b *testing.B) {
+	b.StopTimer()
+	s := getOldPollServer(b)
+	fd0, fd1 := socketpair(b)
+	defer syscall.Close(fd0)
+	defer syscall.Close(fd1)
+	for _, fd := range []int{fd0, fd1} {
+		if err := syscall.SetNonblock(fd, true); err != nil {
+			b.Fatalf("setnonblock: %v", err)
+		}
+	}
+	c0, c1 := make(chan bool, 1), make(chan bool, 1)
+	b.StartTimer()
+	pingPong(b, func(p []byte) error {
+		if _, err := syscall.Write(fd0, p); err != nil {
+			return err
+		}
+		_, err := s.read(fd0, p, c0)
+		return err
+	}, func(p []byte) error {
+		if _, err := s.read(fd1, p, c1); err != nil {
+			return err
+		}
+		_, err := syscall.Write(fd1, p)
+		return err
+	})
+}
@@ -0,0 +1,309 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP client authentication. See RFC 2617 and RFC 7616.
+
+package http
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"sync"
+)
+
+// An Authenticator supplies the credentials of a Client's requests and
+// answers the authentication challenges of servers.
+//
+// An Authenticator must be safe for concurrent use by multiple
+// goroutines.
+type Authenticator interface {
+	// Authenticate sets the credentials of req, usually its
+	// Authorization header, before req is sent.
+	//
+	// If challenge is nil, req is about to be sent for the first
+	// time, and Authenticate may set credentials learned from
+	// earlier challenges; its result is ignored.
+	//
+	// Otherwise, challenge is the 401 Unauthorized response that req
+	// received. Authenticate should set credentials that answer one
+	// of the challenges in its WWW-Authenticate headers and return
+	// true to have req sent again, or return false to have the
+	// response returned to the caller. Authenticate must not read
+	// or close the response body.
+	Authenticate(req *Request, challenge *Response) bool
+}
+
+// A challenge is an authentication challenge from a WWW-Authenticate
+// header: an authentication scheme with its parameters.
+type challenge struct {
+	scheme string            // lower case
+	params map[string]string // by lower-case name
+}
+
+// parseChallenges parses the WWW-Authenticate header values vs. A
+// value may hold several challenges, separated by commas like their
+// parameters:
+//
+//	Digest realm="a, b", nonce="n", Basic realm="c"
+func parseChallenges(vs []string) []challenge {
+	var cs []challenge
+	for _, v := range vs {
+		var cur *challenge
+		for {
+			v = skipSpaceAndCommas(v)
+			if v == "" {
+				break
+			}
+			var tok string
+			tok, v = parseToken(v)
+			if tok == "" {
+				break // malformed; ignore the rest
+			}
+			rest := strings.TrimLeft(v, " \t")
+			if strings.HasPrefix(rest, "=") && cur != nil {
+				// An auth-param of the current challenge.
+				var val string
+				val, v = parseParamValue(strings.TrimLeft(rest[1:], " \t"))
+				cur.params[strings.ToLower(tok)] = val
+				continue
+			}
+			// A new challenge. A token68, as in "Negotiate abc==",
+			// is parsed as a parameter and is of no use to us.
+			cs = append(cs, challenge{strings.ToLower(tok), make(map[string]string)})
+			cur = &cs[len(cs)-1]
+		}
+	}
+	return cs
+}
+
+func skipSpaceAndCommas(s string) string {
+	return strings.TrimLeft(s, " \t,")
+}
+
+// parseToken returns the token at the start of s and the rest of s.
+func parseToken(s string) (token, rest string) {
+	i := strings.IndexFunc(s, isNotToken)
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+// parseParamValue returns the token or quoted string at the start of s,
+// unquoted, and the rest of s.
+func parseParamValue(s string) (value, rest string) {
+	if !strings.HasPrefix(s, `"`) {
+		return parseToken(s)
+	}
+	var b []byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return string(b), s[i+1:]
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b = append(b, s[i])
+			}
+		default:
+			b = append(b, c)
+		}
+	}
+	return string(b), "" // unterminated
+}
+
+// DigestAuth is an Authenticator that answers Digest challenges, as
+// described by RFC 2617 and RFC 7616, with a username and password.
+//
+// It supports the MD5, MD5-sess, SHA-256 and SHA-256-sess algorithms,
+// preferring SHA-256 when a server offers several, and the "auth"
+// quality of protection, as well as challenges without qop from RFC 2069
+// servers. After a server's first challenge, later requests to the same
+// scheme and host are sent with credentials for the same nonce, with an
+// incremented nonce count, so that they need no extra round trip until
+// the server marks the nonce stale.
+type DigestAuth struct {
+	Username, Password string
+
+	// Hosts lists the hosts, in the form of URL.Host, whose
+	// challenges are answered. If empty, only challenges from the
+	// scheme and host of the first request authenticated are
+	// answered, so that the credentials are not offered to another
+	// server that a request is redirected to.
+	Hosts []string
+
+	mu     sync.Mutex
+	origin string                  // scheme and host of the first request
+	spaces map[string]*digestSpace // by scheme and host
+}
+
+// NewDigestAuth returns a DigestAuth for the given credentials.
+func NewDigestAuth(username, password string) *DigestAuth {
+	return &DigestAuth{Username: username, Password: password}
+}
+
+// digestSpace is the state of a protection space: the latest Digest
+// challenge of a server and the number of times its nonce was used.
+type digestSpace struct {
+	realm, nonce, opaque string
+	algorithm            string // as sent by the server
+	qop                  bool   // use qop=auth
+	nc                   int
+}
+
+func (a *DigestAuth) Authenticate(req *Request, res *Response) bool {
+	key := req.URL.Scheme + "://" + strings.ToLower(req.URL.Host)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.allowed(req.URL.Host, key) {
+		return false
+	}
+	if res != nil {
+		sp := newDigestSpace(parseChallenges(res.Header["Www-Authenticate"]))
+		if sp == nil {
+			return false
+		}
+		if a.spaces == nil {
+			a.spaces = make(map[string]*digestSpace)
+		}
+		a.spaces[key] = sp
+	}
+	sp := a.spaces[key]
+	if sp == nil {
+		return false
+	}
+	cnonce, err := newCnonce()
+	if err != nil {
+		return false
+	}
+	sp.nc++
+	req.Header.Set("Authorization", a.authorization(sp, req, cnonce))
+	return true
+}
+
+// allowed reports whether the credentials may be sent to host, whose
+// scheme and host are key. a.mu must be held.
+func (a *DigestAuth) allowed(host, key string) bool {
+	if len(a.Hosts) == 0 {
+		if a.origin == "" {
+			a.origin = key
+		}
+		return key == a.origin
+	}
+	for _, h := range a.Hosts {
+		if strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// newDigestSpace returns the protection space of the strongest usable
+// Digest challenge in cs, or nil if there is none.
+func newDigestSpace(cs []challenge) *digestSpace {
+	var best *digestSpace
+	bestRank := 0
+	for _, c := range cs {
+		if c.scheme != "digest" || c.params["nonce"] == "" {
+			continue
+		}
+		alg := c.params["algorithm"]
+		rank := 0
+		switch strings.ToUpper(alg) {
+		case "", "MD5", "MD5-SESS":
+			rank = 1
+		case "SHA-256", "SHA-256-SESS":
+			rank = 2
+		default:
+			continue
+		}
+		qop, hasQop := c.params["qop"]
+		useQop := false
+		if hasQop {
+			for _, q := range strings.Split(qop, ",") {
+				if strings.TrimSpace(q) == "auth" {
+					useQop = true
+				}
+			}
+			if !useQop {
+				continue // only auth-int offered
+			}
+		}
+		if rank > bestRank {
+			bestRank = rank
+			best = &digestSpace{
+				realm:     c.params["realm"],
+				nonce:     c.params["nonce"],
+				opaque:    c.params["opaque"],
+				algorithm: alg,
+				qop:       useQop,
+			}
+		}
+	}
+	return best
+}
+
+// authorization returns the Authorization header value for req in sp,
+// with the client nonce cnonce.
+func (a *DigestAuth) authorization(sp *digestSpace, req *Request, cnonce string) string {
+	alg := strings.ToUpper(sp.algorithm)
+	var h func() hash.Hash
+	if strings.HasPrefix(alg, "SHA-256") {
+		h = sha256.New
+	} else {
+		h = md5.New
+	}
+	digest := func(parts ...string) string {
+		d := h()
+		io.WriteString(d, strings.Join(parts, ":"))
+		return hex.EncodeToString(d.Sum(nil))
+	}
+
+	uri := req.URL.RequestURI()
+	nc := fmt.Sprintf("%08x", sp.nc)
+	ha1 := digest(a.Username, sp.realm, a.Password)
+	if strings.HasSuffix(alg, "-SESS") {
+		ha1 = digest(ha1, sp.nonce, cnonce)
+	}
+	ha2 := digest(req.Method, uri)
+	var response string
+	if sp.qop {
+		response = digest(ha1, sp.nonce, nc, cnonce, "auth", ha2)
+	} else {
+		response = digest(ha1, sp.nonce, ha2)
+	}
+
+	s := fmt.Sprintf(`Digest username=%s, realm=%s, nonce=%s, uri=%s, response="%s"`,
+		quote(a.Username), quote(sp.realm), quote(sp.nonce), quote(uri), response)
+	if sp.algorithm != "" {
+		s += ", algorithm=" + sp.algorithm
+	}
+	if sp.opaque != "" {
+		s += ", opaque=" + quote(sp.opaque)
+	}
+	if sp.qop {
+		s += fmt.Sprintf(`, qop=auth, nc=%s, cnonce="%s"`, nc, cnonce)
+	}
+	return s
+}
+
+// quote returns s as a quoted string.
+func quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func newCnonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,362 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http_test
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	. "net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// digestServer is a handler that requires Digest authentication.
+type digestServer struct {
+	realm      string
+	algorithms []string // offered, in order; "" for none
+	qop        string   // qop parameter, or "" for RFC 2069
+	user, pass string
+
+	mu         sync.Mutex
+	nonce      int
+	lastNC     map[string]string // last nonce count seen, by nonce
+	challenges int
+	stale      bool // rotate the nonce after each success
+}
+
+var authParamRE = regexp.MustCompile(`(\w+)=("([^"\\]|\\.)*"|[^,\s]*)`)
+
+func parseAuthorization(s string) map[string]string {
+	m := make(map[string]string)
+	if !strings.HasPrefix(s, "Digest ") {
+		return m
+	}
+	for _, kv := range authParamRE.FindAllStringSubmatch(s[len("Digest "):], -1) {
+		v := kv[2]
+		if strings.HasPrefix(v, `"`) {
+			v = strings.Replace(v[1:len(v)-1], `\"`, `"`, -1)
+		}
+		m[kv[1]] = v
+	}
+	return m
+}
+
+func (s *digestServer) ServeHTTP(w ResponseWriter, r *Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	nonce := fmt.Sprint("nonce", s.nonce)
+	p := parseAuthorization(r.Header.Get("Authorization"))
+	stale := false
+	if p["response"] != "" {
+		ok, isStale := s.check(r, p, nonce)
+		if ok {
+			if s.stale {
+				s.nonce++
+			}
+			fmt.Fprintf(w, "hello %s, nc=%s, alg=%s", p["username"], p["nc"], p["algorithm"])
+			return
+		}
+		stale = isStale
+	}
+	s.challenges++
+	w.Header().Add("WWW-Authenticate", `Basic realm="basic"`)
+	for _, alg := range s.algorithms {
+		c := fmt.Sprintf(`Digest realm="%s", nonce="%s", opaque="op,aque"`, s.realm, nonce)
+		if s.qop != "" {
+			c += `, qop="` + s.qop + `"`
+		}
+		if alg != "" {
+			c += ", algorithm=" + alg
+		}
+		if stale {
+			c += ", stale=true"
+		}
+		w.Header().Add("WWW-Authenticate", c)
+	}
+	w.WriteHeader(StatusUnauthorized)
+	io.WriteString(w, "unauthorized")
+}
+
+// check verifies the credentials p, reporting whether they are valid
+// and whether they are only invalid for using an old nonce.
+func (s *digestServer) check(r *Request, p map[string]string, nonce string) (ok, stale bool) {
+	var h func() hash.Hash
+	switch strings.ToUpper(p["algorithm"]) {
+	case "", "MD5", "MD5-SESS":
+		h = md5.New
+	case "SHA-256", "SHA-256-SESS":
+		h = sha256.New
+	default:
+		return false, false
+	}
+	digest := func(parts ...string) string {
+		d := h()
+		io.WriteString(d, strings.Join(parts, ":"))
+		return hex.EncodeToString(d.Sum(nil))
+	}
+	if p["uri"] != r.URL.RequestURI() || p["realm"] != s.realm || p["opaque"] != "op,aque" {
+		return false, false
+	}
+	ha1 := digest(s.user, s.realm, s.pass)
+	if strings.HasSuffix(strings.ToUpper(p["algorithm"]), "-SESS") {
+		ha1 = digest(ha1, p["nonce"], p["cnonce"])
+	}
+	ha2 := digest(r.Method, p["uri"])
+	var want string
+	if s.qop != "" {
+		if p["qop"] != "auth" || p["nc"] <= s.lastNC[p["nonce"]] {
+			return false, false
+		}
+		s.lastNC[p["nonce"]] = p["nc"]
+		want = digest(ha1, p["nonce"], p["nc"], p["cnonce"], "auth", ha2)
+	} else {
+		want = digest(ha1, p["nonce"], ha2)
+	}
+	if p["response"] != want || p["username"] != s.user {
+		return false, false
+	}
+	if p["nonce"] != nonce {
+		return false, true
+	}
+	return true, false
+}
+
+func newDigestServer(algorithms ...string) *digestServer {
+	return &digestServer{
+		realm:      "test, realm",
+		algorithms: algorithms,
+		qop:        "auth,auth-int",
+		user:       "gopher",
+		pass:       "s3cr\"t",
+		lastNC:     make(map[string]string),
+	}
+}
+
+func authGet(t *testing.T, c *Client, method, url string, body io.Reader) (int, string) {
+	req, _ := NewRequest(method, url, body)
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, _ := ioutil.ReadAll(res.Body)
+	return res.StatusCode, string(b)
+}
+
+func TestDigestAuth(t *testing.T) {
+	tests := []struct {
+		algorithms []string
+		qop        string
+		wantAlg    string
+	}{
+		{[]string{""}, "auth", ""},
+		{[]string{"MD5"}, "auth", "MD5"},
+		{[]string{"MD5-sess"}, "auth", "MD5-sess"},
+		{[]string{"MD5", "SHA-256"}, "auth", "SHA-256"},
+		{[]string{"SHA-256-sess", "MD5"}, "auth", "SHA-256-sess"},
+		{[]string{"MD5"}, "", "MD5"},
+	}
+	for _, tt := range tests {
+		ds := newDigestServer(tt.algorithms...)
+		ds.qop = tt.qop
+		ts := httptest.NewServer(ds)
+		c := &Client{Auth: NewDigestAuth("gopher", "s3cr\"t")}
+
+		for i := 1; i <= 3; i++ {
+			code, body := authGet(t, c, "GET", ts.URL+"/path?q=1", nil)
+			want := fmt.Sprintf("hello gopher, nc=%08x, alg=%s", i, tt.wantAlg)
+			if tt.qop == "" {
+				want = "hello gopher, nc=, alg=" + tt.wantAlg
+			}
+			if code != 200 || body != want {
+				t.Errorf("%v qop %q: request %d = %d %q; want 200 %q", tt.algorithms, tt.qop, i, code, body, want)
+			}
+		}
+		if ds.challenges != 1 {
+			t.Errorf("%v: %d challenges; want 1", tt.algorithms, ds.challenges)
+		}
+		ts.Close()
+	}
+}
+
+func TestDigestAuthRequestUnchanged(t *testing.T) {
+	ts := httptest.NewServer(newDigestServer("MD5"))
+	defer ts.Close()
+	c := &Client{Auth: NewDigestAuth("gopher", "s3cr\"t")}
+
+	req, _ := NewRequest("GET", ts.URL, nil)
+	req.Header.Set("X-Test", "1")
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Errorf("status = %d; want 200", res.StatusCode)
+	}
+	if a := req.Header.Get("Authorization"); a != "" {
+		t.Errorf("caller's request got Authorization %q", a)
+	}
+	if len(req.Header) != 1 {
+		t.Errorf("caller's request header = %v; want only X-Test", req.Header)
+	}
+}
+
+func TestDigestAuthStaleNonce(t *testing.T) {
+	ds := newDigestServer("MD5")
+	ds.stale = true
+	ts := httptest.NewServer(ds)
+	defer ts.Close()
+	c := &Client{Auth: NewDigestAuth("gopher", "s3cr\"t")}
+
+	for i := 0; i < 3; i++ {
+		if code, body := authGet(t, c, "GET", ts.URL, nil); code != 200 {
+			t.Errorf("request %d = %d %q", i, code, body)
+		}
+	}
+	if ds.challenges != 3 {
+		t.Errorf("%d challenges; want 3", ds.challenges)
+	}
+}
+
+func TestDigestAuthFailures(t *testing.T) {
+	ds := newDigestServer("MD5")
+	ts := httptest.NewServer(ds)
+	defer ts.Close()
+
+	c := &Client{Auth: NewDigestAuth("gopher", "wrong")}
+	if code, body := authGet(t, c, "GET", ts.URL, nil); code != 401 || body != "unauthorized" {
+		t.Errorf("wrong password: got %d %q; want 401", code, body)
+	}
+	if ds.challenges != 2 {
+		t.Errorf("wrong password: %d challenges; want 2", ds.challenges)
+	}
+
+	// A request with a body can't be sent again, but once the
+	// client knows the nonce it is authenticated at once.
+	c = &Client{Auth: NewDigestAuth("gopher", "s3cr\"t")}
+	if code, _ := authGet(t, c, "POST", ts.URL, strings.NewReader("data")); code != 401 {
+		t.Errorf("first POST: got %d; want 401", code)
+	}
+	if code, body := authGet(t, c, "POST", ts.URL, strings.NewReader("data")); code != 200 {
+		t.Errorf("second POST: got %d %q; want 200", code, body)
+	}
+
+	// Servers that don't offer Digest get no answer.
+	ds.algorithms = []string{"UNKNOWN"}
+	c = &Client{Auth: NewDigestAuth("gopher", "s3cr\"t")}
+	before := ds.challenges
+	if code, _ := authGet(t, c, "GET", ts.URL, nil); code != 401 {
+		t.Errorf("unknown algorithm: got %d; want 401", code)
+	}
+	if n := ds.challenges - before; n != 1 {
+		t.Errorf("unknown algorithm: %d challenges; want 1", n)
+	}
+}
+
+func TestDigestAuthOverridesURLCredentials(t *testing.T) {
+	ts := httptest.NewServer(newDigestServer("MD5"))
+	defer ts.Close()
+	c := &Client{Auth: NewDigestAuth("gopher", "s3cr\"t")}
+
+	url := strings.Replace(ts.URL, "http://", "http://someone:else@", 1)
+	for i := 0; i < 2; i++ {
+		req, _ := NewRequest("GET", url, nil)
+		res, err := c.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != 200 {
+			t.Errorf("request %d: status = %d; want 200", i, res.StatusCode)
+		}
+		if req.URL.User == nil {
+			t.Errorf("request %d: credentials removed from the caller's URL", i)
+		}
+	}
+}
+
+func TestDigestAuthCrossHostRedirect(t *testing.T) {
+	var mu sync.Mutex
+	var sent []string
+	ds := newDigestServer("MD5")
+	other := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		mu.Lock()
+		sent = append(sent, r.Header.Get("Authorization"))
+		mu.Unlock()
+		ds.ServeHTTP(w, r)
+	}))
+	defer other.Close()
+	origin := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		Redirect(w, r, other.URL+"/secret", StatusFound)
+	}))
+	defer origin.Close()
+
+	c := &Client{Auth: NewDigestAuth("gopher", "s3cr\"t")}
+	if code, _ := authGet(t, c, "GET", origin.URL, nil); code != 401 {
+		t.Errorf("cross-host redirect: status = %d; want 401", code)
+	}
+	for i, a := range sent {
+		if a != "" {
+			t.Errorf("request %d to the other host got Authorization %q", i, a)
+		}
+	}
+
+	a := NewDigestAuth("gopher", "s3cr\"t")
+	a.Hosts = []string{origin.Listener.Addr().String(), other.Listener.Addr().String()}
+	c = &Client{Auth: a}
+	if code, body := authGet(t, c, "GET", origin.URL, nil); code != 200 {
+		t.Errorf("redirect to a listed host: got %d %q; want 200", code, body)
+	}
+}
+
+// Known-answer tests from RFC 2617, section 3.5, and RFC 7616,
+// section 3.9.1.
+var digestVectorTests = []struct {
+	username, password, realm, nonce, opaque, algorithm, cnonce string
+	response                                                    string
+}{
+	{
+		"Mufasa", "Circle Of Life", "testrealm@host.com",
+		"dcd98b7102dd2f0e8b11d0f600bfb0c093", "5ccc069c403ebaf9f0171e9517f40e41", "",
+		"0a4f113b",
+		"6629fae49393a05397450978507c4ef1",
+	},
+	{
+		"Mufasa", "Circle of Life", "http-auth@example.org",
+		"7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS", "MD5",
+		"f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ",
+		"8ca523f5e9506fed4657c9700eebdbec",
+	},
+	{
+		"Mufasa", "Circle of Life", "http-auth@example.org",
+		"7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS", "SHA-256",
+		"f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ",
+		"753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1",
+	},
+}
+
+func TestDigestAuthVectors(t *testing.T) {
+	for _, tt := range digestVectorTests {
+		req, _ := NewRequest("GET", "http://www.example.org/dir/index.html", nil)
+		a := NewDigestAuth(tt.username, tt.password)
+		h := DigestAuthorizationForTesting(a, req, tt.realm, tt.nonce, tt.opaque, tt.algorithm, tt.cnonce)
+		p := parseAuthorization(h)
+		if p["response"] != tt.response {
+			t.Errorf("%s %q: response = %q; want %q", tt.realm, tt.algorithm, p["response"], tt.response)
+		}
+		if p["nc"] != "00000001" || p["cnonce"] != tt.cnonce || p["uri"] != "/dir/index.html" {
+			t.Errorf("%s %q: Authorization = %s", tt.realm, tt.algorithm, h)
+		}
+	}
+}
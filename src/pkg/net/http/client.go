@@ -14,6 +14,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"net/url"
 	"strings"
@@ -48,6 +49,18 @@ type Client struct {
 	// If Jar is nil, cookies are not sent in requests and ignored
 	// in responses.
 	Jar CookieJar
+
+	// Auth specifies the authentication policy.
+	// If Auth is not nil, the client calls its Authenticate method
+	// before sending each request and, if the response is a 401
+	// Unauthorized with a WWW-Authenticate header, calls it again
+	// with the response; if it returns true, the request is sent
+	// once more, and the response to that is returned. Requests
+	// with a body are not sent again, since the body has been
+	// consumed, but the challenge may let Auth authenticate later
+	// requests at once. Credentials in the URL are not used if
+	// Auth sets an Authorization header.
+	Auth Authenticator
 }
 
 // DefaultClient is the default Client and is used by Get, Head, and Post.
@@ -93,6 +106,22 @@ func (c *Client) send(req *Request) (*Response, error) {
 			req.AddCookie(cookie)
 		}
 	}
+	canResend := req.Body == nil
+	if c.Auth != nil {
+		// Authenticate a copy, so that the Authorization header
+		// doesn't stick to the caller's request.
+		r := new(Request)
+		*r = *req
+		r.Header = make(Header)
+		for k, vv := range req.Header {
+			r.Header[k] = append([]string(nil), vv...)
+		}
+		u := *req.URL
+		r.URL = &u
+		req = r
+		c.Auth.Authenticate(req, nil)
+		dropURLCredentials(req)
+	}
 	resp, err := send(req, c.Transport)
 	if err != nil {
 		return nil, err
@@ -100,9 +129,33 @@ func (c *Client) send(req *Request) (*Response, error) {
 	if c.Jar != nil {
 		c.Jar.SetCookies(req.URL, resp.Cookies())
 	}
+	if c.Auth != nil && resp.StatusCode == StatusUnauthorized &&
+		resp.Header.Get("Www-Authenticate") != "" && c.Auth.Authenticate(req, resp) && canResend {
+		dropURLCredentials(req)
+		// Read a little of the body so that the connection may
+		// be reused.
+		io.CopyN(ioutil.Discard, resp.Body, 2<<10)
+		resp.Body.Close()
+		resp, err = send(req, c.Transport)
+		if err != nil {
+			return nil, err
+		}
+		if c.Jar != nil {
+			c.Jar.SetCookies(req.URL, resp.Cookies())
+		}
+	}
 	return resp, err
 }
 
+// dropURLCredentials removes the credentials from the URL of req, a
+// copy of the caller's request, if an Authenticator set its
+// Authorization header, so that they don't override it.
+func dropURLCredentials(req *Request) {
+	if req.URL.User != nil && req.Header.Get("Authorization") != "" {
+		req.URL.User = nil
+	}
+}
+
 // Do sends an HTTP request and returns an HTTP response, following
 // policy (e.g. redirects, cookies, auth) as configured on the client.
 //
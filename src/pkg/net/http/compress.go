@@ -0,0 +1,323 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// CompressHandler returns a handler that serves HTTP requests by
+// invoking the handler h and compressing its response body with gzip
+// or deflate, as negotiated by the request's Accept-Encoding header.
+//
+// The response is sent uncompressed if the client accepts neither
+// coding, if h sets its own Content-Encoding, if the status does not
+// allow a body or is 206 Partial Content, if h writes no body, or if
+// the Content-Type, as set by h or detected by DetectContentType from
+// the first written block of data, is already compressed (such as
+// most images, audio and video, and archives). Compressed responses
+// have no Content-Length or Accept-Ranges header, and a strong ETag
+// set by h is made weak. Every response that might have been
+// compressed lists Accept-Encoding in its Vary header.
+//
+// The ResponseWriter passed to h implements Flusher, flushing any
+// pending compressed output, and implements Hijacker and
+// CloseNotifier if the underlying ResponseWriter does.
+func CompressHandler(h Handler) Handler {
+	return &compressHandler{h}
+}
+
+type compressHandler struct {
+	handler Handler
+}
+
+func (h *compressHandler) ServeHTTP(w ResponseWriter, r *Request) {
+	cw := &compressWriter{
+		w:        w,
+		encoding: acceptedEncoding(r.Header.get("Accept-Encoding")),
+	}
+	if r.Method == "HEAD" {
+		// There is no body to sniff; decide from the header alone
+		// so that HEAD responses match their GET counterparts.
+		cw.head = true
+	}
+	defer cw.close()
+
+	var rw ResponseWriter = cw
+	_, isHijacker := w.(Hijacker)
+	_, isCloseNotifier := w.(CloseNotifier)
+	switch {
+	case isHijacker && isCloseNotifier:
+		rw = compressHijackCloseNotifier{cw}
+	case isHijacker:
+		rw = compressHijacker{cw}
+	case isCloseNotifier:
+		rw = compressCloseNotifier{cw}
+	}
+	h.handler.ServeHTTP(rw, r)
+}
+
+// acceptedEncoding returns the content coding, "gzip" or "deflate",
+// to use for a request with the given Accept-Encoding header, or ""
+// if neither is acceptable. When both are equally acceptable, gzip
+// is preferred.
+func acceptedEncoding(accept string) string {
+	best, bestq := "", 0.0
+	for _, coding := range []string{"gzip", "deflate"} {
+		if q := acceptEncodingQ(accept, coding); q > bestq {
+			best, bestq = coding, q
+		}
+	}
+	return best
+}
+
+// acceptEncodingQ returns the quality value that the Accept-Encoding
+// header value accept gives to coding, either directly or through
+// "*". A quality of zero means that coding is not acceptable.
+func acceptEncodingQ(accept, coding string) float64 {
+	q, starq := -1.0, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		c := strings.ToLower(strings.TrimSpace(params[0]))
+		if c != coding && c != "*" {
+			continue
+		}
+		qv := 1.0
+		for _, p := range params[1:] {
+			p = strings.TrimSpace(p)
+			if len(p) > 2 && (p[0] == 'q' || p[0] == 'Q') && p[1] == '=' {
+				if f, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					qv = f
+				}
+			}
+		}
+		if c == coding {
+			q = qv
+		} else {
+			starq = qv
+		}
+	}
+	if q < 0 {
+		return starq
+	}
+	return q
+}
+
+// incompressibleType reports whether content of type ct is usually
+// compressed already, so that compressing it again would waste time.
+func incompressibleType(ct string) bool {
+	if i := strings.Index(ct, ";"); i != -1 {
+		ct = ct[:i]
+	}
+	ct = strings.ToLower(strings.TrimSpace(ct))
+	switch {
+	case ct == "image/svg+xml", ct == "image/bmp", ct == "image/vnd.microsoft.icon":
+		return false
+	case strings.HasPrefix(ct, "image/"),
+		strings.HasPrefix(ct, "audio/"),
+		strings.HasPrefix(ct, "video/"):
+		return true
+	}
+	switch ct {
+	case "application/ogg",
+		"application/pdf",
+		"application/x-gzip",
+		"application/x-rar-compressed",
+		"application/zip":
+		return true
+	}
+	return false
+}
+
+// varies reports whether the Vary header in h already lists the
+// lowercase header name field, or "*".
+func varies(h Header, field string) bool {
+	for _, v := range h["Vary"] {
+		if hasToken(v, field) || strings.TrimSpace(v) == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// compressWriter is the ResponseWriter passed to the handler by
+// CompressHandler. The choice to compress is made when the first
+// body data is written or the response is flushed, so that the
+// Content-Type can be sniffed; until then a status passed to
+// WriteHeader is held back.
+type compressWriter struct {
+	w        ResponseWriter
+	encoding string // negotiated coding, or "" for none
+	head     bool   // request method is HEAD
+
+	status   int  // status passed to WriteHeader, or 0
+	empty    bool // the handler returned without writing a body
+	started  bool // underlying WriteHeader has been called
+	hijacked bool
+	cw       compressor // nil if not compressing
+}
+
+func (w *compressWriter) Header() Header {
+	return w.w.Header()
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.status != 0 || w.started {
+		return
+	}
+	w.status = code
+	if w.head || !bodyAllowedForStatus(code) {
+		w.start(nil)
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.start(p)
+	}
+	if w.cw != nil {
+		return w.cw.Write(p)
+	}
+	return w.w.Write(p)
+}
+
+// start decides whether to compress the response, using p, the
+// first block of the body, to sniff its type, and writes the header
+// to the underlying ResponseWriter.
+func (w *compressWriter) start(p []byte) {
+	w.started = true
+	if w.status == 0 {
+		w.status = StatusOK
+	}
+	h := w.w.Header()
+	if h.get("Content-Encoding") == "" && bodyAllowedForStatus(w.status) &&
+		w.status != StatusPartialContent {
+		if !varies(h, "accept-encoding") {
+			h.Add("Vary", "Accept-Encoding")
+		}
+		compress := w.encoding != "" && !w.empty
+		ct := h.get("Content-Type")
+		if compress && ct == "" && !w.head {
+			// Sniff now: the server would otherwise sniff the
+			// compressed bytes.
+			ct = DetectContentType(p)
+			h.Set("Content-Type", ct)
+		}
+		if compress && !incompressibleType(ct) {
+			h.Set("Content-Encoding", w.encoding)
+			h.Del("Content-Length")
+			// Ranges would apply to the encoded bytes, but
+			// range requests are served unencoded.
+			h.Del("Accept-Ranges")
+			if etag := h.get("Etag"); strings.HasPrefix(etag, `"`) {
+				// The encoded bytes are a different
+				// representation from the one the strong
+				// validator identified.
+				h.Set("Etag", "W/"+etag)
+			}
+			if !w.head {
+				if w.encoding == "gzip" {
+					w.cw = gzip.NewWriter(w.w)
+				} else {
+					w.cw = zlib.NewWriter(w.w)
+				}
+			}
+		}
+	}
+	w.w.WriteHeader(w.status)
+}
+
+// Flush writes any buffered compressed data and flushes the
+// underlying ResponseWriter, if it implements Flusher.
+func (w *compressWriter) Flush() {
+	if w.hijacked {
+		return
+	}
+	if !w.started {
+		w.start(nil)
+	}
+	if w.cw != nil {
+		w.cw.Flush()
+	}
+	if f, ok := w.w.(Flusher); ok {
+		f.Flush()
+	}
+}
+
+// compressor is implemented by *gzip.Writer and *zlib.Writer.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// close finishes the compressed stream after the handler returns.
+func (w *compressWriter) close() {
+	if w.hijacked {
+		return
+	}
+	if !w.started {
+		if w.status == 0 {
+			// Nothing was written; leave the default response
+			// to the underlying ResponseWriter.
+			return
+		}
+		// Only a status was written; an empty body is sent
+		// uncompressed.
+		w.empty = true
+		w.start(nil)
+	}
+	if w.cw != nil {
+		w.cw.Close()
+	}
+}
+
+func (w *compressWriter) hijack() (net.Conn, *bufio.ReadWriter, error) {
+	c, brw, err := w.w.(Hijacker).Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return c, brw, err
+}
+
+func (w *compressWriter) closeNotify() <-chan bool {
+	return w.w.(CloseNotifier).CloseNotify()
+}
+
+// The following types add the optional interfaces implemented by the
+// underlying ResponseWriter to a compressWriter.
+
+type compressHijacker struct {
+	*compressWriter
+}
+
+func (w compressHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.hijack()
+}
+
+type compressCloseNotifier struct {
+	*compressWriter
+}
+
+func (w compressCloseNotifier) CloseNotify() <-chan bool {
+	return w.closeNotify()
+}
+
+type compressHijackCloseNotifier struct {
+	*compressWriter
+}
+
+func (w compressHijackCloseNotifier) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.hijack()
+}
+
+func (w compressHijackCloseNotifier) CloseNotify() <-chan bool {
+	return w.closeNotify()
+}
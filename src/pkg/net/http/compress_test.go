@@ -0,0 +1,292 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package http_test
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	. "net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var acceptedEncodingTests = []struct {
+	accept, want string
+}{
+	{"", ""},
+	{"identity", ""},
+	{"gzip", "gzip"},
+	{"GZIP", "gzip"},
+	{"deflate", "deflate"},
+	{"gzip, deflate", "gzip"},
+	{"deflate, gzip", "gzip"},
+	{"gzip;q=0.5, deflate", "deflate"},
+	{"gzip;q=0, deflate;q=0", ""},
+	{"*", "gzip"},
+	{"*;q=0.1, gzip;q=0", "deflate"},
+	{"compress, br", ""},
+}
+
+func TestAcceptedEncoding(t *testing.T) {
+	for _, tt := range acceptedEncodingTests {
+		if got := AcceptedEncodingForTesting(tt.accept); got != tt.want {
+			t.Errorf("acceptedEncoding(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+var pngHeader = "\x89PNG\x0D\x0A\x1A\x0A\x00\x00\x00\x0DIHDR"
+
+var compressHandlerTests = []struct {
+	name        string
+	accept      string
+	contentType string // set by the handler if non-empty
+	body        string
+	code        int
+
+	wantEncoding string
+	wantVary     bool
+	wantType     string
+}{
+	{"gzip text", "gzip", "", "<html>hello</html>", 200, "gzip", true, "text/html; charset=utf-8"},
+	{"deflate text", "deflate", "text/css", "body { color: red }", 200, "deflate", true, "text/css"},
+	{"no accept", "", "", "hello, world", 200, "", true, "text/plain; charset=utf-8"},
+	{"sniffed png", "gzip", "", pngHeader, 200, "", true, "image/png"},
+	{"declared jpeg", "gzip", "image/jpeg", "not really a jpeg", 200, "", true, "image/jpeg"},
+	{"svg", "gzip", "image/svg+xml", "<svg/>", 200, "gzip", true, "image/svg+xml"},
+	{"not modified", "gzip", "", "", 304, "", false, ""},
+	{"no content", "gzip", "", "", 204, "", false, ""},
+	{"not found", "gzip", "", "no such page", 404, "gzip", true, "text/plain; charset=utf-8"},
+}
+
+func TestCompressHandler(t *testing.T) {
+	for _, tt := range compressHandlerTests {
+		tt := tt
+		ts := httptest.NewServer(CompressHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+			if tt.contentType != "" {
+				w.Header().Set("Content-Type", tt.contentType)
+			}
+			if tt.code == 200 {
+				// Must be removed when compressing.
+				w.Header().Set("Content-Length", strconv.Itoa(len(tt.body)))
+			}
+			w.WriteHeader(tt.code)
+			io.WriteString(w, tt.body)
+		})))
+		res := compressGet(t, ts.URL, tt.accept)
+		ts.Close()
+
+		if res.StatusCode != tt.code {
+			t.Errorf("%s: status = %d, want %d", tt.name, res.StatusCode, tt.code)
+		}
+		if got := res.Header.Get("Content-Encoding"); got != tt.wantEncoding {
+			t.Errorf("%s: Content-Encoding = %q, want %q", tt.name, got, tt.wantEncoding)
+		}
+		if got := res.Header.Get("Vary") == "Accept-Encoding"; got != tt.wantVary {
+			t.Errorf("%s: Vary = %q, want set = %v", tt.name, res.Header.Get("Vary"), tt.wantVary)
+		}
+		if tt.wantType != "" && res.Header.Get("Content-Type") != tt.wantType {
+			t.Errorf("%s: Content-Type = %q, want %q", tt.name, res.Header.Get("Content-Type"), tt.wantType)
+		}
+		var body io.Reader = res.Body
+		switch tt.wantEncoding {
+		case "gzip":
+			if res.ContentLength != -1 {
+				t.Errorf("%s: ContentLength = %d, want -1", tt.name, res.ContentLength)
+			}
+			zr, err := gzip.NewReader(res.Body)
+			if err != nil {
+				t.Errorf("%s: gzip.NewReader: %v", tt.name, err)
+				res.Body.Close()
+				continue
+			}
+			body = zr
+		case "deflate":
+			zr, err := zlib.NewReader(res.Body)
+			if err != nil {
+				t.Errorf("%s: zlib.NewReader: %v", tt.name, err)
+				res.Body.Close()
+				continue
+			}
+			body = zr
+		}
+		got, err := ioutil.ReadAll(body)
+		res.Body.Close()
+		if err != nil || string(got) != tt.body {
+			t.Errorf("%s: body = %q, %v; want %q", tt.name, got, err, tt.body)
+		}
+	}
+}
+
+// compressGet fetches url with the given Accept-Encoding, without
+// the Transport's own decompression.
+func compressGet(t *testing.T, url, accept string) *Response {
+	req, _ := NewRequest("GET", url, nil)
+	if accept != "" {
+		req.Header.Set("Accept-Encoding", accept)
+	}
+	tr := &Transport{DisableCompression: true}
+	res, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatalf("RoundTrip: %v", err)
+	}
+	return res
+}
+
+func TestCompressHandlerKeepsEncoding(t *testing.T) {
+	ts := httptest.NewServer(CompressHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Content-Encoding", "x-custom")
+		io.WriteString(w, "already encoded")
+	})))
+	defer ts.Close()
+	res := compressGet(t, ts.URL, "gzip")
+	defer res.Body.Close()
+	if got := res.Header.Get("Content-Encoding"); got != "x-custom" {
+		t.Errorf("Content-Encoding = %q, want x-custom", got)
+	}
+	if got, _ := ioutil.ReadAll(res.Body); string(got) != "already encoded" {
+		t.Errorf("body = %q", got)
+	}
+}
+
+func TestCompressHandlerVaryAndETag(t *testing.T) {
+	tests := []struct {
+		accept, etag string
+		wantETag     string
+	}{
+		{"gzip", `"abc"`, `W/"abc"`},
+		{"gzip", `W/"abc"`, `W/"abc"`},
+		{"", `"abc"`, `"abc"`},
+	}
+	for _, tt := range tests {
+		etag := tt.etag
+		ts := httptest.NewServer(CompressHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+			w.Header().Set("Vary", "Cookie, accept-encoding")
+			w.Header().Set("ETag", etag)
+			io.WriteString(w, "hello, world")
+		})))
+		res := compressGet(t, ts.URL, tt.accept)
+		res.Body.Close()
+		ts.Close()
+		if got := res.Header["Vary"]; len(got) != 1 || got[0] != "Cookie, accept-encoding" {
+			t.Errorf("Accept-Encoding %q: Vary = %q, want one unchanged value", tt.accept, got)
+		}
+		if got := res.Header.Get("ETag"); got != tt.wantETag {
+			t.Errorf("Accept-Encoding %q, ETag %s: got ETag %s, want %s", tt.accept, tt.etag, got, tt.wantETag)
+		}
+	}
+}
+
+func TestCompressHandlerAcceptRanges(t *testing.T) {
+	ts := httptest.NewServer(CompressHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		io.WriteString(w, "hello, world")
+	})))
+	defer ts.Close()
+	for _, accept := range []string{"gzip", ""} {
+		res := compressGet(t, ts.URL, accept)
+		res.Body.Close()
+		compressed := res.Header.Get("Content-Encoding") != ""
+		if got := res.Header.Get("Accept-Ranges") != ""; got == compressed {
+			t.Errorf("Accept-Encoding %q: Content-Encoding %q with Accept-Ranges %q",
+				accept, res.Header.Get("Content-Encoding"), res.Header.Get("Accept-Ranges"))
+		}
+	}
+}
+
+func TestCompressHandlerEmptyBody(t *testing.T) {
+	ts := httptest.NewServer(CompressHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.WriteHeader(StatusOK)
+	})))
+	defer ts.Close()
+	res := compressGet(t, ts.URL, "gzip")
+	defer res.Body.Close()
+	if got := res.Header.Get("Content-Encoding"); got != "" {
+		t.Errorf("Content-Encoding = %q; want none", got)
+	}
+	if got, err := ioutil.ReadAll(res.Body); len(got) != 0 || err != nil {
+		t.Errorf("body = %q, %v; want empty", got, err)
+	}
+}
+
+func TestCompressHandlerFlush(t *testing.T) {
+	proceed := make(chan bool)
+	ts := httptest.NewServer(CompressHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, "first\n")
+		w.(Flusher).Flush()
+		<-proceed
+		io.WriteString(w, "second\n")
+	})))
+	defer ts.Close()
+	res := compressGet(t, ts.URL, "gzip")
+	defer res.Body.Close()
+	zr, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(zr)
+	// The first line must arrive before the handler finishes.
+	if line, err := br.ReadString('\n'); line != "first\n" || err != nil {
+		t.Fatalf("first line = %q, %v", line, err)
+	}
+	proceed <- true
+	if line, err := br.ReadString('\n'); line != "second\n" || err != nil {
+		t.Fatalf("second line = %q, %v", line, err)
+	}
+}
+
+func TestCompressHandlerInterfaces(t *testing.T) {
+	type result struct{ hijacker, closeNotifier bool }
+	got := make(chan result, 1)
+	h := CompressHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+		_, hj := w.(Hijacker)
+		_, cn := w.(CloseNotifier)
+		got <- result{hj, cn}
+	}))
+
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	res, err := Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if r := <-got; !r.hijacker || !r.closeNotifier {
+		t.Errorf("server ResponseWriter: Hijacker = %v, CloseNotifier = %v; want both", r.hijacker, r.closeNotifier)
+	}
+
+	req, _ := NewRequest("GET", "/", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if r := <-got; r.hijacker || r.closeNotifier {
+		t.Errorf("ResponseRecorder: Hijacker = %v, CloseNotifier = %v; want neither", r.hijacker, r.closeNotifier)
+	}
+}
+
+func TestCompressHandlerHijack(t *testing.T) {
+	ts := httptest.NewServer(CompressHandler(HandlerFunc(func(w ResponseWriter, r *Request) {
+		conn, bufrw, err := w.(Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+		bufrw.WriteString("HTTP/1.0 200 OK\r\n\r\nraw")
+		bufrw.Flush()
+	})))
+	defer ts.Close()
+	res := compressGet(t, ts.URL, "gzip")
+	defer res.Body.Close()
+	if got, _ := ioutil.ReadAll(res.Body); string(got) != "raw" {
+		t.Errorf("body = %q, want %q", got, "raw")
+	}
+	if strings.Contains(res.Header.Get("Content-Encoding"), "gzip") {
+		t.Errorf("hijacked response has Content-Encoding gzip")
+	}
+}
@@ -48,3 +48,20 @@ func NewTestTimeoutHandler(handler Handler, ch <-chan time.Time) Handler {
 	}
 	return &timeoutHandler{handler, f, ""}
 }
+
+func AcceptedEncodingForTesting(accept string) string {
+	return acceptedEncoding(accept)
+}
+
+const MaxContentHashes = maxContentHashes
+
+func (h *FileHandler) ContentHashCountForTesting() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.hashes)
+}
+
+func DigestAuthorizationForTesting(a *DigestAuth, req *Request, realm, nonce, opaque, algorithm, cnonce string) string {
+	sp := &digestSpace{realm: realm, nonce: nonce, opaque: opaque, algorithm: algorithm, qop: true, nc: 1}
+	return a.authorization(sp, req, cnonce)
+}
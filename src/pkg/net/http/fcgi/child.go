@@ -7,41 +7,75 @@ package fcgi
 // This file implements FastCGI from the perspective of a child process.
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"net/http/cgi"
 	"os"
+	"strconv"
+	"sync"
 	"time"
 )
 
-// request holds the state for an in-progress request. As soon as it's complete,
-// it's converted to an http.Request.
+// request holds the state for an in-progress request. As soon as its
+// parameters are complete, it's converted to an http.Request.
 type request struct {
-	pw        *io.PipeWriter
 	reqId     uint16
+	role      uint16
 	params    map[string]string
 	buf       [1024]byte
 	rawParams []byte
 	keepConn  bool
+
+	stdin *stream // request body
+	data  *stream // data stream of the Filter role
+
+	started bool // its parameters are complete and it is being served
+
+	mu      sync.Mutex
+	aborted bool
 }
 
-func newRequest(reqId uint16, flags uint8) *request {
+func newRequest(reqId uint16, role uint16, flags uint8) *request {
 	r := &request{
 		reqId:    reqId,
+		role:     role,
 		params:   map[string]string{},
 		keepConn: flags&flagKeepConn != 0,
+		stdin:    newStream(),
+		data:     newStream(),
 	}
 	r.rawParams = r.buf[:0]
 	return r
 }
 
+// abort marks r as aborted, ending its input streams with err.
+func (r *request) abort(err error) {
+	r.mu.Lock()
+	r.aborted = true
+	r.mu.Unlock()
+	r.stdin.closeWithError(err)
+	r.data.closeWithError(err)
+}
+
+func (r *request) isAborted() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.aborted
+}
+
 // parseParams reads an encoded []byte into Params.
 func (r *request) parseParams() {
-	text := r.rawParams
+	parsePairs(r.params, r.rawParams)
 	r.rawParams = nil
+}
+
+// parsePairs reads the name-value pairs encoded in text into m.
+func parsePairs(m map[string]string, text []byte) {
 	for len(text) > 0 {
 		keyLen, n := readSize(text)
 		if n == 0 {
@@ -57,8 +91,143 @@ func (r *request) parseParams() {
 		text = text[keyLen:]
 		val := readString(text, valLen)
 		text = text[valLen:]
-		r.params[key] = val
+		m[key] = val
+	}
+}
+
+// maxStreamMemory is the amount of unread content of a stream that is
+// held in memory. Content beyond it is stored in a temporary file.
+const maxStreamMemory = 64 << 10
+
+// stream is the reading end of a stream of a request: an input stream
+// of a Server's request, or the output of a Handler's. Content is
+// buffered as it arrives so that the records of other requests on the
+// connection can be read while its reader is busy; past maxStreamMemory,
+// it is buffered on disk.
+type stream struct {
+	mu   sync.Mutex
+	cond sync.Cond
+	buf  bytes.Buffer // unread content held in memory
+	file *os.File     // unread content that follows buf, once spilled
+	roff int64        // read offset in file
+	woff int64        // write offset in file
+	err  error        // io.EOF once the stream has ended
+	done bool         // the reader has been closed
+}
+
+func newStream() *stream {
+	s := new(stream)
+	s.cond.L = &s.mu
+	return s
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.buf.Len() == 0 && s.roff == s.woff && s.err == nil && !s.done {
+		s.cond.Wait()
+	}
+	if s.done {
+		return 0, errors.New("fcgi: read from closed stream")
+	}
+	if s.buf.Len() > 0 {
+		return s.buf.Read(p)
+	}
+	if s.roff == s.woff {
+		return 0, s.err
 	}
+	if rest := s.woff - s.roff; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+	n, err := s.file.ReadAt(p, s.roff)
+	s.roff += int64(n)
+	if s.roff == s.woff {
+		// Caught up; reuse the file from the start.
+		s.roff, s.woff = 0, 0
+		s.file.Truncate(0)
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func (s *stream) Close() error {
+	s.mu.Lock()
+	s.done = true
+	s.buf.Reset()
+	s.removeFile()
+	s.mu.Unlock()
+	s.cond.Broadcast()
+	return nil
+}
+
+// write appends the content of a record to the stream.
+func (s *stream) write(p []byte) {
+	s.mu.Lock()
+	if !s.done && s.err == nil {
+		if err := s.append(p); err != nil {
+			s.err = err
+		}
+	}
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// append stores p after the unread content. s.mu must be held.
+func (s *stream) append(p []byte) error {
+	if s.roff == s.woff && s.buf.Len()+len(p) <= maxStreamMemory {
+		s.buf.Write(p)
+		return nil
+	}
+	if s.file == nil {
+		f, err := ioutil.TempFile("", "fcgi-")
+		if err != nil {
+			return err
+		}
+		s.file = f
+	}
+	n, err := s.file.WriteAt(p, s.woff)
+	s.woff += int64(n)
+	return err
+}
+
+// removeFile removes the temporary file of s, if any. s.mu must be held.
+func (s *stream) removeFile() {
+	if s.file != nil {
+		s.file.Close()
+		os.Remove(s.file.Name())
+		s.file = nil
+		s.roff, s.woff = 0, 0
+	}
+}
+
+// buffered returns the amount of unread content.
+func (s *stream) buffered() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(s.buf.Len()) + s.woff - s.roff
+}
+
+// discard drops the unread content and ends the stream with err.
+func (s *stream) discard(err error) {
+	s.mu.Lock()
+	s.buf.Reset()
+	s.removeFile()
+	s.err = err
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// closeWithError ends the stream; reads return err once the buffered
+// content is consumed.
+func (s *stream) closeWithError(err error) {
+	s.mu.Lock()
+	if s.err == nil {
+		s.err = err
+	}
+	s.mu.Unlock()
+	s.cond.Broadcast()
 }
 
 // response implements http.ResponseWriter.
@@ -82,6 +251,9 @@ func (r *response) Header() http.Header {
 }
 
 func (r *response) Write(data []byte) (int, error) {
+	if r.req.isAborted() {
+		return 0, errAborted
+	}
 	if !r.wroteHeader {
 		r.WriteHeader(http.StatusOK)
 	}
@@ -124,21 +296,24 @@ func (r *response) Close() error {
 }
 
 type child struct {
-	conn     *conn
-	handler  http.Handler
+	conn *conn
+	srv  *Server
+
+	mu       sync.Mutex          // protects requests
 	requests map[uint16]*request // keyed by request ID
 }
 
-func newChild(rwc io.ReadWriteCloser, handler http.Handler) *child {
+func newChild(rwc io.ReadWriteCloser, srv *Server) *child {
 	return &child{
 		conn:     newConn(rwc),
-		handler:  handler,
+		srv:      srv,
 		requests: make(map[uint16]*request),
 	}
 }
 
 func (c *child) serve() {
 	defer c.conn.Close()
+	defer c.abortAll()
 	var rec record
 	for {
 		if err := rec.read(c.conn.rwc); err != nil {
@@ -150,11 +325,61 @@ func (c *child) serve() {
 	}
 }
 
-var errCloseConn = errors.New("fcgi: connection should be closed")
+// abortAll aborts the requests in flight once the web server is gone.
+func (c *child) abortAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, req := range c.requests {
+		req.abort(io.ErrUnexpectedEOF)
+		if !req.started {
+			req.stdin.Close()
+			req.data.Close()
+		}
+	}
+}
+
+var errAborted = errors.New("fcgi: request aborted by the web server")
+
+// The values reported for FCGI_MAX_CONNS and FCGI_MAX_REQS. Serve
+// imposes no limits of its own, so these are the most requests a
+// connection can carry.
+const (
+	maxConns = 1<<16 - 1
+	maxReqs  = 1<<16 - 1
+)
+
+// handleManagementRecord answers a record that concerns the connection
+// rather than a request.
+func (c *child) handleManagementRecord(rec *record) error {
+	if rec.h.Type != typeGetValues {
+		b := make([]byte, 8)
+		b[0] = byte(rec.h.Type)
+		return c.conn.writeRecord(typeUnknownType, 0, b)
+	}
+	query := make(map[string]string)
+	parsePairs(query, rec.content())
+	values := make(map[string]string)
+	for name := range query {
+		switch name {
+		case "FCGI_MAX_CONNS":
+			values[name] = strconv.Itoa(maxConns)
+		case "FCGI_MAX_REQS":
+			values[name] = strconv.Itoa(maxReqs)
+		case "FCGI_MPXS_CONNS":
+			values[name] = "1"
+		}
+	}
+	return c.conn.writePairs(typeGetValuesResult, 0, values)
+}
 
 func (c *child) handleRecord(rec *record) error {
+	if rec.h.Id == 0 {
+		return c.handleManagementRecord(rec)
+	}
+	c.mu.Lock()
 	req, ok := c.requests[rec.h.Id]
-	if !ok && rec.h.Type != typeBeginRequest && rec.h.Type != typeGetValues {
+	c.mu.Unlock()
+	if !ok && rec.h.Type != typeBeginRequest {
 		// The spec says to ignore unknown request IDs.
 		return nil
 	}
@@ -170,11 +395,13 @@ func (c *child) handleRecord(rec *record) error {
 		if err := br.read(rec.content()); err != nil {
 			return err
 		}
-		if br.role != roleResponder {
+		if c.srv.handler(br.role) == nil {
 			c.conn.writeEndRequest(rec.h.Id, 0, statusUnknownRole)
 			return nil
 		}
-		c.requests[rec.h.Id] = newRequest(rec.h.Id, br.flags)
+		c.mu.Lock()
+		c.requests[rec.h.Id] = newRequest(rec.h.Id, br.role, br.flags)
+		c.mu.Unlock()
 	case typeParams:
 		// NOTE(eds): Technically a key-value pair can straddle the boundary
 		// between two packets. We buffer until we've received all parameters.
@@ -183,35 +410,38 @@ func (c *child) handleRecord(rec *record) error {
 			return nil
 		}
 		req.parseParams()
-	case typeStdin:
-		content := rec.content()
-		if req.pw == nil {
-			var body io.ReadCloser
-			if len(content) > 0 {
-				// body could be an io.LimitReader, but it shouldn't matter
-				// as long as both sides are behaving.
-				body, req.pw = io.Pipe()
-			}
-			go c.serveRequest(req, body)
+		if req.role == roleAuthorizer {
+			// Authorizers receive no input streams.
+			req.stdin.closeWithError(io.EOF)
 		}
-		if len(content) > 0 {
-			// TODO(eds): This blocks until the handler reads from the pipe.
-			// If the handler takes a long time, it might be a problem.
-			req.pw.Write(content)
-		} else if req.pw != nil {
-			req.pw.Close()
+		req.started = true
+		go c.serveRequest(req)
+	case typeStdin:
+		if content := rec.content(); len(content) > 0 {
+			req.stdin.write(content)
+		} else {
+			req.stdin.closeWithError(io.EOF)
 		}
-	case typeGetValues:
-		values := map[string]string{"FCGI_MPXS_CONNS": "1"}
-		c.conn.writePairs(typeGetValuesResult, 0, values)
 	case typeData:
-		// If the filter role is implemented, read the data stream here.
+		if content := rec.content(); len(content) > 0 {
+			req.data.write(content)
+		} else {
+			req.data.closeWithError(io.EOF)
+		}
 	case typeAbortRequest:
-		delete(c.requests, rec.h.Id)
-		c.conn.writeEndRequest(rec.h.Id, 0, statusRequestComplete)
+		req.abort(errAborted)
+		if req.started {
+			// The request ends once its handler returns.
+			return nil
+		}
+		req.stdin.Close()
+		req.data.Close()
+		c.mu.Lock()
+		delete(c.requests, req.reqId)
+		c.mu.Unlock()
+		c.conn.writeEndRequest(req.reqId, 0, statusRequestComplete)
 		if !req.keepConn {
-			// connection will close upon return
-			return errCloseConn
+			return errAborted
 		}
 	default:
 		b := make([]byte, 8)
@@ -221,7 +451,7 @@ func (c *child) handleRecord(rec *record) error {
 	return nil
 }
 
-func (c *child) serveRequest(req *request, body io.ReadCloser) {
+func (c *child) serveRequest(req *request) {
 	r := newResponse(c, req)
 	httpReq, err := cgi.RequestFromMap(req.params)
 	if err != nil {
@@ -229,25 +459,89 @@ func (c *child) serveRequest(req *request, body io.ReadCloser) {
 		r.WriteHeader(http.StatusInternalServerError)
 		c.conn.writeRecord(typeStderr, req.reqId, []byte(err.Error()))
 	} else {
-		httpReq.Body = body
-		c.handler.ServeHTTP(r, httpReq)
-	}
-	if body != nil {
-		body.Close()
+		httpReq.Body = req.stdin
+		if req.role == roleFilter {
+			httpReq.Body = &filterBody{req.stdin, req.data}
+		}
+		c.srv.handler(req.role).ServeHTTP(r, httpReq)
 	}
+	req.stdin.Close()
+	req.data.Close()
 	r.Close()
+	c.mu.Lock()
+	delete(c.requests, req.reqId)
+	c.mu.Unlock()
 	c.conn.writeEndRequest(req.reqId, 0, statusRequestComplete)
 	if !req.keepConn {
 		c.conn.Close()
 	}
 }
 
+// filterBody is the body of a request to a Filter. It reads the
+// request body and carries the data stream along with it.
+type filterBody struct {
+	*stream
+	data *stream
+}
+
+// FilterData returns the data stream of r, which holds the file the
+// web server asks a Filter to filter, or nil if r is not being served
+// by a Server's Filter. The stream is carried by r.Body, so FilterData
+// returns nil once r.Body has been replaced. It is valid until the
+// handler returns.
+//
+// The web server sends the data stream after the whole request body,
+// so a Filter must read r.Body to EOF before reading the data stream.
+func FilterData(r *http.Request) io.Reader {
+	if b, ok := r.Body.(*filterBody); ok {
+		return b.data
+	}
+	return nil
+}
+
+// A Server defines the handlers of a FastCGI application for each of
+// the roles of the protocol. Requests for roles without a handler are
+// refused.
+//
+// Requests are multiplexed: the requests of a connection are served
+// concurrently, and their input streams are buffered as they arrive,
+// in memory up to a limit and in temporary files beyond it.
+type Server struct {
+	// Handler is the handler of the Responder role, which
+	// replies to requests like any HTTP handler.
+	Handler http.Handler
+
+	// Authorizer is the handler of the Authorizer role, which
+	// decides whether the web server may serve a request. The
+	// request has no body. A response with status 200 authorizes
+	// the request; the web server then adds the values of its
+	// headers named "Variable-NAME" as NAME to the parameters of
+	// later roles. Any other response is sent to the client.
+	Authorizer http.Handler
+
+	// Filter is the handler of the Filter role, which replies to
+	// requests with content derived from a file supplied by the
+	// web server; see FilterData.
+	Filter http.Handler
+}
+
+func (srv *Server) handler(role uint16) http.Handler {
+	switch role {
+	case roleResponder:
+		return srv.Handler
+	case roleAuthorizer:
+		return srv.Authorizer
+	case roleFilter:
+		return srv.Filter
+	}
+	return nil
+}
+
 // Serve accepts incoming FastCGI connections on the listener l, creating a new
-// goroutine for each. The goroutine reads requests and then calls handler
-// to reply to them.
+// goroutine for each. The goroutine reads requests and then calls the
+// handler of their role to reply to them.
 // If l is nil, Serve accepts connections from os.Stdin.
-// If handler is nil, http.DefaultServeMux is used.
-func Serve(l net.Listener, handler http.Handler) error {
+func (srv *Server) Serve(l net.Listener) error {
 	if l == nil {
 		var err error
 		l, err = net.FileListener(os.Stdin)
@@ -256,16 +550,26 @@ func Serve(l net.Listener, handler http.Handler) error {
 		}
 		defer l.Close()
 	}
-	if handler == nil {
-		handler = http.DefaultServeMux
-	}
 	for {
 		rw, err := l.Accept()
 		if err != nil {
 			return err
 		}
-		c := newChild(rw, handler)
+		c := newChild(rw, srv)
 		go c.serve()
 	}
 	panic("unreachable")
 }
+
+// Serve accepts incoming FastCGI connections on the listener l, creating a new
+// goroutine for each. The goroutine reads requests and then calls handler
+// to reply to them. Only the Responder role is served.
+// If l is nil, Serve accepts connections from os.Stdin.
+// If handler is nil, http.DefaultServeMux is used.
+func Serve(l net.Listener, handler http.Handler) error {
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	srv := &Server{Handler: handler}
+	return srv.Serve(l)
+}
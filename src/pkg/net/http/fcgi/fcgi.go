@@ -3,7 +3,9 @@
 // license that can be found in the LICENSE file.
 
 // Package fcgi implements the FastCGI protocol.
-// Currently only the responder role is supported.
+// Serve and Server run a FastCGI application in the responder, authorizer
+// and filter roles, and Handler forwards HTTP requests to an application
+// in the responder role.
 // The protocol is defined at http://www.fastcgi.com/drupal/node/6?q=node/22
 package fcgi
 
@@ -46,7 +48,7 @@ const (
 )
 
 const (
-	roleResponder = iota + 1 // only Responders are implemented.
+	roleResponder = iota + 1
 	roleAuthorizer
 	roleFilter
 )
@@ -6,9 +6,15 @@ package fcgi
 
 import (
 	"bytes"
-	"errors"
 	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 var sizeTests = []struct {
@@ -113,38 +119,295 @@ outer:
 	}
 }
 
-type writeOnlyConn struct {
-	buf []byte
+// childTest runs a child on one end of a pipe, acting as the web server
+// on the other.
+type childTest struct {
+	t     *testing.T
+	c     *conn
+	recs  chan *record
+	out   map[uint16][]byte // stdout by request ID
+	ended map[uint16]uint8  // protocol status of ended requests, by ID
 }
 
-func (c *writeOnlyConn) Write(p []byte) (int, error) {
-	c.buf = append(c.buf, p...)
-	return len(p), nil
+func newChildTest(t *testing.T, srv *Server) *childTest {
+	c1, c2 := net.Pipe()
+	go newChild(c1, srv).serve()
+	ct := &childTest{
+		t:     t,
+		c:     newConn(c2),
+		recs:  make(chan *record, 16),
+		out:   make(map[uint16][]byte),
+		ended: make(map[uint16]uint8),
+	}
+	go func() {
+		defer close(ct.recs)
+		for {
+			rec := new(record)
+			if err := rec.read(c2); err != nil {
+				return
+			}
+			ct.recs <- rec
+		}
+	}()
+	return ct
+}
+
+func (ct *childTest) next() *record {
+	select {
+	case rec, ok := <-ct.recs:
+		if !ok {
+			ct.t.Fatal("connection closed")
+		}
+		return rec
+	case <-time.After(5 * time.Second):
+		ct.t.Fatal("timeout waiting for a record")
+	}
+	panic("unreachable")
+}
+
+var testParams = map[string]string{
+	"REQUEST_METHOD":  "GET",
+	"SERVER_PROTOCOL": "HTTP/1.1",
+	"HTTP_HOST":       "example.com",
+	"REQUEST_URI":     "/path",
+}
+
+// begin starts request id in role with testParams and extra params.
+func (ct *childTest) begin(id uint16, role uint16, extra map[string]string) {
+	params := make(map[string]string)
+	for k, v := range testParams {
+		params[k] = v
+	}
+	for k, v := range extra {
+		params[k] = v
+	}
+	ct.c.writeBeginRequest(id, role, flagKeepConn)
+	ct.c.writePairs(typeParams, id, params)
 }
 
-func (c *writeOnlyConn) Read(p []byte) (int, error) {
-	return 0, errors.New("conn is write-only")
+// send sends the stream recType of request id with content.
+func (ct *childTest) send(recType recType, id uint16, content string) {
+	w := newWriter(ct.c, recType, id)
+	w.WriteString(content)
+	w.Close()
 }
 
-func (c *writeOnlyConn) Close() error {
-	return nil
+// end reads records until request id ends, returning its output and
+// protocol status. Other requests that end meanwhile are recorded for
+// later calls.
+func (ct *childTest) end(id uint16) (string, uint8) {
+	for {
+		if status, ok := ct.ended[id]; ok {
+			out := string(ct.out[id])
+			delete(ct.out, id)
+			delete(ct.ended, id)
+			return out, status
+		}
+		rec := ct.next()
+		switch rec.h.Type {
+		case typeStdout:
+			ct.out[rec.h.Id] = append(ct.out[rec.h.Id], rec.content()...)
+		case typeEndRequest:
+			ct.ended[rec.h.Id] = rec.content()[4]
+		}
+	}
+	panic("unreachable")
 }
 
 func TestGetValues(t *testing.T) {
-	var rec record
-	rec.h.Type = typeGetValues
+	ct := newChildTest(t, &Server{})
+	query := map[string]string{"FCGI_MPXS_CONNS": "", "FCGI_MAX_REQS": "", "FCGI_UNKNOWN": ""}
+	ct.c.writePairs(typeGetValues, 0, query)
 
-	wc := new(writeOnlyConn)
-	c := newChild(wc, nil)
-	err := c.handleRecord(&rec)
-	if err != nil {
-		t.Fatalf("handleRecord: %v", err)
+	var content []byte
+	for {
+		rec := ct.next()
+		if rec.h.Type != typeGetValuesResult || rec.h.Id != 0 {
+			t.Fatalf("got record type %d, ID %d", rec.h.Type, rec.h.Id)
+		}
+		if len(rec.content()) == 0 {
+			break
+		}
+		content = append(content, rec.content()...)
+	}
+	values := make(map[string]string)
+	parsePairs(values, content)
+	want := map[string]string{"FCGI_MPXS_CONNS": "1", "FCGI_MAX_REQS": "65535"}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("values = %v; want %v", values, want)
+	}
+}
+
+func TestUnknownManagementRecord(t *testing.T) {
+	ct := newChildTest(t, &Server{})
+	ct.c.writeRecord(recType(42), 0, nil)
+	rec := ct.next()
+	if rec.h.Type != typeUnknownType || rec.content()[0] != 42 {
+		t.Errorf("got record type %d, content %v", rec.h.Type, rec.content())
+	}
+}
+
+func TestChildRoles(t *testing.T) {
+	srv := &Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "responder")
+		}),
+		Authorizer: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Header().Set("Variable-User", "gopher")
+		}),
+		Filter: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ioutil.ReadAll(r.Body)
+			data, err := ioutil.ReadAll(FilterData(r))
+			if err != nil {
+				t.Errorf("reading data: %v", err)
+			}
+			w.Write(bytes.ToUpper(data))
+		}),
+	}
+	ct := newChildTest(t, srv)
+
+	ct.begin(1, roleAuthorizer, map[string]string{"HTTP_AUTHORIZATION": "secret"})
+	if out, _ := ct.end(1); !strings.HasPrefix(out, "Status: 200 OK\r\n") || !strings.Contains(out, "Variable-User: gopher\r\n") {
+		t.Errorf("authorized: got %q", out)
+	}
+	ct.begin(1, roleAuthorizer, nil)
+	if out, _ := ct.end(1); !strings.HasPrefix(out, "Status: 401 Unauthorized\r\n") {
+		t.Errorf("unauthorized: got %q", out)
 	}
 
-	const want = "\x01\n\x00\x00\x00\x12\x06\x00" +
-		"\x0f\x01FCGI_MPXS_CONNS1" +
-		"\x00\x00\x00\x00\x00\x00\x01\n\x00\x00\x00\x00\x00\x00"
-	if got := string(wc.buf); got != want {
-		t.Errorf(" got: %q\nwant: %q\n", got, want)
+	ct.begin(2, roleFilter, map[string]string{"FCGI_DATA_LENGTH": "8"})
+	ct.send(typeStdin, 2, "")
+	ct.send(typeData, 2, "the file")
+	if out, _ := ct.end(2); !strings.HasSuffix(out, "\r\n\r\nTHE FILE") {
+		t.Errorf("filter: got %q", out)
+	}
+
+	ct.begin(3, roleResponder, nil)
+	ct.send(typeStdin, 3, "")
+	if out, _ := ct.end(3); !strings.HasSuffix(out, "\r\n\r\nresponder") {
+		t.Errorf("responder: got %q", out)
+	}
+
+	ct = newChildTest(t, &Server{Handler: srv.Handler})
+	ct.begin(1, roleFilter, nil)
+	if _, status := ct.end(1); status != statusUnknownRole {
+		t.Errorf("filter without handler: protocol status %d; want %d", status, statusUnknownRole)
+	}
+}
+
+func TestChildMultiplex(t *testing.T) {
+	first := make(chan bool)
+	srv := &Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/first" {
+			// Blocks until the second request's body has arrived.
+			<-first
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Write(b)
+		if r.URL.Path == "/second" {
+			close(first)
+		}
+	})}
+	ct := newChildTest(t, srv)
+	ct.begin(1, roleResponder, map[string]string{"REQUEST_URI": "/first"})
+	ct.send(typeStdin, 1, strings.Repeat("x", 100000))
+	ct.begin(2, roleResponder, map[string]string{"REQUEST_URI": "/second"})
+	ct.send(typeStdin, 2, "second body")
+	if out, _ := ct.end(2); !strings.HasSuffix(out, "second body") {
+		t.Errorf("second: got %q", out)
+	}
+	if out, _ := ct.end(1); !strings.HasSuffix(out, strings.Repeat("x", 100000)) {
+		t.Errorf("first: got %d bytes", len(out))
+	}
+}
+
+func TestChildAbort(t *testing.T) {
+	errc := make(chan error, 1)
+	srv := &Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := ioutil.ReadAll(r.Body)
+		errc <- err
+	})}
+	ct := newChildTest(t, srv)
+	ct.begin(1, roleResponder, nil)
+	ct.c.writeRecord(typeStdin, 1, []byte("partial"))
+	ct.c.writeRecord(typeAbortRequest, 1, nil)
+	if _, status := ct.end(1); status != statusRequestComplete {
+		t.Errorf("protocol status %d", status)
+	}
+	if err := <-errc; err != errAborted {
+		t.Errorf("reading body of aborted request: %v", err)
+	}
+
+	// The ID can be reused at once.
+	ct.begin(1, roleResponder, nil)
+	ct.send(typeStdin, 1, "")
+	if _, status := ct.end(1); status != statusRequestComplete {
+		t.Errorf("reused ID: protocol status %d", status)
+	}
+}
+
+func TestChildAbortBeforeParams(t *testing.T) {
+	served := make(chan bool, 1)
+	srv := &Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served <- true
+	})}
+	ct := newChildTest(t, srv)
+	ct.c.writeBeginRequest(1, roleResponder, flagKeepConn)
+	ct.c.writeRecord(typeParams, 1, []byte{4, 3, 'P', 'A', 'T', 'H', '/', 'a', 'b'})
+	ct.c.writeRecord(typeAbortRequest, 1, nil)
+	if _, status := ct.end(1); status != statusRequestComplete {
+		t.Errorf("protocol status %d", status)
+	}
+	select {
+	case <-served:
+		t.Error("handler ran for a request aborted before its parameters were complete")
+	default:
+	}
+
+	// The ID is free again.
+	ct.begin(1, roleResponder, nil)
+	ct.send(typeStdin, 1, "")
+	if _, status := ct.end(1); status != statusRequestComplete {
+		t.Errorf("reused ID: protocol status %d", status)
+	}
+}
+
+func TestStreamSpill(t *testing.T) {
+	s := newStream()
+	var want bytes.Buffer
+	chunk := make([]byte, 10000)
+	for i := 0; want.Len() < 3*maxStreamMemory; i++ {
+		for j := range chunk {
+			chunk[j] = byte(i + j)
+		}
+		s.write(chunk)
+		want.Write(chunk)
+	}
+	if s.file == nil {
+		t.Fatal("stream past maxStreamMemory has no file")
+	}
+	name := s.file.Name()
+	// Read half, write more, then read the rest.
+	got := make([]byte, want.Len()/2)
+	if _, err := io.ReadFull(s, got); err != nil {
+		t.Fatal(err)
+	}
+	s.write([]byte("tail"))
+	want.WriteString("tail")
+	s.closeWithError(io.EOF)
+	rest, err := ioutil.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got = append(got, rest...); !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("read %d bytes, different from the %d written", len(got), want.Len())
+	}
+	s.Close()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("temporary file %s not removed: %v", name, err)
 	}
 }
@@ -0,0 +1,461 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fcgi
+
+// This file implements FastCGI from the perspective of the web server.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Handler is an http.Handler that forwards requests to a FastCGI
+// application in the responder role, such as one started with Serve.
+//
+// Requests are multiplexed over a single connection to the application,
+// which is dialed when first needed and dialed again after it fails.
+// The request body is streamed to the application as it is read, and
+// its output is streamed back to the client, flushing after each record
+// if the ResponseWriter is an http.Flusher. Output that a slow client
+// has yet to take is buffered, up to a limit past which the request
+// is aborted.
+type Handler struct {
+	Network string // network of Addr, as for net.Dial; "tcp" if empty
+	Addr    string // address of the FastCGI application
+
+	Root string   // root URI prefix of handler, or empty for "/"
+	Path string   // path to the script, sent as SCRIPT_FILENAME
+	Env  []string // extra parameters to set, if any, as "key=value"
+
+	// Logger receives the lines the application writes to its error
+	// stream and the errors of the handler. If nil, the log package's
+	// standard logger is used.
+	Logger *log.Logger
+
+	mu sync.Mutex
+	cc *clientConn // current connection, or nil
+}
+
+func (h *Handler) printf(format string, v ...interface{}) {
+	if h.Logger != nil {
+		h.Logger.Printf(format, v...)
+	} else {
+		log.Printf(format, v...)
+	}
+}
+
+var (
+	errTooManyRequests = errors.New("fcgi: too many requests in flight")
+	errOutputOverflow  = errors.New("fcgi: too much output waiting for the client")
+	errBodyStopped     = errors.New("fcgi: request body no longer wanted")
+)
+
+// maxPendingOutput is the amount of output of a request that may wait
+// for a slow client. A request whose output exceeds it is aborted.
+const maxPendingOutput = 1 << 20
+
+// clientConn is a connection to a FastCGI application carrying any
+// number of requests.
+type clientConn struct {
+	h    *Handler
+	conn *conn
+
+	mu     sync.Mutex
+	reqs   map[uint16]*clientRequest // keyed by request ID
+	nextId uint16
+	err    error // set once the connection has failed
+}
+
+// clientRequest holds the state of a request in flight.
+type clientRequest struct {
+	id     uint16
+	stdout *stream // output waiting to be sent to the client
+	stderr []byte  // incomplete line of the error stream
+}
+
+// clientConn returns a working connection to the application, dialing one if
+// necessary.
+func (h *Handler) clientConn() (*clientConn, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cc != nil {
+		return h.cc, nil
+	}
+	network := h.Network
+	if network == "" {
+		network = "tcp"
+	}
+	rwc, err := net.Dial(network, h.Addr)
+	if err != nil {
+		return nil, err
+	}
+	h.cc = &clientConn{
+		h:    h,
+		conn: newConn(rwc),
+		reqs: make(map[uint16]*clientRequest),
+	}
+	go h.cc.readLoop()
+	return h.cc, nil
+}
+
+// newRequest registers a new request on the connection.
+func (cc *clientConn) newRequest() (*clientRequest, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.err != nil {
+		return nil, cc.err
+	}
+	if len(cc.reqs) >= 1<<16-1 {
+		return nil, errTooManyRequests
+	}
+	for {
+		cc.nextId++
+		if _, ok := cc.reqs[cc.nextId]; cc.nextId != 0 && !ok {
+			break
+		}
+	}
+	req := &clientRequest{id: cc.nextId, stdout: newStream()}
+	cc.reqs[req.id] = req
+	return req, nil
+}
+
+// fail closes the connection and ends all its requests with err.
+func (cc *clientConn) fail(err error) {
+	cc.h.mu.Lock()
+	if cc.h.cc == cc {
+		cc.h.cc = nil
+	}
+	cc.h.mu.Unlock()
+
+	cc.mu.Lock()
+	if cc.err == nil {
+		cc.err = err
+	}
+	for id, req := range cc.reqs {
+		req.stdout.closeWithError(err)
+		delete(cc.reqs, id)
+	}
+	cc.mu.Unlock()
+	cc.conn.Close()
+}
+
+// readLoop reads the records sent by the application and hands them to
+// their requests until the connection fails.
+func (cc *clientConn) readLoop() {
+	var rec record
+	for {
+		if err := rec.read(cc.conn.rwc); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			cc.fail(err)
+			return
+		}
+		if err := cc.handleRecord(&rec); err != nil {
+			cc.fail(err)
+			return
+		}
+	}
+}
+
+func (cc *clientConn) handleRecord(rec *record) error {
+	cc.mu.Lock()
+	req := cc.reqs[rec.h.Id]
+	cc.mu.Unlock()
+	if req == nil {
+		// Management records and records of aborted requests.
+		return nil
+	}
+
+	switch rec.h.Type {
+	case typeStdout:
+		// The output is queued so that a slow client holds up
+		// only its own request, and not the others on the
+		// connection.
+		if content := rec.content(); len(content) > 0 {
+			req.stdout.write(content)
+			if req.stdout.buffered() > maxPendingOutput {
+				req.stdout.discard(errOutputOverflow)
+				go cc.abort(req)
+			}
+		}
+	case typeStderr:
+		content := rec.content()
+		if len(content) == 0 {
+			cc.logStderr(req, true)
+			return nil
+		}
+		req.stderr = append(req.stderr, content...)
+		cc.logStderr(req, false)
+	case typeEndRequest:
+		content := rec.content()
+		if len(content) != 8 {
+			return errors.New("fcgi: invalid end request record")
+		}
+		appStatus := binary.BigEndian.Uint32(content)
+		cc.mu.Lock()
+		delete(cc.reqs, req.id)
+		cc.mu.Unlock()
+		cc.logStderr(req, true)
+		var err error
+		switch content[4] {
+		case statusRequestComplete:
+			if appStatus != 0 {
+				cc.h.printf("fcgi: application exited with status %d", appStatus)
+			}
+		case statusCantMultiplex:
+			err = errors.New("fcgi: application cannot multiplex connections")
+		case statusOverloaded:
+			err = errors.New("fcgi: application is overloaded")
+		case statusUnknownRole:
+			err = errors.New("fcgi: application does not implement the responder role")
+		default:
+			err = fmt.Errorf("fcgi: unknown protocol status %d", content[4])
+		}
+		if err == nil {
+			err = io.EOF
+		}
+		req.stdout.closeWithError(err)
+	}
+	return nil
+}
+
+// logStderr logs the complete lines of the error stream of req, and the
+// incomplete last line too if all is set.
+func (cc *clientConn) logStderr(req *clientRequest, all bool) {
+	for {
+		i := bytes.IndexByte(req.stderr, '\n')
+		if i < 0 {
+			break
+		}
+		cc.h.printf("fcgi: %s", bytes.TrimRight(req.stderr[:i], "\r"))
+		req.stderr = req.stderr[i+1:]
+	}
+	if all && len(req.stderr) > 0 {
+		cc.h.printf("fcgi: %s", req.stderr)
+		req.stderr = nil
+	}
+}
+
+// abort asks the application to abort req. Its ID stays in use until
+// the application ends the request.
+func (cc *clientConn) abort(req *clientRequest) {
+	cc.mu.Lock()
+	_, ok := cc.reqs[req.id]
+	cc.mu.Unlock()
+	if ok {
+		cc.conn.writeRecord(typeAbortRequest, req.id, nil)
+	}
+}
+
+// params returns the CGI parameters of req, as described by RFC 3875.
+func (h *Handler) params(req *http.Request) map[string]string {
+	root := h.Root
+	if root == "" {
+		root = "/"
+	}
+	pathInfo := req.URL.Path
+	if root != "/" && strings.HasPrefix(pathInfo, root) {
+		pathInfo = pathInfo[len(root):]
+	}
+	port := "80"
+	if req.TLS != nil {
+		port = "443"
+	}
+	if _, p, err := net.SplitHostPort(req.Host); err == nil {
+		port = p
+	}
+	remoteAddr, remotePort, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		remoteAddr, remotePort = req.RemoteAddr, ""
+	}
+
+	params := map[string]string{
+		"SERVER_SOFTWARE":   "go",
+		"SERVER_NAME":       req.Host,
+		"SERVER_PROTOCOL":   "HTTP/1.1",
+		"SERVER_PORT":       port,
+		"GATEWAY_INTERFACE": "CGI/1.1",
+		"REQUEST_METHOD":    req.Method,
+		"QUERY_STRING":      req.URL.RawQuery,
+		"REQUEST_URI":       req.URL.RequestURI(),
+		"PATH_INFO":         pathInfo,
+		"SCRIPT_NAME":       root,
+		"SCRIPT_FILENAME":   h.Path,
+		"REMOTE_ADDR":       remoteAddr,
+		"REMOTE_HOST":       remoteAddr,
+		"REMOTE_PORT":       remotePort,
+		"HTTP_HOST":         req.Host,
+	}
+	if req.TLS != nil {
+		params["HTTPS"] = "on"
+	}
+	for k, v := range req.Header {
+		k = strings.Map(upperCaseAndUnderscore, k)
+		joinStr := ", "
+		if k == "COOKIE" {
+			joinStr = "; "
+		}
+		params["HTTP_"+k] = strings.Join(v, joinStr)
+	}
+	if req.ContentLength > 0 {
+		params["CONTENT_LENGTH"] = strconv.FormatInt(req.ContentLength, 10)
+	}
+	if ctype := req.Header.Get("Content-Type"); ctype != "" {
+		params["CONTENT_TYPE"] = ctype
+	}
+	for _, e := range h.Env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) == 2 {
+			params[kv[0]] = kv[1]
+		}
+	}
+	return params
+}
+
+func upperCaseAndUnderscore(r rune) rune {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return r - ('a' - 'A')
+	case r == '-', r == '=':
+		return '_'
+	}
+	return r
+}
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	badGateway := func(err error) {
+		rw.WriteHeader(http.StatusBadGateway)
+		h.printf("fcgi: %v", err)
+	}
+
+	cc, err := h.clientConn()
+	if err != nil {
+		badGateway(err)
+		return
+	}
+	creq, err := cc.newRequest()
+	if err != nil {
+		badGateway(err)
+		return
+	}
+	stdout := creq.stdout
+	defer stdout.Close()
+
+	c := cc.conn
+	if err := c.writeBeginRequest(creq.id, roleResponder, flagKeepConn); err != nil {
+		cc.fail(err)
+		badGateway(err)
+		return
+	}
+	if err := c.writePairs(typeParams, creq.id, h.params(req)); err != nil {
+		cc.fail(err)
+		badGateway(err)
+		return
+	}
+	stop := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		defer close(done)
+		w := newWriter(c, typeStdin, creq.id)
+		if req.Body != nil && req.ContentLength != 0 {
+			if _, err := io.Copy(w, stoppableReader{req.Body, stop}); err != nil {
+				if err != errBodyStopped {
+					// Whatever is wrong, the request is incomplete.
+					h.printf("fcgi: error sending request body: %v", err)
+					cc.abort(creq)
+				}
+				return
+			}
+		}
+		w.Close()
+	}()
+
+	// Abort the request if it is still in flight when we return, once
+	// the request body is no longer read.
+	defer cc.abort(creq)
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	br := bufio.NewReader(stdout)
+	mh, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil {
+		badGateway(fmt.Errorf("error reading headers: %v", err))
+		return
+	}
+	header := http.Header(mh)
+	statusCode := http.StatusOK
+	if status := header.Get("Status"); status != "" {
+		if len(status) < 3 {
+			badGateway(fmt.Errorf("bogus status (short): %q", status))
+			return
+		}
+		statusCode, err = strconv.Atoi(status[:3])
+		if err != nil {
+			badGateway(fmt.Errorf("bogus status: %q", status))
+			return
+		}
+		header.Del("Status")
+	} else if header.Get("Location") != "" {
+		statusCode = http.StatusFound
+	}
+	for k, vv := range header {
+		for _, v := range vv {
+			rw.Header().Add(k, v)
+		}
+	}
+	rw.WriteHeader(statusCode)
+
+	flusher, _ := rw.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := br.Read(buf)
+		if n > 0 {
+			if _, werr := rw.Write(buf[:n]); werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			h.printf("fcgi: copy error: %v", err)
+			return
+		}
+	}
+	panic("unreachable")
+}
+
+// stoppableReader reads from r until stop is closed. A Read already
+// in progress is not interrupted.
+type stoppableReader struct {
+	r    io.Reader
+	stop chan bool
+}
+
+func (s stoppableReader) Read(p []byte) (int, error) {
+	select {
+	case <-s.stop:
+		return 0, errBodyStopped
+	default:
+	}
+	return s.r.Read(p)
+}
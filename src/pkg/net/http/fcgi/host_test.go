@@ -0,0 +1,408 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fcgi
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countListener counts the connections it accepts.
+type countListener struct {
+	net.Listener
+	mu sync.Mutex
+	n  int
+}
+
+func (l *countListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.n++
+		l.mu.Unlock()
+	}
+	return c, err
+}
+
+// startChild serves handler with Serve, returning the listener.
+func startChild(t *testing.T, handler http.Handler) *countListener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := &countListener{Listener: l}
+	go Serve(cl, handler)
+	return cl
+}
+
+func TestHandler(t *testing.T) {
+	l := startChild(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		if r.URL.Path == "/redirect" {
+			w.Header().Set("Location", "/elsewhere")
+			w.WriteHeader(http.StatusMovedPermanently)
+			return
+		}
+		fmt.Fprintf(w, "%s %s %s %q", r.URL.Path, r.URL.RawQuery, r.Header.Get("X-Foo"), body)
+	}))
+	defer l.Close()
+
+	h := &Handler{Addr: l.Addr().String(), Env: []string{"SERVER_SOFTWARE=test"}}
+	tests := []struct {
+		method, url, body string
+		code              int
+		want              string
+	}{
+		{"GET", "http://example.com/foo?a=b", "", 200, `/foo a=b bar ""`},
+		{"POST", "http://example.com/post", "some data", 200, `/post  bar "some data"`},
+		{"GET", "http://example.com/redirect", "", 301, ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		req.Header.Set("X-Foo", "bar")
+		req.RemoteAddr = "192.168.0.1:4321"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.code || rec.Body.String() != tt.want {
+			t.Errorf("%s %s = %d %q; want %d %q", tt.method, tt.url, rec.Code, rec.Body, tt.code, tt.want)
+		}
+		if m := rec.HeaderMap.Get("X-Method"); m != tt.method {
+			t.Errorf("%s %s: X-Method = %q", tt.method, tt.url, m)
+		}
+	}
+	if l.n != 1 {
+		t.Errorf("handler dialed %d connections; want 1", l.n)
+	}
+}
+
+func TestHandlerParams(t *testing.T) {
+	h := &Handler{Root: "/app", Path: "/srv/app.php", Env: []string{"SERVER_SOFTWARE=test", "EXTRA=x=y"}}
+	req, _ := http.NewRequest("POST", "http://example.com:8080/app/a/b?q=1", strings.NewReader("body"))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Add("Cookie", "a=1")
+	req.Header.Add("Cookie", "b=2")
+	req.RemoteAddr = "192.168.0.1:4321"
+	p := h.params(req)
+	want := map[string]string{
+		"SERVER_SOFTWARE": "test",
+		"SERVER_PORT":     "8080",
+		"REQUEST_METHOD":  "POST",
+		"REQUEST_URI":     "/app/a/b?q=1",
+		"QUERY_STRING":    "q=1",
+		"SCRIPT_NAME":     "/app",
+		"SCRIPT_FILENAME": "/srv/app.php",
+		"PATH_INFO":       "/a/b",
+		"REMOTE_ADDR":     "192.168.0.1",
+		"REMOTE_PORT":     "4321",
+		"CONTENT_LENGTH":  "4",
+		"CONTENT_TYPE":    "text/plain",
+		"HTTP_COOKIE":     "a=1; b=2",
+		"HTTP_HOST":       "example.com:8080",
+		"EXTRA":           "x=y",
+	}
+	for k, v := range want {
+		if p[k] != v {
+			t.Errorf("%s = %q; want %q", k, p[k], v)
+		}
+	}
+}
+
+func TestHandlerMultiplex(t *testing.T) {
+	const n = 5
+	var arrived sync.WaitGroup
+	arrived.Add(n)
+	l := startChild(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// No request completes before all have arrived.
+		arrived.Done()
+		arrived.Wait()
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Write(bytes.ToUpper(b))
+	}))
+	defer l.Close()
+
+	h := &Handler{Addr: l.Addr().String()}
+	big := strings.Repeat("abcdefgh", 20000) // several records
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprint(i, big)
+			req, _ := http.NewRequest("POST", "http://example.com/", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if got := rec.Body.String(); got != strings.ToUpper(body) {
+				t.Errorf("request %d: got %d bytes, want %d", i, len(got), len(body))
+			}
+		}(i)
+	}
+	wg.Wait()
+	if l.n != 1 {
+		t.Errorf("handler dialed %d connections; want 1", l.n)
+	}
+}
+
+func TestHandlerStreaming(t *testing.T) {
+	release := make(chan bool)
+	l := startChild(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "first\n")
+		w.(http.Flusher).Flush()
+		<-release
+		io.WriteString(w, "second\n")
+	}))
+	defer l.Close()
+
+	ts := httptest.NewServer(&Handler{Addr: l.Addr().String()})
+	defer ts.Close()
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	br := bufio.NewReader(res.Body)
+	if line, err := br.ReadString('\n'); line != "first\n" {
+		t.Fatalf("first line = %q, %v", line, err)
+	}
+	close(release)
+	if line, err := br.ReadString('\n'); line != "second\n" {
+		t.Fatalf("second line = %q, %v", line, err)
+	}
+}
+
+// fakeApp answers each request on its connections with an error stream
+// and the response resp.
+func fakeApp(t *testing.T, stderr, resp string) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for {
+			rwc, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				c := newConn(rwc)
+				defer c.Close()
+				var rec record
+				for {
+					if err := rec.read(rwc); err != nil {
+						return
+					}
+					if rec.h.Type != typeStdin || len(rec.content()) > 0 {
+						continue
+					}
+					id := rec.h.Id
+					for _, line := range strings.SplitAfter(stderr, "\n") {
+						c.writeRecord(typeStderr, id, []byte(line))
+					}
+					c.writeRecord(typeStdout, id, []byte(resp))
+					c.writeEndRequest(id, 0, statusRequestComplete)
+				}
+			}()
+		}
+	}()
+	return l
+}
+
+func TestHandlerStderr(t *testing.T) {
+	l := fakeApp(t, "warning: one\nwarning: t", "Status: 404 Not Found\r\nContent-Type: text/plain\r\n\r\nnot here")
+	defer l.Close()
+
+	var logbuf bytes.Buffer
+	h := &Handler{Addr: l.Addr().String(), Logger: log.New(&logbuf, "", 0)}
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != 404 || rec.Body.String() != "not here" || rec.HeaderMap.Get("Content-Type") != "text/plain" {
+		t.Errorf("got %d %q %v", rec.Code, rec.Body, rec.HeaderMap)
+	}
+	if rec.HeaderMap.Get("Status") != "" {
+		t.Errorf("Status header was passed on")
+	}
+	if got, want := logbuf.String(), "fcgi: warning: one\nfcgi: warning: t\n"; got != want {
+		t.Errorf("log = %q; want %q", got, want)
+	}
+}
+
+func TestHandlerBadGateway(t *testing.T) {
+	var logbuf bytes.Buffer
+	logger := log.New(&logbuf, "", 0)
+
+	// An address nobody listens on.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	h := &Handler{Addr: addr, Logger: logger}
+	req, _ := http.NewRequest("GET", "http://example.com/", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("no application: code = %d; want 502", rec.Code)
+	}
+
+	// An application that sends garbage headers.
+	l = fakeApp(t, "", "no header here\r\n\r\n")
+	defer l.Close()
+	h = &Handler{Addr: l.Addr().String(), Logger: logger}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("bad headers: code = %d; want 502", rec.Code)
+	}
+	if logbuf.Len() == 0 {
+		t.Errorf("nothing logged")
+	}
+}
+
+// blockingWriter is a ResponseWriter whose Write blocks until release is
+// closed.
+type blockingWriter struct {
+	*httptest.ResponseRecorder
+	blocked chan bool
+	release chan bool
+	once    sync.Once
+}
+
+func (w *blockingWriter) Write(p []byte) (int, error) {
+	w.once.Do(func() { close(w.blocked) })
+	<-w.release
+	return w.ResponseRecorder.Write(p)
+}
+
+// requestsInFlight returns the number of requests on h's connection to
+// the application.
+func requestsInFlight(h *Handler) int {
+	h.mu.Lock()
+	cc := h.cc
+	h.mu.Unlock()
+	if cc == nil {
+		return 0
+	}
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return len(cc.reqs)
+}
+
+func TestHandlerSlowClient(t *testing.T) {
+	big := strings.Repeat("x", 2*maxPendingOutput)
+	proceed := make(chan bool)
+	l := startChild(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/big" {
+			io.WriteString(w, "start")
+			w.(http.Flusher).Flush()
+			<-proceed
+			io.WriteString(w, big)
+		} else {
+			io.WriteString(w, "small")
+		}
+	}))
+	defer l.Close()
+
+	h := &Handler{Addr: l.Addr().String(), Logger: log.New(ioutil.Discard, "", 0)}
+	bw := &blockingWriter{
+		ResponseRecorder: httptest.NewRecorder(),
+		blocked:          make(chan bool),
+		release:          make(chan bool),
+	}
+	bigDone := make(chan bool)
+	go func() {
+		req, _ := http.NewRequest("GET", "http://example.com/big", nil)
+		h.ServeHTTP(bw, req)
+		close(bigDone)
+	}()
+	<-bw.blocked
+	close(proceed)
+
+	// The client of /big reads nothing more; other requests go on.
+	smallDone := make(chan bool)
+	go func() {
+		req, _ := http.NewRequest("GET", "http://example.com/small", nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Body.String() != "small" {
+			t.Errorf("small body = %q", rec.Body)
+		}
+		close(smallDone)
+	}()
+	select {
+	case <-smallDone:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request blocked by a slow client")
+	}
+
+	// Release the client of /big only once the application has
+	// ended it; while the client blocks, its output can only have
+	// overflowed by then.
+	for deadline := time.Now().Add(5 * time.Second); requestsInFlight(h) > 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("big request never ended")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(bw.release)
+	<-bigDone
+	if n := bw.Body.Len(); n >= len(big) {
+		t.Errorf("slow client got all %d bytes; want the request aborted", n)
+	}
+}
+
+// endlessBody is a request body that never ends.
+type endlessBody struct {
+	mu sync.Mutex
+	n  int // number of reads
+}
+
+func (b *endlessBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	b.n++
+	b.mu.Unlock()
+	time.Sleep(time.Millisecond)
+	return len(p), nil
+}
+
+func (b *endlessBody) reads() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.n
+}
+
+func TestHandlerStopsReadingBody(t *testing.T) {
+	l := startChild(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "no thanks")
+	}))
+	defer l.Close()
+
+	h := &Handler{Addr: l.Addr().String()}
+	body := new(endlessBody)
+	req, _ := http.NewRequest("POST", "http://example.com/", body)
+	req.ContentLength = -1
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Body.String() != "no thanks" {
+		t.Errorf("body = %q", rec.Body)
+	}
+	n := body.reads()
+	time.Sleep(20 * time.Millisecond)
+	if m := body.reads(); m != n {
+		t.Errorf("request body read %d times after ServeHTTP returned", m-n)
+	}
+}
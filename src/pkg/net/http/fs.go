@@ -7,6 +7,9 @@
 package http
 
 import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -18,6 +21,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -83,7 +87,7 @@ func dirList(w ResponseWriter, f File) {
 // ServeContent replies to the request using the content in the
 // provided ReadSeeker.  The main benefit of ServeContent over io.Copy
 // is that it handles Range requests properly, sets the MIME type, and
-// handles If-Modified-Since requests.
+// handles conditional requests.
 //
 // If the response's Content-Type header is not set, ServeContent
 // first tries to deduce the type from name's file extension and,
@@ -101,7 +105,10 @@ func dirList(w ResponseWriter, f File) {
 // a seek to the end of the content to determine its size.
 //
 // If the caller has set w's ETag header, ServeContent uses it to
-// handle requests using If-Range and If-None-Match.
+// handle requests using If-Match, If-None-Match and If-Range, as
+// described in RFC 2616, section 14. Without an ETag, ServeContent
+// evaluates If-Unmodified-Since, If-Modified-Since and If-Range
+// against modtime.
 //
 // Note that *os.File implements the io.ReadSeeker interface.
 func ServeContent(w ResponseWriter, req *Request, name string, modtime time.Time, content io.ReadSeeker) {
@@ -122,13 +129,11 @@ func ServeContent(w ResponseWriter, req *Request, name string, modtime time.Time
 // if modtime.IsZero(), modtime is unknown.
 // content must be seeked to the beginning of the file.
 func serveContent(w ResponseWriter, r *Request, name string, modtime time.Time, size int64, content io.ReadSeeker) {
-	if checkLastModified(w, r, modtime) {
-		return
-	}
-	rangeReq, done := checkETag(w, r)
+	rangeReq, done := checkPreconditions(w, r, modtime)
 	if done {
 		return
 	}
+	setLastModified(w, modtime)
 
 	code := StatusOK
 
@@ -237,80 +242,168 @@ func serveContent(w ResponseWriter, r *Request, name string, modtime time.Time,
 	}
 }
 
-// modtime is the modification time of the resource to be served, or IsZero().
-// return value is whether this request is now complete.
-func checkLastModified(w ResponseWriter, r *Request, modtime time.Time) bool {
-	if modtime.IsZero() {
-		return false
-	}
-
-	// The Date-Modified header truncates sub-second precision, so
-	// use mtime < t+1s instead of mtime <= t to check for unmodified.
-	if t, err := time.Parse(TimeFormat, r.Header.Get("If-Modified-Since")); err == nil && modtime.Before(t.Add(1*time.Second)) {
-		h := w.Header()
-		delete(h, "Content-Type")
-		delete(h, "Content-Length")
-		w.WriteHeader(StatusNotModified)
-		return true
+// setLastModified sets w's Last-Modified header from modtime, unless
+// modtime.IsZero().
+func setLastModified(w ResponseWriter, modtime time.Time) {
+	if !modtime.IsZero() {
+		w.Header().Set("Last-Modified", modtime.UTC().Format(TimeFormat))
 	}
-	w.Header().Set("Last-Modified", modtime.UTC().Format(TimeFormat))
-	return false
 }
 
-// checkETag implements If-None-Match and If-Range checks.
-// The ETag must have been previously set in the ResponseWriter's headers.
+// checkPreconditions evaluates the conditional request headers of
+// RFC 2616, section 14, against the ETag set in w's header, if any,
+// and modtime, which is the modification time of the resource to be
+// served, or IsZero().
 //
 // The return value is the effective request "Range" header to use and
-// whether this request is now considered done.
-func checkETag(w ResponseWriter, r *Request) (rangeReq string, done bool) {
+// whether this request is now considered done, with a 304 Not Modified
+// or 412 Precondition Failed response written.
+func checkPreconditions(w ResponseWriter, r *Request, modtime time.Time) (rangeReq string, done bool) {
 	etag := w.Header().get("Etag")
-	rangeReq = r.Header.get("Range")
 
-	// Invalidate the range request if the entity doesn't match the one
-	// the client was expecting.
-	// "If-Range: version" means "ignore the Range: header unless version matches the
-	// current file."
-	// We only support ETag versions.
-	// The caller must have set the ETag on the response already.
-	if ir := r.Header.get("If-Range"); ir != "" && ir != etag {
-		// TODO(bradfitz): handle If-Range requests with Last-Modified
-		// times instead of ETags? I'd rather not, at least for
-		// now. That seems like a bug/compromise in the RFC 2616, and
-		// I've never heard of anybody caring about that (yet).
-		rangeReq = ""
+	// If-Match, or failing that If-Unmodified-Since, must hold for
+	// any method.
+	if im := r.Header.get("If-Match"); im != "" {
+		if !etagListMatch(im, etag, true) {
+			writePreconditionFailed(w)
+			return "", true
+		}
+	} else if t, ok := parseIfModifiedTime(r.Header.get("If-Unmodified-Since"), modtime); ok && !notModifiedSince(modtime, t) {
+		writePreconditionFailed(w)
+		return "", true
 	}
 
+	// If-None-Match, or failing that If-Modified-Since, decides
+	// whether the client's copy is current.
+	get := r.Method == "GET" || r.Method == "HEAD"
 	if inm := r.Header.get("If-None-Match"); inm != "" {
-		// Must know ETag.
-		if etag == "" {
-			return rangeReq, false
+		if etagListMatch(inm, etag, false) {
+			if get {
+				writeNotModified(w)
+			} else {
+				writePreconditionFailed(w)
+			}
+			return "", true
 		}
+	} else if t, ok := parseIfModifiedTime(r.Header.get("If-Modified-Since"), modtime); ok && get && notModifiedSince(modtime, t) {
+		writeNotModified(w)
+		return "", true
+	}
 
-		// TODO(bradfitz): non-GET/HEAD requests require more work:
-		// sending a different status code on matches, and
-		// also can't use weak cache validators (those with a "W/
-		// prefix).  But most users of ServeContent will be using
-		// it on GET or HEAD, so only support those for now.
-		if r.Method != "GET" && r.Method != "HEAD" {
-			return rangeReq, false
+	// "If-Range: validator" means "ignore the Range: header unless
+	// validator matches the current entity". The validator is either
+	// a strong entity tag or the exact Last-Modified date.
+	rangeReq = r.Header.get("Range")
+	if ir := r.Header.get("If-Range"); ir != "" && rangeReq != "" {
+		if strings.HasPrefix(ir, `"`) || strings.HasPrefix(ir, "W/") {
+			if !etagStrongMatch(ir, etag) {
+				rangeReq = ""
+			}
+		} else if t, err := time.Parse(TimeFormat, ir); err != nil || modtime.IsZero() || !modtime.Truncate(time.Second).Equal(t) {
+			rangeReq = ""
 		}
+	}
+	return rangeReq, false
+}
 
-		// TODO(bradfitz): deal with comma-separated or multiple-valued
-		// list of If-None-match values.  For now just handle the common
-		// case of a single item.
-		if inm == etag || inm == "*" {
-			h := w.Header()
-			delete(h, "Content-Type")
-			delete(h, "Content-Length")
-			w.WriteHeader(StatusNotModified)
-			return "", true
+// parseIfModifiedTime parses the value of an If-Modified-Since or
+// If-Unmodified-Since header. It reports false if the header is
+// absent or invalid, or if modtime is unknown.
+func parseIfModifiedTime(v string, modtime time.Time) (time.Time, bool) {
+	if v == "" || modtime.IsZero() {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(TimeFormat, v)
+	return t, err == nil
+}
+
+// notModifiedSince reports whether modtime is no later than t.
+// The Last-Modified header truncates sub-second precision, so use
+// mtime < t+1s instead of mtime <= t.
+func notModifiedSince(modtime, t time.Time) bool {
+	return modtime.Before(t.Add(1 * time.Second))
+}
+
+func writeNotModified(w ResponseWriter) {
+	h := w.Header()
+	delete(h, "Content-Type")
+	delete(h, "Content-Length")
+	delete(h, "Content-Encoding")
+	w.WriteHeader(StatusNotModified)
+}
+
+func writePreconditionFailed(w ResponseWriter) {
+	h := w.Header()
+	delete(h, "Content-Type")
+	delete(h, "Content-Length")
+	delete(h, "Content-Encoding")
+	w.WriteHeader(StatusPreconditionFailed)
+}
+
+// scanETag returns the first entity tag in the comma-separated list s,
+// including any "W/" prefix, and the remainder of the list. It returns
+// an empty tag if s does not begin with a valid entity tag.
+func scanETag(s string) (etag, remain string) {
+	s = strings.TrimLeft(s, " \t,")
+	start := 0
+	if strings.HasPrefix(s, "W/") {
+		start = 2
+	}
+	if len(s) < start+2 || s[start] != '"' {
+		return "", ""
+	}
+	for i := start + 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			return s[:i+1], s[i+1:]
+		case c < 0x21 || c == 0x7f:
+			return "", ""
 		}
 	}
-	return rangeReq, false
+	return "", ""
+}
+
+// etagStrongMatch reports whether a and b are the same strong entity
+// tag, per RFC 2616, section 13.3.3.
+func etagStrongMatch(a, b string) bool {
+	return a == b && a != "" && !strings.HasPrefix(a, "W/")
+}
+
+// etagWeakMatch reports whether a and b have the same opaque tag,
+// ignoring any weakness indicator.
+func etagWeakMatch(a, b string) bool {
+	if strings.HasPrefix(a, "W/") {
+		a = a[2:]
+	}
+	if strings.HasPrefix(b, "W/") {
+		b = b[2:]
+	}
+	return a == b && a != ""
+}
+
+// etagListMatch reports whether the If-Match or If-None-Match header
+// value list matches etag. "*" matches any current entity, as the
+// resource being served exists.
+func etagListMatch(list, etag string, strong bool) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	for {
+		var tag string
+		tag, list = scanETag(list)
+		if tag == "" {
+			return false
+		}
+		if strong && etagStrongMatch(tag, etag) || !strong && etagWeakMatch(tag, etag) {
+			return true
+		}
+	}
+	panic("unreachable")
 }
 
 // name is '/'-separated, not filepath.Separator.
-func serveFile(w ResponseWriter, r *Request, fs FileSystem, name string, redirect bool) {
+func (h *FileHandler) serveFile(w ResponseWriter, r *Request, name string, redirect bool) {
+	fs := h.Root
 	const indexPage = "/index.html"
 
 	// redirect .../index.html to .../
@@ -370,15 +463,44 @@ func serveFile(w ResponseWriter, r *Request, fs FileSystem, name string, redirec
 
 	// Still a directory? (we didn't find an index.html file)
 	if d.IsDir() {
-		if checkLastModified(w, r, d.ModTime()) {
+		if _, done := checkPreconditions(w, r, d.ModTime()); done {
 			return
 		}
+		setLastModified(w, d.ModTime())
 		dirList(w, f)
 		return
 	}
 
-	// serverContent will check modification time
-	serveContent(w, r, d.Name(), d.ModTime(), d.Size(), f)
+	// Serve a precompressed variant instead, if there is one and the
+	// client accepts it. Its type is that of the uncompressed file, so
+	// it must be known without sniffing.
+	contentName := d.Name()
+	if h.Precompressed && d.Mode().IsRegular() && !strings.HasSuffix(name, ".gz") &&
+		(w.Header().Get("Content-Type") != "" || mime.TypeByExtension(filepath.Ext(contentName)) != "") {
+		if gf, err := fs.Open(name + ".gz"); err == nil {
+			defer gf.Close()
+			if gd, err := gf.Stat(); err == nil && gd.Mode().IsRegular() {
+				w.Header().Add("Vary", "Accept-Encoding")
+				if acceptEncodingQ(r.Header.get("Accept-Encoding"), "gzip") > 0 {
+					w.Header().Set("Content-Encoding", "gzip")
+					f, d = gf, gd
+					name += ".gz"
+				}
+			}
+		}
+	}
+
+	if h.ETag != ETagNone {
+		etag, err := h.etag(name, d, f)
+		if err != nil {
+			Error(w, err.Error(), StatusInternalServerError)
+			return
+		}
+		w.Header().Set("ETag", etag)
+	}
+
+	// serveContent will check modification time and ETag
+	serveContent(w, r, contentName, d.ModTime(), d.Size(), f)
 }
 
 // localRedirect gives a Moved Permanently response.
@@ -394,11 +516,61 @@ func localRedirect(w ResponseWriter, r *Request, newPath string) {
 // ServeFile replies to the request with the contents of the named file or directory.
 func ServeFile(w ResponseWriter, r *Request, name string) {
 	dir, file := filepath.Split(name)
-	serveFile(w, r, Dir(dir), file, false)
+	h := &FileHandler{Root: Dir(dir)}
+	h.serveFile(w, r, file, false)
 }
 
-type fileHandler struct {
-	root FileSystem
+// An ETagMode specifies how a FileHandler generates ETags.
+type ETagMode int
+
+const (
+	ETagNone        ETagMode = iota // no ETags
+	ETagContentHash                 // SHA-1 hash of the file contents
+	ETagInode                       // inode number, size and modification time
+)
+
+// A FileHandler serves HTTP requests with the contents of a file
+// system. FileServer returns a FileHandler with default settings.
+type FileHandler struct {
+	// Root is the file system to serve.
+	Root FileSystem
+
+	// ETag specifies how to generate the ETag header of file
+	// responses, which is then used to evaluate If-Match,
+	// If-None-Match and If-Range requests. With ETagContentHash,
+	// the hash of each file is computed on first use and cached
+	// until the file's size or modification time changes; only the
+	// most recently used hashes are kept.
+	// ETagInode requires the FileSystem's os.FileInfo values to
+	// carry inode numbers, as those of Dir do on Unix systems;
+	// otherwise only the size and modification time are used.
+	ETag ETagMode
+
+	// Precompressed specifies whether a file may be served from a
+	// precompressed sibling with a ".gz" suffix, such as
+	// "app.js.gz" for "app.js". If the sibling exists and the
+	// request's Accept-Encoding header allows gzip, its contents
+	// are sent with "Content-Encoding: gzip" and the Content-Type
+	// of the uncompressed file, which must be known from its
+	// extension or the response header. Responses for files with a
+	// precompressed sibling carry a "Vary: Accept-Encoding" header.
+	Precompressed bool
+
+	mu     sync.Mutex
+	hashes map[string]*list.Element // of *contentHash, keyed by file name
+	lru    *list.List               // of *contentHash, most recent first
+}
+
+// maxContentHashes is the number of ETagContentHash ETags a
+// FileHandler caches.
+const maxContentHashes = 1000
+
+// contentHash is a cached ETagContentHash ETag.
+type contentHash struct {
+	name    string
+	size    int64
+	modtime time.Time
+	etag    string
 }
 
 // FileServer returns a handler that serves HTTP requests
@@ -408,17 +580,85 @@ type fileHandler struct {
 // use http.Dir:
 //
 //     http.Handle("/", http.FileServer(http.Dir("/tmp")))
+//
+// To generate ETags or serve precompressed files, use a FileHandler.
 func FileServer(root FileSystem) Handler {
-	return &fileHandler{root}
+	return &FileHandler{Root: root}
 }
 
-func (f *fileHandler) ServeHTTP(w ResponseWriter, r *Request) {
+func (h *FileHandler) ServeHTTP(w ResponseWriter, r *Request) {
 	upath := r.URL.Path
 	if !strings.HasPrefix(upath, "/") {
 		upath = "/" + upath
 		r.URL.Path = upath
 	}
-	serveFile(w, r, f.root, path.Clean(upath), true)
+	h.serveFile(w, r, path.Clean(upath), true)
+}
+
+// etag returns the ETag for the file f, with the given name and
+// FileInfo d, according to h.ETag. It leaves f positioned at its
+// beginning.
+func (h *FileHandler) etag(name string, d os.FileInfo, f File) (string, error) {
+	if h.ETag == ETagInode {
+		if ino, ok := fileInode(d); ok {
+			return fmt.Sprintf(`"%x-%x-%x"`, ino, d.Size(), d.ModTime().UnixNano()), nil
+		}
+		return fmt.Sprintf(`"%x-%x"`, d.Size(), d.ModTime().UnixNano()), nil
+	}
+
+	if etag, ok := h.cachedHash(name, d); ok {
+		return etag, nil
+	}
+
+	hash := sha1.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	if _, err := f.Seek(0, os.SEEK_SET); err != nil {
+		return "", err
+	}
+	c := &contentHash{
+		name:    name,
+		size:    d.Size(),
+		modtime: d.ModTime(),
+		etag:    `"` + hex.EncodeToString(hash.Sum(nil)) + `"`,
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.hashes == nil {
+		h.hashes = make(map[string]*list.Element)
+		h.lru = list.New()
+	}
+	if e, ok := h.hashes[name]; ok {
+		h.lru.Remove(e)
+	}
+	h.hashes[name] = h.lru.PushFront(c)
+	for h.lru.Len() > maxContentHashes {
+		e := h.lru.Back()
+		h.lru.Remove(e)
+		delete(h.hashes, e.Value.(*contentHash).name)
+	}
+	return c.etag, nil
+}
+
+// cachedHash returns the cached ETagContentHash ETag for the file
+// with the given name and FileInfo d, if there is one. A cached hash
+// for an older version of the file is dropped.
+func (h *FileHandler) cachedHash(name string, d os.FileInfo) (string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	e, ok := h.hashes[name]
+	if !ok {
+		return "", false
+	}
+	c := e.Value.(*contentHash)
+	if c.size != d.Size() || !c.modtime.Equal(d.ModTime()) {
+		h.lru.Remove(e)
+		delete(h.hashes, name)
+		return "", false
+	}
+	h.lru.MoveToFront(e)
+	return c.etag, true
 }
 
 // httpRange specifies the byte range to be sent to the client.
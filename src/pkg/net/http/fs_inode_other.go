@@ -0,0 +1,15 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build plan9 windows
+
+package http
+
+import "os"
+
+// fileInode returns the inode number of the file described by fi,
+// if known. Inode numbers are not available on this system.
+func fileInode(fi os.FileInfo) (uint64, bool) {
+	return 0, false
+}
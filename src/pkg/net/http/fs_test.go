@@ -6,6 +6,8 @@ package http_test
 
 import (
 	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -622,6 +624,80 @@ func TestServeContent(t *testing.T) {
 			wantStatus:      200,
 			wantContentType: "text/css; charset=utf-8",
 		},
+		"not_modified_etag_list_weak": {
+			file:      "testdata/style.css",
+			serveETag: `W/"foo"`,
+			reqHeader: map[string]string{
+				"If-None-Match": `"bar", "foo"`,
+			},
+			wantStatus: 304,
+		},
+		"not_modified_star": {
+			file: "testdata/style.css",
+			reqHeader: map[string]string{
+				"If-None-Match": "*",
+			},
+			wantStatus: 304,
+		},
+		"if_match_fail": {
+			file:      "testdata/style.css",
+			serveETag: `"A"`,
+			reqHeader: map[string]string{
+				"If-Match": `"B"`,
+			},
+			wantStatus:      StatusPreconditionFailed,
+			wantContentType: "text/plain; charset=utf-8",
+		},
+		// If-Match uses the strong comparison function.
+		"if_match_weak": {
+			file:      "testdata/style.css",
+			serveETag: `W/"A"`,
+			reqHeader: map[string]string{
+				"If-Match": `W/"A"`,
+			},
+			wantStatus:      StatusPreconditionFailed,
+			wantContentType: "text/plain; charset=utf-8",
+		},
+		"if_match_list": {
+			file:      "testdata/style.css",
+			serveETag: `"A"`,
+			reqHeader: map[string]string{
+				"If-Match": `"B", "A"`,
+			},
+			wantStatus:      200,
+			wantContentType: "text/css; charset=utf-8",
+		},
+		"if_unmodified_since_fail": {
+			file:    "testdata/style.css",
+			modtime: htmlModTime,
+			reqHeader: map[string]string{
+				"If-Unmodified-Since": htmlModTime.Add(-1 * time.Hour).UTC().Format(TimeFormat),
+			},
+			wantStatus:      StatusPreconditionFailed,
+			wantContentType: "text/plain; charset=utf-8",
+		},
+		"range_if_range_date": {
+			file:    "testdata/style.css",
+			modtime: htmlModTime,
+			reqHeader: map[string]string{
+				"Range":    "bytes=0-4",
+				"If-Range": htmlModTime.UTC().Format(TimeFormat),
+			},
+			wantStatus:      StatusPartialContent,
+			wantContentType: "text/css; charset=utf-8",
+			wantLastMod:     htmlModTime.UTC().Format(TimeFormat),
+		},
+		// If-Range requires a strong validator.
+		"range_if_range_weak": {
+			file:      "testdata/style.css",
+			serveETag: `W/"A"`,
+			reqHeader: map[string]string{
+				"Range":    "bytes=0-4",
+				"If-Range": `W/"A"`,
+			},
+			wantStatus:      200,
+			wantContentType: "text/css; charset=utf-8",
+		},
 	}
 	for testName, tt := range tests {
 		f, err := os.Open(tt.file)
@@ -662,6 +738,137 @@ func TestServeContent(t *testing.T) {
 	}
 }
 
+func TestFileServerETag(t *testing.T) {
+	contents, err := ioutil.ReadFile("testdata/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.New()
+	sum.Write(contents)
+	hashETag := `"` + hex.EncodeToString(sum.Sum(nil)) + `"`
+
+	for _, mode := range []ETagMode{ETagContentHash, ETagInode} {
+		ts := httptest.NewServer(&FileHandler{Root: Dir("testdata"), ETag: mode})
+		res, err := Get(ts.URL + "/file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		etag := res.Header.Get("ETag")
+		if mode == ETagContentHash && etag != hashETag {
+			t.Errorf("content hash ETag = %q; want %q", etag, hashETag)
+		}
+		if !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) || len(etag) < 3 {
+			t.Errorf("mode %d: invalid ETag %q", mode, etag)
+		}
+
+		// A second request must produce the same ETag and be
+		// answered with 304 when it matches.
+		req, _ := NewRequest("GET", ts.URL+"/file", nil)
+		req.Header.Set("If-None-Match", etag)
+		res, err = DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != StatusNotModified {
+			t.Errorf("mode %d: If-None-Match status = %d; want 304", mode, res.StatusCode)
+		}
+		if g := res.Header.Get("ETag"); g != etag {
+			t.Errorf("mode %d: 304 ETag = %q; want %q", mode, g, etag)
+		}
+		ts.Close()
+	}
+
+	ts := httptest.NewServer(FileServer(Dir("testdata")))
+	defer ts.Close()
+	res, err := Get(ts.URL + "/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if etag := res.Header.Get("ETag"); etag != "" {
+		t.Errorf("FileServer sent ETag %q; want none", etag)
+	}
+}
+
+func TestFileServerContentHashCacheBounded(t *testing.T) {
+	modtime := time.Unix(1000000000, 0).UTC()
+	fs := fakeFS{}
+	for i := 0; i < MaxContentHashes+10; i++ {
+		name := fmt.Sprintf("f%d.txt", i)
+		fs["/"+name] = &fakeFileInfo{basename: name, modtime: modtime, contents: name}
+	}
+	h := &FileHandler{Root: fs, ETag: ETagContentHash}
+	for name := range fs {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, &Request{Method: "GET", URL: &url.URL{Path: name}})
+		if rec.Code != StatusOK || rec.HeaderMap.Get("ETag") == "" {
+			t.Fatalf("%s: status %d, ETag %q", name, rec.Code, rec.HeaderMap.Get("ETag"))
+		}
+	}
+	if n := h.ContentHashCountForTesting(); n != MaxContentHashes {
+		t.Errorf("cached %d content hashes; want %d", n, MaxContentHashes)
+	}
+}
+
+func TestFileServerPrecompressed(t *testing.T) {
+	modtime := time.Unix(1000000000, 0).UTC()
+	fs := fakeFS{
+		"/app.js":    &fakeFileInfo{basename: "app.js", modtime: modtime, contents: "var x = 1;"},
+		"/app.js.gz": &fakeFileInfo{basename: "app.js.gz", modtime: modtime, contents: "pretend gzip"},
+		"/plain.txt": &fakeFileInfo{basename: "plain.txt", modtime: modtime, contents: "plain"},
+	}
+	ts := httptest.NewServer(&FileHandler{Root: fs, ETag: ETagContentHash, Precompressed: true})
+	defer ts.Close()
+
+	tests := []struct {
+		path, accept string
+		wantEncoding string
+		wantVary     bool
+		wantBody     string
+	}{
+		{"/app.js", "gzip, deflate", "gzip", true, "pretend gzip"},
+		{"/app.js", "deflate", "", true, "var x = 1;"},
+		{"/app.js", "gzip;q=0", "", true, "var x = 1;"},
+		{"/app.js", "", "", true, "var x = 1;"},
+		{"/app.js.gz", "gzip", "", false, "pretend gzip"},
+	}
+	etags := make(map[string]string)
+	tr := &Transport{DisableCompression: true}
+	for _, tt := range tests {
+		req, _ := NewRequest("GET", ts.URL+tt.path, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept-Encoding", tt.accept)
+		}
+		res, err := tr.RoundTrip(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if g := res.Header.Get("Content-Encoding"); g != tt.wantEncoding {
+			t.Errorf("%s (%q): Content-Encoding = %q; want %q", tt.path, tt.accept, g, tt.wantEncoding)
+		}
+		if g := res.Header.Get("Vary") == "Accept-Encoding"; g != tt.wantVary {
+			t.Errorf("%s (%q): Vary = %q; want set = %v", tt.path, tt.accept, res.Header.Get("Vary"), tt.wantVary)
+		}
+		if string(body) != tt.wantBody {
+			t.Errorf("%s (%q): body = %q; want %q", tt.path, tt.accept, body, tt.wantBody)
+		}
+		if tt.path == "/app.js" {
+			if g, e := res.Header.Get("Content-Type"), mime.TypeByExtension(".js"); g != e {
+				t.Errorf("%s (%q): Content-Type = %q", tt.path, tt.accept, g)
+			}
+			etags[tt.wantEncoding] = res.Header.Get("ETag")
+		}
+	}
+	// Each variant needs its own ETag.
+	if etags["gzip"] == etags[""] {
+		t.Errorf("compressed and uncompressed variants share ETag %q", etags[""])
+	}
+}
+
 // verifies that sendfile is being used on Linux
 func TestLinuxSendfile(t *testing.T) {
 	if runtime.GOOS != "linux" {
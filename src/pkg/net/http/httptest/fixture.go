@@ -0,0 +1,263 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Implementation of FixtureTransport
+
+package httptest
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// FixtureTransport is an http.RoundTripper that records requests and
+// their responses to a fixture file, or replays the recorded responses
+// without contacting any server, so that tests of HTTP clients can run
+// offline and deterministically.
+//
+// A fixture file holds a sequence of request and response pairs, each
+// in wire format with a Content-Length framed body, as produced by
+// httputil.DumpRequestOut and httputil.DumpResponse. The pairs are
+// written with http.Request's and http.Response's Write methods, which
+// those functions also use, as this package cannot import httputil,
+// whose tests depend on it. The only difference is that the recorded
+// request lacks the Accept-Encoding header that DumpRequestOut adds on
+// behalf of http.Transport. The scheme of request URLs is not
+// recorded.
+//
+// When replaying, a request matches a recorded one if they have the
+// same method, host and request URI, the same values for the header
+// fields listed in MatchHeaders and, if MatchBody is set, the same
+// body. Each recorded pair is replayed once, in the order recorded;
+// when all pairs matching a request have been replayed, the last of
+// them is replayed again. A request that matches no recorded pair
+// fails with an error.
+type FixtureTransport struct {
+	// Transport performs the requests being recorded. If nil,
+	// http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// MatchHeaders lists the header fields that must have equal
+	// values in matching requests.
+	MatchHeaders []string
+
+	// MatchBody requires matching requests to have equal bodies.
+	MatchBody bool
+
+	replay   bool       // replaying rather than recording
+	mu       sync.Mutex // guards w and the fixtures' used fields
+	w        *os.File   // fixture file being recorded, or nil once closed
+	fixtures []*fixture // recorded pairs being replayed
+}
+
+// fixture is a recorded request and response pair.
+type fixture struct {
+	req     *http.Request
+	reqBody []byte
+	res     *http.Response
+	resBody []byte
+	used    bool
+}
+
+// NewRecordingTransport returns a FixtureTransport that sends requests
+// using rt and records them and their responses to the named file,
+// which is created or truncated. The caller must call Close when
+// done.
+func NewRecordingTransport(filename string, rt http.RoundTripper) (*FixtureTransport, error) {
+	f, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &FixtureTransport{Transport: rt, w: f}, nil
+}
+
+// NewReplayTransport returns a FixtureTransport that replays the
+// responses recorded in the named file.
+func NewReplayTransport(filename string) (*FixtureTransport, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	t := &FixtureTransport{replay: true}
+	br := bufio.NewReader(f)
+	for {
+		if _, err := br.Peek(1); err == io.EOF {
+			break
+		}
+		fx, err := readFixture(br)
+		if err != nil {
+			return nil, fmt.Errorf("httptest: reading fixture %d of %s: %v", len(t.fixtures)+1, filename, err)
+		}
+		t.fixtures = append(t.fixtures, fx)
+	}
+	return t, nil
+}
+
+func readFixture(br *bufio.Reader) (*fixture, error) {
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return nil, err
+	}
+	reqBody, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &fixture{req: req, reqBody: reqBody, res: res, resBody: resBody}, nil
+}
+
+// Close closes the fixture file being recorded.
+func (t *FixtureTransport) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.w == nil {
+		return nil
+	}
+	err := t.w.Close()
+	t.w = nil
+	return err
+}
+
+func (t *FixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if t.replay {
+		return t.replayResponse(req, body)
+	}
+	return t.record(req, body)
+}
+
+func (t *FixtureTransport) record(req *http.Request, body []byte) (*http.Response, error) {
+	outreq := new(http.Request)
+	*outreq = *req
+	outreq.Body = bodyReader(body)
+	outreq.ContentLength = int64(len(body))
+	outreq.TransferEncoding = nil
+	rt := t.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	res, err := rt.RoundTrip(outreq)
+	if err != nil {
+		return nil, err
+	}
+	resBody, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// The framing matches httputil.DumpRequestOut and
+	// httputil.DumpResponse; see the FixtureTransport comment.
+	var buf bytes.Buffer
+	outreq.Body = bodyReader(body)
+	if err := outreq.Write(&buf); err != nil {
+		return nil, err
+	}
+	dres := new(http.Response)
+	*dres = *res
+	dres.Request = outreq
+	if req.Method == "HEAD" {
+		dres.Body = nil
+		dres.TransferEncoding = nil
+		if dres.ContentLength < 0 {
+			dres.ContentLength = 0
+		}
+	} else {
+		// Frame even an empty body with Content-Length, rather
+		// than the end of the file.
+		dres.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+		dres.ContentLength = int64(len(resBody))
+		dres.TransferEncoding = []string{"identity"}
+	}
+	if err := dres.Write(&buf); err != nil {
+		return nil, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.w == nil {
+		return nil, errors.New("httptest: FixtureTransport is closed")
+	}
+	if _, err := t.w.Write(buf.Bytes()); err != nil {
+		return nil, err
+	}
+
+	res.Body = ioutil.NopCloser(bytes.NewReader(resBody))
+	return res, nil
+}
+
+// bodyReader returns a request or response body reading b, or nil if
+// b is empty.
+func bodyReader(b []byte) io.ReadCloser {
+	if len(b) == 0 {
+		return nil
+	}
+	return ioutil.NopCloser(bytes.NewReader(b))
+}
+
+func (t *FixtureTransport) replayResponse(req *http.Request, body []byte) (*http.Response, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var last *fixture
+	for _, fx := range t.fixtures {
+		if !t.match(req, body, fx) {
+			continue
+		}
+		last = fx
+		if !fx.used {
+			break
+		}
+	}
+	if last == nil {
+		return nil, fmt.Errorf("httptest: no recorded response for %s %s", req.Method, req.URL)
+	}
+	last.used = true
+	res := new(http.Response)
+	*res = *last.res
+	res.Header = make(http.Header)
+	for k, vv := range last.res.Header {
+		res.Header[k] = append([]string(nil), vv...)
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(last.resBody))
+	res.Request = req
+	return res, nil
+}
+
+func (t *FixtureTransport) match(req *http.Request, body []byte, fx *fixture) bool {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	if req.Method != fx.req.Method || host != fx.req.Host || req.URL.RequestURI() != fx.req.URL.RequestURI() {
+		return false
+	}
+	for _, h := range t.MatchHeaders {
+		if fmt.Sprint(req.Header[http.CanonicalHeaderKey(h)]) != fmt.Sprint(fx.req.Header[http.CanonicalHeaderKey(h)]) {
+			return false
+		}
+	}
+	return !t.MatchBody || bytes.Equal(body, fx.reqBody)
+}
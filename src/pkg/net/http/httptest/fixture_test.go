@@ -0,0 +1,131 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httptest
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func fixtureGet(t *testing.T, c *http.Client, method, url, key, body string) (string, error) {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set("X-Key", key)
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("%d %s %s", res.StatusCode, res.Header.Get("X-Count"), b), nil
+}
+
+func TestFixtureTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httptest-fixture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "fixture.http")
+
+	var mu sync.Mutex
+	count := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		count++
+		n := count
+		mu.Unlock()
+		w.Header().Set("X-Count", fmt.Sprint(n))
+		switch r.URL.Path {
+		case "/empty":
+			return
+		case "/post":
+			b, _ := ioutil.ReadAll(r.Body)
+			io.WriteString(w, r.Header.Get("X-Key")+":"+string(b))
+			return
+		}
+		io.WriteString(w, "path "+r.URL.Path)
+	})
+
+	rec, err := NewRecordingTransport(filename, NewHandlerTransport(handler))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &http.Client{Transport: rec}
+	recorded := []struct {
+		method, url, key, body string
+		want                   string
+	}{
+		{"GET", "http://example.com/a", "", "", "200 1 path /a"},
+		{"POST", "http://example.com/post", "k1", "data", "200 2 k1:data"},
+		{"GET", "http://example.com/empty", "", "", "200 3 "},
+		{"GET", "http://example.com/a", "", "", "200 4 path /a"},
+	}
+	for _, r := range recorded {
+		got, err := fixtureGet(t, c, r.method, r.url, r.key, r.body)
+		if err != nil || got != r.want {
+			t.Errorf("recording %s %s = %q, %v; want %q", r.method, r.url, got, err, r.want)
+		}
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dump, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(dump), "GET /a HTTP/1.1\r\nHost: example.com\r\n") {
+		t.Errorf("fixture file starts with %q", dump[:20])
+	}
+
+	rep, err := NewReplayTransport(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rep.MatchHeaders = []string{"X-Key"}
+	rep.MatchBody = true
+	c = &http.Client{Transport: rep}
+	replayed := []struct {
+		method, url, key, body string
+		want                   string // "" for an error
+	}{
+		{"GET", "http://example.com/a", "", "", "200 1 path /a"},
+		{"GET", "http://example.com/a", "", "", "200 4 path /a"},
+		{"GET", "http://example.com/a", "", "", "200 4 path /a"}, // last one again
+		{"GET", "http://example.com/empty", "", "", "200 3 "},
+		{"POST", "http://example.com/post", "k1", "data", "200 2 k1:data"},
+		{"POST", "http://example.com/post", "k2", "data", ""},
+		{"POST", "http://example.com/post", "k1", "other", ""},
+		{"GET", "http://example.com/post", "k1", "", ""},
+		{"GET", "http://example.org/a", "", "", ""},
+		{"GET", "http://example.com/b", "", "", ""},
+	}
+	for _, r := range replayed {
+		got, err := fixtureGet(t, c, r.method, r.url, r.key, r.body)
+		if r.want == "" {
+			if err == nil {
+				t.Errorf("replaying %s %s (key %q, body %q) = %q; want error", r.method, r.url, r.key, r.body, got)
+			}
+			continue
+		}
+		if err != nil || got != r.want {
+			t.Errorf("replaying %s %s = %q, %v; want %q", r.method, r.url, got, err, r.want)
+		}
+	}
+	if count != len(recorded) {
+		t.Errorf("handler called %d times; want %d", count, len(recorded))
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Implementation of HandlerTransport
+
+package httptest
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// HandlerTransport is an http.RoundTripper that serves each request
+// in-process with a Handler, without opening any sockets. It can be
+// used as the Transport of an http.Client to test handlers through
+// client code.
+//
+// Each request is written in wire format to one end of an in-memory
+// connection, the other end of which is served by an http.Server, and
+// the response is read back from it, so that the handler sees the
+// request as a real server would and the response body streams as the
+// handler writes and flushes it. The ResponseWriter passed to the
+// handler implements http.Flusher, http.Hijacker and
+// http.CloseNotifier; closing the response body before reading it to
+// the end closes the connection and so notifies the handler.
+//
+// Unlike http.Transport, HandlerTransport does not request or decode
+// gzip-compressed responses, and its connections are not reused.
+type HandlerTransport struct {
+	// Handler serves the requests.
+	Handler http.Handler
+
+	// RemoteAddr is the client network address seen by the
+	// handler in Request.RemoteAddr. If empty, "127.0.0.1:1234" is
+	// used.
+	RemoteAddr string
+}
+
+// NewHandlerTransport returns a new HandlerTransport that serves
+// requests with handler.
+func NewHandlerTransport(handler http.Handler) *HandlerTransport {
+	return &HandlerTransport{Handler: handler}
+}
+
+func (t *HandlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	remote := t.RemoteAddr
+	if remote == "" {
+		remote = "127.0.0.1:1234"
+	}
+	host := req.URL.Host
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host += ":80"
+	}
+	client, server := net.Pipe()
+	srv := &http.Server{Handler: t.Handler}
+	go srv.Serve(&pipeListener{conn: &addrConn{server, fakeAddr(host), fakeAddr(remote)}})
+
+	writec := make(chan error, 1)
+	go func() {
+		writec <- req.Write(client)
+	}()
+	res, err := http.ReadResponse(bufio.NewReader(client), req)
+	if err != nil {
+		client.Close()
+		select {
+		case werr := <-writec:
+			if werr != nil {
+				return nil, werr
+			}
+		default:
+		}
+		return nil, err
+	}
+	res.Body = &pipeBody{ReadCloser: res.Body, conn: client}
+	return res, nil
+}
+
+// pipeBody is a response body that closes its connection when closed.
+type pipeBody struct {
+	io.ReadCloser
+	conn net.Conn
+}
+
+func (b *pipeBody) Close() error {
+	// Close the connection first: closing the body alone would
+	// wait for the rest of it to be read.
+	b.conn.Close()
+	b.ReadCloser.Close()
+	return nil
+}
+
+// pipeListener is a net.Listener that accepts a single connection.
+type pipeListener struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	c := l.conn
+	if c == nil {
+		return nil, io.EOF
+	}
+	l.conn = nil
+	return c, nil
+}
+
+func (l *pipeListener) Close() error { return nil }
+
+func (l *pipeListener) Addr() net.Addr { return fakeAddr("pipe") }
+
+// addrConn is a net.Conn with the given addresses.
+type addrConn struct {
+	net.Conn
+	local, remote net.Addr
+}
+
+func (c *addrConn) LocalAddr() net.Addr  { return c.local }
+func (c *addrConn) RemoteAddr() net.Addr { return c.remote }
+
+// fakeAddr is a TCP network address.
+type fakeAddr string
+
+func (a fakeAddr) Network() string { return "tcp" }
+func (a fakeAddr) String() string  { return string(a) }
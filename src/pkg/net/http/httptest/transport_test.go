@@ -0,0 +1,123 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httptest
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandlerTransport(t *testing.T) {
+	c := &http.Client{Transport: NewHandlerTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Remote", r.RemoteAddr)
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, r.Host+r.URL.RequestURI()+" "+string(body))
+	}))}
+
+	res, err := c.Post("http://example.com/path?q=1", "text/plain", strings.NewReader("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("status = %d; want 201", res.StatusCode)
+	}
+	if g, e := string(body), "example.com/path?q=1 data"; g != e {
+		t.Errorf("body = %q; want %q", g, e)
+	}
+	if g := res.Header.Get("X-Method"); g != "POST" {
+		t.Errorf("handler saw method %q", g)
+	}
+	if g := res.Header.Get("X-Remote"); g != "127.0.0.1:1234" {
+		t.Errorf("handler saw RemoteAddr %q", g)
+	}
+}
+
+func TestHandlerTransportStreaming(t *testing.T) {
+	release := make(chan bool)
+	c := &http.Client{Transport: NewHandlerTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "first\n")
+		w.(http.Flusher).Flush()
+		<-release
+		io.WriteString(w, "second\n")
+	}))}
+
+	res, err := c.Get("http://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	br := bufio.NewReader(res.Body)
+	if line, err := br.ReadString('\n'); line != "first\n" || err != nil {
+		t.Fatalf("first line = %q, %v", line, err)
+	}
+	close(release)
+	rest, err := ioutil.ReadAll(br)
+	if string(rest) != "second\n" || err != nil {
+		t.Errorf("rest = %q, %v", rest, err)
+	}
+}
+
+func TestHandlerTransportHijack(t *testing.T) {
+	c := &http.Client{Transport: NewHandlerTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+		io.WriteString(brw, "HTTP/1.0 200 OK\r\nX-Raw: yes\r\n\r\nraw body")
+		brw.Flush()
+	}))}
+
+	res, err := c.Get("http://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.Header.Get("X-Raw") != "yes" || string(body) != "raw body" {
+		t.Errorf("got header %v, body %q", res.Header, body)
+	}
+}
+
+func TestHandlerTransportCloseNotify(t *testing.T) {
+	notified := make(chan bool, 1)
+	c := &http.Client{Transport: NewHandlerTransport(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gone := w.(http.CloseNotifier).CloseNotify()
+		io.WriteString(w, "waiting")
+		w.(http.Flusher).Flush()
+		select {
+		case <-gone:
+			notified <- true
+		case <-time.After(5 * time.Second):
+			notified <- false
+		}
+	}))}
+
+	res, err := c.Get("http://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len("waiting"))
+	if _, err := io.ReadFull(res.Body, buf); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if !<-notified {
+		t.Errorf("handler was not notified of the closed connection")
+	}
+}
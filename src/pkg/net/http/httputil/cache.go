@@ -0,0 +1,547 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// HTTP client-side response cache
+
+package httputil
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A CacheStorage stores the entries of a CachingTransport. Keys are
+// derived from request URLs; values are opaque byte slices. The
+// methods must be safe for concurrent use by multiple goroutines.
+type CacheStorage interface {
+	// Get returns the value stored under key, if any.
+	Get(key string) (value []byte, ok bool)
+
+	// Set stores value under key. A storage may drop values, for
+	// example to stay within a size limit.
+	Set(key string, value []byte)
+
+	// Delete removes the value stored under key, if any.
+	Delete(key string)
+}
+
+// CachingTransport is an http.RoundTripper that keeps a private cache
+// of responses, as described by RFC 2616, section 13.
+//
+// Successful responses to GET requests are stored unless forbidden by
+// a "no-store" Cache-Control directive in the request or response or
+// a "Vary: *" header. A stored response is returned without
+// contacting the server while it is fresh, according to its max-age
+// directive, its Expires header or, for URLs without a query, a
+// heuristic based on its Last-Modified header, and to the max-age,
+// min-fresh and max-stale directives of the request. Otherwise, if the
+// response has an ETag or Last-Modified header, the request is sent
+// with If-None-Match or If-Modified-Since, and a 304 Not Modified
+// answer refreshes the stored response, which is then returned. Only
+// the most recent variant of a response with a Vary header is kept;
+// it is used for requests whose varying header fields match.
+//
+// Requests with a Range header or their own preconditions bypass the
+// cache. A successful request with a method other than GET or HEAD
+// removes the stored response for its URL.
+//
+// A response is stored once its body has been read to the end. Its
+// body is buffered in memory while it is read, unless it is longer
+// than MaxBodySize, in which case it is not stored.
+type CachingTransport struct {
+	// The transport used to perform requests that cannot be
+	// answered from the cache. If nil, http.DefaultTransport is
+	// used.
+	Transport http.RoundTripper
+
+	// Storage holds the cache entries.
+	Storage CacheStorage
+
+	// MaxBodySize is the size in bytes of the longest response
+	// body that is stored. If zero, 10 MB is used.
+	MaxBodySize int64
+}
+
+// NewCachingTransport returns a new CachingTransport that stores
+// responses in storage and sends requests with http.DefaultTransport.
+func NewCachingTransport(storage CacheStorage) *CachingTransport {
+	return &CachingTransport{Storage: storage}
+}
+
+func (t *CachingTransport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
+
+func (t *CachingTransport) maxBodySize() int64 {
+	if t.MaxBodySize != 0 {
+		return t.MaxBodySize
+	}
+	return 10 << 20
+}
+
+// maxHeuristicLifetime caps the freshness lifetime computed from
+// Last-Modified, beyond which RFC 2616 would require a warning.
+const maxHeuristicLifetime = 24 * time.Hour
+
+// cacheableStatus lists the status codes of responses that may be
+// stored (RFC 2616, section 13.4).
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusGone:                 true,
+}
+
+// hopHeaders are not stored or updated from 304 responses.
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// preconditionHeaders make a request conditional.
+var preconditionHeaders = []string{
+	"If-Match",
+	"If-Modified-Since",
+	"If-None-Match",
+	"If-Range",
+	"If-Unmodified-Since",
+}
+
+func cacheKey(req *http.Request) string {
+	return req.URL.String()
+}
+
+func (t *CachingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := cacheKey(req)
+	if req.Method != "GET" && req.Method != "HEAD" {
+		res, err := t.transport().RoundTrip(req)
+		if err == nil && res.StatusCode < 400 {
+			t.Storage.Delete(key)
+		}
+		return res, err
+	}
+	reqCC := parseCacheControl(req.Header)
+	if req.Method == "HEAD" || req.Header.Get("Range") != "" || reqCC.has("no-store") {
+		return t.transport().RoundTrip(req)
+	}
+	for _, h := range preconditionHeaders {
+		if req.Header.Get(h) != "" {
+			return t.transport().RoundTrip(req)
+		}
+	}
+
+	e := t.load(key, req)
+	now := time.Now()
+	if e != nil {
+		if res, ok := e.fresh(req, reqCC, now); ok {
+			return res, nil
+		}
+	}
+	if reqCC.has("only-if-cached") {
+		return &http.Response{
+			Status:     "504 Gateway Timeout",
+			StatusCode: http.StatusGatewayTimeout,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     make(http.Header),
+			Body:       ioutil.NopCloser(strings.NewReader("")),
+			Request:    req,
+		}, nil
+	}
+
+	outreq := req
+	if e != nil {
+		etag, lastMod := e.header.Get("Etag"), e.header.Get("Last-Modified")
+		if etag != "" || lastMod != "" {
+			outreq = new(http.Request)
+			*outreq = *req
+			outreq.Header = make(http.Header)
+			copyHeader(outreq.Header, req.Header)
+			if etag != "" {
+				outreq.Header.Set("If-None-Match", etag)
+			}
+			if lastMod != "" {
+				outreq.Header.Set("If-Modified-Since", lastMod)
+			}
+		}
+	}
+
+	reqTime := time.Now()
+	res, err := t.transport().RoundTrip(outreq)
+	if err != nil {
+		if e != nil && !e.cc.has("must-revalidate") && !e.cc.has("no-cache") {
+			// RFC 2616, section 13.1.5: a stale response may be
+			// returned when the server cannot be reached.
+			stale := e.response(req, time.Now())
+			stale.Header.Add("Warning", `111 - "Revalidation Failed"`)
+			return stale, nil
+		}
+		return nil, err
+	}
+	resTime := time.Now()
+
+	if outreq != req && res.StatusCode == http.StatusNotModified {
+		res.Body.Close()
+		e.update(res.Header, reqTime, resTime)
+		t.Storage.Set(key, e.encode())
+		return e.response(req, resTime), nil
+	}
+	if !storable(reqCC, res) || res.ContentLength > t.maxBodySize() {
+		if e != nil {
+			t.Storage.Delete(key)
+		}
+		return res, nil
+	}
+	ne := newCacheEntry(req, res, reqTime, resTime)
+	res.Body = &cachingBody{
+		ReadCloser: res.Body,
+		max:        t.maxBodySize(),
+		store: func(body []byte) {
+			ne.body = body
+			t.Storage.Set(key, ne.encode())
+		},
+	}
+	return res, nil
+}
+
+// load returns the stored entry for key if it matches req.
+func (t *CachingTransport) load(key string, req *http.Request) *cacheEntry {
+	b, ok := t.Storage.Get(key)
+	if !ok {
+		return nil
+	}
+	e, err := decodeCacheEntry(b, req)
+	if err != nil {
+		t.Storage.Delete(key)
+		return nil
+	}
+	for k, v := range e.varied {
+		if strings.Join(req.Header[k], ", ") != v {
+			return nil
+		}
+	}
+	return e
+}
+
+// storable reports whether res, a response to a GET request, may be
+// stored.
+func storable(reqCC cacheControl, res *http.Response) bool {
+	if !cacheableStatus[res.StatusCode] {
+		return false
+	}
+	resCC := parseCacheControl(res.Header)
+	if reqCC.has("no-store") || resCC.has("no-store") {
+		return false
+	}
+	for _, f := range varyFields(res.Header) {
+		if f == "*" {
+			return false
+		}
+	}
+	return true
+}
+
+// varyFields returns the canonical names of the header fields listed
+// in the Vary header of h.
+func varyFields(h http.Header) []string {
+	var fields []string
+	for _, v := range h["Vary"] {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				fields = append(fields, textproto.CanonicalMIMEHeaderKey(f))
+			}
+		}
+	}
+	return fields
+}
+
+// cacheControl holds the directives of Cache-Control header fields.
+type cacheControl map[string]string
+
+func parseCacheControl(h http.Header) cacheControl {
+	cc := make(cacheControl)
+	for _, v := range h["Cache-Control"] {
+		for _, d := range strings.Split(v, ",") {
+			d = strings.TrimSpace(d)
+			if d == "" {
+				continue
+			}
+			name, value := d, ""
+			if i := strings.Index(d, "="); i >= 0 {
+				name, value = strings.TrimSpace(d[:i]), strings.Trim(strings.TrimSpace(d[i+1:]), `"`)
+			}
+			cc[strings.ToLower(name)] = value
+		}
+	}
+	if h.Get("Cache-Control") == "" && strings.Contains(strings.ToLower(h.Get("Pragma")), "no-cache") {
+		cc["no-cache"] = ""
+	}
+	return cc
+}
+
+func (cc cacheControl) has(name string) bool {
+	_, ok := cc[name]
+	return ok
+}
+
+// seconds returns the value of the delta-seconds directive name.
+func (cc cacheControl) seconds(name string) (time.Duration, bool) {
+	v, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// cacheEntry is a stored response.
+type cacheEntry struct {
+	status  string
+	code    int
+	header  http.Header
+	body    []byte
+	cc      cacheControl
+	reqTime time.Time         // when the request was sent
+	resTime time.Time         // when the response was received
+	varied  map[string]string // request header fields named by Vary
+}
+
+func newCacheEntry(req *http.Request, res *http.Response, reqTime, resTime time.Time) *cacheEntry {
+	e := &cacheEntry{
+		status:  res.Status,
+		code:    res.StatusCode,
+		header:  make(http.Header),
+		reqTime: reqTime,
+		resTime: resTime,
+		varied:  make(map[string]string),
+	}
+	copyHeader(e.header, res.Header)
+	for _, h := range hopHeaders {
+		e.header.Del(h)
+	}
+	for _, f := range varyFields(res.Header) {
+		e.varied[f] = strings.Join(req.Header[f], ", ")
+	}
+	e.cc = parseCacheControl(e.header)
+	return e
+}
+
+// update merges the header of a 304 response into e.
+func (e *cacheEntry) update(h http.Header, reqTime, resTime time.Time) {
+	for k, vv := range h {
+		if k == "Content-Length" {
+			continue
+		}
+		e.header[k] = vv
+	}
+	for _, h := range hopHeaders {
+		e.header.Del(h)
+	}
+	e.cc = parseCacheControl(e.header)
+	e.reqTime, e.resTime = reqTime, resTime
+}
+
+func (e *cacheEntry) date() time.Time {
+	if d, err := http.ParseTime(e.header.Get("Date")); err == nil {
+		return d
+	}
+	return e.resTime
+}
+
+// age returns the current age of e at now (RFC 2616, section 13.2.3).
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	age := e.resTime.Sub(e.date())
+	if age < 0 {
+		age = 0
+	}
+	if n, err := strconv.ParseInt(e.header.Get("Age"), 10, 64); err == nil {
+		if a := time.Duration(n) * time.Second; a > age {
+			age = a
+		}
+	}
+	return age + e.resTime.Sub(e.reqTime) + now.Sub(e.resTime)
+}
+
+// lifetime returns the freshness lifetime of e (RFC 2616, section
+// 13.2.4).
+func (e *cacheEntry) lifetime(url string) time.Duration {
+	if d, ok := e.cc.seconds("max-age"); ok {
+		return d
+	}
+	if v := e.header.Get("Expires"); v != "" {
+		exp, err := http.ParseTime(v)
+		if err != nil {
+			return 0 // invalid dates, such as "0", are in the past
+		}
+		return exp.Sub(e.date())
+	}
+	if lm, err := http.ParseTime(e.header.Get("Last-Modified")); err == nil && !strings.Contains(url, "?") {
+		d := e.date().Sub(lm) / 10
+		if d > maxHeuristicLifetime {
+			d = maxHeuristicLifetime
+		}
+		return d
+	}
+	return 0
+}
+
+// fresh returns a response from e for req if e may be used without
+// revalidation.
+func (e *cacheEntry) fresh(req *http.Request, reqCC cacheControl, now time.Time) (*http.Response, bool) {
+	if reqCC.has("no-cache") || e.cc.has("no-cache") {
+		return nil, false
+	}
+	lifetime := e.lifetime(req.URL.String())
+	if d, ok := reqCC.seconds("max-age"); ok && d < lifetime {
+		lifetime = d
+	}
+	age := e.age(now)
+	if d, ok := reqCC.seconds("min-fresh"); ok {
+		age += d
+	}
+	if lifetime > age {
+		return e.response(req, now), true
+	}
+	if !reqCC.has("max-stale") || e.cc.has("must-revalidate") {
+		return nil, false
+	}
+	if d, ok := reqCC.seconds("max-stale"); ok && age-lifetime > d {
+		return nil, false
+	}
+	res := e.response(req, now)
+	res.Header.Add("Warning", `110 - "Response is Stale"`)
+	return res, true
+}
+
+// response returns the response stored in e as an answer to req.
+func (e *cacheEntry) response(req *http.Request, now time.Time) *http.Response {
+	res := &http.Response{
+		Status:        e.status,
+		StatusCode:    e.code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          ioutil.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+	copyHeader(res.Header, e.header)
+	res.Header.Set("Age", strconv.FormatInt(int64(e.age(now)/time.Second), 10))
+	return res
+}
+
+// encode serializes e: a header block of metadata, followed by the
+// response in wire format.
+func (e *cacheEntry) encode() []byte {
+	var buf bytes.Buffer
+	meta := make(http.Header)
+	meta.Set("Request-Time", strconv.FormatInt(e.reqTime.UnixNano(), 10))
+	meta.Set("Response-Time", strconv.FormatInt(e.resTime.UnixNano(), 10))
+	for k, v := range e.varied {
+		meta.Set("Varied-"+k, v)
+	}
+	meta.Write(&buf)
+	buf.WriteString("\r\n")
+	res := &http.Response{
+		Status:        e.status,
+		StatusCode:    e.code,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header,
+		Body:          ioutil.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+	}
+	res.Write(&buf)
+	return buf.Bytes()
+}
+
+func decodeCacheEntry(b []byte, req *http.Request) (*cacheEntry, error) {
+	br := bufio.NewReader(bytes.NewReader(b))
+	meta, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	reqNano, err1 := strconv.ParseInt(meta.Get("Request-Time"), 10, 64)
+	resNano, err2 := strconv.ParseInt(meta.Get("Response-Time"), 10, 64)
+	if err1 != nil || err2 != nil {
+		return nil, errCorruptEntry
+	}
+	e := &cacheEntry{
+		status:  res.Status,
+		code:    res.StatusCode,
+		header:  res.Header,
+		body:    body,
+		cc:      parseCacheControl(res.Header),
+		reqTime: time.Unix(0, reqNano),
+		resTime: time.Unix(0, resNano),
+		varied:  make(map[string]string),
+	}
+	for k, vv := range meta {
+		if strings.HasPrefix(k, "Varied-") {
+			e.varied[k[len("Varied-"):]] = vv[0]
+		}
+	}
+	return e, nil
+}
+
+var errCorruptEntry = errors.New("httputil: corrupt cache entry")
+
+// cachingBody is a response body that stores the response once it
+// has been read completely, unless the body is longer than max.
+type cachingBody struct {
+	io.ReadCloser
+	buf   bytes.Buffer
+	max   int64
+	store func(body []byte)
+	done  bool // stored, or too long to store
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.done {
+		return n, err
+	}
+	if int64(b.buf.Len()+n) > b.max {
+		b.done = true
+		b.buf = bytes.Buffer{}
+		return n, err
+	}
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.done = true
+		b.store(b.buf.Bytes())
+	}
+	return n, err
+}
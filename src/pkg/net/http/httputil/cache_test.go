@@ -0,0 +1,331 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputil
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cacheBackend is a test server that counts the requests it serves.
+type cacheBackend struct {
+	*httptest.Server
+	mu   sync.Mutex
+	hits int
+}
+
+func newCacheBackend(h func(w http.ResponseWriter, r *http.Request)) *cacheBackend {
+	b := new(cacheBackend)
+	b.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b.mu.Lock()
+		b.hits++
+		b.mu.Unlock()
+		h(w, r)
+	}))
+	return b
+}
+
+func (b *cacheBackend) Hits() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.hits
+}
+
+// cachedGet sends a request with the given header fields through c
+// and returns the response, with its body read into body.
+func cachedGet(t *testing.T, c *http.Client, method, url string, kv ...string) (res *http.Response, body string) {
+	req, _ := http.NewRequest(method, url, nil)
+	for i := 0; i < len(kv); i += 2 {
+		req.Header.Set(kv[i], kv[i+1])
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, string(b)
+}
+
+func TestCachingTransportFresh(t *testing.T) {
+	backend := newCacheBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		io.WriteString(w, "fresh")
+	})
+	defer backend.Close()
+	c := &http.Client{Transport: NewCachingTransport(NewMemoryCache(1 << 20))}
+
+	for i := 0; i < 3; i++ {
+		res, body := cachedGet(t, c, "GET", backend.URL)
+		if res.StatusCode != 200 || body != "fresh" {
+			t.Fatalf("GET %d = %d %q", i, res.StatusCode, body)
+		}
+		if i > 0 && res.Header.Get("Age") == "" {
+			t.Errorf("cached response has no Age header")
+		}
+	}
+	if n := backend.Hits(); n != 1 {
+		t.Errorf("backend hits = %d; want 1", n)
+	}
+
+	// The request can ask for revalidation or a fresher response.
+	cachedGet(t, c, "GET", backend.URL, "Cache-Control", "no-cache")
+	cachedGet(t, c, "GET", backend.URL, "Pragma", "no-cache")
+	cachedGet(t, c, "GET", backend.URL, "Cache-Control", "min-fresh=7200")
+	if n := backend.Hits(); n != 4 {
+		t.Errorf("backend hits = %d; want 4", n)
+	}
+}
+
+func TestCachingTransportRevalidate(t *testing.T) {
+	const lastMod = "Mon, 02 Jan 2006 15:04:05 GMT"
+	backend := newCacheBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=0")
+		w.Header().Set("X-Served", "yes")
+		if r.URL.Path == "/etag" {
+			w.Header().Set("Etag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		} else {
+			w.Header().Set("Last-Modified", lastMod)
+			if r.Header.Get("If-Modified-Since") == lastMod {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.Header().Set("X-Served", "full")
+		io.WriteString(w, "body of "+r.URL.Path)
+	})
+	defer backend.Close()
+	c := &http.Client{Transport: NewCachingTransport(NewMemoryCache(1 << 20))}
+
+	for _, path := range []string{"/etag", "/lastmod"} {
+		for i := 0; i < 2; i++ {
+			res, body := cachedGet(t, c, "GET", backend.URL+path)
+			if res.StatusCode != 200 || body != "body of "+path {
+				t.Errorf("GET %s #%d = %d %q", path, i, res.StatusCode, body)
+			}
+			want := "full"
+			if i > 0 {
+				want = "yes" // updated from the 304 response
+			}
+			if g := res.Header.Get("X-Served"); g != want {
+				t.Errorf("GET %s #%d: X-Served = %q; want %q", path, i, g, want)
+			}
+		}
+	}
+	if n := backend.Hits(); n != 4 {
+		t.Errorf("backend hits = %d; want 4", n)
+	}
+}
+
+func TestCachingTransportNotStored(t *testing.T) {
+	backend := newCacheBackend(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/nostore":
+			w.Header().Set("Cache-Control", "no-store, max-age=3600")
+		case "/varystar":
+			w.Header().Set("Cache-Control", "max-age=3600")
+			w.Header().Set("Vary", "*")
+		case "/expired":
+			w.Header().Set("Expires", "Thu, 01 Dec 1994 16:00:00 GMT")
+		case "/notfound":
+			w.Header().Set("Cache-Control", "max-age=3600")
+			w.WriteHeader(http.StatusNotFound)
+		}
+		io.WriteString(w, "x")
+	})
+	defer backend.Close()
+	c := &http.Client{Transport: NewCachingTransport(NewMemoryCache(1 << 20))}
+
+	for _, path := range []string{"/nostore", "/varystar", "/expired", "/notfound"} {
+		before := backend.Hits()
+		cachedGet(t, c, "GET", backend.URL+path)
+		cachedGet(t, c, "GET", backend.URL+path)
+		if n := backend.Hits() - before; n != 2 {
+			t.Errorf("%s: backend hits = %d; want 2", path, n)
+		}
+	}
+	if res, _ := cachedGet(t, c, "GET", backend.URL+"/nostore", "Cache-Control", "only-if-cached"); res.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("only-if-cached status = %d; want 504", res.StatusCode)
+	}
+}
+
+func TestCachingTransportMaxBodySize(t *testing.T) {
+	backend := newCacheBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		switch r.URL.Path {
+		case "/short":
+			io.WriteString(w, strings.Repeat("s", 50))
+		case "/long":
+			w.Header().Set("Content-Length", "200")
+			io.WriteString(w, strings.Repeat("l", 200))
+		case "/chunked":
+			// Flush the header so that the body has no length.
+			w.(http.Flusher).Flush()
+			io.WriteString(w, strings.Repeat("c", 200))
+		}
+	})
+	defer backend.Close()
+	tr := NewCachingTransport(NewMemoryCache(1 << 20))
+	tr.MaxBodySize = 100
+	c := &http.Client{Transport: tr}
+
+	for _, tt := range []struct {
+		path     string
+		size     int
+		wantHits int
+	}{
+		{"/short", 50, 1},
+		{"/long", 200, 2},
+		{"/chunked", 200, 2},
+	} {
+		before := backend.Hits()
+		for i := 0; i < 2; i++ {
+			if _, body := cachedGet(t, c, "GET", backend.URL+tt.path); len(body) != tt.size {
+				t.Errorf("%s: body length = %d; want %d", tt.path, len(body), tt.size)
+			}
+		}
+		if n := backend.Hits() - before; n != tt.wantHits {
+			t.Errorf("%s: backend hits = %d; want %d", tt.path, n, tt.wantHits)
+		}
+	}
+}
+
+func TestCachingTransportVary(t *testing.T) {
+	backend := newCacheBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=3600")
+		w.Header().Set("Vary", "Accept-Language")
+		io.WriteString(w, "lang="+r.Header.Get("Accept-Language"))
+	})
+	defer backend.Close()
+	c := &http.Client{Transport: NewCachingTransport(NewMemoryCache(1 << 20))}
+
+	for i, lang := range []string{"en", "en", "fr", "fr", "en"} {
+		_, body := cachedGet(t, c, "GET", backend.URL, "Accept-Language", lang)
+		if body != "lang="+lang {
+			t.Errorf("request %d for %s got %q", i, lang, body)
+		}
+	}
+	if n := backend.Hits(); n != 3 {
+		t.Errorf("backend hits = %d; want 3", n)
+	}
+}
+
+func TestCachingTransportInvalidate(t *testing.T) {
+	var mu sync.Mutex
+	version := 1
+	backend := newCacheBackend(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == "POST" {
+			version++
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=3600")
+		io.WriteString(w, strings.Repeat("v", version))
+	})
+	defer backend.Close()
+	c := &http.Client{Transport: NewCachingTransport(NewMemoryCache(1 << 20))}
+
+	for _, want := range []string{"v", "v"} {
+		if _, body := cachedGet(t, c, "GET", backend.URL); body != want {
+			t.Errorf("GET = %q; want %q", body, want)
+		}
+	}
+	cachedGet(t, c, "POST", backend.URL)
+	if _, body := cachedGet(t, c, "GET", backend.URL); body != "vv" {
+		t.Errorf("GET after POST = %q; want %q", body, "vv")
+	}
+}
+
+func TestCachingTransportStaleOnError(t *testing.T) {
+	backend := newCacheBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=0")
+		w.Header().Set("Etag", `"x"`)
+		io.WriteString(w, "stale")
+	})
+	c := &http.Client{Transport: NewCachingTransport(NewMemoryCache(1 << 20))}
+	cachedGet(t, c, "GET", backend.URL)
+	backend.Close()
+
+	res, body := cachedGet(t, c, "GET", backend.URL)
+	if body != "stale" || !strings.HasPrefix(res.Header.Get("Warning"), "111 ") {
+		t.Errorf("got %q with Warning %q; want stale response with 111 warning", body, res.Header.Get("Warning"))
+	}
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+	c := NewMemoryCache(10)
+	c.Set("a", []byte("aaaa"))
+	c.Set("b", []byte("bbbb"))
+	c.Get("a") // b is now least recently used
+	c.Set("c", []byte("cccc"))
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("b was not evicted")
+	}
+	for _, k := range []string{"a", "c"} {
+		if v, ok := c.Get(k); !ok || string(v) != strings.Repeat(k, 4) {
+			t.Errorf("Get(%q) = %q, %v", k, v, ok)
+		}
+	}
+	if s := c.Size(); s != 8 {
+		t.Errorf("Size = %d; want 8", s)
+	}
+	c.Set("big", make([]byte, 11))
+	if _, ok := c.Get("big"); ok {
+		t.Errorf("value larger than the cache was stored")
+	}
+	c.Delete("a")
+	if s := c.Size(); s != 4 {
+		t.Errorf("Size after Delete = %d; want 4", s)
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httputil-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dc, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	backend := newCacheBackend(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", "max-age=3600")
+		io.WriteString(w, "on disk")
+	})
+	defer backend.Close()
+
+	// A second transport sharing the directory sees the entry.
+	for i := 0; i < 2; i++ {
+		c := &http.Client{Transport: NewCachingTransport(dc)}
+		if _, body := cachedGet(t, c, "GET", backend.URL); body != "on disk" {
+			t.Errorf("GET = %q", body)
+		}
+	}
+	if n := backend.Hits(); n != 1 {
+		t.Errorf("backend hits = %d; want 1", n)
+	}
+	dc.Delete(backend.URL)
+	if _, ok := dc.Get(backend.URL); ok {
+		t.Errorf("entry still present after Delete")
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputil
+
+import (
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// MemoryCache is a CacheStorage that keeps values in memory, up to a
+// total size, discarding the least recently used values first.
+type MemoryCache struct {
+	maxSize int64
+
+	mu    sync.Mutex
+	size  int64
+	lru   *list.List               // of *memoryItem, most recent first
+	items map[string]*list.Element // by key
+}
+
+type memoryItem struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCache returns a MemoryCache holding at most maxSize bytes
+// of values.
+func NewMemoryCache(maxSize int64) *MemoryCache {
+	return &MemoryCache{
+		maxSize: maxSize,
+		lru:     list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*memoryItem).value, true
+}
+
+func (c *MemoryCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(key)
+	if int64(len(value)) > c.maxSize {
+		return
+	}
+	c.items[key] = c.lru.PushFront(&memoryItem{key, value})
+	c.size += int64(len(value))
+	for c.size > c.maxSize {
+		c.remove(c.lru.Back().Value.(*memoryItem).key)
+	}
+}
+
+func (c *MemoryCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(key)
+}
+
+// remove deletes key. c.mu must be held.
+func (c *MemoryCache) remove(key string) {
+	if el, ok := c.items[key]; ok {
+		c.lru.Remove(el)
+		delete(c.items, key)
+		c.size -= int64(len(el.Value.(*memoryItem).value))
+	}
+}
+
+// Size returns the total size of the values in c.
+func (c *MemoryCache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// DiskCache is a CacheStorage that keeps each value in a file in a
+// directory. Values are replaced atomically, so that several
+// processes may share the directory. Errors are ignored: a value that
+// cannot be written is not stored, and one that cannot be read is
+// missing.
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache returns a DiskCache that stores values in dir, which is
+// created if necessary.
+func NewDiskCache(dir string) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir}, nil
+}
+
+// filename returns the name of the file holding the value for key.
+func (c *DiskCache) filename(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(h.Sum(nil)))
+}
+
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	value, err := ioutil.ReadFile(c.filename(key))
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+func (c *DiskCache) Set(key string, value []byte) {
+	f, err := ioutil.TempFile(c.dir, "tmp")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.filename(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+func (c *DiskCache) Delete(key string) {
+	os.Remove(c.filename(key))
+}
@@ -0,0 +1,493 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Load-balancing reverse proxy handler
+
+package httputil
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Strategy selects the backend of a LoadBalancer for each request.
+type Strategy int
+
+const (
+	// RoundRobin cycles through the available backends in turn.
+	RoundRobin Strategy = iota
+
+	// LeastOutstanding picks the available backend with the fewest
+	// requests in flight, cycling through backends with equal
+	// counts.
+	LeastOutstanding
+)
+
+// A LoadBalancer is an HTTP Handler that proxies each request to one
+// of a pool of backend servers, as a ReverseProxy created by
+// NewSingleHostReverseProxy does for a single backend.
+//
+// A backend is available unless it has failed its most recent active
+// health check or has been ejected. A backend is ejected for
+// EjectDuration after MaxFails consecutive failed requests, where a
+// request fails if the backend cannot be reached or answers with a
+// 5xx status.
+//
+// Requests that cannot be sent to a backend are retried on other
+// backends, up to Retries times, provided that they are idempotent
+// (GET, HEAD, OPTIONS, TRACE, PUT or DELETE) and have no body. If no
+// backend is available, the client receives a 503 Service Unavailable
+// response; if the last backend tried cannot be reached, it receives a
+// 502 Bad Gateway response.
+//
+// Upgrade requests are sent to a backend chosen in the same way, which
+// counts them as outstanding until the upgraded connection is closed.
+type LoadBalancer struct {
+	// Strategy selects the backend for each request.
+	Strategy Strategy
+
+	// The transport used to perform proxy requests and health
+	// checks. If nil, http.DefaultTransport is used. A transport
+	// that is not an *http.Transport must itself bound the time
+	// taken by a health check that is never answered.
+	Transport http.RoundTripper
+
+	// FlushInterval specifies the flush interval to flush to the
+	// client while copying the response body, as in ReverseProxy.
+	FlushInterval time.Duration
+
+	// Retries is the maximum number of other backends to try when
+	// an idempotent request cannot be sent.
+	Retries int
+
+	// MaxFails is the number of consecutive failed requests after
+	// which a backend is ejected. If zero, 3 is used. If negative,
+	// backends are never ejected.
+	MaxFails int
+
+	// EjectDuration is how long an ejected backend is left out of
+	// the pool. If zero, 30 seconds is used.
+	EjectDuration time.Duration
+
+	// HealthCheckPath, if not empty, is the path, relative to each
+	// backend's URL, of an active health check. Every
+	// HealthCheckInterval, a GET request is sent to the path on each
+	// backend; a backend is healthy if it answers with a 2xx status
+	// within HealthCheckTimeout. Health checks start with the first
+	// request served and stop when the LoadBalancer is closed.
+	HealthCheckPath     string
+	HealthCheckInterval time.Duration
+
+	// HealthCheckTimeout limits the duration of a health check. If
+	// zero, HealthCheckInterval is used.
+	HealthCheckTimeout time.Duration
+
+	backends  []*backend // fixed at construction
+	startOnce sync.Once
+	done      chan bool // closed by Close
+
+	mu     sync.Mutex // guards the following and the backends' state
+	next   int        // index at which to start the next selection
+	closed bool
+}
+
+// backend is a member of a LoadBalancer's pool. Its mutable fields
+// are guarded by the LoadBalancer's mu.
+type backend struct {
+	url *url.URL
+
+	healthy      bool
+	probing      bool // a health check is in progress
+	ejectedUntil time.Time
+	fails        int // consecutive failed requests
+	outstanding  int
+	requests     int64
+	failures     int64
+}
+
+// BackendStats describes the state of a LoadBalancer backend.
+type BackendStats struct {
+	URL         *url.URL
+	Healthy     bool  // passed the most recent health check
+	Ejected     bool  // ejected after failed requests
+	Outstanding int   // requests in flight
+	Requests    int64 // requests sent, including failed ones
+	Failures    int64 // failed requests
+}
+
+// NewLoadBalancer returns a new LoadBalancer that proxies requests to
+// the given targets, rewriting URLs as NewSingleHostReverseProxy does.
+// All backends are initially considered healthy.
+func NewLoadBalancer(targets []*url.URL) *LoadBalancer {
+	lb := &LoadBalancer{done: make(chan bool)}
+	for _, u := range targets {
+		lb.backends = append(lb.backends, &backend{url: u, healthy: true})
+	}
+	return lb
+}
+
+func (lb *LoadBalancer) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if lb.HealthCheckPath != "" && lb.HealthCheckInterval > 0 {
+		lb.startOnce.Do(func() {
+			go lb.healthLoop()
+		})
+	}
+	p := &ReverseProxy{
+		Director:      func(*http.Request) {},
+		Transport:     lbTransport{lb},
+		FlushInterval: lb.FlushInterval,
+	}
+	p.ServeHTTP(rw, req)
+}
+
+// Close stops the active health checks.
+func (lb *LoadBalancer) Close() {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if !lb.closed {
+		lb.closed = true
+		close(lb.done)
+	}
+}
+
+// Stats returns the current state of each backend, in the order of
+// the targets passed to NewLoadBalancer.
+func (lb *LoadBalancer) Stats() []BackendStats {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	now := time.Now()
+	stats := make([]BackendStats, len(lb.backends))
+	for i, b := range lb.backends {
+		stats[i] = BackendStats{
+			URL:         b.url,
+			Healthy:     b.healthy,
+			Ejected:     now.Before(b.ejectedUntil),
+			Outstanding: b.outstanding,
+			Requests:    b.requests,
+			Failures:    b.failures,
+		}
+	}
+	return stats
+}
+
+func (lb *LoadBalancer) transport() http.RoundTripper {
+	if lb.Transport != nil {
+		return lb.Transport
+	}
+	return http.DefaultTransport
+}
+
+// pick selects an available backend not in tried and records a new
+// request on it. It returns nil if there is none.
+func (lb *LoadBalancer) pick(tried map[*backend]bool) *backend {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	now := time.Now()
+	n := len(lb.backends)
+	var best *backend
+	bestIndex := 0
+	for i := 0; i < n; i++ {
+		j := (lb.next + i) % n
+		b := lb.backends[j]
+		if tried[b] || !b.healthy || now.Before(b.ejectedUntil) {
+			continue
+		}
+		if best == nil || lb.Strategy == LeastOutstanding && b.outstanding < best.outstanding {
+			best, bestIndex = b, j
+		}
+		if lb.Strategy == RoundRobin {
+			break
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	lb.next = bestIndex + 1
+	best.outstanding++
+	best.requests++
+	return best
+}
+
+// release records the end of a request on b.
+func (lb *LoadBalancer) release(b *backend, failed bool) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	b.outstanding--
+	if !failed {
+		b.fails = 0
+		return
+	}
+	b.failures++
+	b.fails++
+	maxFails := lb.MaxFails
+	if maxFails == 0 {
+		maxFails = 3
+	}
+	if maxFails > 0 && b.fails >= maxFails {
+		d := lb.EjectDuration
+		if d == 0 {
+			d = 30 * time.Second
+		}
+		b.ejectedUntil = time.Now().Add(d)
+		b.fails = 0
+	}
+}
+
+// canRetry reports whether req may be sent again after a failure.
+func canRetry(req *http.Request) bool {
+	switch req.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return req.ContentLength == 0 && len(req.TransferEncoding) == 0
+	}
+	return false
+}
+
+// lbTransport is the RoundTripper used by a LoadBalancer's proxy. It
+// sends each request to a backend chosen by the LoadBalancer and
+// answers itself, with a 502 or 503 response, when none can take it.
+type lbTransport struct {
+	lb *LoadBalancer
+}
+
+func (t lbTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	lb := t.lb
+	retries := 0
+	if canRetry(req) {
+		retries = lb.Retries
+	}
+	tried := make(map[*backend]bool)
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		b := lb.pick(tried)
+		if b == nil {
+			break
+		}
+		tried[b] = true
+
+		outreq := new(http.Request)
+		*outreq = *req
+		u := *req.URL
+		outreq.URL = &u
+		rewriteURL(outreq, b.url)
+
+		res, err := lb.transport().RoundTrip(outreq)
+		if err != nil {
+			lb.release(b, true)
+			lastErr = err
+			continue
+		}
+		res.Body = &backendBody{
+			ReadCloser: res.Body,
+			lb:         lb,
+			b:          b,
+			failed:     res.StatusCode/100 == 5,
+		}
+		return res, nil
+	}
+	if lastErr == nil {
+		log.Printf("http: proxy error: no available backend for %s", req.URL)
+		return errorResponse(req, http.StatusServiceUnavailable), nil
+	}
+	log.Printf("http: proxy error: %v", lastErr)
+	return errorResponse(req, http.StatusBadGateway), nil
+}
+
+func (t lbTransport) dialUpgrade(req *http.Request) (net.Conn, func(failed bool), error) {
+	lb := t.lb
+	retries := 0
+	if canRetry(req) {
+		retries = lb.Retries
+	}
+	tried := make(map[*backend]bool)
+	orig := *req.URL
+	var lastErr error
+	for attempt := 0; attempt <= retries; attempt++ {
+		b := lb.pick(tried)
+		if b == nil {
+			break
+		}
+		tried[b] = true
+
+		u := orig
+		req.URL = &u
+		rewriteURL(req, b.url)
+
+		c, err := dialBackend(lb.transport(), req)
+		if err != nil {
+			lb.release(b, true)
+			lastErr = err
+			continue
+		}
+		return c, func(failed bool) { lb.release(b, failed) }, nil
+	}
+	if lastErr == nil {
+		return nil, nil, statusError{http.StatusServiceUnavailable, errors.New("no available backend for " + orig.String())}
+	}
+	return nil, nil, statusError{http.StatusBadGateway, lastErr}
+}
+
+// errorResponse returns a plain text response to req with the given
+// status code.
+func errorResponse(req *http.Request, code int) *http.Response {
+	body := http.StatusText(code) + "\n"
+	return &http.Response{
+		Status:        strconv.Itoa(code) + " " + http.StatusText(code),
+		StatusCode:    code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": {"text/plain; charset=utf-8"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// backendBody is a response body that releases its backend when
+// closed.
+type backendBody struct {
+	io.ReadCloser
+	lb     *LoadBalancer
+	b      *backend
+	failed bool
+	once   sync.Once
+}
+
+func (body *backendBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.once.Do(func() {
+		body.lb.release(body.b, body.failed)
+	})
+	return err
+}
+
+func (lb *LoadBalancer) healthLoop() {
+	t := time.NewTicker(lb.HealthCheckInterval)
+	defer t.Stop()
+	for {
+		lb.checkHealth()
+		select {
+		case <-lb.done:
+			return
+		case <-t.C:
+		}
+	}
+	panic("unreached")
+}
+
+// checkHealth runs an active health check on every backend and
+// records the results.
+func (lb *LoadBalancer) checkHealth() {
+	timeout := lb.HealthCheckTimeout
+	if timeout == 0 {
+		timeout = lb.HealthCheckInterval
+	}
+	rt := lb.healthTransport(timeout)
+	var wg sync.WaitGroup
+	for _, b := range lb.backends {
+		wg.Add(1)
+		go func(b *backend) {
+			defer wg.Done()
+			lb.probe(b, rt, timeout)
+		}(b)
+	}
+	wg.Wait()
+}
+
+// healthTransport returns the transport for health checks that must
+// finish within timeout. Unless lb.Transport is set to something other
+// than an *http.Transport, it is a copy of the transport without
+// keep-alives whose connections are dialed with the timeout and
+// closed when it expires, so that a backend that accepts a check and
+// never answers cannot block it forever.
+func (lb *LoadBalancer) healthTransport(timeout time.Duration) http.RoundTripper {
+	rt := lb.transport()
+	t, ok := rt.(*http.Transport)
+	if !ok || timeout <= 0 {
+		return rt
+	}
+	dial := t.Dial
+	return &http.Transport{
+		Proxy: t.Proxy,
+		Dial: func(network, addr string) (net.Conn, error) {
+			deadline := time.Now().Add(timeout)
+			var c net.Conn
+			var err error
+			if dial != nil {
+				c, err = dial(network, addr)
+			} else {
+				c, err = net.DialTimeout(network, addr, timeout)
+			}
+			if err != nil {
+				return nil, err
+			}
+			c.SetDeadline(deadline)
+			return c, nil
+		},
+		TLSClientConfig:    t.TLSClientConfig,
+		DisableKeepAlives:  true,
+		DisableCompression: t.DisableCompression,
+	}
+}
+
+// probe runs a health check on b through rt and records the result.
+// A check that has not finished within timeout, if positive, fails. A
+// backend whose previous check has not yet finished fails without a
+// new request being sent, so that a backend that never answers does
+// not accumulate blocked checks.
+func (lb *LoadBalancer) probe(b *backend, rt http.RoundTripper, timeout time.Duration) {
+	u := *b.url
+	u.Path = singleJoiningSlash(b.url.Path, lb.HealthCheckPath)
+	u.RawQuery = ""
+	req, err := http.NewRequest("GET", u.String(), nil)
+	lb.mu.Lock()
+	if err != nil || b.probing {
+		b.healthy = false
+		lb.mu.Unlock()
+		return
+	}
+	b.probing = true
+	lb.mu.Unlock()
+
+	expired := false // guarded by lb.mu
+	done := make(chan bool)
+	go func() {
+		ok := false
+		if res, err := rt.RoundTrip(req); err == nil {
+			io.Copy(ioutil.Discard, io.LimitReader(res.Body, 4<<10))
+			res.Body.Close()
+			ok = res.StatusCode/100 == 2
+		}
+		lb.mu.Lock()
+		b.probing = false
+		if !expired {
+			b.healthy = ok
+		}
+		lb.mu.Unlock()
+		close(done)
+	}()
+	if timeout <= 0 {
+		<-done
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		lb.mu.Lock()
+		if b.probing {
+			expired = true
+			b.healthy = false
+		}
+		lb.mu.Unlock()
+	}
+}
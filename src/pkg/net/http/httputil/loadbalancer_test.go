@@ -0,0 +1,258 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputil
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// namedBackend returns a test server that replies with its name.
+func namedBackend(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, name)
+	}))
+}
+
+// lbGet issues a request to the load balancer server and returns the
+// status code and body.
+func lbGet(t *testing.T, method, url string, body io.Reader) (int, string) {
+	req, _ := http.NewRequest(method, url, body)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, string(b)
+}
+
+func TestLoadBalancerRoundRobin(t *testing.T) {
+	var targets []*url.URL
+	for _, name := range []string{"a", "b", "c"} {
+		ts := namedBackend(name)
+		defer ts.Close()
+		targets = append(targets, mustParseURL(ts.URL))
+	}
+	lb := NewLoadBalancer(targets)
+	defer lb.Close()
+	front := httptest.NewServer(lb)
+	defer front.Close()
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		_, body := lbGet(t, "GET", front.URL, nil)
+		got = append(got, body)
+	}
+	if g := strings.Join(got, ""); g != "abcabc" {
+		t.Errorf("backends = %q; want %q", g, "abcabc")
+	}
+	for i, st := range lb.Stats() {
+		if st.Requests != 2 || st.Failures != 0 || st.Outstanding != 0 || !st.Healthy {
+			t.Errorf("backend %d stats = %+v", i, st)
+		}
+	}
+}
+
+func TestLoadBalancerLeastOutstanding(t *testing.T) {
+	started := make(chan bool)
+	release := make(chan bool)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		<-release
+		io.WriteString(w, "slow")
+	}))
+	defer slow.Close()
+	fast := namedBackend("fast")
+	defer fast.Close()
+
+	lb := NewLoadBalancer([]*url.URL{mustParseURL(slow.URL), mustParseURL(fast.URL)})
+	lb.Strategy = LeastOutstanding
+	defer lb.Close()
+	front := httptest.NewServer(lb)
+	defer front.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if _, body := lbGet(t, "GET", front.URL, nil); body != "slow" {
+			t.Errorf("first request went to %q; want slow", body)
+		}
+	}()
+	<-started
+	if st := lb.Stats()[0]; st.Outstanding != 1 {
+		t.Errorf("slow backend outstanding = %d; want 1", st.Outstanding)
+	}
+	for i := 0; i < 3; i++ {
+		if _, body := lbGet(t, "GET", front.URL, nil); body != "fast" {
+			t.Errorf("request %d went to %q; want fast", i, body)
+		}
+	}
+	close(release)
+	wg.Wait()
+}
+
+func TestLoadBalancerRetryAndEject(t *testing.T) {
+	log.SetOutput(ioutil.Discard) // proxy errors are logged
+	defer log.SetOutput(os.Stderr)
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL := mustParseURL(down.URL)
+	down.Close()
+	up := namedBackend("up")
+	defer up.Close()
+	targets := []*url.URL{downURL, mustParseURL(up.URL)}
+
+	lb := NewLoadBalancer(targets)
+	lb.Retries = 1
+	lb.MaxFails = 1
+	defer lb.Close()
+	front := httptest.NewServer(lb)
+	defer front.Close()
+
+	// The first request goes to the dead backend and is retried.
+	if code, body := lbGet(t, "GET", front.URL, nil); code != 200 || body != "up" {
+		t.Fatalf("GET = %d %q; want 200 \"up\"", code, body)
+	}
+	st := lb.Stats()
+	if !st[0].Ejected || st[0].Failures != 1 || st[0].Outstanding != 0 {
+		t.Errorf("dead backend stats = %+v; want ejected after 1 failure", st[0])
+	}
+	if st[1].Ejected || st[1].Requests != 1 {
+		t.Errorf("live backend stats = %+v", st[1])
+	}
+	// While ejected, the dead backend is skipped.
+	for i := 0; i < 2; i++ {
+		if code, body := lbGet(t, "GET", front.URL, nil); code != 200 || body != "up" {
+			t.Errorf("GET = %d %q; want 200 \"up\"", code, body)
+		}
+	}
+	if st := lb.Stats(); st[0].Requests != 1 {
+		t.Errorf("ejected backend got %d requests; want 1", st[0].Requests)
+	}
+
+	// Requests with bodies are not retried.
+	lb = NewLoadBalancer(targets)
+	lb.Retries = 1
+	defer lb.Close()
+	front2 := httptest.NewServer(lb)
+	defer front2.Close()
+	if code, _ := lbGet(t, "POST", front2.URL, strings.NewReader("data")); code != 502 {
+		t.Errorf("POST to dead backend status = %d; want 502", code)
+	}
+	if st := lb.Stats(); st[1].Requests != 0 {
+		t.Errorf("POST was retried on live backend")
+	}
+}
+
+func TestLoadBalancerHealthCheck(t *testing.T) {
+	var mu sync.Mutex
+	sick := true
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/base/healthz" {
+			mu.Lock()
+			defer mu.Unlock()
+			if sick {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+			return
+		}
+		io.WriteString(w, "flaky")
+	}))
+	defer flaky.Close()
+	steady := namedBackend("steady")
+	defer steady.Close()
+
+	lb := NewLoadBalancer([]*url.URL{mustParseURL(flaky.URL + "/base"), mustParseURL(steady.URL)})
+	lb.HealthCheckPath = "/healthz"
+	defer lb.Close()
+	front := httptest.NewServer(lb)
+	defer front.Close()
+
+	lb.checkHealth()
+	if st := lb.Stats(); st[0].Healthy || !st[1].Healthy {
+		t.Fatalf("after check: healthy = %v, %v; want false, true", st[0].Healthy, st[1].Healthy)
+	}
+	for i := 0; i < 3; i++ {
+		if _, body := lbGet(t, "GET", front.URL, nil); body != "steady" {
+			t.Errorf("request went to %q; want steady", body)
+		}
+	}
+
+	mu.Lock()
+	sick = false
+	mu.Unlock()
+	lb.checkHealth()
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		_, body := lbGet(t, "GET", front.URL, nil)
+		seen[body] = true
+	}
+	if !seen["flaky"] || !seen["steady"] {
+		t.Errorf("after recovery, requests went to %v; want both backends", seen)
+	}
+}
+
+func TestLoadBalancerNoBackend(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	lb := NewLoadBalancer(nil)
+	front := httptest.NewServer(lb)
+	defer front.Close()
+	if code, _ := lbGet(t, "GET", front.URL, nil); code != 503 {
+		t.Errorf("status = %d; want 503", code)
+	}
+}
+
+func TestLoadBalancerHungHealthCheck(t *testing.T) {
+	var mu sync.Mutex
+	checks := 0
+	hang := make(chan bool)
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		checks++
+		first := checks == 1
+		mu.Unlock()
+		if first {
+			<-hang
+		}
+	}))
+	defer hung.Close()
+	defer close(hang)
+
+	lb := NewLoadBalancer([]*url.URL{mustParseURL(hung.URL)})
+	lb.HealthCheckPath = "/healthz"
+	lb.HealthCheckTimeout = 50 * time.Millisecond
+	defer lb.Close()
+
+	lb.checkHealth()
+	if st := lb.Stats(); st[0].Healthy {
+		t.Fatal("hung backend reported healthy")
+	}
+
+	// The hung check's connection is closed when it times out, so
+	// a later check reaches the recovered backend.
+	for i := 0; !lb.Stats()[0].Healthy; i++ {
+		if i == 20 {
+			t.Fatalf("backend still unhealthy after %d more checks", i)
+		}
+		time.Sleep(10 * time.Millisecond)
+		lb.checkHealth()
+	}
+}
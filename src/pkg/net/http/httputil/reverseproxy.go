@@ -7,6 +7,11 @@
 package httputil
 
 import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net"
@@ -24,6 +29,19 @@ var onExitFlushLoop func()
 // ReverseProxy is an HTTP Handler that takes an incoming request and
 // sends it to another server, proxying the response back to the
 // client.
+//
+// Requests to switch protocols, such as WebSocket handshakes, which
+// carry an Upgrade header and the "upgrade" Connection option, are
+// not sent using Transport's RoundTrip. Instead, a connection to the
+// backend is dialed with the Transport's Dial function, Proxy and TLS
+// configuration if Transport is an *http.Transport, or with net.Dial
+// otherwise, and the request is written to it directly. A connection
+// through a proxy is tunneled with CONNECT; if the proxy cannot be
+// used, the client receives a 502 Bad Gateway response. If the
+// backend accepts the upgrade with a 101 Switching Protocols
+// response, the client connection is hijacked, the response is
+// forwarded to the client, and bytes are then copied in both
+// directions until both sides have finished sending.
 type ReverseProxy struct {
 	// Director must be a function which modifies
 	// the request into a new request to be sent
@@ -59,20 +77,25 @@ func singleJoiningSlash(a, b string) string {
 // target's path is "/base" and the incoming request was for "/dir",
 // the target request will be for /base/dir.
 func NewSingleHostReverseProxy(target *url.URL) *ReverseProxy {
-	targetQuery := target.RawQuery
 	director := func(req *http.Request) {
-		req.URL.Scheme = target.Scheme
-		req.URL.Host = target.Host
-		req.URL.Path = singleJoiningSlash(target.Path, req.URL.Path)
-		if targetQuery == "" || req.URL.RawQuery == "" {
-			req.URL.RawQuery = targetQuery + req.URL.RawQuery
-		} else {
-			req.URL.RawQuery = targetQuery + "&" + req.URL.RawQuery
-		}
+		rewriteURL(req, target)
 	}
 	return &ReverseProxy{Director: director}
 }
 
+// rewriteURL rewrites req's URL to the scheme and host of target,
+// prefixing the path and query with target's.
+func rewriteURL(req *http.Request, target *url.URL) {
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+	req.URL.Path = singleJoiningSlash(target.Path, req.URL.Path)
+	if target.RawQuery == "" || req.URL.RawQuery == "" {
+		req.URL.RawQuery = target.RawQuery + req.URL.RawQuery
+	} else {
+		req.URL.RawQuery = target.RawQuery + "&" + req.URL.RawQuery
+	}
+}
+
 func copyHeader(dst, src http.Header) {
 	for k, vv := range src {
 		for _, v := range vv {
@@ -96,14 +119,20 @@ func (p *ReverseProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	outreq.ProtoMinor = 1
 	outreq.Close = false
 
+	upgrade := isUpgrade(req.Header)
+
 	// Remove the connection header to the backend.  We want a
 	// persistent connection, regardless of what the client sent
 	// to us.  This is modifying the same underlying map from req
 	// (shallow copied above) so we only copy it if necessary.
+	// An upgrade request keeps only the upgrade option.
 	if outreq.Header.Get("Connection") != "" {
 		outreq.Header = make(http.Header)
 		copyHeader(outreq.Header, req.Header)
 		outreq.Header.Del("Connection")
+		if upgrade {
+			outreq.Header.Set("Connection", "Upgrade")
+		}
 	}
 
 	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
@@ -116,6 +145,11 @@ func (p *ReverseProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 		outreq.Header.Set("X-Forwarded-For", clientIP)
 	}
 
+	if upgrade {
+		p.serveUpgrade(rw, outreq, transport)
+		return
+	}
+
 	res, err := transport.RoundTrip(outreq)
 	if err != nil {
 		log.Printf("http: proxy error: %v", err)
@@ -130,6 +164,246 @@ func (p *ReverseProxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
 	p.copyResponse(rw, res.Body)
 }
 
+// isUpgrade reports whether h, the header of a request, asks to
+// switch protocols.
+func isUpgrade(h http.Header) bool {
+	if h.Get("Upgrade") == "" {
+		return false
+	}
+	for _, v := range h["Connection"] {
+		for _, opt := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(opt), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// serveUpgrade proxies the upgrade request req on a connection of its
+// own and, if the backend switches protocols, joins that connection
+// to the client's.
+func (p *ReverseProxy) serveUpgrade(rw http.ResponseWriter, req *http.Request, transport http.RoundTripper) {
+	hj, ok := rw.(http.Hijacker)
+	if !ok {
+		log.Printf("http: proxy error: can't switch protocols using non-Hijacker ResponseWriter type %T", rw)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	var backConn net.Conn
+	release := func(failed bool) {}
+	var err error
+	if d, ok := transport.(upgradeDialer); ok {
+		backConn, release, err = d.dialUpgrade(req)
+	} else {
+		backConn, err = dialBackend(transport, req)
+	}
+	if err != nil {
+		log.Printf("http: proxy error: %v", err)
+		code := http.StatusInternalServerError
+		if se, ok := err.(statusError); ok {
+			code = se.code
+		}
+		rw.WriteHeader(code)
+		return
+	}
+	defer backConn.Close()
+	failed := true
+	defer func() { release(failed) }()
+
+	if req.ContentLength == 0 {
+		req.Body = nil
+	}
+	if err := req.Write(backConn); err != nil {
+		log.Printf("http: proxy error: %v", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	backBuf := bufio.NewReader(backConn)
+	res, err := http.ReadResponse(backBuf, req)
+	if err != nil {
+		log.Printf("http: proxy error: %v", err)
+		rw.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	failed = res.StatusCode/100 == 5
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		// The backend refused; relay its answer as usual.
+		defer res.Body.Close()
+		copyHeader(rw.Header(), res.Header)
+		rw.WriteHeader(res.StatusCode)
+		p.copyResponse(rw, res.Body)
+		return
+	}
+
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		log.Printf("http: proxy error: %v", err)
+		return
+	}
+	defer conn.Close()
+	// The connection outlives the request, so the server's read
+	// and write timeouts no longer apply.
+	conn.SetDeadline(time.Time{})
+
+	fmt.Fprintf(brw, "HTTP/1.1 %s\r\n", res.Status)
+	res.Header.Write(brw)
+	io.WriteString(brw, "\r\n")
+	if err := brw.Flush(); err != nil {
+		log.Printf("http: proxy error: %v", err)
+		return
+	}
+
+	// Either side may have sent data already, which is buffered in
+	// the readers, so copy from those rather than the connections.
+	done := make(chan bool, 2)
+	go spliceHalf(backConn, brw.Reader, done)
+	go spliceHalf(conn, backBuf, done)
+	<-done
+	<-done
+}
+
+// An upgradeDialer is a RoundTripper that also chooses and dials the
+// backend for upgrade requests, which bypass RoundTrip.
+type upgradeDialer interface {
+	// dialUpgrade dials the backend for req, rewriting req.URL to
+	// address it. The returned release function must be called once
+	// the connection is finished with, reporting whether the backend
+	// failed the request.
+	dialUpgrade(req *http.Request) (c net.Conn, release func(failed bool), err error)
+}
+
+// A statusError is an error with the status code to answer the
+// client with.
+type statusError struct {
+	code int
+	err  error
+}
+
+func (e statusError) Error() string { return e.err.Error() }
+
+// dialBackend dials the host of req.URL, using transport's Dial
+// function, proxy and TLS configuration if it is an *http.Transport.
+// Proxy failures are reported as a statusError with code 502.
+func dialBackend(transport http.RoundTripper, req *http.Request) (net.Conn, error) {
+	dial := net.Dial
+	var cfg *tls.Config
+	var proxy func(*http.Request) (*url.URL, error)
+	if t, ok := transport.(*http.Transport); ok {
+		if t.Dial != nil {
+			dial = t.Dial
+		}
+		cfg = t.TLSClientConfig
+		proxy = t.Proxy
+	}
+	u := req.URL
+	https := u.Scheme == "https" || u.Scheme == "wss"
+	addr := u.Host
+	if !hasPort(addr) {
+		if https {
+			addr += ":443"
+		} else {
+			addr += ":80"
+		}
+	}
+	var proxyURL *url.URL
+	if proxy != nil {
+		var err error
+		if proxyURL, err = proxy(req); err != nil {
+			return nil, statusError{http.StatusBadGateway, err}
+		}
+	}
+
+	var conn net.Conn
+	var err error
+	if proxyURL == nil {
+		conn, err = dial("tcp", addr)
+	} else {
+		conn, err = dialProxy(dial, proxyURL, addr)
+	}
+	if err != nil || !https {
+		return conn, err
+	}
+	host, _, _ := net.SplitHostPort(addr)
+	if cfg == nil || cfg.ServerName == "" {
+		if cfg == nil {
+			cfg = &tls.Config{ServerName: host}
+		} else {
+			clone := *cfg // shallow clone
+			clone.ServerName = host
+			cfg = &clone
+		}
+	}
+	tconn := tls.Client(conn, cfg)
+	if err := tconn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tconn, nil
+}
+
+// hasPort reports whether host, as in URL.Host, has a port.
+func hasPort(host string) bool {
+	return strings.LastIndex(host, ":") > strings.LastIndex(host, "]")
+}
+
+// dialProxy dials the HTTP proxy at proxyURL and asks it to open a
+// tunnel to addr with CONNECT.
+func dialProxy(dial func(net, addr string) (net.Conn, error), proxyURL *url.URL, addr string) (net.Conn, error) {
+	if proxyURL.Scheme != "" && proxyURL.Scheme != "http" {
+		return nil, statusError{http.StatusBadGateway, errors.New("unsupported proxy scheme " + proxyURL.Scheme)}
+	}
+	proxyAddr := proxyURL.Host
+	if !hasPort(proxyAddr) {
+		proxyAddr += ":80"
+	}
+	conn, err := dial("tcp", proxyAddr)
+	if err != nil {
+		return nil, statusError{http.StatusBadGateway, err}
+	}
+	connectReq := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if u := proxyURL.User; u != nil {
+		password, _ := u.Password()
+		credential := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + password))
+		connectReq.Header.Set("Proxy-Authorization", "Basic "+credential)
+	}
+	if err := connectReq.Write(conn); err != nil {
+		conn.Close()
+		return nil, statusError{http.StatusBadGateway, err}
+	}
+	// The backend will not speak until spoken to, so nothing is
+	// lost by discarding the reader.
+	res, err := http.ReadResponse(bufio.NewReader(conn), connectReq)
+	if err == nil && res.StatusCode != http.StatusOK {
+		err = errors.New("proxy CONNECT to " + addr + " failed: " + res.Status)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, statusError{http.StatusBadGateway, err}
+	}
+	return conn, nil
+}
+
+// spliceHalf copies from src to dst until src is exhausted and then
+// shuts down the writing side of dst, closing dst entirely if it
+// cannot be half-closed.
+func spliceHalf(dst net.Conn, src io.Reader, done chan<- bool) {
+	io.Copy(dst, src)
+	if cw, ok := dst.(interface {
+		CloseWrite() error
+	}); ok {
+		cw.CloseWrite()
+	} else {
+		dst.Close()
+	}
+	done <- true
+}
+
 func (p *ReverseProxy) copyResponse(dst io.Writer, src io.Reader) {
 	if p.FlushInterval != 0 {
 		if wf, ok := dst.(writeFlusher); ok {
@@ -7,10 +7,15 @@
 package httputil
 
 import (
+	"bufio"
+	"io"
 	"io/ioutil"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -191,3 +196,235 @@ func TestReverseProxyFlushInterval(t *testing.T) {
 		t.Error("maxLatencyWriter flushLoop() never exited")
 	}
 }
+
+// upgradeBackend accepts upgrades to the "echo" protocol: it greets
+// the client, echoes what it receives and says goodbye once the
+// client has finished sending.
+func upgradeBackend(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "echo" {
+			http.Error(w, "unsupported protocol", http.StatusBadRequest)
+			return
+		}
+		if c := r.Header.Get("Connection"); c != "Upgrade" {
+			t.Errorf("backend got Connection header %q; want Upgrade", c)
+		}
+		if r.Header.Get("X-Forwarded-For") == "" {
+			t.Errorf("didn't get X-Forwarded-For header")
+		}
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+		io.WriteString(brw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\nhello\n")
+		brw.Flush()
+		io.Copy(conn, brw)
+		io.WriteString(conn, "bye\n")
+	}))
+}
+
+func TestReverseProxyUpgrade(t *testing.T) {
+	backend := upgradeBackend(t)
+	defer backend.Close()
+	frontend := httptest.NewServer(NewSingleHostReverseProxy(mustParseURL(backend.URL)))
+	defer frontend.Close()
+	testEchoUpgrade(t, frontend.Listener.Addr().String(), 0)
+}
+
+func TestReverseProxyUpgradeReadTimeout(t *testing.T) {
+	backend := upgradeBackend(t)
+	defer backend.Close()
+	frontend := httptest.NewUnstartedServer(NewSingleHostReverseProxy(mustParseURL(backend.URL)))
+	frontend.Config.ReadTimeout = 50 * time.Millisecond
+	frontend.Start()
+	defer frontend.Close()
+	testEchoUpgrade(t, frontend.Listener.Addr().String(), 200*time.Millisecond)
+}
+
+// connectProxy is an HTTP proxy that serves only CONNECT requests,
+// answering the rest with the given status.
+type connectProxy struct {
+	net.Listener
+	status  int
+	tunnels chan string // addresses tunneled to
+}
+
+func newConnectProxy(t *testing.T, status int) *connectProxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &connectProxy{Listener: l, status: status, tunnels: make(chan string, 10)}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(c)
+		}
+	}()
+	return p
+}
+
+func (p *connectProxy) serve(c net.Conn) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	req, err := http.ReadRequest(br)
+	if err != nil || req.Method != "CONNECT" || p.status != http.StatusOK {
+		io.WriteString(c, "HTTP/1.1 403 Forbidden\r\nContent-Length: 0\r\n\r\n")
+		return
+	}
+	p.tunnels <- req.URL.Host
+	back, err := net.Dial("tcp", req.URL.Host)
+	if err != nil {
+		io.WriteString(c, "HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\n\r\n")
+		return
+	}
+	io.WriteString(c, "HTTP/1.1 200 OK\r\n\r\n")
+	done := make(chan bool, 2)
+	go spliceHalf(back, br, done)
+	go spliceHalf(c, back, done)
+	<-done
+	<-done
+}
+
+func TestReverseProxyUpgradeThroughProxy(t *testing.T) {
+	backend := upgradeBackend(t)
+	defer backend.Close()
+	cp := newConnectProxy(t, http.StatusOK)
+	defer cp.Close()
+	rp := NewSingleHostReverseProxy(mustParseURL(backend.URL))
+	rp.Transport = &http.Transport{Proxy: http.ProxyURL(mustParseURL("http://" + cp.Addr().String()))}
+	frontend := httptest.NewServer(rp)
+	defer frontend.Close()
+
+	testEchoUpgrade(t, frontend.Listener.Addr().String(), 0)
+	select {
+	case addr := <-cp.tunnels:
+		if want := backend.Listener.Addr().String(); addr != want {
+			t.Errorf("proxy tunneled to %q; want %q", addr, want)
+		}
+	default:
+		t.Error("upgrade did not go through the proxy")
+	}
+}
+
+func TestReverseProxyUpgradeProxyRefused(t *testing.T) {
+	backend := upgradeBackend(t)
+	defer backend.Close()
+	cp := newConnectProxy(t, http.StatusForbidden)
+	defer cp.Close()
+	rp := NewSingleHostReverseProxy(mustParseURL(backend.URL))
+	rp.Transport = &http.Transport{Proxy: http.ProxyURL(mustParseURL("http://" + cp.Addr().String()))}
+	frontend := httptest.NewServer(rp)
+	defer frontend.Close()
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	req, _ := http.NewRequest("GET", frontend.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "echo")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadGateway {
+		t.Errorf("status = %d; want 502", res.StatusCode)
+	}
+}
+
+func TestLoadBalancerUpgrade(t *testing.T) {
+	backend := upgradeBackend(t)
+	defer backend.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL := mustParseURL(down.URL)
+	down.Close()
+
+	lb := NewLoadBalancer([]*url.URL{downURL, mustParseURL(backend.URL)})
+	lb.Retries = 1
+	defer lb.Close()
+	frontend := httptest.NewServer(lb)
+	defer frontend.Close()
+	log.SetOutput(ioutil.Discard) // the dead backend's dial error is logged
+	defer log.SetOutput(os.Stderr)
+	testEchoUpgrade(t, frontend.Listener.Addr().String(), 0)
+
+	// The upgraded connection is released once the proxy has
+	// finished copying, shortly after the client sees EOF.
+	for i := 0; ; i++ {
+		st := lb.Stats()
+		if st[1].Outstanding == 0 {
+			if st[1].Requests != 1 || st[0].Failures != 1 {
+				t.Errorf("stats = %+v; want one request to live backend after a failed dial", st)
+			}
+			break
+		}
+		if i == 50 {
+			t.Fatalf("upgraded connection still outstanding: %+v", st[1])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// testEchoUpgrade upgrades a connection to the proxy at addr, backed
+// by upgradeBackend, and checks that data flows in both directions,
+// pausing for the given duration before sending data.
+func testEchoUpgrade(t *testing.T, addr string, pause time.Duration) {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	io.WriteString(c, "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: keep-alive, Upgrade\r\nUpgrade: echo\r\n\r\n")
+	br := bufio.NewReader(c)
+	res, err := http.ReadResponse(br, &http.Request{Method: "GET"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusSwitchingProtocols || res.Header.Get("Upgrade") != "echo" {
+		t.Fatalf("handshake response = %d, Upgrade %q; want 101, echo", res.StatusCode, res.Header.Get("Upgrade"))
+	}
+	if line, err := br.ReadString('\n'); line != "hello\n" || err != nil {
+		t.Fatalf("greeting = %q, %v; want hello", line, err)
+	}
+	time.Sleep(pause)
+	io.WriteString(c, "ping\n")
+	if line, err := br.ReadString('\n'); line != "ping\n" || err != nil {
+		t.Fatalf("echo = %q, %v; want ping", line, err)
+	}
+	if err := c.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	rest, err := ioutil.ReadAll(br)
+	if err != nil {
+		t.Fatalf("reading after close: %v", err)
+	}
+	if string(rest) != "bye\n" {
+		t.Errorf("after close got %q; want bye", rest)
+	}
+}
+
+func TestReverseProxyUpgradeRefused(t *testing.T) {
+	backend := upgradeBackend(t)
+	defer backend.Close()
+	frontend := httptest.NewServer(NewSingleHostReverseProxy(mustParseURL(backend.URL)))
+	defer frontend.Close()
+
+	req, _ := http.NewRequest("GET", frontend.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "nope")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusBadRequest || string(body) != "unsupported protocol\n" {
+		t.Errorf("got %d %q; want 400 from backend", res.StatusCode, body)
+	}
+}
@@ -0,0 +1,348 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Server-sent events, as defined by
+// http://www.w3.org/TR/eventsource/
+
+package httputil
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An Event is a server-sent event.
+type Event struct {
+	// ID is the event's ID. Clients send the ID of the last event
+	// they received in the Last-Event-ID header when they reconnect.
+	// Carriage returns, line feeds and NUL bytes are removed from it
+	// when the event is published or written.
+	ID string
+
+	// Type is the event type, or empty for the default type,
+	// "message". Like ID, it loses any carriage returns, line feeds
+	// and NUL bytes.
+	Type string
+
+	// Data is the event's data. It may span several lines.
+	Data string
+
+	// Retry, if positive, tells the client how long to wait before
+	// reconnecting after the connection is lost.
+	Retry time.Duration
+}
+
+// eventField returns s without the characters that would end a field
+// of the text/event-stream format or, in an ID, void it.
+func eventField(s string) string {
+	if strings.IndexAny(s, "\r\n\x00") < 0 {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '\r', '\n', 0:
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// writeEvent writes ev to w in the text/event-stream format.
+func writeEvent(w io.Writer, ev *Event) error {
+	var b bytes.Buffer
+	if id := eventField(ev.ID); id != "" {
+		b.WriteString("id: " + id + "\n")
+	}
+	if typ := eventField(ev.Type); typ != "" {
+		b.WriteString("event: " + typ + "\n")
+	}
+	if ev.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(int64(ev.Retry/time.Millisecond), 10) + "\n")
+	}
+	data := strings.Replace(ev.Data, "\r\n", "\n", -1)
+	data = strings.Replace(data, "\r", "\n", -1)
+	for _, line := range strings.Split(data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// An EventStream is an http.Handler that streams the events published
+// on it to every connected client, as a text/event-stream response.
+//
+// Events published without an ID get the next of a sequence of numeric
+// IDs. The most recent events are kept so that clients reconnecting
+// with a Last-Event-ID header first receive the events they missed.
+//
+// Each client has a buffer of pending events. A client whose buffer is
+// full when an event is published is disconnected rather than holding
+// up the others; it can reconnect and resume.
+type EventStream struct {
+	// History is the number of recent events kept for resuming
+	// clients.
+	History int
+
+	// BufferSize is the number of events buffered for each client.
+	// If zero, DefaultEventBufferSize is used.
+	BufferSize int
+
+	// Retry, if positive, is sent to clients when they connect as the
+	// time to wait before reconnecting.
+	Retry time.Duration
+
+	// Heartbeat, if positive, is the interval at which an idle stream
+	// gets a comment line, which keeps proxies from closing it.
+	Heartbeat time.Duration
+
+	mu      sync.Mutex
+	clients map[chan *Event]bool
+	history []*Event
+	lastID  int64
+	closed  bool
+}
+
+// DefaultEventBufferSize is the default value of EventStream.BufferSize.
+const DefaultEventBufferSize = 16
+
+// NewEventStream returns an EventStream keeping the given number of
+// events for resuming clients.
+func NewEventStream(history int) *EventStream {
+	return &EventStream{History: history}
+}
+
+// Publish sends ev to all connected clients. If ev.ID is empty, the next
+// numeric ID is assigned. It returns the event's ID.
+func (s *EventStream) Publish(ev Event) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ev.ID = eventField(ev.ID)
+	ev.Type = eventField(ev.Type)
+	if ev.ID == "" {
+		s.lastID++
+		ev.ID = strconv.FormatInt(s.lastID, 10)
+	}
+	if s.History > 0 {
+		s.history = append(s.history, &ev)
+		if len(s.history) > s.History {
+			s.history = s.history[len(s.history)-s.History:]
+		}
+	}
+	for c := range s.clients {
+		select {
+		case c <- &ev:
+		default:
+			// Too slow; drop the client.
+			delete(s.clients, c)
+			close(c)
+		}
+	}
+	return ev.ID
+}
+
+// Close disconnects all clients. Later requests are answered with
+// status 503 Service Unavailable.
+func (s *EventStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for c := range s.clients {
+		delete(s.clients, c)
+		close(c)
+	}
+}
+
+// subscribe registers a new client, returning its channel and the
+// events published after the one with ID lastID, if it is known.
+func (s *EventStream) subscribe(lastID string) (chan *Event, []*Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil, nil
+	}
+	var missed []*Event
+	if lastID != "" {
+		for i := len(s.history) - 1; i >= 0; i-- {
+			if s.history[i].ID == lastID {
+				missed = append(missed, s.history[i+1:]...)
+				break
+			}
+		}
+	}
+	size := s.BufferSize
+	if size <= 0 {
+		size = DefaultEventBufferSize
+	}
+	c := make(chan *Event, size)
+	if s.clients == nil {
+		s.clients = make(map[chan *Event]bool)
+	}
+	s.clients[c] = true
+	return c, missed
+}
+
+func (s *EventStream) unsubscribe(c chan *Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.clients[c] {
+		delete(s.clients, c)
+		close(c)
+	}
+}
+
+func (s *EventStream) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	var closeNotify <-chan bool
+	if cn, ok := w.(http.CloseNotifier); ok {
+		closeNotify = cn.CloseNotify()
+	}
+	c, missed := s.subscribe(req.Header.Get("Last-Event-ID"))
+	if c == nil {
+		http.Error(w, "event stream closed", http.StatusServiceUnavailable)
+		return
+	}
+	defer s.unsubscribe(c)
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if s.Retry > 0 {
+		io.WriteString(w, "retry: "+strconv.FormatInt(int64(s.Retry/time.Millisecond), 10)+"\n\n")
+	}
+	for _, ev := range missed {
+		if writeEvent(w, ev) != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	var heartbeat <-chan time.Time
+	if s.Heartbeat > 0 {
+		t := time.NewTicker(s.Heartbeat)
+		defer t.Stop()
+		heartbeat = t.C
+	}
+	for {
+		select {
+		case ev, ok := <-c:
+			if !ok {
+				return
+			}
+			if writeEvent(w, ev) != nil {
+				return
+			}
+		case <-heartbeat:
+			if _, err := io.WriteString(w, ":\n\n"); err != nil {
+				return
+			}
+		case <-closeNotify:
+			return
+		}
+		flusher.Flush()
+	}
+	panic("unreachable")
+}
+
+// An EventReader reads server-sent events from a text/event-stream.
+type EventReader struct {
+	r      *bufio.Reader
+	lastID string
+	retry  time.Duration
+	begun  bool
+}
+
+// NewEventReader returns an EventReader reading from r.
+func NewEventReader(r io.Reader) *EventReader {
+	return &EventReader{r: bufio.NewReader(r)}
+}
+
+// LastEventID returns the last event ID the stream has set, which is the
+// value of the Last-Event-ID header to send when reconnecting.
+func (r *EventReader) LastEventID() string {
+	return r.lastID
+}
+
+// Retry returns the last reconnection time the stream has set, or zero.
+func (r *EventReader) Retry() time.Duration {
+	return r.retry
+}
+
+// ReadEvent reads the next event from the stream. The event's ID is the
+// last event ID set by the stream, and its Retry the last reconnection
+// time. An event cut short by the end of the stream is discarded, and
+// io.EOF is returned.
+func (r *EventReader) ReadEvent() (*Event, error) {
+	var typ string
+	var data bytes.Buffer
+	hasData := false
+	for {
+		line, err := r.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = line[:len(line)-1]
+		if strings.HasSuffix(line, "\r") {
+			line = line[:len(line)-1]
+		}
+		if !r.begun {
+			r.begun = true
+			if strings.HasPrefix(line, "\ufeff") {
+				line = line[len("\ufeff"):] // byte order mark
+			}
+		}
+		if line == "" {
+			if !hasData {
+				typ = ""
+				continue
+			}
+			return &Event{
+				ID:    r.lastID,
+				Type:  typ,
+				Data:  data.String(),
+				Retry: r.retry,
+			}, nil
+		}
+		if line[0] == ':' {
+			continue // comment
+		}
+		field, value := line, ""
+		if i := strings.Index(line, ":"); i >= 0 {
+			field, value = line[:i], line[i+1:]
+			if strings.HasPrefix(value, " ") {
+				value = value[1:]
+			}
+		}
+		switch field {
+		case "event":
+			typ = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "id":
+			if strings.IndexRune(value, 0) < 0 {
+				r.lastID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 64); err == nil {
+				r.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	panic("unreachable")
+}
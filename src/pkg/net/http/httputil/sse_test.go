@@ -0,0 +1,205 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httputil
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventReader(t *testing.T) {
+	const stream = "\ufeff: a comment\r\n" +
+		"retry: 2500\n" +
+		"data: first\n" +
+		"\n" +
+		"event: update\r\n" +
+		"id: 7\n" +
+		"data:two\n" +
+		"data:  lines\n" +
+		"\n" +
+		"event: ignored\n" +
+		"\n" +
+		"data\n" +
+		"id: bad\x00id\n" +
+		"retry: -1\n" +
+		"\n" +
+		"data: cut short\n"
+	want := []Event{
+		{Data: "first", Retry: 2500 * time.Millisecond},
+		{ID: "7", Type: "update", Data: "two\n lines", Retry: 2500 * time.Millisecond},
+		{ID: "7", Data: "", Retry: 2500 * time.Millisecond},
+	}
+	r := NewEventReader(strings.NewReader(stream))
+	for i, w := range want {
+		ev, err := r.ReadEvent()
+		if err != nil {
+			t.Fatalf("event %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(*ev, w) {
+			t.Errorf("event %d = %+v; want %+v", i, *ev, w)
+		}
+	}
+	if ev, err := r.ReadEvent(); err != io.EOF {
+		t.Errorf("at end got %+v, %v; want io.EOF", ev, err)
+	}
+	if r.LastEventID() != "7" {
+		t.Errorf("LastEventID = %q; want 7", r.LastEventID())
+	}
+}
+
+// numClients returns the number of clients connected to s.
+func (s *EventStream) numClients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+func waitClients(t *testing.T, s *EventStream, n int) {
+	for i := 0; s.numClients() != n; i++ {
+		if i == 500 {
+			t.Fatalf("%d clients; want %d", s.numClients(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// connectEvents connects to the event stream at ts. Closing the
+// returned connection disconnects at once; closing a response body
+// would read it to the end.
+func connectEvents(t *testing.T, ts *httptest.Server, lastID string) (net.Conn, *EventReader) {
+	c, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	req.Write(c)
+	res, err := http.ReadResponse(bufio.NewReader(c), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+	return c, NewEventReader(res.Body)
+}
+
+func readEvent(t *testing.T, r *EventReader, id, typ, data string) {
+	ev, err := r.ReadEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.ID != id || ev.Type != typ || ev.Data != data {
+		t.Errorf("got event %+v; want ID %q, type %q, data %q", *ev, id, typ, data)
+	}
+}
+
+func TestWriteEventFields(t *testing.T) {
+	var b bytes.Buffer
+	ev := &Event{ID: "7\ndata: forged", Type: "x\r\nretry: 1\x00", Data: "ok"}
+	if err := writeEvent(&b, ev); err != nil {
+		t.Fatal(err)
+	}
+	want := "id: 7data: forged\nevent: xretry: 1\ndata: ok\n\n"
+	if b.String() != want {
+		t.Errorf("wrote %q; want %q", b.String(), want)
+	}
+
+	s := NewEventStream(1)
+	if id := s.Publish(Event{ID: "a\nb", Data: "x"}); id != "ab" {
+		t.Errorf("Publish returned ID %q; want %q", id, "ab")
+	}
+	if id := s.Publish(Event{ID: "\r\n", Data: "x"}); id != "1" {
+		t.Errorf("Publish of ID without other characters returned %q; want %q", id, "1")
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	s := NewEventStream(10)
+	s.Retry = 1500 * time.Millisecond
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	c, r := connectEvents(t, ts, "")
+	waitClients(t, s, 1)
+	s.Publish(Event{Data: "one"})
+	s.Publish(Event{Type: "multi", Data: "two\r\nlines"})
+	readEvent(t, r, "1", "", "one")
+	readEvent(t, r, "2", "multi", "two\nlines")
+	if r.Retry() != 1500*time.Millisecond {
+		t.Errorf("Retry = %v", r.Retry())
+	}
+
+	// A closed connection unsubscribes the client.
+	c.Close()
+	waitClients(t, s, 0)
+
+	// A resuming client gets the events it missed.
+	s.Publish(Event{ID: "custom", Data: "three"})
+	c, r = connectEvents(t, ts, r.LastEventID())
+	defer c.Close()
+	readEvent(t, r, "custom", "", "three")
+	waitClients(t, s, 1)
+	s.Publish(Event{Data: "four"})
+	readEvent(t, r, "3", "", "four")
+
+	s.Close()
+	if ev, err := r.ReadEvent(); err != io.EOF {
+		t.Errorf("after Close got %+v, %v; want io.EOF", ev, err)
+	}
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("after Close got status %d; want 503", res.StatusCode)
+	}
+}
+
+func TestEventStreamHeartbeat(t *testing.T) {
+	s := NewEventStream(0)
+	s.Heartbeat = 10 * time.Millisecond
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	defer s.Close()
+
+	c, r := connectEvents(t, ts, "")
+	defer c.Close()
+	br := r.r
+	for i := 0; i < 2; i++ {
+		if line, err := br.ReadString('\n'); line != ":\n" {
+			t.Fatalf("got %q, %v; want a comment", line, err)
+		}
+		br.ReadString('\n')
+	}
+}
+
+func TestEventStreamSlowClient(t *testing.T) {
+	s := NewEventStream(0)
+	s.BufferSize = 1
+	c, _ := s.subscribe("")
+	s.Publish(Event{Data: "one"})
+	s.Publish(Event{Data: "two"})
+	if ev := <-c; ev.Data != "one" {
+		t.Errorf("got %q", ev.Data)
+	}
+	if _, ok := <-c; ok {
+		t.Errorf("slow client was not dropped")
+	}
+	if n := s.numClients(); n != 0 {
+		t.Errorf("%d clients left", n)
+	}
+}
@@ -144,12 +144,19 @@ type Request struct {
 	// The HTTP client ignores MultipartForm and uses Body instead.
 	MultipartForm *multipart.Form
 
-	// Trailer maps trailer keys to values.  Like for Header, if the
-	// response has multiple trailer lines with the same key, they will be
-	// concatenated, delimited by commas.
-	// For server requests, Trailer is only populated after Body has been
-	// closed or fully consumed.
-	// Trailer support is only partially complete.
+	// Trailer maps trailer keys to values, in the same format as
+	// the header.
+	//
+	// For server requests, Trailer initially contains only the
+	// trailer keys declared in the "Trailer" header, with nil
+	// values. The values are filled in once Body has been read to
+	// EOF; Body must not be closed before then.
+	//
+	// For client requests, Trailer must be initialized to a map
+	// containing the trailer keys to send later, which makes the
+	// request body chunked. The values may be nil or their final
+	// values, and may be updated while the body is being read. Once
+	// the body returns EOF, the caller must not mutate Trailer.
 	Trailer Header
 
 	// RemoteAddr allows HTTP servers and other software to record
@@ -175,6 +182,10 @@ type Request struct {
 	// otherwise it leaves the field nil.
 	// This field is ignored by the HTTP client.
 	TLS *tls.ConnectionState
+
+	// pathValues holds the values of the wildcards in the
+	// ServeMux pattern that matched the request.
+	pathValues map[string]string
 }
 
 // ProtoAtLeast returns whether the HTTP protocol used
@@ -230,6 +241,23 @@ func (r *Request) Referer() string {
 	return r.Header.Get("Referer")
 }
 
+// PathValue returns the value of the named wildcard in the ServeMux
+// pattern that matched the request, or the empty string if the request
+// was not routed by such a pattern or the pattern has no wildcard of
+// that name.
+func (r *Request) PathValue(name string) string {
+	return r.pathValues[name]
+}
+
+// SetPathValue sets the value returned by PathValue for name. It is
+// useful to test handlers without routing requests through a ServeMux.
+func (r *Request) SetPathValue(name, value string) {
+	if r.pathValues == nil {
+		r.pathValues = make(map[string]string)
+	}
+	r.pathValues[name] = value
+}
+
 // multipartByReader is a sentinel value.
 // Its presence in Request.MultipartForm indicates that parsing of the request
 // body has been handed off to a MultipartReader instead of ParseMultipartFrom.
@@ -65,6 +65,12 @@ type Response struct {
 
 	// Trailer maps trailer keys to values, in the same
 	// format as the header.
+	//
+	// Trailer initially contains only the trailer keys declared by
+	// the server in the "Trailer" header, with nil values. The
+	// values are filled in once Body has been read to EOF, and
+	// Trailer must not be accessed concurrently with reads from
+	// Body.
 	Trailer Header
 
 	// The Request that was sent to obtain this Response.
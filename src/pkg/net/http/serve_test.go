@@ -1288,6 +1288,135 @@ For:
 	ts.Close()
 }
 
+func TestServerTrailers(t *testing.T) {
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Trailer", "Checksum, Rows")
+		w.Header().Add("Trailer", "Not-Set")
+		w.Header().Set("Content-Length", "5") // superseded by chunking
+		io.WriteString(w, "hello")
+		w.Header().Set("Checksum", "abc123")
+		w.Header().Set("Rows", "1")
+	}))
+	defer ts.Close()
+
+	res, err := Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Header{"Checksum": nil, "Rows": nil, "Not-Set": nil}
+	if !reflect.DeepEqual(res.Trailer, want) {
+		t.Errorf("Trailer before body = %v; want %v", res.Trailer, want)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil || string(body) != "hello" {
+		t.Fatalf("body = %q, %v", body, err)
+	}
+	want = Header{"Checksum": {"abc123"}, "Rows": {"1"}, "Not-Set": nil}
+	if !reflect.DeepEqual(res.Trailer, want) {
+		t.Errorf("Trailer = %v; want %v", res.Trailer, want)
+	}
+	if res.Header.Get("Checksum") != "" || res.Header.Get("Trailer") != "" {
+		t.Errorf("trailers leaked into header: %v", res.Header)
+	}
+}
+
+func TestServerTrailersDropped(t *testing.T) {
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Trailer", "Checksum")
+		io.WriteString(w, "hello")
+		w.Header().Set("Checksum", "abc123")
+	}))
+	defer ts.Close()
+
+	// HEAD responses and HTTP/1.0 responses cannot carry trailers.
+	res, err := Head(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.Trailer != nil || res.Header.Get("Trailer") != "" {
+		t.Errorf("HEAD: Trailer = %v, Trailer header = %q", res.Trailer, res.Header.Get("Trailer"))
+	}
+
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET / HTTP/1.0\r\nHost: foo\r\n\r\n")
+	all, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(all)
+	if strings.Contains(got, "Trailer") || strings.Contains(got, "Checksum") || !strings.HasSuffix(got, "\r\n\r\nhello") {
+		t.Errorf("HTTP/1.0 response = %q", got)
+	}
+}
+
+// trailerBody is a request body that sets a trailer value when it
+// reaches EOF.
+type trailerBody struct {
+	r       io.Reader
+	trailer Header
+}
+
+func (b *trailerBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err == io.EOF {
+		b.trailer.Set("Checksum", "xyz")
+	}
+	return n, err
+}
+
+func TestRequestTrailers(t *testing.T) {
+	type result struct {
+		body             string
+		before, after    Header
+		transferEncoding []string
+	}
+	got := make(chan result, 1)
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		var res result
+		res.before = Header{}
+		for k, v := range r.Trailer {
+			res.before[k] = v
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		res.body = string(b)
+		res.after = r.Trailer
+		res.transferEncoding = r.TransferEncoding
+		got <- res
+	}))
+	defer ts.Close()
+
+	trailer := Header{"Checksum": nil}
+	req, _ := NewRequest("POST", ts.URL, nil)
+	req.Body = ioutil.NopCloser(&trailerBody{strings.NewReader("payload"), trailer})
+	req.ContentLength = 7
+	req.Trailer = trailer
+	res, err := DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	r := <-got
+	if r.body != "payload" {
+		t.Errorf("body = %q", r.body)
+	}
+	if !reflect.DeepEqual(r.transferEncoding, []string{"chunked"}) {
+		t.Errorf("TransferEncoding = %v; want chunked", r.transferEncoding)
+	}
+	if want := (Header{"Checksum": nil}); !reflect.DeepEqual(r.before, want) {
+		t.Errorf("Trailer before body = %v; want %v", r.before, want)
+	}
+	if want := (Header{"Checksum": {"xyz"}}); !reflect.DeepEqual(r.after, want) {
+		t.Errorf("Trailer = %v; want %v", r.after, want)
+	}
+}
+
 // goTimeout runs f, failing t if f takes more than ns to complete.
 func goTimeout(t *testing.T, d time.Duration, f func()) {
 	ch := make(chan bool, 2)
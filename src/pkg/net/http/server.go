@@ -11,6 +11,7 @@ package http
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/tls"
 	"errors"
 	"fmt"
@@ -21,10 +22,12 @@ import (
 	"net/url"
 	"path"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
 )
 
 // Errors introduced by the HTTP server.
@@ -52,7 +55,15 @@ type Handler interface {
 type ResponseWriter interface {
 	// Header returns the header map that will be sent by WriteHeader.
 	// Changing the header after a call to WriteHeader (or Write) has
-	// no effect.
+	// no effect, except for trailers.
+	//
+	// To send trailers, declare their names in the "Trailer" header
+	// before calling WriteHeader or Write, and set their values in
+	// the header map after writing the body. Declared trailers are
+	// sent after a chunked body, once the handler returns, and are
+	// omitted from the header itself. Trailers cannot be sent to
+	// HTTP/1.0 clients or in responses without a body, and are
+	// dropped in those cases.
 	Header() Header
 
 	// Write writes the data to the connection as part of an HTTP reply.
@@ -206,6 +217,10 @@ type response struct {
 	status        int      // status code passed to WriteHeader
 	needSniff     bool     // need to sniff to find Content-Type
 
+	// trailers holds the canonical names of the trailers declared
+	// in the "Trailer" header at WriteHeader time, or is nil.
+	trailers map[string]bool
+
 	// close connection after this reply.  set on request and
 	// updated after response from handler if there's a
 	// "Connection: keep-alive" response header and a
@@ -393,6 +408,19 @@ func (w *response) WriteHeader(code int) {
 		}
 	}
 
+	// Declared trailers need a chunked body, which supersedes any
+	// Content-Length.
+	if w.trailers = declaredTrailers(w.header); w.trailers != nil {
+		if w.req.ProtoAtLeast(1, 1) && w.req.Method != "HEAD" &&
+			bodyAllowedForStatus(code) && code != StatusNoContent {
+			w.header.Del("Content-Length")
+			hasCL = false
+		} else {
+			w.header.Del("Trailer")
+			w.trailers = nil
+		}
+	}
+
 	if w.req.wantsHttp10KeepAlive() && (w.req.Method == "HEAD" || hasCL) {
 		_, connectionHeaderSet := w.header["Connection"]
 		if !connectionHeaderSet {
@@ -501,7 +529,7 @@ func (w *response) WriteHeader(code int) {
 		text = "status code " + codestring
 	}
 	io.WriteString(w.conn.buf, proto+" "+codestring+" "+text+"\r\n")
-	w.header.Write(w.conn.buf)
+	w.header.WriteSubset(w.conn.buf, w.trailers)
 
 	// If we need to sniff the body, leave the header open.
 	// Otherwise, end it here.
@@ -614,7 +642,7 @@ func (w *response) finishRequest() {
 	// HTTP/1.0 clients keep their "keep-alive" connections alive, and for
 	// HTTP/1.1 clients is just as good as the alternative: sending a
 	// chunked response and immediately sending the zero-length EOF chunk.
-	if w.written == 0 && w.header.get("Content-Length") == "" && w.req.Method != "HEAD" {
+	if w.written == 0 && w.header.get("Content-Length") == "" && w.header.get("Trailer") == "" && w.req.Method != "HEAD" {
 		w.header.Set("Content-Length", "0")
 	}
 	// If this was an HTTP/1.0 request with keep-alive and we sent a
@@ -634,6 +662,7 @@ func (w *response) finishRequest() {
 	if w.chunking {
 		io.WriteString(w.conn.buf, "0\r\n")
 		// trailer key/value pairs, followed by blank line
+		w.writeTrailers()
 		io.WriteString(w.conn.buf, "\r\n")
 	}
 	w.conn.buf.Flush()
@@ -652,6 +681,41 @@ func (w *response) finishRequest() {
 	}
 }
 
+// declaredTrailers returns the set of trailer names declared in the
+// "Trailer" header h, or nil if there are none. Names that may not
+// be sent as trailers are ignored.
+func declaredTrailers(h Header) map[string]bool {
+	var m map[string]bool
+	for _, v := range h["Trailer"] {
+		for _, k := range strings.Split(v, ",") {
+			k = CanonicalHeaderKey(strings.TrimSpace(k))
+			switch k {
+			case "", "Transfer-Encoding", "Trailer", "Content-Length":
+				continue
+			}
+			if m == nil {
+				m = make(map[string]bool)
+			}
+			m[k] = true
+		}
+	}
+	return m
+}
+
+// writeTrailers writes the current values of the declared trailers.
+func (w *response) writeTrailers() {
+	if w.trailers == nil {
+		return
+	}
+	t := make(Header)
+	for k := range w.trailers {
+		if vv, ok := w.header[k]; ok {
+			t[k] = vv
+		}
+	}
+	t.Write(w.conn.buf)
+}
+
 func (w *response) Flush() {
 	if !w.wroteHeader {
 		w.WriteHeader(StatusOK)
@@ -972,38 +1036,294 @@ func RedirectHandler(url string, code int) Handler {
 // "/codesearch" and "codesearch.google.com/" without also taking over
 // requests for "http://www.google.com/".
 //
+// Patterns may also begin with an HTTP method followed by a space, as in
+// "GET /users/" or "POST example.com/upload", in which case they match
+// only requests with that method.  A space in a pattern that does not
+// separate such a method, as in "/foo bar", is part of the path.  A "GET" pattern also matches HEAD
+// requests.
+//
+// A path segment of a pattern consisting entirely of a name in braces,
+// like "{id}", is a wildcard matching any single non-empty segment of
+// the request path.  The final segment may instead be "{name...}",
+// matching the whole remainder of the path, including further slashes.
+// Handlers retrieve the matched values with Request.PathValue, so that
+// "GET /users/{id}/posts/{rest...}" routes "/users/7/posts/2012/12"
+// with PathValue("id") == "7" and PathValue("rest") == "2012/12".
+//
+// When several patterns match a request, the one that takes precedence
+// is chosen by these rules, in order:
+//
+//	1. A pattern with a host beats one without.
+//	2. Comparing the patterns' path segments from left to right, at the
+//	   first segment where they differ, a literal segment beats a "{name}"
+//	   wildcard, which beats the remainder matched by a trailing slash or
+//	   a "{name...}" wildcard.  A pattern whose path ends there beats one
+//	   that goes on to match the remainder.
+//	3. A pattern with the request's method beats a "GET" pattern
+//	   serving a HEAD request, which beats a pattern without a method.
+//
+// Two patterns that no rule can order, such as "/a/{x}" and "/a/{y}",
+// conflict, and registering the second one panics.  If no pattern matches
+// a request but some pattern would have matched with a different method,
+// ServeMux replies with 405 Method Not Allowed and an Allow header
+// listing the methods that would have matched.
+//
 // ServeMux also takes care of sanitizing the URL request path,
 // redirecting any request containing . or .. elements to an
 // equivalent .- and ..-free URL.
 type ServeMux struct {
-	mu    sync.RWMutex
-	m     map[string]muxEntry
-	hosts bool // whether any patterns contain hostnames
+	mu sync.RWMutex
+	m  map[string]muxEntry // keyed by muxEntry.key
 }
 
 type muxEntry struct {
 	explicit bool
 	h        Handler
 	pattern  string
+
+	method  string           // "" matches any method
+	host    string           // "" matches any host
+	path    string           // path portion of pattern
+	segs    []patternSegment // path segments, excluding any trailing remainder
+	subtree bool             // path ends in "/" or "{name...}"
+	rest    string           // name of the final "{name...}" wildcard, if any
+}
+
+// A patternSegment is one slash-separated element of a pattern path.
+type patternSegment struct {
+	s    string // literal text, or wildcard name
+	wild bool
 }
 
+// Precedence ranks of the element of a pattern at some segment
+// position, from least to most specific.
+const (
+	rankRemainder = iota // trailing slash or {name...}
+	rankWildcard
+	rankLiteral
+	rankEnd // the pattern's path ends before this segment
+)
+
 // NewServeMux allocates and returns a new ServeMux.
 func NewServeMux() *ServeMux { return &ServeMux{m: make(map[string]muxEntry)} }
 
 // DefaultServeMux is the default ServeMux used by Serve.
 var DefaultServeMux = NewServeMux()
 
-// Does path match pattern?
-func pathMatch(pattern, path string) bool {
-	if len(pattern) == 0 {
-		// should not happen
+// parsePattern parses pattern into a muxEntry without a handler.
+// It panics if pattern is malformed.
+func parsePattern(pattern string) muxEntry {
+	e := muxEntry{pattern: pattern}
+	rest := pattern
+	if method, r, ok := splitPatternMethod(pattern); ok {
+		e.method, rest = method, r
+	}
+	i := strings.Index(rest, "/")
+	if i < 0 {
+		panic("http: invalid pattern " + pattern)
+	}
+	e.host, e.path, rest = rest[:i], rest[i:], rest[i+1:]
+
+	seen := make(map[string]bool)
+	for rest != "" {
+		var seg string
+		if i := strings.Index(rest, "/"); i >= 0 {
+			seg, rest = rest[:i], rest[i+1:]
+			if rest == "" {
+				e.subtree = true
+			}
+		} else {
+			seg, rest = rest, ""
+		}
+		if len(seg) < 2 || seg[0] != '{' || seg[len(seg)-1] != '}' {
+			e.segs = append(e.segs, patternSegment{s: seg})
+			continue
+		}
+		name := seg[1 : len(seg)-1]
+		multi := strings.HasSuffix(name, "...")
+		if multi {
+			name = name[:len(name)-len("...")]
+		}
+		if !isWildcardName(name) {
+			panic("http: bad wildcard name " + strconv.Quote(name) + " in pattern " + pattern)
+		}
+		if seen[name] {
+			panic("http: duplicate wildcard name " + strconv.Quote(name) + " in pattern " + pattern)
+		}
+		seen[name] = true
+		if multi {
+			if rest != "" || e.subtree {
+				panic("http: {" + name + "...} wildcard not at end of pattern " + pattern)
+			}
+			e.subtree = true
+			e.rest = name
+			break
+		}
+		e.segs = append(e.segs, patternSegment{s: name, wild: true})
+	}
+	if len(e.segs) == 0 && e.rest == "" {
+		// The root pattern "/" is a subtree matching everything.
+		e.subtree = true
+	}
+	return e
+}
+
+// splitPatternMethod splits pattern into a leading method and the rest
+// of the pattern. Text before the first space is a method only if it is
+// a token and is followed by a path or a host and a path; otherwise, as
+// in "/foo bar", the space belongs to a literal path.
+func splitPatternMethod(pattern string) (method, rest string, ok bool) {
+	i := strings.Index(pattern, " ")
+	if i <= 0 || strings.IndexFunc(pattern[:i], isNotToken) >= 0 {
+		return "", pattern, false
+	}
+	rest = strings.TrimLeft(pattern[i+1:], " ")
+	j := strings.Index(rest, "/")
+	if j < 0 || strings.Index(rest[:j], " ") >= 0 {
+		return "", pattern, false
+	}
+	return pattern[:i], rest, true
+}
+
+func isWildcardName(s string) bool {
+	if s == "" {
 		return false
 	}
-	n := len(pattern)
-	if pattern[n-1] != '/' {
-		return pattern == path
+	for i, r := range s {
+		if r != '_' && !unicode.IsLetter(r) && (i == 0 || !unicode.IsDigit(r)) {
+			return false
+		}
+	}
+	return true
+}
+
+// key returns a string identifying the requests e can match, so that
+// patterns differing only in wildcard names have the same key.
+func (e *muxEntry) key() string {
+	var b bytes.Buffer
+	b.WriteString(e.method)
+	b.WriteByte(' ')
+	b.WriteString(e.host)
+	for _, s := range e.segs {
+		b.WriteByte('/')
+		if s.wild {
+			b.WriteString("{}")
+		} else {
+			b.WriteString(s.s)
+		}
+	}
+	if e.subtree {
+		b.WriteByte('/')
+	}
+	return b.String()
+}
+
+// hasWildcards reports whether e's path contains wildcards.
+func (e *muxEntry) hasWildcards() bool {
+	if e.rest != "" {
+		return true
+	}
+	for _, s := range e.segs {
+		if s.wild {
+			return true
+		}
+	}
+	return false
+}
+
+// matchMethod reports whether e applies to requests with the given method.
+func (e *muxEntry) matchMethod(method string) bool {
+	return e.method == "" || e.method == method || e.method == "GET" && method == "HEAD"
+}
+
+// matchPath reports whether the path of e matches path. If it does and
+// e has wildcards, their values are returned.
+func (e *muxEntry) matchPath(path string) (ok bool, values map[string]string) {
+	if path == "" || path[0] != '/' {
+		return false, nil
+	}
+	path = path[1:]
+	for i, seg := range e.segs {
+		elem := path
+		j := strings.Index(path, "/")
+		if j >= 0 {
+			elem, path = path[:j], path[j+1:]
+		} else if i < len(e.segs)-1 || e.subtree {
+			// The path has too few segments.
+			return false, nil
+		}
+		switch {
+		case !seg.wild:
+			if elem != seg.s {
+				return false, nil
+			}
+		case elem == "":
+			return false, nil
+		default:
+			if values == nil {
+				values = make(map[string]string)
+			}
+			values[seg.s] = elem
+		}
+		if j < 0 {
+			// Matched the final segment of an exact pattern.
+			return true, values
+		}
+	}
+	if !e.subtree {
+		return false, nil
 	}
-	return len(path) >= n && path[0:n] == pattern
+	if e.rest != "" {
+		if values == nil {
+			values = make(map[string]string)
+		}
+		values[e.rest] = path
+	}
+	return true, values
+}
+
+// rank returns the precedence rank of e at segment position i.
+func (e *muxEntry) rank(i int) int {
+	switch {
+	case i < len(e.segs) && e.segs[i].wild:
+		return rankWildcard
+	case i < len(e.segs):
+		return rankLiteral
+	case e.subtree:
+		return rankRemainder
+	}
+	return rankEnd
+}
+
+// moreSpecific reports whether e takes precedence over f, when both
+// match a request with the given method.
+func (e *muxEntry) moreSpecific(f *muxEntry, method string) bool {
+	if (e.host != "") != (f.host != "") {
+		return e.host != ""
+	}
+	n := len(e.segs)
+	if len(f.segs) > n {
+		n = len(f.segs)
+	}
+	for i := 0; i <= n; i++ {
+		if re, rf := e.rank(i), f.rank(i); re != rf {
+			return re > rf
+		}
+	}
+	return e.methodRank(method) > f.methodRank(method)
+}
+
+// methodRank ranks how closely the method of e matches method, which
+// e must match: an exact match ranks above a GET pattern serving a
+// HEAD request, which ranks above a pattern without a method.
+func (e *muxEntry) methodRank(method string) int {
+	switch e.method {
+	case "":
+		return 0
+	case method:
+		return 2
+	}
+	return 1
 }
 
 // Return the canonical path for p, eliminating . and .. elements.
@@ -1023,23 +1343,6 @@ func cleanPath(p string) string {
 	return np
 }
 
-// Find a handler on a handler map given a path string
-// Most-specific (longest) pattern wins
-func (mux *ServeMux) match(path string) (h Handler, pattern string) {
-	var n = 0
-	for k, v := range mux.m {
-		if !pathMatch(k, path) {
-			continue
-		}
-		if h == nil || len(k) > n {
-			n = len(k)
-			h = v.h
-			pattern = v.pattern
-		}
-	}
-	return
-}
-
 // Handler returns the handler to use for the given request,
 // consulting r.Method, r.Host, and r.URL.Path. It always returns
 // a non-nil handler. If the path is not in its canonical form, the
@@ -1051,46 +1354,96 @@ func (mux *ServeMux) match(path string) (h Handler, pattern string) {
 // the pattern that will match after following the redirect.
 //
 // If there is no registered handler that applies to the request,
-// Handler returns a ``page not found'' handler and an empty pattern.
+// Handler returns a ``page not found'' handler and an empty pattern,
+// or a ``method not allowed'' handler if a pattern for another method
+// matches the request path.
 func (mux *ServeMux) Handler(r *Request) (h Handler, pattern string) {
+	h, pattern, _ = mux.findHandler(r)
+	return
+}
+
+// findHandler is like Handler but also returns the values of the
+// matched pattern's wildcards.
+func (mux *ServeMux) findHandler(r *Request) (h Handler, pattern string, values map[string]string) {
 	if r.Method != "CONNECT" {
 		if p := cleanPath(r.URL.Path); p != r.URL.Path {
-			_, pattern = mux.handler(r.Host, p)
-			return RedirectHandler(p, StatusMovedPermanently), pattern
+			_, pattern, _ = mux.handler(r.Method, r.Host, p)
+			return RedirectHandler(p, StatusMovedPermanently), pattern, nil
 		}
 	}
 
-	return mux.handler(r.Host, r.URL.Path)
+	return mux.handler(r.Method, r.Host, r.URL.Path)
 }
 
 // handler is the main implementation of Handler.
 // The path is known to be in canonical form, except for CONNECT methods.
-func (mux *ServeMux) handler(host, path string) (h Handler, pattern string) {
+func (mux *ServeMux) handler(method, host, path string) (h Handler, pattern string, values map[string]string) {
 	mux.mu.RLock()
 	defer mux.mu.RUnlock()
 
-	// Host-specific pattern takes precedence over generic ones
-	if mux.hosts {
-		h, pattern = mux.match(host + path)
+	var best *muxEntry
+	var allow []string // methods of entries that matched all but the method
+	for k := range mux.m {
+		e := mux.m[k]
+		if e.host != "" && e.host != host {
+			continue
+		}
+		ok, v := e.matchPath(path)
+		if !ok {
+			continue
+		}
+		if !e.matchMethod(method) {
+			allow = append(allow, e.method)
+			continue
+		}
+		if best == nil || e.moreSpecific(best, method) {
+			best = &e
+			values = v
+		}
 	}
-	if h == nil {
-		h, pattern = mux.match(path)
+	switch {
+	case best != nil:
+		return best.h, best.pattern, values
+	case allow != nil:
+		return methodNotAllowedHandler(allow), "", nil
 	}
-	if h == nil {
-		h, pattern = NotFoundHandler(), ""
+	return NotFoundHandler(), "", nil
+}
+
+// methodNotAllowedHandler returns a handler that replies with a 405
+// error listing the allowed methods.
+func methodNotAllowedHandler(methods []string) Handler {
+	seen := make(map[string]bool)
+	var allow []string
+	for _, m := range methods {
+		if !seen[m] {
+			seen[m] = true
+			allow = append(allow, m)
+		}
 	}
-	return
+	if seen["GET"] && !seen["HEAD"] {
+		allow = append(allow, "HEAD")
+	}
+	sort.Strings(allow)
+	return HandlerFunc(func(w ResponseWriter, r *Request) {
+		w.Header().Set("Allow", strings.Join(allow, ", "))
+		Error(w, "405 method not allowed", StatusMethodNotAllowed)
+	})
 }
 
 // ServeHTTP dispatches the request to the handler whose
 // pattern most closely matches the request URL.
 func (mux *ServeMux) ServeHTTP(w ResponseWriter, r *Request) {
-	h, _ := mux.Handler(r)
+	h, _, values := mux.findHandler(r)
+	if values != nil {
+		r.pathValues = values
+	}
 	h.ServeHTTP(w, r)
 }
 
 // Handle registers the handler for the given pattern.
-// If a handler already exists for pattern, Handle panics.
+// If a handler already exists for pattern, or for a pattern
+// that matches exactly the same requests, Handle panics.
 func (mux *ServeMux) Handle(pattern string, handler Handler) {
 	mux.mu.Lock()
 	defer mux.mu.Unlock()
@@ -1101,33 +1454,46 @@ func (mux *ServeMux) Handle(pattern string, handler Handler) {
 	if handler == nil {
 		panic("http: nil handler")
 	}
-	if mux.m[pattern].explicit {
-		panic("http: multiple registrations for " + pattern)
+	e := parsePattern(pattern)
+	key := e.key()
+	if old := mux.m[key]; old.explicit {
+		if old.pattern == pattern {
+			panic("http: multiple registrations for " + pattern)
+		}
+		panic("http: pattern " + pattern + " conflicts with " + old.pattern)
 	}
 
-	mux.m[pattern] = muxEntry{explicit: true, h: handler, pattern: pattern}
-
-	if pattern[0] != '/' {
-		mux.hosts = true
-	}
+	e.explicit = true
+	e.h = handler
+	mux.m[key] = e
 
 	// Helpful behavior:
 	// If pattern is /tree/, insert an implicit permanent redirect for /tree.
 	// It can be overridden by an explicit registration.
 	n := len(pattern)
-	if n > 0 && pattern[n-1] == '/' && !mux.m[pattern[0:n-1]].explicit {
-		// If pattern contains a host name, strip it and use remaining
-		// path for redirect.
-		path := pattern
-		if pattern[0] != '/' {
-			// In pattern, at least the last character is a '/', so
-			// strings.Index can't be -1.
-			path = pattern[strings.Index(pattern, "/"):]
+	if n > 0 && pattern[n-1] == '/' && len(e.segs) > 0 {
+		re := parsePattern(pattern[0 : n-1])
+		rkey := re.key()
+		if mux.m[rkey].explicit {
+			return
 		}
-		mux.m[pattern[0:n-1]] = muxEntry{h: RedirectHandler(path, StatusMovedPermanently), pattern: pattern}
+		if e.hasWildcards() {
+			re.h = HandlerFunc(redirectToSubtree)
+		} else {
+			// If pattern contains a method or host name, strip
+			// them and use remaining path for redirect.
+			re.h = RedirectHandler(e.path, StatusMovedPermanently)
+		}
+		re.pattern = pattern
+		mux.m[rkey] = re
 	}
 }
 
+// redirectToSubtree redirects a request for /tree to /tree/.
+func redirectToSubtree(w ResponseWriter, r *Request) {
+	Redirect(w, r, r.URL.Path+"/", StatusMovedPermanently)
+}
+
 // HandleFunc registers the handler function for the given pattern.
 func (mux *ServeMux) HandleFunc(pattern string, handler func(ResponseWriter, *Request)) {
 	mux.Handle(pattern, HandlerFunc(handler))
@@ -6,6 +6,7 @@ package http
 
 import (
 	"net/url"
+	"reflect"
 	"testing"
 )
 
@@ -93,3 +94,155 @@ type codeSaver struct {
 func (cs *codeSaver) Header() Header              { return cs.h }
 func (cs *codeSaver) Write(p []byte) (int, error) { return len(p), nil }
 func (cs *codeSaver) WriteHeader(code int)        { cs.code = code }
+
+var serveMuxRoutes = []string{
+	"/",
+	"GET /users/{id}",
+	"DELETE /users/{id}",
+	"/users/new",
+	"POST /users/",
+	"/files/{path...}",
+	"/files/{owner}/private/",
+	"GET api.example.com/v1/{name}",
+	"/a/{x}/c",
+	"/a/b/{y}",
+}
+
+var serveMuxRouteTests = []struct {
+	method  string
+	host    string
+	path    string
+	code    int
+	pattern string
+	values  map[string]string
+}{
+	{"GET", "example.com", "/users/7", 200, "GET /users/{id}", map[string]string{"id": "7"}},
+	{"HEAD", "example.com", "/users/7", 200, "GET /users/{id}", map[string]string{"id": "7"}},
+	{"DELETE", "example.com", "/users/7", 200, "DELETE /users/{id}", map[string]string{"id": "7"}},
+	{"POST", "example.com", "/users/7", 200, "POST /users/", nil},
+	{"PUT", "example.com", "/users/7", 200, "/", nil},
+	{"GET", "example.com", "/users/new", 200, "/users/new", nil},
+	{"POST", "example.com", "/users", 301, "POST /users/", nil},
+	{"GET", "example.com", "/users", 200, "/", nil},
+	{"GET", "example.com", "/files/", 200, "/files/{path...}", map[string]string{"path": ""}},
+	{"GET", "example.com", "/files/a/b/c", 200, "/files/{path...}", map[string]string{"path": "a/b/c"}},
+	{"GET", "example.com", "/files/bob/private", 301, "/files/{owner}/private/", map[string]string{"owner": "bob"}},
+	{"GET", "example.com", "/files/bob/private/key", 200, "/files/{owner}/private/", map[string]string{"owner": "bob"}},
+	{"GET", "api.example.com", "/v1/widgets", 200, "GET api.example.com/v1/{name}", map[string]string{"name": "widgets"}},
+	{"GET", "api.example.com", "/v1/", 200, "/", nil},
+	{"GET", "example.com", "/a/b/c", 200, "/a/b/{y}", map[string]string{"y": "c"}},
+	{"GET", "example.com", "/a/z/c", 200, "/a/{x}/c", map[string]string{"x": "z"}},
+}
+
+func TestServeMuxRouting(t *testing.T) {
+	mux := NewServeMux()
+	for _, p := range serveMuxRoutes {
+		mux.Handle(p, serve(200))
+	}
+	for _, tt := range serveMuxRouteTests {
+		r := &Request{
+			Method: tt.method,
+			Host:   tt.host,
+			URL:    &url.URL{Path: tt.path},
+		}
+		h, pattern, values := mux.findHandler(r)
+		cs := &codeSaver{h: Header{}}
+		h.ServeHTTP(cs, r)
+		if pattern != tt.pattern || cs.code != tt.code {
+			t.Errorf("%s %s %s = %d, %q, want %d, %q", tt.method, tt.host, tt.path, cs.code, pattern, tt.code, tt.pattern)
+		}
+		if !reflect.DeepEqual(values, tt.values) {
+			t.Errorf("%s %s %s: values = %v, want %v", tt.method, tt.host, tt.path, values, tt.values)
+		}
+	}
+}
+
+func TestServeMuxHeadOverGet(t *testing.T) {
+	// With both registered, HEAD must always pick its own pattern
+	// rather than the GET pattern that also serves HEAD.
+	mux := NewServeMux()
+	mux.Handle("GET /a", serve(200))
+	mux.Handle("HEAD /a", serve(204))
+	for i := 0; i < 50; i++ {
+		r := &Request{Method: "HEAD", URL: &url.URL{Path: "/a"}}
+		if _, pattern, _ := mux.findHandler(r); pattern != "HEAD /a" {
+			t.Fatalf("HEAD /a matched %q, want %q", pattern, "HEAD /a")
+		}
+		r.Method = "GET"
+		if _, pattern, _ := mux.findHandler(r); pattern != "GET /a" {
+			t.Fatalf("GET /a matched %q, want %q", pattern, "GET /a")
+		}
+	}
+}
+
+func TestServeMuxMethodNotAllowed(t *testing.T) {
+	mux := NewServeMux()
+	mux.Handle("GET /items/{id}", serve(200))
+	mux.Handle("PUT /items/{id}", serve(200))
+	r := &Request{Method: "POST", URL: &url.URL{Path: "/items/1"}}
+	cs := &codeSaver{h: Header{}}
+	mux.ServeHTTP(cs, r)
+	if cs.code != StatusMethodNotAllowed {
+		t.Errorf("code = %d, want 405", cs.code)
+	}
+	if got, want := cs.h.Get("Allow"), "GET, HEAD, PUT"; got != want {
+		t.Errorf("Allow = %q, want %q", got, want)
+	}
+}
+
+func TestServeMuxPathValue(t *testing.T) {
+	mux := NewServeMux()
+	var got string
+	mux.HandleFunc("/users/{id}/posts/{rest...}", func(w ResponseWriter, r *Request) {
+		got = r.PathValue("id") + " " + r.PathValue("rest")
+	})
+	r := &Request{Method: "GET", URL: &url.URL{Path: "/users/7/posts/2012/12"}}
+	mux.ServeHTTP(&codeSaver{h: Header{}}, r)
+	if want := "7 2012/12"; got != want {
+		t.Errorf("path values = %q, want %q", got, want)
+	}
+}
+
+func TestServeMuxBadPatterns(t *testing.T) {
+	bad := [][]string{
+		{"/a/{x}", "/a/{y}"},
+		{"GET /a", "GET /a"},
+		{"/a/{x...}/b"},
+		{"/a/{x}/{x}"},
+		{"/a/{1x}"},
+		{"nopath"},
+	}
+	for _, patterns := range bad {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registering %q did not panic", patterns)
+				}
+			}()
+			mux := NewServeMux()
+			for _, p := range patterns {
+				mux.Handle(p, serve(200))
+			}
+		}()
+	}
+
+	// Spaces that don't follow a method are part of a literal path,
+	// as they were before patterns could have methods.
+	good := []string{"/foo bar", "/a b/", "G@T /a"}
+	for _, p := range good {
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					t.Errorf("registering %q panicked: %v", p, err)
+				}
+			}()
+			NewServeMux().Handle(p, serve(200))
+		}()
+	}
+	mux := NewServeMux()
+	mux.Handle("/foo bar", serve(201))
+	req := &Request{Method: "GET", Host: "example.com", URL: &url.URL{Path: "/foo bar"}}
+	if h, pattern := mux.Handler(req); pattern != "/foo bar" {
+		t.Errorf("/foo bar matched %q (%T); want the literal pattern", pattern, h)
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/textproto"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -66,7 +67,9 @@ func newTransferWriter(r interface{}) (t *transferWriter, err error) {
 					t.BodyCloser = nil
 				}
 			}
-			if t.ContentLength < 0 {
+			if t.ContentLength < 0 || t.Body != nil && len(t.Trailer) > 0 {
+				// Trailers can only follow a chunked body.
+				t.ContentLength = -1
 				t.TransferEncoding = []string{"chunked"}
 			}
 		}
@@ -164,21 +167,19 @@ func (t *transferWriter) WriteHeader(w io.Writer) (err error) {
 	if t.Trailer != nil {
 		// TODO: At some point, there should be a generic mechanism for
 		// writing long headers, using HTTP line splitting
-		io.WriteString(w, "Trailer: ")
-		needComma := false
+		keys := make([]string, 0, len(t.Trailer))
 		for k := range t.Trailer {
 			k = CanonicalHeaderKey(k)
 			switch k {
 			case "Transfer-Encoding", "Trailer", "Content-Length":
 				return &badStringError{"invalid Trailer key", k}
 			}
-			if needComma {
-				io.WriteString(w, ",")
-			}
-			io.WriteString(w, k)
-			needComma = true
+			keys = append(keys, k)
+		}
+		if len(keys) > 0 {
+			sort.Strings(keys)
+			_, err = io.WriteString(w, "Trailer: "+strings.Join(keys, ",")+"\r\n")
 		}
-		_, err = io.WriteString(w, "\r\n")
 	}
 
 	return
@@ -218,9 +219,14 @@ func (t *transferWriter) WriteBody(w io.Writer) (err error) {
 			t.ContentLength, ncopy)
 	}
 
-	// TODO(petar): Place trailer writer code here.
 	if chunked(t.TransferEncoding) {
-		// Last chunk, empty trailer
+		// Trailer values, which the Body may have set while it was
+		// being read, followed by a blank line.
+		if t.Trailer != nil {
+			if err = t.Trailer.Write(w); err != nil {
+				return err
+			}
+		}
 		_, err = io.WriteString(w, "\r\n")
 	}
 
@@ -309,7 +315,7 @@ func readTransfer(msg interface{}, r *bufio.Reader) (err error) {
 	}
 
 	// Trailer
-	t.Trailer, err = fixTrailer(t.Header, t.TransferEncoding)
+	t.Trailer, err = fixTrailer(t.Header, t.TransferEncoding, realLength == 0)
 	if err != nil {
 		return err
 	}
@@ -493,25 +499,31 @@ func shouldClose(major, minor int, header Header) bool {
 	return false
 }
 
-// Parse the trailer header
-func fixTrailer(header Header, te []string) (Header, error) {
-	raw := header.get("Trailer")
-	if raw == "" {
+// Parse the trailer header. The returned Header has the declared
+// keys, with nil values until the trailer itself has been read.
+// noBody reports whether the message has no body, in which case the
+// trailer can never arrive and the declaration is ignored.
+func fixTrailer(header Header, te []string, noBody bool) (Header, error) {
+	raw, present := header["Trailer"]
+	if !present {
 		return nil, nil
 	}
 
 	header.Del("Trailer")
 	trailer := make(Header)
-	keys := strings.Split(raw, ",")
-	for _, key := range keys {
-		key = CanonicalHeaderKey(strings.TrimSpace(key))
-		switch key {
-		case "Transfer-Encoding", "Trailer", "Content-Length":
-			return nil, &badStringError{"bad trailer key", key}
+	for _, v := range raw {
+		for _, key := range strings.Split(v, ",") {
+			key = CanonicalHeaderKey(strings.TrimSpace(key))
+			switch key {
+			case "Transfer-Encoding", "Trailer", "Content-Length":
+				return nil, &badStringError{"bad trailer key", key}
+			case "":
+				continue
+			}
+			trailer[key] = nil
 		}
-		trailer.Del(key)
 	}
-	if len(trailer) == 0 {
+	if len(trailer) == 0 || noBody {
 		return nil, nil
 	}
 	if !chunked(te) {
@@ -614,13 +626,26 @@ func (b *body) readTrailer() error {
 	}
 	switch rr := b.hdr.(type) {
 	case *Request:
-		rr.Trailer = Header(hdr)
+		mergeSetHeader(&rr.Trailer, Header(hdr))
 	case *Response:
-		rr.Trailer = Header(hdr)
+		mergeSetHeader(&rr.Trailer, Header(hdr))
 	}
 	return nil
 }
 
+// mergeSetHeader sets the values of src in *dst, which is allocated
+// if nil. Updating the existing map in place lets callers holding the
+// declared Trailer map see the values.
+func mergeSetHeader(dst *Header, src Header) {
+	if *dst == nil {
+		*dst = src
+		return
+	}
+	for k, vv := range src {
+		(*dst)[k] = vv
+	}
+}
+
 func (b *body) Close() error {
 	if b.closed {
 		return nil
@@ -58,7 +58,16 @@ type Transport struct {
 	Proxy func(*Request) (*url.URL, error)
 
 	// Dial specifies the dial function for creating TCP
-	// connections.
+	// connections. To set options such as a timeout, keep-alives
+	// or dual-stack dialing, call the Dial method of a net.Dialer:
+	//
+	//	d := &net.Dialer{Timeout: 30 * time.Second}
+	//	t := &http.Transport{
+	//		Dial: func(network, addr string) (net.Conn, error) {
+	//			return d.Dial(network, addr)
+	//		},
+	//	}
+	//
 	// If Dial is nil, net.Dial is used.
 	Dial func(net, addr string) (c net.Conn, err error)
 
@@ -1044,6 +1044,42 @@ func (fooProto) RoundTrip(req *Request) (*Response, error) {
 	return res, nil
 }
 
+func TestTransportDialer(t *testing.T) {
+	ts := httptest.NewServer(HandlerFunc(func(w ResponseWriter, r *Request) {
+		io.WriteString(w, r.RemoteAddr)
+	}))
+	defer ts.Close()
+
+	laddr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	d := &net.Dialer{LocalAddr: laddr, KeepAlive: time.Minute}
+	tr := &Transport{Dial: func(n, addr string) (net.Conn, error) {
+		return d.Dial(n, addr)
+	}}
+	c := &Client{Transport: tr}
+	res, err := c.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if host, _, err := net.SplitHostPort(string(body)); err != nil || host != "127.0.0.1" {
+		t.Errorf("server saw remote address %q; want 127.0.0.1", body)
+	}
+
+	expired := &net.Dialer{Deadline: time.Now().Add(-time.Second)}
+	tr = &Transport{Dial: func(n, addr string) (net.Conn, error) {
+		return expired.Dial(n, addr)
+	}}
+	c = &Client{Transport: tr}
+	if res, err := c.Get(ts.URL); err == nil {
+		res.Body.Close()
+		t.Error("Get with an expired Dialer.Deadline succeeded")
+	}
+}
+
 func TestTransportAltProto(t *testing.T) {
 	tr := &Transport{}
 	c := &Client{Transport: tr}
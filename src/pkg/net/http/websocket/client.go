@@ -0,0 +1,276 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// A Dialer contains options for connecting to a WebSocket server.
+type Dialer struct {
+	// NetDial specifies the dial function for creating TCP
+	// connections. If NetDial is nil, net.Dial is used.
+	NetDial func(network, addr string) (net.Conn, error)
+
+	// Proxy specifies a function to return a proxy for a given
+	// Request, as in http.Transport. The request passed to Proxy
+	// has an "http" or "https" URL scheme, so that
+	// http.ProxyFromEnvironment can be used. If Proxy is nil or
+	// returns a nil *URL, no proxy is used.
+	Proxy func(*http.Request) (*url.URL, error)
+
+	// TLSClientConfig specifies the TLS configuration to use with
+	// tls.Client. If nil, the default configuration is used.
+	TLSClientConfig *tls.Config
+
+	// HandshakeTimeout specifies the duration for the handshake,
+	// including any proxy CONNECT and TLS negotiation, to
+	// complete. If zero, no timeout is used.
+	HandshakeTimeout time.Duration
+
+	// ReadBufferSize and WriteBufferSize specify the I/O buffer
+	// sizes in bytes, as in Upgrader.
+	ReadBufferSize, WriteBufferSize int
+
+	// Subprotocols specifies the client's requested subprotocols.
+	Subprotocols []string
+}
+
+// DefaultDialer is a dialer with all fields set to the default values
+// except Proxy, which uses the proxy given by the environment.
+var DefaultDialer = &Dialer{
+	Proxy: http.ProxyFromEnvironment,
+}
+
+// Dial creates a new client connection using DefaultDialer.
+func Dial(urlStr string, requestHeader http.Header) (*Conn, *http.Response, error) {
+	return DefaultDialer.Dial(urlStr, requestHeader)
+}
+
+func generateChallengeKey() (string, error) {
+	p := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, p); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(p), nil
+}
+
+// hostPortNoPort returns the host:port to dial for u, and the host
+// without the port for use in TLS server name verification.
+func hostPortNoPort(u *url.URL) (hostPort, hostNoPort string) {
+	hostPort = u.Host
+	hostNoPort = u.Host
+	if i := strings.LastIndex(u.Host, ":"); i > strings.LastIndex(u.Host, "]") {
+		hostNoPort = hostNoPort[:i]
+	} else if u.Scheme == "https" {
+		hostPort += ":443"
+	} else {
+		hostPort += ":80"
+	}
+	return hostPort, hostNoPort
+}
+
+// Dial creates a new client connection to the WebSocket server at
+// urlStr, whose scheme must be "ws" or "wss". Use requestHeader to
+// specify the origin (Origin), cookies (Cookie) and other headers of
+// the opening handshake; the handshake headers themselves may not be
+// set.
+//
+// If the server rejects the handshake, Dial returns ErrBadHandshake
+// along with the server's response, so that callers can inspect the
+// status and headers. The response body is not usable.
+func (d *Dialer) Dial(urlStr string, requestHeader http.Header) (*Conn, *http.Response, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	default:
+		return nil, nil, ErrBadScheme
+	}
+	if u.User != nil {
+		return nil, nil, errors.New("websocket: user name and password in URL are not supported")
+	}
+	if u.Host == "" {
+		return nil, nil, errors.New("websocket: missing host in URL")
+	}
+
+	challengeKey, err := generateChallengeKey()
+	if err != nil {
+		return nil, nil, err
+	}
+	req := &http.Request{
+		Method:     "GET",
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Host:       u.Host,
+	}
+	for k, vs := range requestHeader {
+		switch http.CanonicalHeaderKey(k) {
+		case "Host":
+			if len(vs) > 0 {
+				req.Host = vs[0]
+			}
+		case "Upgrade", "Connection", "Sec-Websocket-Key",
+			"Sec-Websocket-Version", "Sec-Websocket-Extensions",
+			"Sec-Websocket-Protocol":
+			return nil, nil, errors.New("websocket: duplicate header not allowed: " + k)
+		default:
+			req.Header[http.CanonicalHeaderKey(k)] = vs
+		}
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", challengeKey)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	if len(d.Subprotocols) > 0 {
+		req.Header.Set("Sec-WebSocket-Protocol", strings.Join(d.Subprotocols, ", "))
+	}
+
+	var deadline time.Time
+	if d.HandshakeTimeout != 0 {
+		deadline = time.Now().Add(d.HandshakeTimeout)
+	}
+
+	hostPort, hostNoPort := hostPortNoPort(u)
+	var proxyURL *url.URL
+	if d.Proxy != nil {
+		proxyURL, err = d.Proxy(req)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	dial := d.NetDial
+	if dial == nil {
+		dial = net.Dial
+	}
+	addr := hostPort
+	if proxyURL != nil {
+		addr, _ = hostPortNoPort(proxyURL)
+	}
+	netConn, err := dial("tcp", addr)
+	if err != nil {
+		if proxyURL != nil {
+			err = errors.New("websocket: error connecting to proxy " + proxyURL.String() + ": " + err.Error())
+		}
+		return nil, nil, err
+	}
+	ok := false
+	defer func() {
+		if !ok {
+			netConn.Close()
+		}
+	}()
+	if err := netConn.SetDeadline(deadline); err != nil {
+		return nil, nil, err
+	}
+
+	if proxyURL != nil {
+		if err := proxyConnect(netConn, proxyURL, hostPort); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if u.Scheme == "https" {
+		cfg := d.TLSClientConfig
+		if cfg == nil {
+			cfg = &tls.Config{ServerName: hostNoPort}
+		} else if cfg.ServerName == "" {
+			clone := *cfg // shallow clone
+			clone.ServerName = hostNoPort
+			cfg = &clone
+		}
+		tlsConn := tls.Client(netConn, cfg)
+		netConn = tlsConn
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, nil, err
+		}
+		if !cfg.InsecureSkipVerify {
+			if err := tlsConn.VerifyHostname(cfg.ServerName); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	conn := newConn(netConn, false, nil, d.ReadBufferSize, d.WriteBufferSize)
+	if err := req.Write(netConn); err != nil {
+		return nil, nil, err
+	}
+	resp, err := http.ReadResponse(conn.br, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols ||
+		!tokenListContainsValue(resp.Header, "Upgrade", "websocket") ||
+		!tokenListContainsValue(resp.Header, "Connection", "upgrade") ||
+		resp.Header.Get("Sec-WebSocket-Accept") != computeAcceptKey(challengeKey) {
+		return nil, resp, ErrBadHandshake
+	}
+	conn.subprotocol = resp.Header.Get("Sec-WebSocket-Protocol")
+	if conn.subprotocol != "" && !containsString(d.Subprotocols, conn.subprotocol) {
+		return nil, resp, ErrBadHandshake
+	}
+
+	netConn.SetDeadline(time.Time{})
+	ok = true
+	return conn, resp, nil
+}
+
+// proxyConnect asks the HTTP proxy on conn to open a tunnel to
+// hostPort.
+func proxyConnect(conn net.Conn, proxyURL *url.URL, hostPort string) error {
+	connectReq := &http.Request{
+		Method: "CONNECT",
+		URL:    &url.URL{Opaque: hostPort},
+		Host:   hostPort,
+		Header: make(http.Header),
+	}
+	if u := proxyURL.User; u != nil {
+		password, _ := u.Password()
+		credential := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + password))
+		connectReq.Header.Set("Proxy-Authorization", "Basic "+credential)
+	}
+	if err := connectReq.Write(conn); err != nil {
+		return err
+	}
+
+	// Okay to use and discard buffered reader here, because
+	// the WebSocket server will not speak until spoken to.
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, connectReq)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("websocket: proxy CONNECT failed: " + resp.Status)
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,613 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Frame header bits and opcodes, RFC 6455 section 5.2.
+const (
+	finalBit = 1 << 7
+	rsvBits  = 7 << 4
+	maskBit  = 1 << 7
+
+	continuationFrame = 0
+	noFrame           = -1
+
+	maxFrameHeaderSize         = 2 + 8 + 4 // fixed header + length + mask
+	maxControlFramePayloadSize = 125
+)
+
+const (
+	defaultReadBufferSize  = 4096
+	defaultWriteBufferSize = 4096
+
+	// controlWriteTimeout bounds the time spent writing the
+	// automatic replies to ping and close messages.
+	controlWriteTimeout = 5 * time.Second
+)
+
+var errWriteClosed = errors.New("websocket: write on closed message writer")
+
+// Conn represents a WebSocket connection.
+type Conn struct {
+	conn        net.Conn
+	isServer    bool
+	subprotocol string
+
+	// Write fields.
+	wmu           sync.Mutex // guards bw, closeSent and conn write deadlines
+	bw            *bufio.Writer
+	closeSent     bool
+	writeDeadline time.Time
+	writeBufSize  int
+	writer        *messageWriter // current NextWriter, or nil
+
+	// Read fields.
+	br            *bufio.Reader
+	readErr       error
+	readLimit     int64 // 0 means no limit
+	readLength    int64 // bytes read in current message
+	readRemaining int64 // bytes remaining in current frame
+	readFinal     bool  // current frame is the last of its message
+	readMasked    bool
+	readMaskKey   [4]byte
+	readMaskPos   int
+	readInMessage bool // a fragmented message is in progress
+	reader        *messageReader
+
+	hmu        sync.Mutex // guards handlePing and handlePong
+	handlePing func(appData string) error
+	handlePong func(appData string) error
+}
+
+// newConn returns a Conn on netConn. If br is nil, a new reader of
+// readBufSize bytes is allocated.
+func newConn(netConn net.Conn, isServer bool, br *bufio.Reader, readBufSize, writeBufSize int) *Conn {
+	if readBufSize <= 0 {
+		readBufSize = defaultReadBufferSize
+	}
+	if writeBufSize <= 0 {
+		writeBufSize = defaultWriteBufferSize
+	}
+	if br == nil {
+		br = bufio.NewReaderSize(netConn, readBufSize)
+	}
+	c := &Conn{
+		conn:         netConn,
+		isServer:     isServer,
+		br:           br,
+		bw:           bufio.NewWriterSize(netConn, writeBufSize+maxFrameHeaderSize),
+		writeBufSize: writeBufSize,
+		readFinal:    true,
+	}
+	return c
+}
+
+// Subprotocol returns the negotiated subprotocol for the connection,
+// or the empty string if none was negotiated.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// Close closes the underlying network connection without sending or
+// waiting for a close message.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// LocalAddr returns the local network address.
+func (c *Conn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetReadDeadline sets the deadline for future reads on the
+// underlying network connection. A zero value for t means reads will
+// not time out.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for future writes of data
+// messages on the underlying network connection. A zero value for t
+// means writes will not time out.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.writeDeadline = t
+	return c.conn.SetWriteDeadline(t)
+}
+
+// SetReadLimit sets the maximum size in bytes of a message read from
+// the peer. If a message exceeds the limit, the connection sends a
+// close message to the peer and the read methods return ErrReadLimit.
+// A limit of zero or less means no limit.
+func (c *Conn) SetReadLimit(limit int64) {
+	c.readLimit = limit
+}
+
+// SetPingHandler sets the handler for ping messages received from the
+// peer. The appData argument is the ping message payload. The default
+// handler, also installed when h is nil, sends a pong with the same
+// payload. The handler is called from the read methods.
+func (c *Conn) SetPingHandler(h func(appData string) error) {
+	c.hmu.Lock()
+	c.handlePing = h
+	c.hmu.Unlock()
+}
+
+// SetPongHandler sets the handler for pong messages received from the
+// peer. The appData argument is the pong message payload. The default
+// handler, also installed when h is nil, does nothing. The handler is
+// called from the read methods.
+func (c *Conn) SetPongHandler(h func(appData string) error) {
+	c.hmu.Lock()
+	c.handlePong = h
+	c.hmu.Unlock()
+}
+
+// Write methods
+
+// writeFrame writes a single frame and flushes it to the network.
+// The payload is not modified, even when it must be masked.
+// The caller must hold c.wmu.
+func (c *Conn) writeFrame(final bool, opcode int, payload []byte) error {
+	b0 := byte(opcode)
+	if final {
+		b0 |= finalBit
+	}
+	var hdr [maxFrameHeaderSize]byte
+	hdr[0] = b0
+	n := 2
+	switch length := len(payload); {
+	case length <= 125:
+		hdr[1] = byte(length)
+	case length <= 0xffff:
+		hdr[1] = 126
+		hdr[2] = byte(length >> 8)
+		hdr[3] = byte(length)
+		n = 4
+	default:
+		hdr[1] = 127
+		for i := 0; i < 8; i++ {
+			hdr[2+i] = byte(uint64(length) >> uint(56-8*i))
+		}
+		n = 10
+	}
+	var key [4]byte
+	if !c.isServer {
+		// Clients must mask every frame with a fresh,
+		// unpredictable key (RFC 6455, section 5.3).
+		if _, err := io.ReadFull(rand.Reader, key[:]); err != nil {
+			return err
+		}
+		hdr[1] |= maskBit
+		copy(hdr[n:], key[:])
+		n += 4
+	}
+	if _, err := c.bw.Write(hdr[:n]); err != nil {
+		return err
+	}
+	if c.isServer {
+		if _, err := c.bw.Write(payload); err != nil {
+			return err
+		}
+	} else {
+		var scratch [512]byte
+		pos := 0
+		for len(payload) > 0 {
+			m := copy(scratch[:], payload)
+			pos = maskBytes(key, pos, scratch[:m])
+			if _, err := c.bw.Write(scratch[:m]); err != nil {
+				return err
+			}
+			payload = payload[m:]
+		}
+	}
+	return c.bw.Flush()
+}
+
+// WriteControl writes a control message with the given deadline. The
+// allowed message types are CloseMessage, PingMessage and PongMessage.
+// Control message payloads are limited to 125 bytes.
+//
+// After a close message has been written, further writes return
+// ErrCloseSent.
+func (c *Conn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	if messageType != CloseMessage && messageType != PingMessage && messageType != PongMessage {
+		return errors.New("websocket: bad control message type")
+	}
+	if len(data) > maxControlFramePayloadSize {
+		return errors.New("websocket: control message payload too large")
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	c.conn.SetWriteDeadline(deadline)
+	err := c.writeFrame(true, messageType, data)
+	c.conn.SetWriteDeadline(c.writeDeadline)
+	if messageType == CloseMessage {
+		c.closeSent = true
+	}
+	return err
+}
+
+// writeDataFrame writes one frame of a data message.
+func (c *Conn) writeDataFrame(final bool, opcode int, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	return c.writeFrame(final, opcode, payload)
+}
+
+// NextWriter returns a writer for the next message to send. The
+// writer's Close method flushes the complete message to the network.
+// Data written beyond the write buffer size is sent as a sequence of
+// fragments. Calling NextWriter closes any writer previously returned.
+//
+// The messageType must be TextMessage or BinaryMessage.
+func (c *Conn) NextWriter(messageType int) (io.WriteCloser, error) {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return nil, errors.New("websocket: bad data message type")
+	}
+	if c.writer != nil {
+		if err := c.writer.Close(); err != nil {
+			return nil, err
+		}
+	}
+	c.writer = &messageWriter{
+		c:      c,
+		opcode: messageType,
+		buf:    make([]byte, 0, c.writeBufSize),
+	}
+	return c.writer, nil
+}
+
+// WriteMessage writes data as a single, unfragmented message of the
+// given type. It closes any writer previously returned by NextWriter.
+func (c *Conn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return errors.New("websocket: bad data message type")
+	}
+	if c.writer != nil {
+		if err := c.writer.Close(); err != nil {
+			return err
+		}
+	}
+	return c.writeDataFrame(true, messageType, data)
+}
+
+// messageWriter accumulates a data message and emits it as one or
+// more frames.
+type messageWriter struct {
+	c      *Conn
+	opcode int // opcode of the next frame; continuationFrame after the first
+	buf    []byte
+	err    error // sticky
+}
+
+func (w *messageWriter) flushFrame(final bool) error {
+	err := w.c.writeDataFrame(final, w.opcode, w.buf)
+	w.opcode = continuationFrame
+	w.buf = w.buf[:0]
+	return err
+}
+
+func (w *messageWriter) Write(p []byte) (n int, err error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	for len(p) > 0 {
+		if len(w.buf) == cap(w.buf) {
+			if err = w.flushFrame(false); err != nil {
+				w.err = err
+				return n, err
+			}
+		}
+		m := copy(w.buf[len(w.buf):cap(w.buf)], p)
+		w.buf = w.buf[:len(w.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+func (w *messageWriter) Close() error {
+	if w.err != nil {
+		if w.err == errWriteClosed {
+			return nil
+		}
+		return w.err
+	}
+	err := w.flushFrame(true)
+	if err != nil {
+		w.err = err
+	} else {
+		w.err = errWriteClosed
+	}
+	if w.c.writer == w {
+		w.c.writer = nil
+	}
+	return err
+}
+
+// Read methods
+
+// protocolError sends a close message with the given code and returns
+// an error describing the problem.
+func (c *Conn) protocolError(code int, message string) error {
+	c.WriteControl(CloseMessage, FormatCloseMessage(code, message), time.Now().Add(controlWriteTimeout))
+	return errors.New("websocket: " + message)
+}
+
+// readFull reads exactly len(p) bytes, mapping a premature end of the
+// connection to a CloseError with the CloseAbnormalClosure code.
+func (c *Conn) readFull(p []byte) error {
+	_, err := io.ReadFull(c.br, p)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = &CloseError{Code: CloseAbnormalClosure, Text: io.ErrUnexpectedEOF.Error()}
+	}
+	return err
+}
+
+// advanceFrame reads the next frame header. Control frames are read
+// and processed in full, in which case noFrame is returned. For data
+// frames the opcode is returned and the payload is left for the
+// message reader.
+func (c *Conn) advanceFrame() (int, error) {
+	// Skip the remainder of the previous frame.
+	if c.readRemaining > 0 {
+		if _, err := io.CopyN(ioutil.Discard, c.br, c.readRemaining); err != nil {
+			return noFrame, err
+		}
+		c.readRemaining = 0
+	}
+
+	var hdr [8]byte
+	if err := c.readFull(hdr[:2]); err != nil {
+		return noFrame, err
+	}
+	final := hdr[0]&finalBit != 0
+	opcode := int(hdr[0] & 0xf)
+	masked := hdr[1]&maskBit != 0
+	length := int64(hdr[1] & 0x7f)
+
+	if hdr[0]&rsvBits != 0 {
+		return noFrame, c.protocolError(CloseProtocolError, "unexpected reserved bits set")
+	}
+	switch opcode {
+	case CloseMessage, PingMessage, PongMessage:
+		if length > maxControlFramePayloadSize {
+			return noFrame, c.protocolError(CloseProtocolError, "control frame length > 125")
+		}
+		if !final {
+			return noFrame, c.protocolError(CloseProtocolError, "control frame not final")
+		}
+	case TextMessage, BinaryMessage:
+		if c.readInMessage {
+			return noFrame, c.protocolError(CloseProtocolError, "data frame received before previous message ended")
+		}
+		c.readInMessage = !final
+	case continuationFrame:
+		if !c.readInMessage {
+			return noFrame, c.protocolError(CloseProtocolError, "continuation frame without a message in progress")
+		}
+		c.readInMessage = !final
+	default:
+		return noFrame, c.protocolError(CloseProtocolError, "unknown opcode")
+	}
+	if masked != c.isServer {
+		if c.isServer {
+			return noFrame, c.protocolError(CloseProtocolError, "client frame is not masked")
+		}
+		return noFrame, c.protocolError(CloseProtocolError, "server frame is masked")
+	}
+
+	switch length {
+	case 126:
+		if err := c.readFull(hdr[:2]); err != nil {
+			return noFrame, err
+		}
+		length = int64(hdr[0])<<8 | int64(hdr[1])
+	case 127:
+		if err := c.readFull(hdr[:8]); err != nil {
+			return noFrame, err
+		}
+		if hdr[0]&0x80 != 0 {
+			return noFrame, c.protocolError(CloseProtocolError, "frame length has most significant bit set")
+		}
+		length = 0
+		for _, b := range hdr[:8] {
+			length = length<<8 | int64(b)
+		}
+	}
+	if masked {
+		if err := c.readFull(c.readMaskKey[:]); err != nil {
+			return noFrame, err
+		}
+	}
+	c.readMasked = masked
+	c.readMaskPos = 0
+
+	if opcode == TextMessage || opcode == BinaryMessage || opcode == continuationFrame {
+		if opcode != continuationFrame {
+			// A new message; frames skipped from an abandoned
+			// one don't count against it.
+			c.readLength = 0
+		}
+		c.readLength += length
+		if c.readLimit > 0 && c.readLength > c.readLimit {
+			c.protocolError(CloseMessageTooBig, "message too big")
+			return noFrame, ErrReadLimit
+		}
+		c.readRemaining = length
+		c.readFinal = final
+		return opcode, nil
+	}
+
+	payload := make([]byte, length)
+	if err := c.readFull(payload); err != nil {
+		return noFrame, err
+	}
+	if masked {
+		maskBytes(c.readMaskKey, 0, payload)
+	}
+
+	switch opcode {
+	case PingMessage:
+		c.hmu.Lock()
+		h := c.handlePing
+		c.hmu.Unlock()
+		if h == nil {
+			err := c.WriteControl(PongMessage, payload, time.Now().Add(controlWriteTimeout))
+			if err != nil && err != ErrCloseSent {
+				return noFrame, err
+			}
+		} else if err := h(string(payload)); err != nil {
+			return noFrame, err
+		}
+	case PongMessage:
+		c.hmu.Lock()
+		h := c.handlePong
+		c.hmu.Unlock()
+		if h != nil {
+			if err := h(string(payload)); err != nil {
+				return noFrame, err
+			}
+		}
+	case CloseMessage:
+		closeCode := CloseNoStatusReceived
+		closeText := ""
+		switch {
+		case len(payload) == 1:
+			return noFrame, c.protocolError(CloseProtocolError, "invalid close payload")
+		case len(payload) >= 2:
+			closeCode = int(payload[0])<<8 | int(payload[1])
+			closeText = string(payload[2:])
+			if !validReceivedCloseCode(closeCode) {
+				return noFrame, c.protocolError(CloseProtocolError, "invalid close code")
+			}
+			if !utf8.ValidString(closeText) {
+				return noFrame, c.protocolError(CloseInvalidFramePayloadData, "invalid utf8 in close reason")
+			}
+		}
+		// Echo the close code back to complete the closing
+		// handshake. If we initiated the close, this is a no-op.
+		c.WriteControl(CloseMessage, FormatCloseMessage(closeCode, ""), time.Now().Add(controlWriteTimeout))
+		return noFrame, &CloseError{Code: closeCode, Text: closeText}
+	}
+	return noFrame, nil
+}
+
+// NextReader returns the next data message received from the peer.
+// The returned messageType is either TextMessage or BinaryMessage.
+// The reader returns io.EOF at the end of the message, and is
+// invalidated by the next call to NextReader or ReadMessage.
+//
+// Control messages arriving before or between the fragments of the
+// message are processed as they are read. Once a read method returns
+// an error, all subsequent calls return the same error.
+func (c *Conn) NextReader() (messageType int, r io.Reader, err error) {
+	c.reader = nil
+	for c.readErr == nil {
+		frameType, err := c.advanceFrame()
+		if err != nil {
+			c.readErr = err
+			break
+		}
+		switch frameType {
+		case TextMessage, BinaryMessage:
+			c.reader = &messageReader{c}
+			return frameType, c.reader, nil
+		case continuationFrame:
+			// A continuation of a message the application
+			// abandoned; skip it.
+		}
+	}
+	return noFrame, nil, c.readErr
+}
+
+// ReadMessage reads the next data message in full. Text messages that
+// are not valid UTF-8 cause a close message with the
+// CloseInvalidFramePayloadData code to be sent to the peer.
+func (c *Conn) ReadMessage() (messageType int, p []byte, err error) {
+	messageType, r, err := c.NextReader()
+	if err != nil {
+		return messageType, nil, err
+	}
+	p, err = ioutil.ReadAll(r)
+	if err == nil && messageType == TextMessage && !utf8.Valid(p) {
+		c.readErr = c.protocolError(CloseInvalidFramePayloadData, "invalid utf8 in text message")
+		err = c.readErr
+	}
+	return messageType, p, err
+}
+
+// messageReader reads the payload of one data message, across frames.
+type messageReader struct{ c *Conn }
+
+func (r *messageReader) Read(b []byte) (int, error) {
+	c := r.c
+	if c.reader != r {
+		return 0, io.EOF
+	}
+	for c.readErr == nil {
+		if c.readRemaining > 0 {
+			if int64(len(b)) > c.readRemaining {
+				b = b[:c.readRemaining]
+			}
+			n, err := c.br.Read(b)
+			if c.readMasked {
+				c.readMaskPos = maskBytes(c.readMaskKey, c.readMaskPos, b[:n])
+			}
+			c.readRemaining -= int64(n)
+			if err == io.EOF {
+				err = &CloseError{Code: CloseAbnormalClosure, Text: io.ErrUnexpectedEOF.Error()}
+			}
+			c.readErr = err
+			return n, err
+		}
+		if c.readFinal {
+			c.reader = nil
+			return 0, io.EOF
+		}
+		frameType, err := c.advanceFrame()
+		switch {
+		case err != nil:
+			c.readErr = err
+		case frameType == TextMessage || frameType == BinaryMessage:
+			c.readErr = errors.New("websocket: internal error, unexpected data frame in message")
+		}
+	}
+	return 0, c.readErr
+}
+
+// maskBytes applies the masking key to b, starting at offset pos of
+// the key, and returns the offset for the next byte.
+func maskBytes(key [4]byte, pos int, b []byte) int {
+	for i := range b {
+		b[i] ^= key[pos&3]
+		pos++
+	}
+	return pos & 3
+}
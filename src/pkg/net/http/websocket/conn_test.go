@@ -0,0 +1,217 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakeNetConn is a net.Conn that reads from r and writes to w.
+type fakeNetConn struct {
+	io.Reader
+	io.Writer
+}
+
+func (c fakeNetConn) Close() error                       { return nil }
+func (c fakeNetConn) LocalAddr() net.Addr                { return nil }
+func (c fakeNetConn) RemoteAddr() net.Addr               { return nil }
+func (c fakeNetConn) SetDeadline(t time.Time) error      { return nil }
+func (c fakeNetConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c fakeNetConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// connPair returns a writing Conn and a reading Conn of the opposite
+// role joined by buf.
+func connPair(buf *bytes.Buffer, writerIsServer bool, writeBufSize int) (wc, rc *Conn) {
+	var discard bytes.Buffer
+	wc = newConn(fakeNetConn{Reader: nil, Writer: buf}, writerIsServer, nil, 1024, writeBufSize)
+	rc = newConn(fakeNetConn{Reader: buf, Writer: &discard}, !writerIsServer, nil, 1024, 1024)
+	return wc, rc
+}
+
+var frameSizeTests = []int{0, 1, 125, 126, 1000, 65535, 65536, 100000}
+
+func TestFrameSizes(t *testing.T) {
+	for _, isServer := range []bool{true, false} {
+		for _, n := range frameSizeTests {
+			var buf bytes.Buffer
+			wc, rc := connPair(&buf, isServer, 1024)
+			msg := bytes.Repeat([]byte{'x'}, n)
+			if err := wc.WriteMessage(BinaryMessage, msg); err != nil {
+				t.Fatalf("server=%v size=%d: WriteMessage: %v", isServer, n, err)
+			}
+			typ, p, err := rc.ReadMessage()
+			if err != nil {
+				t.Fatalf("server=%v size=%d: ReadMessage: %v", isServer, n, err)
+			}
+			if typ != BinaryMessage || !bytes.Equal(p, msg) {
+				t.Errorf("server=%v size=%d: got type %d, %d bytes", isServer, n, typ, len(p))
+			}
+		}
+	}
+}
+
+func TestFragmentedWriter(t *testing.T) {
+	var buf bytes.Buffer
+	wc, rc := connPair(&buf, false, 16)
+	w, err := wc.NextWriter(TextMessage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "The quick brown fox jumps over the lazy dog, twice over."
+	io.WriteString(w, want[:10])
+	io.WriteString(w, want[10:])
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first frame must be a non-final text frame holding
+	// exactly one write buffer.
+	hdr := buf.Bytes()[:2]
+	if hdr[0] != TextMessage || hdr[1] != maskBit|16 {
+		t.Errorf("first frame header = %#x %#x; want %#x %#x", hdr[0], hdr[1], TextMessage, maskBit|16)
+	}
+
+	typ, r, err := rc.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ioutil.ReadAll(r)
+	if typ != TextMessage || string(p) != want || err != nil {
+		t.Errorf("read %d %q %v; want %d %q", typ, p, err, TextMessage, want)
+	}
+}
+
+func TestControlInterleavedWithFragments(t *testing.T) {
+	var buf bytes.Buffer
+	wc, rc := connPair(&buf, true, 4)
+	w, _ := wc.NextWriter(BinaryMessage)
+	w.Write([]byte("abcdef"))
+	if err := wc.WriteControl(PingMessage, []byte("hi"), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("ghi"))
+	w.Close()
+
+	var pings []string
+	rc.SetPingHandler(func(s string) error {
+		pings = append(pings, s)
+		return nil
+	})
+	_, p, err := rc.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(p) != "abcdefghi" {
+		t.Errorf("message = %q; want %q", p, "abcdefghi")
+	}
+	if len(pings) != 1 || pings[0] != "hi" {
+		t.Errorf("pings = %q; want [hi]", pings)
+	}
+}
+
+func TestReadLimit(t *testing.T) {
+	var buf bytes.Buffer
+	wc, rc := connPair(&buf, true, 1024)
+	wc.WriteMessage(BinaryMessage, make([]byte, 10))
+	wc.WriteMessage(BinaryMessage, make([]byte, 11))
+	rc.SetReadLimit(10)
+	if _, _, err := rc.ReadMessage(); err != nil {
+		t.Fatalf("message at limit: %v", err)
+	}
+	if _, _, err := rc.ReadMessage(); err != ErrReadLimit {
+		t.Fatalf("message over limit: got %v; want ErrReadLimit", err)
+	}
+}
+
+func TestReadLimitAfterAbandonedMessage(t *testing.T) {
+	var buf bytes.Buffer
+	wc, rc := connPair(&buf, true, 4)
+	wc.WriteMessage(BinaryMessage, make([]byte, 8)) // two frames
+	wc.WriteMessage(BinaryMessage, make([]byte, 8))
+	rc.SetReadLimit(8)
+
+	_, r, err := rc.NextReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Read(make([]byte, 1)) // abandon the rest of the message
+	if _, p, err := rc.ReadMessage(); err != nil || len(p) != 8 {
+		t.Fatalf("message after abandoned one: got %d bytes, %v; want 8 bytes", len(p), err)
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	var buf bytes.Buffer
+	wc, rc := connPair(&buf, true, 1024)
+	wc.WriteMessage(TextMessage, []byte{'a', 0xff})
+	if _, _, err := rc.ReadMessage(); err == nil {
+		t.Fatal("expected error for invalid UTF-8 text message")
+	}
+}
+
+func TestCloseMessage(t *testing.T) {
+	var buf bytes.Buffer
+	wc, rc := connPair(&buf, false, 1024)
+	if err := wc.WriteControl(CloseMessage, FormatCloseMessage(CloseGoingAway, "bye"), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := wc.WriteMessage(TextMessage, []byte("late")); err != ErrCloseSent {
+		t.Errorf("write after close = %v; want ErrCloseSent", err)
+	}
+	_, _, err := rc.NextReader()
+	ce, ok := err.(*CloseError)
+	if !ok || ce.Code != CloseGoingAway || ce.Text != "bye" {
+		t.Fatalf("NextReader error = %#v; want CloseError{1001, bye}", err)
+	}
+	if _, _, err2 := rc.NextReader(); err2 != err {
+		t.Errorf("second NextReader error = %v; want sticky %v", err2, err)
+	}
+}
+
+var badFrameTests = []struct {
+	name  string
+	frame []byte
+}{
+	{"unmasked", []byte{finalBit | TextMessage, 1, 'a'}},
+	{"reserved bits", []byte{finalBit | 0x40 | TextMessage, maskBit | 0, 0, 0, 0, 0}},
+	{"unknown opcode", []byte{finalBit | 3, maskBit | 0, 0, 0, 0, 0}},
+	{"fragmented ping", []byte{PingMessage, maskBit | 0, 0, 0, 0, 0}},
+	{"orphan continuation", []byte{finalBit | continuationFrame, maskBit | 0, 0, 0, 0, 0}},
+	{"bad close code", []byte{finalBit | CloseMessage, maskBit | 2, 0, 0, 0, 0, 0x03, 0xed}},
+}
+
+func TestServerRejectsBadFrames(t *testing.T) {
+	for _, tt := range badFrameTests {
+		var out bytes.Buffer
+		c := newConn(fakeNetConn{Reader: bytes.NewReader(tt.frame), Writer: &out}, true, nil, 1024, 1024)
+		if _, _, err := c.NextReader(); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+			continue
+		}
+		// The server must have answered with a protocol error
+		// close message.
+		pc := newConn(fakeNetConn{Reader: &out, Writer: ioutil.Discard}, false, bufio.NewReader(&out), 0, 0)
+		_, _, err := pc.NextReader()
+		if ce, ok := err.(*CloseError); !ok || ce.Code != CloseProtocolError {
+			t.Errorf("%s: peer got %v; want close %d", tt.name, err, CloseProtocolError)
+		}
+	}
+}
+
+func TestMaskBytes(t *testing.T) {
+	key := [4]byte{1, 2, 3, 4}
+	p := []byte{0, 0, 0, 0, 0, 0}
+	pos := maskBytes(key, 0, p[:3])
+	pos = maskBytes(key, pos, p[3:])
+	if want := []byte{1, 2, 3, 4, 1, 2}; !bytes.Equal(p, want) || pos != 2 {
+		t.Errorf("maskBytes = %v, %d; want %v, 2", p, pos, want)
+	}
+}
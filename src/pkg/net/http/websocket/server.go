@@ -0,0 +1,192 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// An Upgrader specifies parameters for upgrading an HTTP connection
+// to a WebSocket connection.
+type Upgrader struct {
+	// HandshakeTimeout specifies the duration for the handshake
+	// response to be written. If zero, no timeout is used.
+	HandshakeTimeout time.Duration
+
+	// ReadBufferSize and WriteBufferSize specify the I/O buffer
+	// sizes in bytes. If zero, a size of 4096 is used. The write
+	// buffer size also bounds the payload of the frames sent by a
+	// writer returned from NextWriter.
+	ReadBufferSize, WriteBufferSize int
+
+	// Subprotocols specifies the server's supported protocols in
+	// order of preference. The first of the client's requested
+	// protocols that the server supports is selected. If
+	// Subprotocols is nil, no protocol is negotiated unless the
+	// response header passed to Upgrade sets one.
+	Subprotocols []string
+
+	// CheckOrigin returns true if the request Origin header is
+	// acceptable. If CheckOrigin is nil, requests without an Origin
+	// header and requests whose Origin host matches the request
+	// Host are accepted.
+	CheckOrigin func(r *http.Request) bool
+}
+
+func (u *Upgrader) returnError(w http.ResponseWriter, status int, reason string) (*Conn, error) {
+	err := HandshakeError{reason}
+	w.Header().Set("Sec-WebSocket-Version", "13")
+	http.Error(w, http.StatusText(status), status)
+	return nil, err
+}
+
+// checkSameOrigin returns true if the origin is not set or is equal
+// to the request host.
+func checkSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func (u *Upgrader) selectSubprotocol(r *http.Request, responseHeader http.Header) string {
+	if u.Subprotocols != nil {
+		clientProtocols := headerTokens(r.Header, "Sec-WebSocket-Protocol")
+		for _, sp := range u.Subprotocols {
+			for _, cp := range clientProtocols {
+				if cp == sp {
+					return cp
+				}
+			}
+		}
+	} else if responseHeader != nil {
+		return responseHeader.Get("Sec-WebSocket-Protocol")
+	}
+	return ""
+}
+
+// Upgrade upgrades the HTTP server connection to the WebSocket
+// protocol.
+//
+// The responseHeader is included in the response to the client's
+// upgrade request. Use it to specify cookies (Set-Cookie) and the
+// application negotiated subprotocol (Sec-WebSocket-Protocol).
+//
+// If the upgrade fails, Upgrade replies to the client with an HTTP
+// error response and returns a HandshakeError. Once the connection
+// has been hijacked, errors are returned without replying.
+func (u *Upgrader) Upgrade(w http.ResponseWriter, r *http.Request, responseHeader http.Header) (*Conn, error) {
+	if r.Method != "GET" {
+		return u.returnError(w, http.StatusMethodNotAllowed, "websocket: request method is not GET")
+	}
+	if !tokenListContainsValue(r.Header, "Connection", "upgrade") {
+		return u.returnError(w, http.StatusBadRequest, "websocket: 'upgrade' token not found in 'Connection' header")
+	}
+	if !tokenListContainsValue(r.Header, "Upgrade", "websocket") {
+		return u.returnError(w, http.StatusBadRequest, "websocket: 'websocket' token not found in 'Upgrade' header")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return u.returnError(w, http.StatusBadRequest, "websocket: unsupported version: 13 not found in 'Sec-WebSocket-Version' header")
+	}
+	checkOrigin := u.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = checkSameOrigin
+	}
+	if !checkOrigin(r) {
+		return u.returnError(w, http.StatusForbidden, "websocket: request origin not allowed by Upgrader.CheckOrigin")
+	}
+	challengeKey := r.Header.Get("Sec-WebSocket-Key")
+	if k, err := base64.StdEncoding.DecodeString(challengeKey); err != nil || len(k) != 16 {
+		return u.returnError(w, http.StatusBadRequest, "websocket: not a websocket handshake: 'Sec-WebSocket-Key' header is missing or invalid")
+	}
+	subprotocol := u.selectSubprotocol(r, responseHeader)
+
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		return u.returnError(w, http.StatusInternalServerError, "websocket: response does not implement http.Hijacker")
+	}
+	netConn, brw, err := h.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	if brw.Reader.Buffered() > 0 {
+		netConn.Close()
+		return nil, errors.New("websocket: client sent data before handshake is complete")
+	}
+
+	c := newConn(netConn, true, nil, u.ReadBufferSize, u.WriteBufferSize)
+	c.subprotocol = subprotocol
+
+	p := []byte("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: ")
+	p = append(p, computeAcceptKey(challengeKey)...)
+	p = append(p, "\r\n"...)
+	if subprotocol != "" {
+		p = append(p, "Sec-WebSocket-Protocol: "...)
+		p = append(p, subprotocol...)
+		p = append(p, "\r\n"...)
+	}
+	for k, vs := range responseHeader {
+		if k == "Sec-Websocket-Protocol" {
+			continue
+		}
+		for _, v := range vs {
+			p = append(p, k...)
+			p = append(p, ": "...)
+			for i := 0; i < len(v); i++ {
+				b := v[i]
+				if b <= 31 {
+					// Prevent response splitting.
+					b = ' '
+				}
+				p = append(p, b)
+			}
+			p = append(p, "\r\n"...)
+		}
+	}
+	p = append(p, "\r\n"...)
+
+	// Clear any deadlines set by the http.Server; from here on the
+	// application controls them through the Conn.
+	netConn.SetDeadline(time.Time{})
+	if u.HandshakeTimeout > 0 {
+		netConn.SetWriteDeadline(time.Now().Add(u.HandshakeTimeout))
+	}
+	if _, err = netConn.Write(p); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	if u.HandshakeTimeout > 0 {
+		netConn.SetWriteDeadline(time.Time{})
+	}
+	return c, nil
+}
+
+// Handler is a simple interface to a WebSocket server. ServeHTTP
+// upgrades each request using a zero Upgrader and calls the function
+// with the resulting connection, closing it when the function returns.
+// Requests that are not valid WebSocket handshakes are answered with
+// an HTTP error.
+type Handler func(*Conn)
+
+// ServeHTTP implements the http.Handler interface for a WebSocket.
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var u Upgrader
+	c, err := u.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer c.Close()
+	h(c)
+}
@@ -0,0 +1,204 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package websocket implements the WebSocket protocol defined in RFC 6455.
+//
+// The server side is built on http.Handler: an Upgrader validates the
+// opening handshake, takes over the connection with http.Hijacker and
+// returns a *Conn. The client side, Dialer, performs the opening
+// handshake over a plain or TLS connection, optionally tunneled through
+// an HTTP proxy using the same proxy function type as http.Transport.
+//
+// A Conn reads and writes whole messages with ReadMessage and
+// WriteMessage, or streams them with NextReader and NextWriter.
+// Fragmented messages, masking, ping/pong and the closing handshake
+// are handled by the Conn.
+//
+// Concurrency
+//
+// A Conn supports one concurrent reader and one concurrent writer.
+// Applications are responsible for ensuring that no more than one
+// goroutine calls the write methods (NextWriter, WriteMessage)
+// concurrently and that no more than one goroutine calls the read
+// methods (NextReader, ReadMessage) concurrently. The Close and
+// WriteControl methods can be called concurrently with all other
+// methods.
+//
+// Control messages
+//
+// Ping and pong messages are processed by the read methods. By
+// default a Conn answers each ping with a pong carrying the same
+// application data; SetPingHandler and SetPongHandler change that.
+// When the peer sends a close message, the read methods echo it back
+// and return a *CloseError. An application should therefore keep
+// reading from a Conn, even if it has no use for incoming data
+// messages, in order to process control messages.
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The message types are defined in RFC 6455, section 11.8.
+const (
+	// TextMessage denotes a text data message. The text message
+	// payload is interpreted as UTF-8 encoded text data.
+	TextMessage = 1
+
+	// BinaryMessage denotes a binary data message.
+	BinaryMessage = 2
+
+	// CloseMessage denotes a close control message. The optional
+	// message payload contains a numeric code and text. Use the
+	// FormatCloseMessage function to format a close message payload.
+	CloseMessage = 8
+
+	// PingMessage denotes a ping control message. The optional
+	// message payload is UTF-8 encoded text.
+	PingMessage = 9
+
+	// PongMessage denotes a pong control message. The optional
+	// message payload is UTF-8 encoded text.
+	PongMessage = 10
+)
+
+// Close codes defined in RFC 6455, section 11.7.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+	CloseTLSHandshake            = 1015
+)
+
+// Errors returned by Conn and Dialer.
+var (
+	// ErrCloseSent is returned when the application writes a
+	// message to the connection after sending a close message.
+	ErrCloseSent = errors.New("websocket: close sent")
+
+	// ErrReadLimit is returned when reading a message that is
+	// larger than the read limit set for the connection.
+	ErrReadLimit = errors.New("websocket: read limit exceeded")
+
+	// ErrBadHandshake is returned by Dial when the server
+	// response to the opening handshake is invalid.
+	ErrBadHandshake = errors.New("websocket: bad handshake")
+
+	// ErrBadScheme is returned by Dial when the URL scheme is
+	// neither "ws" nor "wss".
+	ErrBadScheme = errors.New("websocket: URL scheme must be ws or wss")
+)
+
+// CloseError is returned by the read methods when the peer sends a
+// close message or the connection ends without one.
+type CloseError struct {
+	// Code is the close code sent by the peer. It is
+	// CloseNoStatusReceived if the close message had no payload and
+	// CloseAbnormalClosure if the connection ended without a close
+	// message.
+	Code int
+
+	// Text is the reason sent by the peer, if any.
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	s := "websocket: close " + strconv.Itoa(e.Code)
+	if e.Text != "" {
+		s += ": " + e.Text
+	}
+	return s
+}
+
+// HandshakeError describes a failure of the opening handshake
+// initiated by a client.
+type HandshakeError struct {
+	message string
+}
+
+func (e HandshakeError) Error() string { return e.message }
+
+// FormatCloseMessage formats closeCode and text as the payload of a
+// close message, suitable for passing to WriteControl. The
+// CloseNoStatusReceived code produces an empty payload.
+func FormatCloseMessage(closeCode int, text string) []byte {
+	if closeCode == CloseNoStatusReceived {
+		return []byte{}
+	}
+	buf := make([]byte, 2+len(text))
+	buf[0] = byte(closeCode >> 8)
+	buf[1] = byte(closeCode)
+	copy(buf[2:], text)
+	return buf
+}
+
+// IsWebSocketUpgrade reports whether the client requested an upgrade
+// to the WebSocket protocol.
+func IsWebSocketUpgrade(r *http.Request) bool {
+	return tokenListContainsValue(r.Header, "Connection", "upgrade") &&
+		tokenListContainsValue(r.Header, "Upgrade", "websocket")
+}
+
+// keyGUID is the fixed string appended to the client's key when
+// computing the server's accept value (RFC 6455, section 1.3).
+const keyGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+func computeAcceptKey(challengeKey string) string {
+	h := sha1.New()
+	h.Write([]byte(challengeKey))
+	h.Write([]byte(keyGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// tokenListContainsValue reports whether the comma-separated list
+// of tokens in the named header contains value, ignoring case.
+func tokenListContainsValue(h http.Header, name, value string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// headerTokens returns the comma-separated tokens of the named header.
+func headerTokens(h http.Header, name string) []string {
+	var tokens []string
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				tokens = append(tokens, t)
+			}
+		}
+	}
+	return tokens
+}
+
+// validReceivedCloseCode reports whether code may appear in a close
+// message sent by a peer.
+func validReceivedCloseCode(code int) bool {
+	switch code {
+	case CloseNormalClosure, CloseGoingAway, CloseProtocolError,
+		CloseUnsupportedData, CloseInvalidFramePayloadData,
+		ClosePolicyViolation, CloseMessageTooBig,
+		CloseMandatoryExtension, CloseInternalServerErr:
+		return true
+	}
+	return 3000 <= code && code <= 4999
+}
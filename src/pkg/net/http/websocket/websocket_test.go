@@ -0,0 +1,316 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package websocket
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func echoHandler(c *Conn) {
+	for {
+		typ, r, err := c.NextReader()
+		if err != nil {
+			return
+		}
+		w, err := c.NextWriter(typ)
+		if err != nil {
+			return
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			return
+		}
+		if err := w.Close(); err != nil {
+			return
+		}
+	}
+}
+
+func wsURL(s *httptest.Server) string {
+	return "ws" + s.URL[len("http"):]
+}
+
+func TestEcho(t *testing.T) {
+	ts := httptest.NewServer(Handler(echoHandler))
+	defer ts.Close()
+
+	c, resp, err := Dial(wsURL(ts), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer c.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("handshake status = %d", resp.StatusCode)
+	}
+
+	msgs := []struct {
+		typ  int
+		data string
+	}{
+		{TextMessage, "hello"},
+		{BinaryMessage, "\x00\x01\x02"},
+		{TextMessage, strings.Repeat("long ", 2000)},
+		{TextMessage, ""},
+	}
+	for _, m := range msgs {
+		if err := c.WriteMessage(m.typ, []byte(m.data)); err != nil {
+			t.Fatalf("WriteMessage: %v", err)
+		}
+		typ, p, err := c.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage: %v", err)
+		}
+		if typ != m.typ || string(p) != m.data {
+			t.Errorf("echo = %d, %d bytes; want %d, %d bytes", typ, len(p), m.typ, len(m.data))
+		}
+	}
+}
+
+func TestEchoTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(Handler(echoHandler))
+	defer ts.Close()
+
+	d := &Dialer{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	c, _, err := d.Dial("wss"+ts.URL[len("https"):], nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer c.Close()
+	c.WriteMessage(TextMessage, []byte("secure"))
+	if _, p, err := c.ReadMessage(); err != nil || string(p) != "secure" {
+		t.Errorf("ReadMessage = %q, %v", p, err)
+	}
+}
+
+func TestPingPong(t *testing.T) {
+	ts := httptest.NewServer(Handler(echoHandler))
+	defer ts.Close()
+
+	c, _, err := Dial(wsURL(ts), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer c.Close()
+
+	pongs := make(chan string, 1)
+	c.SetPongHandler(func(s string) error {
+		pongs <- s
+		return nil
+	})
+	if err := c.WriteControl(PingMessage, []byte("are you there"), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	// The pong is processed while reading the echo of the next
+	// data message.
+	c.WriteMessage(TextMessage, []byte("x"))
+	if _, _, err := c.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case s := <-pongs:
+		if s != "are you there" {
+			t.Errorf("pong payload = %q", s)
+		}
+	default:
+		t.Error("no pong received")
+	}
+}
+
+func TestClosingHandshake(t *testing.T) {
+	serverErr := make(chan error, 1)
+	ts := httptest.NewServer(Handler(func(c *Conn) {
+		c.WriteControl(CloseMessage, FormatCloseMessage(4001, "done"), time.Now().Add(time.Second))
+		_, _, err := c.ReadMessage()
+		serverErr <- err
+	}))
+	defer ts.Close()
+
+	c, _, err := Dial(wsURL(ts), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer c.Close()
+	_, _, err = c.ReadMessage()
+	if ce, ok := err.(*CloseError); !ok || ce.Code != 4001 || ce.Text != "done" {
+		t.Errorf("client read error = %v; want close 4001", err)
+	}
+	// The server sees the echo of its own close code.
+	err = <-serverErr
+	if ce, ok := err.(*CloseError); !ok || ce.Code != 4001 {
+		t.Errorf("server read error = %v; want close 4001", err)
+	}
+}
+
+func TestSubprotocol(t *testing.T) {
+	u := &Upgrader{Subprotocols: []string{"v2.chat", "v1.chat"}}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := u.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		c.WriteMessage(TextMessage, []byte(c.Subprotocol()))
+		c.Close()
+	}))
+	defer ts.Close()
+
+	d := &Dialer{Subprotocols: []string{"v1.chat", "v2.chat"}}
+	c, _, err := d.Dial(wsURL(ts), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer c.Close()
+	if c.Subprotocol() != "v2.chat" {
+		t.Errorf("client subprotocol = %q; want v2.chat", c.Subprotocol())
+	}
+	if _, p, _ := c.ReadMessage(); string(p) != "v2.chat" {
+		t.Errorf("server subprotocol = %q; want v2.chat", p)
+	}
+}
+
+func TestBadHandshake(t *testing.T) {
+	ts := httptest.NewServer(Handler(echoHandler))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("plain GET status = %d; want 400", res.StatusCode)
+	}
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Origin", "http://evil.example.com")
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("cross-origin status = %d; want 403", res.StatusCode)
+	}
+}
+
+func TestDialNotWebSocket(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusTeapot)
+	}))
+	defer ts.Close()
+
+	_, resp, err := Dial(wsURL(ts), nil)
+	if err != ErrBadHandshake {
+		t.Fatalf("Dial error = %v; want ErrBadHandshake", err)
+	}
+	if resp == nil || resp.StatusCode != http.StatusTeapot {
+		t.Errorf("Dial response = %v; want status 418", resp)
+	}
+	if _, _, err := Dial("http://example.com/", nil); err != ErrBadScheme {
+		t.Errorf("Dial http URL error = %v; want ErrBadScheme", err)
+	}
+}
+
+func TestComputeAcceptKey(t *testing.T) {
+	// Example from RFC 6455, section 1.3.
+	if got := computeAcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("computeAcceptKey = %q", got)
+	}
+}
+
+// connectProxy is an HTTP proxy handler that only implements CONNECT.
+type connectProxy struct {
+	auth     string // required Proxy-Authorization, or empty
+	tunneled chan string
+}
+
+func (p *connectProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "CONNECT" {
+		http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+		return
+	}
+	if p.auth != "" && r.Header.Get("Proxy-Authorization") != p.auth {
+		http.Error(w, "auth required", http.StatusProxyAuthRequired)
+		return
+	}
+	backend, err := net.Dial("tcp", r.Host)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	client, brw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		backend.Close()
+		return
+	}
+	p.tunneled <- r.Host
+	io.WriteString(client, "HTTP/1.1 200 Connection established\r\n\r\n")
+	go func() {
+		io.Copy(backend, brw)
+		backend.Close()
+	}()
+	io.Copy(client, backend)
+	client.Close()
+}
+
+func TestDialThroughProxy(t *testing.T) {
+	ts := httptest.NewServer(Handler(echoHandler))
+	defer ts.Close()
+	proxy := &connectProxy{auth: "Basic dXNlcjpwYXNz", tunneled: make(chan string, 1)}
+	ps := httptest.NewServer(proxy)
+	defer ps.Close()
+
+	proxyURL, _ := url.Parse(ps.URL)
+	proxyURL.User = url.UserPassword("user", "pass")
+	d := &Dialer{Proxy: http.ProxyURL(proxyURL)}
+	c, _, err := d.Dial(wsURL(ts), nil)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer c.Close()
+	if host := <-proxy.tunneled; host != ts.URL[len("http://"):] {
+		t.Errorf("proxy tunneled to %q", host)
+	}
+	c.WriteMessage(TextMessage, []byte("via proxy"))
+	if _, p, err := c.ReadMessage(); err != nil || string(p) != "via proxy" {
+		t.Errorf("ReadMessage = %q, %v", p, err)
+	}
+
+	proxyURL.User = nil
+	if _, _, err := d.Dial(wsURL(ts), nil); err == nil {
+		t.Error("Dial without proxy credentials succeeded")
+	}
+}
+
+func TestUpgradeResponseHeader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var u Upgrader
+		c, err := u.Upgrade(w, r, http.Header{"Set-Cookie": {"session=1"}})
+		if err != nil {
+			return
+		}
+		c.Close()
+	}))
+	defer ts.Close()
+
+	c, resp, err := Dial(wsURL(ts), http.Header{"Origin": {ts.URL}})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	c.Close()
+	if got := resp.Header.Get("Set-Cookie"); got != "session=1" {
+		t.Errorf("Set-Cookie = %q", got)
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// ICMP message bodies.
+
+package icmp
+
+// A Body is the part of an ICMP message that follows the type, code
+// and checksum.
+type Body interface {
+	// Len returns the length of the marshaled body for the
+	// protocol proto.
+	Len(proto int) int
+
+	// Marshal returns the wire format of the body for the
+	// protocol proto.
+	Marshal(proto int) ([]byte, error)
+}
+
+// An Echo is the body of an echo request or reply.
+type Echo struct {
+	ID   int    // identifier
+	Seq  int    // sequence number
+	Data []byte // data, returned unchanged in the reply
+}
+
+func (p *Echo) Len(proto int) int { return 4 + len(p.Data) }
+
+func (p *Echo) Marshal(proto int) ([]byte, error) {
+	b := make([]byte, 4+len(p.Data))
+	b[0], b[1] = byte(p.ID>>8), byte(p.ID)
+	b[2], b[3] = byte(p.Seq>>8), byte(p.Seq)
+	copy(b[4:], p.Data)
+	return b, nil
+}
+
+func parseEcho(b []byte) (Body, error) {
+	if len(b) < 4 {
+		return nil, errShort
+	}
+	p := &Echo{ID: int(b[0])<<8 | int(b[1]), Seq: int(b[2])<<8 | int(b[3])}
+	p.Data = make([]byte, len(b)-4)
+	copy(p.Data, b[4:])
+	return p, nil
+}
+
+// A DstUnreach is the body of a destination unreachable message.
+type DstUnreach struct {
+	// Data holds as much of the datagram that could not be
+	// delivered, starting with its IP header, as fits.
+	Data []byte
+}
+
+func (p *DstUnreach) Len(proto int) int { return 4 + len(p.Data) }
+
+func (p *DstUnreach) Marshal(proto int) ([]byte, error) {
+	return marshalUnused(p.Data), nil
+}
+
+func parseDstUnreach(b []byte) (Body, error) {
+	data, err := parseUnused(b)
+	if err != nil {
+		return nil, err
+	}
+	return &DstUnreach{Data: data}, nil
+}
+
+// A PacketTooBig is the body of an ICMPv6 packet too big message.
+type PacketTooBig struct {
+	MTU  int    // maximum transmission unit of the next hop
+	Data []byte // start of the datagram that was too big
+}
+
+func (p *PacketTooBig) Len(proto int) int { return 4 + len(p.Data) }
+
+func (p *PacketTooBig) Marshal(proto int) ([]byte, error) {
+	b := make([]byte, 4+len(p.Data))
+	b[0], b[1], b[2], b[3] = byte(p.MTU>>24), byte(p.MTU>>16), byte(p.MTU>>8), byte(p.MTU)
+	copy(b[4:], p.Data)
+	return b, nil
+}
+
+func parsePacketTooBig(b []byte) (Body, error) {
+	if len(b) < 4 {
+		return nil, errShort
+	}
+	p := &PacketTooBig{MTU: int(b[0])<<24 | int(b[1])<<16 | int(b[2])<<8 | int(b[3])}
+	p.Data = make([]byte, len(b)-4)
+	copy(p.Data, b[4:])
+	return p, nil
+}
+
+// A TimeExceeded is the body of a time exceeded message.
+type TimeExceeded struct {
+	Data []byte // start of the datagram that was discarded
+}
+
+func (p *TimeExceeded) Len(proto int) int { return 4 + len(p.Data) }
+
+func (p *TimeExceeded) Marshal(proto int) ([]byte, error) {
+	return marshalUnused(p.Data), nil
+}
+
+func parseTimeExceeded(b []byte) (Body, error) {
+	data, err := parseUnused(b)
+	if err != nil {
+		return nil, err
+	}
+	return &TimeExceeded{Data: data}, nil
+}
+
+// A ParamProb is the body of a parameter problem message.
+type ParamProb struct {
+	// Pointer is the offset in Data of the octet where the
+	// problem was found.  It is one octet long in ICMP and four
+	// in ICMPv6.
+	Pointer int
+
+	Data []byte // start of the datagram that was discarded
+}
+
+func (p *ParamProb) Len(proto int) int { return 4 + len(p.Data) }
+
+func (p *ParamProb) Marshal(proto int) ([]byte, error) {
+	b := make([]byte, 4+len(p.Data))
+	if proto == ProtocolIPv6ICMP {
+		if p.Pointer < 0 || int64(p.Pointer) > 0xffffffff {
+			return nil, errPointer
+		}
+		b[0], b[1], b[2], b[3] = byte(p.Pointer>>24), byte(p.Pointer>>16), byte(p.Pointer>>8), byte(p.Pointer)
+	} else {
+		if p.Pointer < 0 || p.Pointer > 0xff {
+			return nil, errPointer
+		}
+		b[0] = byte(p.Pointer)
+	}
+	copy(b[4:], p.Data)
+	return b, nil
+}
+
+func parseParamProb(proto int, b []byte) (Body, error) {
+	if len(b) < 4 {
+		return nil, errShort
+	}
+	p := new(ParamProb)
+	if proto == ProtocolIPv6ICMP {
+		p.Pointer = int(b[0])<<24 | int(b[1])<<16 | int(b[2])<<8 | int(b[3])
+	} else {
+		p.Pointer = int(b[0])
+	}
+	p.Data = make([]byte, len(b)-4)
+	copy(p.Data, b[4:])
+	return p, nil
+}
+
+// A RawBody is the body of a message of a type this package does
+// not know.
+type RawBody struct {
+	Data []byte
+}
+
+func (p *RawBody) Len(proto int) int { return len(p.Data) }
+
+func (p *RawBody) Marshal(proto int) ([]byte, error) {
+	return p.Data, nil
+}
+
+// marshalUnused returns data preceded by four unused octets.
+func marshalUnused(data []byte) []byte {
+	b := make([]byte, 4+len(data))
+	copy(b[4:], data)
+	return b
+}
+
+// parseUnused returns a copy of b after its four unused octets.
+func parseUnused(b []byte) ([]byte, error) {
+	if len(b) < 4 {
+		return nil, errShort
+	}
+	data := make([]byte, len(b)-4)
+	copy(data, b[4:])
+	return data, nil
+}
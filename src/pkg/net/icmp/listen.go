@@ -0,0 +1,145 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package icmp
+
+import (
+	"net"
+	"strings"
+	"time"
+)
+
+// A PacketConn sends and receives ICMP or ICMPv6 messages.
+type PacketConn struct {
+	c     net.PacketConn
+	proto int
+	dgram bool // a datagram socket, which speaks in UDP addresses
+}
+
+// ListenPacket listens for ICMP messages on the local address
+// address.
+//
+// For a raw IP socket, which usually needs root privileges, network
+// is "ip4:icmp" or "ip4:1" for ICMP and "ip6:ipv6-icmp" or "ip6:58"
+// for ICMPv6.
+//
+// For an unprivileged datagram socket, network is "udp4" for ICMP and
+// "udp6" for ICMPv6.  Datagram sockets exist only on Linux, which
+// restricts them to echo requests and replies and manages the echo
+// identifier itself: it replaces the ID of each request sent with
+// the socket's own identifier and delivers only the replies that
+// carry it.
+//
+// address is an IP address, or empty for the unspecified address,
+// and never has a port.
+func ListenPacket(network, address string) (*PacketConn, error) {
+	proto := ProtocolICMP
+	switch network {
+	case "ip4:icmp", "ip4:1":
+	case "ip6:ipv6-icmp", "ip6:58":
+		proto = ProtocolIPv6ICMP
+	case "udp4", "udp6":
+		if network == "udp6" {
+			proto = ProtocolIPv6ICMP
+		}
+		c, err := listenDatagram(network, proto, address)
+		if err != nil {
+			return nil, &net.OpError{Op: "listen", Net: network, Err: err}
+		}
+		return &PacketConn{c: c, proto: proto, dgram: true}, nil
+	default:
+		return nil, net.UnknownNetworkError(network)
+	}
+	c, err := net.ListenPacket(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return &PacketConn{c: c, proto: proto}, nil
+}
+
+// resolveAddr resolves address as an IP address of the family of the
+// datagram network ("udp4" or "udp6").
+func resolveAddr(network, address string) (*net.IPAddr, error) {
+	if address == "" {
+		return &net.IPAddr{}, nil
+	}
+	return net.ResolveIPAddr(strings.Replace(network, "udp", "ip", 1), address)
+}
+
+// Protocol returns the protocol of the messages c carries,
+// ProtocolICMP or ProtocolIPv6ICMP.
+func (c *PacketConn) Protocol() int {
+	return c.proto
+}
+
+// ReadFrom reads an ICMP message into b, returning the number of
+// bytes read and the address of its sender, a *net.IPAddr.  The
+// message does not include an IP header.
+func (c *PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	n, addr, err := c.c.ReadFrom(b)
+	if a, ok := addr.(*net.UDPAddr); ok {
+		addr = &net.IPAddr{IP: a.IP, Zone: a.Zone}
+	}
+	return n, addr, err
+}
+
+// WriteTo writes the ICMP message b to dst, a *net.IPAddr.
+func (c *PacketConn) WriteTo(b []byte, dst net.Addr) (int, error) {
+	if a, ok := dst.(*net.IPAddr); ok && c.dgram {
+		dst = &net.UDPAddr{IP: a.IP, Zone: a.Zone}
+	}
+	return c.c.WriteTo(b, dst)
+}
+
+// ReadMessage reads and parses an ICMP message, returning it with
+// the address of its sender.
+func (c *PacketConn) ReadMessage() (*Message, net.Addr, error) {
+	b := make([]byte, 65535)
+	n, addr, err := c.ReadFrom(b)
+	if err != nil {
+		return nil, addr, err
+	}
+	m, err := ParseMessage(c.proto, b[:n])
+	return m, addr, err
+}
+
+// WriteMessage marshals m and sends it to dst, a *net.IPAddr.
+// ICMPv6 checksums are left to the kernel.
+func (c *PacketConn) WriteMessage(m *Message, dst net.Addr) error {
+	if m.proto() != c.proto {
+		return errProtocolMismatch
+	}
+	b, err := m.Marshal(nil)
+	if err != nil {
+		return err
+	}
+	_, err = c.WriteTo(b, dst)
+	return err
+}
+
+// Close closes the connection.
+func (c *PacketConn) Close() error {
+	return c.c.Close()
+}
+
+// LocalAddr returns the local network address.
+func (c *PacketConn) LocalAddr() net.Addr {
+	return c.c.LocalAddr()
+}
+
+// SetDeadline sets the read and write deadlines associated with the
+// connection.
+func (c *PacketConn) SetDeadline(t time.Time) error {
+	return c.c.SetDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for future reads.
+func (c *PacketConn) SetReadDeadline(t time.Time) error {
+	return c.c.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for future writes.
+func (c *PacketConn) SetWriteDeadline(t time.Time) error {
+	return c.c.SetWriteDeadline(t)
+}
@@ -0,0 +1,63 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package icmp
+
+import (
+	"net"
+	"os"
+	"syscall"
+)
+
+// listenDatagram opens a datagram ICMP socket, as introduced in
+// Linux 3.0 for IPv4 and 3.11 for IPv6, bound to address.
+func listenDatagram(network string, proto int, address string) (net.PacketConn, error) {
+	a, err := resolveAddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+	family, sproto := syscall.AF_INET, syscall.IPPROTO_ICMP
+	var sa syscall.Sockaddr
+	if proto == ProtocolIPv6ICMP {
+		family, sproto = syscall.AF_INET6, syscall.IPPROTO_ICMPV6
+		sa6 := &syscall.SockaddrInet6{}
+		copy(sa6.Addr[:], a.IP.To16())
+		if a.Zone != "" {
+			ifi, err := net.InterfaceByName(a.Zone)
+			if err != nil {
+				return nil, err
+			}
+			sa6.ZoneId = uint32(ifi.Index)
+		}
+		sa = sa6
+	} else {
+		sa4 := &syscall.SockaddrInet4{}
+		if a.IP != nil {
+			ip := a.IP.To4()
+			if ip == nil {
+				return nil, &net.AddrError{Err: "not an IPv4 address", Addr: address}
+			}
+			copy(sa4.Addr[:], ip)
+		}
+		sa = sa4
+	}
+
+	// See ../../syscall/exec_unix.go for description of ForkLock.
+	syscall.ForkLock.RLock()
+	s, err := syscall.Socket(family, syscall.SOCK_DGRAM, sproto)
+	if err == nil {
+		syscall.CloseOnExec(s)
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err := syscall.Bind(s, sa); err != nil {
+		syscall.Close(s)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	f := os.NewFile(uintptr(s), "icmp")
+	defer f.Close()
+	return net.FilePacketConn(f)
+}
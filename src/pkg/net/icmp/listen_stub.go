@@ -0,0 +1,16 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package icmp
+
+import (
+	"errors"
+	"net"
+)
+
+func listenDatagram(network string, proto int, address string) (net.PacketConn, error) {
+	return nil, errors.New("icmp: datagram sockets not supported on this system")
+}
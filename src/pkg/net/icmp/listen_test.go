@@ -0,0 +1,116 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package icmp
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+var pingTests = []struct {
+	network, laddr, raddr string
+	ipv6                  bool
+	dgram                 bool
+}{
+	{"udp4", "127.0.0.1", "127.0.0.1", false, true},
+	{"udp6", "::1", "::1", true, true},
+	{"ip4:icmp", "0.0.0.0", "127.0.0.1", false, false},
+	{"ip6:ipv6-icmp", "::", "::1", true, false},
+}
+
+// socketError reports whether err arose in creating a socket, as it
+// does when the system does not support or permit such sockets.
+func socketError(err error) bool {
+	if oe, ok := err.(*net.OpError); ok {
+		err = oe.Err
+	}
+	se, ok := err.(*os.SyscallError)
+	return ok && se.Syscall == "socket"
+}
+
+func TestPing(t *testing.T) {
+	for _, tt := range pingTests {
+		if tt.ipv6 && !supportsIPv6() {
+			continue
+		}
+		if !tt.dgram && os.Getuid() != 0 {
+			t.Logf("skipping %s test; must be root", tt.network)
+			continue
+		}
+		c, err := ListenPacket(tt.network, tt.laddr)
+		if tt.dgram && runtime.GOOS != "linux" {
+			if err == nil {
+				c.Close()
+				t.Errorf("ListenPacket(%q) succeeded on %s", tt.network, runtime.GOOS)
+			}
+			continue
+		}
+		if tt.dgram && socketError(err) {
+			t.Logf("skipping %s test: %v", tt.network, err)
+			continue
+		}
+		if err != nil {
+			t.Errorf("ListenPacket(%q, %q): %v", tt.network, tt.laddr, err)
+			continue
+		}
+		ping(t, c, tt.raddr)
+		c.Close()
+	}
+}
+
+func ping(t *testing.T, c *PacketConn, raddr string) {
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	typ, reply := TypeEchoRequest, TypeEchoReply
+	if c.Protocol() == ProtocolIPv6ICMP {
+		typ, reply = TypeV6EchoRequest, TypeV6EchoReply
+	}
+	id := os.Getpid() & 0xffff
+	echo := &Echo{ID: id, Seq: 1, Data: []byte("Go Go Gadget Ping!!!")}
+	dst := &net.IPAddr{IP: net.ParseIP(raddr)}
+	if err := c.WriteMessage(&Message{Protocol: c.Protocol(), Type: typ, Body: echo}, dst); err != nil {
+		t.Errorf("WriteMessage: %v", err)
+		return
+	}
+	for {
+		m, addr, err := c.ReadMessage()
+		if err != nil {
+			t.Errorf("ReadMessage: %v", err)
+			return
+		}
+		// A raw socket also sees the request itself, and
+		// other traffic.
+		if m.Type != reply {
+			continue
+		}
+		e, ok := m.Body.(*Echo)
+		if !ok {
+			t.Errorf("echo reply body is %T", m.Body)
+			return
+		}
+		if _, ok := c.c.(*net.IPConn); ok && e.ID != id {
+			continue
+		}
+		if e.Seq != echo.Seq || !bytes.Equal(e.Data, echo.Data) {
+			t.Errorf("reply %+v; want %+v", e, echo)
+		}
+		if a, ok := addr.(*net.IPAddr); !ok || !a.IP.Equal(dst.IP) {
+			t.Errorf("reply from %v; want %v", addr, dst)
+		}
+		return
+	}
+}
+
+func supportsIPv6() bool {
+	ln, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		return false
+	}
+	ln.Close()
+	return true
+}
@@ -0,0 +1,216 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package icmp implements the ICMP message formats of RFC 792 (ICMP
+// for IPv4) and RFC 4443 (ICMPv6), and listeners for exchanging
+// those messages.
+//
+// On Linux, ListenPacket can open an unprivileged datagram ICMP
+// socket, the kind used by ping(8), so that a program can send echo
+// requests without root privileges.  The system administrator
+// decides which groups may do so through the
+// net.ipv4.ping_group_range sysctl.
+package icmp
+
+import (
+	"errors"
+	"net"
+)
+
+// Protocol numbers of ICMP, for use as Message.Protocol.
+const (
+	ProtocolICMP     = 1  // ICMP for IPv4
+	ProtocolIPv6ICMP = 58 // ICMP for IPv6
+)
+
+// A Type is an ICMP message type.  The same number means different
+// things in ICMP and ICMPv6.
+type Type int
+
+// ICMP message types.
+const (
+	TypeEchoReply              Type = 0
+	TypeDestinationUnreachable Type = 3
+	TypeEchoRequest            Type = 8
+	TypeTimeExceeded           Type = 11
+	TypeParameterProblem       Type = 12
+)
+
+// ICMPv6 message types.
+const (
+	TypeV6DestinationUnreachable Type = 1
+	TypeV6PacketTooBig           Type = 2
+	TypeV6TimeExceeded           Type = 3
+	TypeV6ParameterProblem       Type = 4
+	TypeV6EchoRequest            Type = 128
+	TypeV6EchoReply              Type = 129
+)
+
+const headerLen = 4 // type, code and checksum
+
+var (
+	errShort            = errors.New("icmp: message too short")
+	errNoBody           = errors.New("icmp: message has no body")
+	errUnknownProtocol  = errors.New("icmp: unknown protocol")
+	errPointer          = errors.New("icmp: parameter problem pointer out of range")
+	errProtocolMismatch = errors.New("icmp: message protocol does not match connection")
+)
+
+// A Message is an ICMP or ICMPv6 message.
+type Message struct {
+	// Protocol is ProtocolICMP or ProtocolIPv6ICMP.  Zero means
+	// ProtocolICMP.
+	Protocol int
+
+	Type     Type
+	Code     int
+	Checksum int // set by ParseMessage; computed by Marshal
+	Body     Body
+}
+
+func (m *Message) proto() int {
+	if m.Protocol == 0 {
+		return ProtocolICMP
+	}
+	return m.Protocol
+}
+
+// Marshal returns the wire format of m, with its checksum.
+//
+// An ICMPv6 checksum covers a pseudo header holding the source and
+// destination addresses, which psh, as returned by IPv6PseudoHeader,
+// supplies.  If psh is nil the checksum is left zero; the kernel
+// fills it in for messages sent on an ICMPv6 socket.  psh is ignored
+// for ICMP messages.
+func (m *Message) Marshal(psh []byte) ([]byte, error) {
+	proto := m.proto()
+	if proto != ProtocolICMP && proto != ProtocolIPv6ICMP {
+		return nil, errUnknownProtocol
+	}
+	if m.Body == nil {
+		return nil, errNoBody
+	}
+	body, err := m.Body.Marshal(proto)
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, headerLen+len(body))
+	b[0] = byte(m.Type)
+	b[1] = byte(m.Code)
+	copy(b[headerLen:], body)
+	if proto == ProtocolICMP {
+		psh = nil
+	} else if psh == nil {
+		return b, nil
+	}
+	s := checksum(psh, b)
+	b[2], b[3] = byte(s>>8), byte(s)
+	return b, nil
+}
+
+// ParseMessage parses b as an ICMP message of protocol proto,
+// ProtocolICMP or ProtocolIPv6ICMP.  b must not include an IP
+// header.  The checksum is returned in the message but not verified;
+// see VerifyChecksum.
+func ParseMessage(proto int, b []byte) (*Message, error) {
+	if len(b) < headerLen {
+		return nil, errShort
+	}
+	m := &Message{
+		Protocol: proto,
+		Type:     Type(b[0]),
+		Code:     int(b[1]),
+		Checksum: int(b[2])<<8 | int(b[3]),
+	}
+	var err error
+	b = b[headerLen:]
+	switch proto {
+	case ProtocolICMP:
+		switch m.Type {
+		case TypeEchoRequest, TypeEchoReply:
+			m.Body, err = parseEcho(b)
+		case TypeDestinationUnreachable:
+			m.Body, err = parseDstUnreach(b)
+		case TypeTimeExceeded:
+			m.Body, err = parseTimeExceeded(b)
+		case TypeParameterProblem:
+			m.Body, err = parseParamProb(proto, b)
+		default:
+			m.Body = &RawBody{Data: append([]byte(nil), b...)}
+		}
+	case ProtocolIPv6ICMP:
+		switch m.Type {
+		case TypeV6EchoRequest, TypeV6EchoReply:
+			m.Body, err = parseEcho(b)
+		case TypeV6DestinationUnreachable:
+			m.Body, err = parseDstUnreach(b)
+		case TypeV6PacketTooBig:
+			m.Body, err = parsePacketTooBig(b)
+		case TypeV6TimeExceeded:
+			m.Body, err = parseTimeExceeded(b)
+		case TypeV6ParameterProblem:
+			m.Body, err = parseParamProb(proto, b)
+		default:
+			m.Body = &RawBody{Data: append([]byte(nil), b...)}
+		}
+	default:
+		return nil, errUnknownProtocol
+	}
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// VerifyChecksum reports whether the marshaled message b carries a
+// correct checksum.  For ICMPv6, psh is the pseudo header as for
+// Message.Marshal; for ICMP it is nil.
+func VerifyChecksum(psh, b []byte) bool {
+	if len(b) < headerLen {
+		return false
+	}
+	return checksum(psh, b) == 0
+}
+
+// IPv6PseudoHeader returns the pseudo header used in computing the
+// checksum of an ICMPv6 message sent from src to dst, as described
+// in RFC 2460, section 8.1.
+func IPv6PseudoHeader(src, dst net.IP) []byte {
+	b := make([]byte, 2*net.IPv6len+8)
+	copy(b, src.To16())
+	copy(b[net.IPv6len:], dst.To16())
+	b[len(b)-1] = ProtocolIPv6ICMP
+	return b
+}
+
+// checksum returns the Internet checksum, as defined in RFC 1071,
+// of the message b preceded by the pseudo header psh, if any.  Over
+// a message that holds its correct checksum, the result is zero.
+func checksum(psh, b []byte) uint16 {
+	if psh != nil {
+		// The pseudo header ends with the upper-layer packet
+		// length and the next header value.
+		p := make([]byte, len(psh), len(psh)+len(b))
+		copy(p, psh)
+		if len(p) >= 8 {
+			l := len(b)
+			p[len(p)-8] = byte(l >> 24)
+			p[len(p)-7] = byte(l >> 16)
+			p[len(p)-6] = byte(l >> 8)
+			p[len(p)-5] = byte(l)
+		}
+		b = append(p, b...)
+	}
+	var s uint32
+	n := len(b)
+	for i := 0; i < n-1; i += 2 {
+		s += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if n&1 == 1 {
+		s += uint32(b[n-1]) << 8
+	}
+	s = s>>16 + s&0xffff
+	s = s + s>>16
+	return ^uint16(s)
+}
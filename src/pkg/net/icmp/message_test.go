@@ -0,0 +1,177 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package icmp
+
+import (
+	"bytes"
+	"net"
+	"reflect"
+	"testing"
+)
+
+var marshalTests = []struct {
+	m    *Message
+	wire []byte // with a zero checksum
+}{
+	{
+		&Message{Type: TypeEchoRequest, Body: &Echo{ID: 0x1234, Seq: 1, Data: []byte("ping")}},
+		[]byte{8, 0, 0, 0, 0x12, 0x34, 0, 1, 'p', 'i', 'n', 'g'},
+	},
+	{
+		&Message{Type: TypeDestinationUnreachable, Code: 3, Body: &DstUnreach{Data: []byte{0x45, 0}}},
+		[]byte{3, 3, 0, 0, 0, 0, 0, 0, 0x45, 0},
+	},
+	{
+		&Message{Type: TypeTimeExceeded, Body: &TimeExceeded{Data: []byte{0x45, 0}}},
+		[]byte{11, 0, 0, 0, 0, 0, 0, 0, 0x45, 0},
+	},
+	{
+		&Message{Type: TypeParameterProblem, Body: &ParamProb{Pointer: 9, Data: []byte{0x45, 0}}},
+		[]byte{12, 0, 0, 0, 9, 0, 0, 0, 0x45, 0},
+	},
+	{
+		&Message{Type: 13, Body: &RawBody{Data: []byte{1, 2, 3}}},
+		[]byte{13, 0, 0, 0, 1, 2, 3},
+	},
+	{
+		&Message{Protocol: ProtocolIPv6ICMP, Type: TypeV6EchoReply, Body: &Echo{ID: 7, Seq: 0xfffe, Data: []byte{'a'}}},
+		[]byte{129, 0, 0, 0, 0, 7, 0xff, 0xfe, 'a'},
+	},
+	{
+		&Message{Protocol: ProtocolIPv6ICMP, Type: TypeV6PacketTooBig, Body: &PacketTooBig{MTU: 1280, Data: []byte{0x60}}},
+		[]byte{2, 0, 0, 0, 0, 0, 5, 0, 0x60},
+	},
+	{
+		&Message{Protocol: ProtocolIPv6ICMP, Type: TypeV6ParameterProblem, Code: 1, Body: &ParamProb{Pointer: 0x10203, Data: []byte{0x60}}},
+		[]byte{4, 1, 0, 0, 0, 1, 2, 3, 0x60},
+	},
+	{
+		&Message{Protocol: ProtocolIPv6ICMP, Type: TypeV6DestinationUnreachable, Code: 4, Body: &DstUnreach{Data: []byte{0x60}}},
+		[]byte{1, 4, 0, 0, 0, 0, 0, 0, 0x60},
+	},
+	{
+		&Message{Protocol: ProtocolIPv6ICMP, Type: TypeV6TimeExceeded, Body: &TimeExceeded{Data: []byte{0x60}}},
+		[]byte{3, 0, 0, 0, 0, 0, 0, 0, 0x60},
+	},
+}
+
+func TestMarshalAndParse(t *testing.T) {
+	psh := IPv6PseudoHeader(net.ParseIP("fe80::1"), net.ParseIP("ff02::1"))
+	for i, tt := range marshalTests {
+		var p []byte
+		if tt.m.Protocol == ProtocolIPv6ICMP {
+			p = psh
+		}
+		b, err := tt.m.Marshal(p)
+		if err != nil {
+			t.Errorf("#%d: Marshal: %v", i, err)
+			continue
+		}
+		if !VerifyChecksum(p, b) {
+			t.Errorf("#%d: bad checksum in % x", i, b)
+		}
+		if n := headerLen + tt.m.Body.Len(tt.m.proto()); n != len(b) {
+			t.Errorf("#%d: Len = %d; marshaled %d bytes", i, n-headerLen, len(b)-headerLen)
+		}
+		b[2], b[3] = 0, 0
+		if !bytes.Equal(b, tt.wire) {
+			t.Errorf("#%d: Marshal = % x; want % x", i, b, tt.wire)
+		}
+
+		m, err := ParseMessage(tt.m.proto(), tt.wire)
+		if err != nil {
+			t.Errorf("#%d: ParseMessage: %v", i, err)
+			continue
+		}
+		want := *tt.m
+		want.Protocol = tt.m.proto()
+		if !reflect.DeepEqual(m.Body, want.Body) || m.Type != want.Type || m.Code != want.Code || m.Protocol != want.Protocol {
+			t.Errorf("#%d: ParseMessage = %+v, %+v; want %+v, %+v", i, m, m.Body, want, want.Body)
+		}
+		if m.Checksum != 0 {
+			t.Errorf("#%d: Checksum = %#x; want 0", i, m.Checksum)
+		}
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	// An echo request sent by ping(8).
+	b := []byte{
+		0x08, 0x00, 0xf7, 0xfc, 0x00, 0x01, 0x00, 0x02,
+		0x00, 0x00, 0x00, 0x00,
+	}
+	if !VerifyChecksum(nil, b) {
+		t.Errorf("checksum of % x not verified", b)
+	}
+	m, err := ParseMessage(ProtocolICMP, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Checksum != 0xf7fc {
+		t.Errorf("Checksum = %#x; want 0xf7fc", m.Checksum)
+	}
+	b[7]++
+	if VerifyChecksum(nil, b) {
+		t.Errorf("checksum of % x verified", b)
+	}
+
+	// Odd lengths are padded with a zero byte.
+	m = &Message{Type: TypeEchoRequest, Body: &Echo{Data: []byte{1}}}
+	if b, err = m.Marshal(nil); err != nil {
+		t.Fatal(err)
+	}
+	if sum := int(b[2])<<8 | int(b[3]); sum != 0xf6ff {
+		t.Errorf("checksum = %#x; want 0xf6ff", sum)
+	}
+
+	// Without a pseudo header, the ICMPv6 checksum is left to the
+	// kernel.
+	m = &Message{Protocol: ProtocolIPv6ICMP, Type: TypeV6EchoRequest, Body: &Echo{ID: 1}}
+	if b, err = m.Marshal(nil); err != nil {
+		t.Fatal(err)
+	}
+	if b[2] != 0 || b[3] != 0 {
+		t.Errorf("ICMPv6 checksum without pseudo header = % x", b[2:4])
+	}
+}
+
+var parseErrorTests = []struct {
+	proto int
+	b     []byte
+	err   error
+}{
+	{ProtocolICMP, []byte{8, 0, 0}, errShort},
+	{ProtocolICMP, []byte{8, 0, 0, 0, 0, 1, 0}, errShort},
+	{ProtocolICMP, []byte{3, 0, 0, 0, 0}, errShort},
+	{ProtocolIPv6ICMP, []byte{2, 0, 0, 0, 0, 0, 5}, errShort},
+	{ProtocolIPv6ICMP, []byte{4, 0, 0, 0}, errShort},
+	{17, []byte{8, 0, 0, 0, 0, 0, 0, 0}, errUnknownProtocol},
+}
+
+func TestParseErrors(t *testing.T) {
+	for i, tt := range parseErrorTests {
+		if _, err := ParseMessage(tt.proto, tt.b); err != tt.err {
+			t.Errorf("#%d: got %v; want %v", i, err, tt.err)
+		}
+	}
+}
+
+var marshalErrorTests = []struct {
+	m   *Message
+	err error
+}{
+	{&Message{Type: TypeEchoRequest}, errNoBody},
+	{&Message{Protocol: 17, Body: &RawBody{}}, errUnknownProtocol},
+	{&Message{Type: TypeParameterProblem, Body: &ParamProb{Pointer: 256}}, errPointer},
+	{&Message{Protocol: ProtocolIPv6ICMP, Type: TypeV6ParameterProblem, Body: &ParamProb{Pointer: -1}}, errPointer},
+}
+
+func TestMarshalErrors(t *testing.T) {
+	for i, tt := range marshalErrorTests {
+		if _, err := tt.m.Marshal(nil); err != tt.err {
+			t.Errorf("#%d: got %v; want %v", i, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Network interface change notification
+
+package net
+
+import "sync"
+
+// An InterfaceEvent describes a change to the system's network
+// interfaces, addresses or routes.  It is a *LinkEvent, *AddrEvent
+// or *RouteEvent.
+type InterfaceEvent interface {
+	interfaceEvent()
+}
+
+// A LinkEvent reports that a network interface appeared, changed its
+// state, or disappeared.
+type LinkEvent struct {
+	Interface Interface // the interface after the change
+	Deleted   bool      // whether the interface disappeared
+}
+
+// An AddrEvent reports that an address was added to or removed from
+// a network interface.
+type AddrEvent struct {
+	IfIndex int    // index of the interface
+	Addr    *IPNet // the address and its network mask
+	Deleted bool   // whether the address was removed
+}
+
+// A RouteEvent reports that a route was added to or removed from a
+// routing table.
+type RouteEvent struct {
+	Route   Route
+	Deleted bool // whether the route was removed
+}
+
+func (*LinkEvent) interfaceEvent()  {}
+func (*AddrEvent) interfaceEvent()  {}
+func (*RouteEvent) interfaceEvent() {}
+
+// An InterfaceWatcher delivers the changes to the system's network
+// interfaces, addresses and routes as they happen.
+type InterfaceWatcher struct {
+	// Events delivers the changes in the order they happen.  It
+	// is closed when the watcher is closed or fails; Err then
+	// reports why.
+	Events <-chan InterfaceEvent
+
+	fd   *netFD
+	done chan bool // closed by Close
+
+	mu     sync.Mutex
+	closed bool
+	err    error
+}
+
+// Close stops the watcher and closes its Events channel.
+func (w *InterfaceWatcher) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return errClosing
+	}
+	w.closed = true
+	close(w.done)
+	w.mu.Unlock()
+	return w.fd.Close()
+}
+
+// Err returns the error that stopped the watcher, or nil if it is
+// running or was stopped by Close.  If the watcher fell behind and
+// the system dropped events, the error says so; the caller should
+// take a fresh snapshot with Interfaces, InterfaceAddrs and Routes,
+// and watch again.
+func (w *InterfaceWatcher) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// fail records err as the reason the watcher stopped, unless it was
+// closed.
+func (w *InterfaceWatcher) fail(err error) {
+	w.mu.Lock()
+	if !w.closed {
+		w.err = err
+	}
+	w.mu.Unlock()
+}
@@ -0,0 +1,148 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Network interface change notification for Linux
+
+package net
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// Multicast groups of rtnetlink notifications, from
+// <linux/rtnetlink.h>.
+const (
+	rtmgrpLink       = 0x1
+	rtmgrpIPv4Ifaddr = 0x10
+	rtmgrpIPv4Route  = 0x40
+	rtmgrpIPv6Ifaddr = 0x100
+	rtmgrpIPv6Route  = 0x400
+)
+
+// WatchInterfaces returns a watcher that delivers the changes to the
+// system's network interfaces, addresses and routes from now on.  It
+// is only implemented on Linux.
+func WatchInterfaces() (*InterfaceWatcher, error) {
+	// See ../syscall/exec_unix.go for description of ForkLock.
+	syscall.ForkLock.RLock()
+	s, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, syscall.NETLINK_ROUTE)
+	if err == nil {
+		syscall.CloseOnExec(s)
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	sa := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: rtmgrpLink | rtmgrpIPv4Ifaddr | rtmgrpIPv4Route | rtmgrpIPv6Ifaddr | rtmgrpIPv6Route,
+	}
+	if err := syscall.Bind(s, sa); err != nil {
+		closesocket(s)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	fd, err := newFD(s, syscall.AF_NETLINK, syscall.SOCK_RAW, "netlink")
+	if err != nil {
+		closesocket(s)
+		return nil, err
+	}
+	fd.setAddr(nil, nil)
+	c := make(chan InterfaceEvent, 16)
+	w := &InterfaceWatcher{Events: c, fd: fd, done: make(chan bool)}
+	go w.run(c)
+	return w, nil
+}
+
+func (w *InterfaceWatcher) run(c chan<- InterfaceEvent) {
+	defer close(c)
+	b := make([]byte, 16<<10)
+	for {
+		n, sa, err := w.fd.ReadFrom(b)
+		if err != nil {
+			w.fail(err)
+			return
+		}
+		// Only the kernel sends notifications.
+		if sa, ok := sa.(*syscall.SockaddrNetlink); !ok || sa.Pid != 0 {
+			continue
+		}
+		// The events refer to the message data, so each read
+		// gets its own copy.
+		msgs, err := syscall.ParseNetlinkMessage(append([]byte(nil), b[:n]...))
+		if err != nil {
+			w.fail(os.NewSyscallError("netlink message", err))
+			return
+		}
+		for i := range msgs {
+			ev, err := newInterfaceEvent(&msgs[i])
+			if err != nil {
+				w.fail(err)
+				return
+			}
+			if ev == nil {
+				continue
+			}
+			select {
+			case c <- ev:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// newInterfaceEvent returns the event a notification message
+// describes, or nil if it describes none.
+func newInterfaceEvent(m *syscall.NetlinkMessage) (InterfaceEvent, error) {
+	var size int
+	switch m.Header.Type {
+	case syscall.RTM_NEWLINK, syscall.RTM_DELLINK:
+		size = syscall.SizeofIfInfomsg
+	case syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+		size = syscall.SizeofIfAddrmsg
+	case syscall.RTM_NEWROUTE, syscall.RTM_DELROUTE:
+		size = syscall.SizeofRtMsg
+	default:
+		return nil, nil
+	}
+	if len(m.Data) < size {
+		return nil, nil
+	}
+	attrs, err := syscall.ParseNetlinkRouteAttr(m)
+	if err != nil {
+		return nil, os.NewSyscallError("netlink routeattr", err)
+	}
+	switch m.Header.Type {
+	case syscall.RTM_NEWLINK, syscall.RTM_DELLINK:
+		ifim := (*syscall.IfInfomsg)(unsafe.Pointer(&m.Data[0]))
+		return &LinkEvent{
+			Interface: newLink(ifim, attrs),
+			Deleted:   m.Header.Type == syscall.RTM_DELLINK,
+		}, nil
+	case syscall.RTM_NEWADDR, syscall.RTM_DELADDR:
+		ifam := (*syscall.IfAddrmsg)(unsafe.Pointer(&m.Data[0]))
+		ifa := newAddr(attrs, int(ifam.Family), int(ifam.Prefixlen)).(*IPNet)
+		if ifa.IP == nil {
+			return nil, nil
+		}
+		return &AddrEvent{
+			IfIndex: int(ifam.Index),
+			Addr:    ifa,
+			Deleted: m.Header.Type == syscall.RTM_DELADDR,
+		}, nil
+	default:
+		rtm := (*syscall.RtMsg)(unsafe.Pointer(&m.Data[0]))
+		if rtm.Flags&syscall.RTM_F_CLONED != 0 {
+			return nil, nil
+		}
+		r := newRoute(rtm, attrs)
+		if r == nil {
+			return nil, nil
+		}
+		return &RouteEvent{Route: *r, Deleted: m.Header.Type == syscall.RTM_DELROUTE}, nil
+	}
+	panic("unreachable")
+}
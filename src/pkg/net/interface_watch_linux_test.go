@@ -0,0 +1,114 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// netlinkMessage returns a netlink message of type typ whose data is
+// the fixed header hdr followed by the route attributes attrs, given
+// as type and value pairs.
+func netlinkMessage(typ int, hdr []byte, attrs ...interface{}) []byte {
+	b := make([]byte, syscall.NLMSG_HDRLEN)
+	b = append(b, hdr...)
+	for i := 0; i < len(attrs); i += 2 {
+		v := attrs[i+1].([]byte)
+		a := make([]byte, syscall.SizeofRtAttr+(len(v)+3)&^3)
+		rta := (*syscall.RtAttr)(unsafe.Pointer(&a[0]))
+		rta.Len = uint16(syscall.SizeofRtAttr + len(v))
+		rta.Type = uint16(attrs[i].(int))
+		copy(a[syscall.SizeofRtAttr:], v)
+		b = append(b, a...)
+	}
+	h := (*syscall.NlMsghdr)(unsafe.Pointer(&b[0]))
+	h.Len = uint32(len(b))
+	h.Type = uint16(typ)
+	return b
+}
+
+func nativeUint32(v uint32) []byte {
+	b := make([]byte, 4)
+	*(*uint32)(unsafe.Pointer(&b[0])) = v
+	return b
+}
+
+func parseEvent(t *testing.T, b []byte) InterfaceEvent {
+	msgs, err := syscall.ParseNetlinkMessage(b)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("ParseNetlinkMessage = %v, %v", msgs, err)
+	}
+	ev, err := newInterfaceEvent(&msgs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ev
+}
+
+func TestInterfaceEvents(t *testing.T) {
+	ifim := make([]byte, syscall.SizeofIfInfomsg)
+	(*syscall.IfInfomsg)(unsafe.Pointer(&ifim[0])).Index = 3
+	(*syscall.IfInfomsg)(unsafe.Pointer(&ifim[0])).Flags = syscall.IFF_UP | syscall.IFF_MULTICAST
+	ev := parseEvent(t, netlinkMessage(syscall.RTM_NEWLINK, ifim,
+		syscall.IFLA_IFNAME, []byte("eth7\x00"),
+		syscall.IFLA_MTU, nativeUint32(9000)))
+	le, ok := ev.(*LinkEvent)
+	if !ok || le.Deleted || le.Interface.Index != 3 || le.Interface.Name != "eth7" || le.Interface.MTU != 9000 || le.Interface.Flags != FlagUp|FlagMulticast {
+		t.Errorf("link event = %#v", ev)
+	}
+
+	ifam := []byte{syscall.AF_INET6, 64, 0, 0, 0, 0, 0, 0}
+	(*syscall.IfAddrmsg)(unsafe.Pointer(&ifam[0])).Index = 3
+	ev = parseEvent(t, netlinkMessage(syscall.RTM_DELADDR, ifam,
+		syscall.IFA_ADDRESS, []byte(ParseIP("2001:db8::7"))))
+	ae, ok := ev.(*AddrEvent)
+	if !ok || !ae.Deleted || ae.IfIndex != 3 || ae.Addr.String() != "2001:db8::7/64" {
+		t.Errorf("address event = %#v", ev)
+	}
+
+	rtm := []byte{syscall.AF_INET, 24, 0, 0, syscall.RT_TABLE_MAIN, 0, 0, routeUnicast, 0, 0, 0, 0}
+	ev = parseEvent(t, netlinkMessage(syscall.RTM_NEWROUTE, rtm,
+		syscall.RTA_DST, []byte{192, 0, 2, 0},
+		syscall.RTA_GATEWAY, []byte{198, 51, 100, 1},
+		syscall.RTA_OIF, nativeUint32(3),
+		syscall.RTA_PRIORITY, nativeUint32(100)))
+	re, ok := ev.(*RouteEvent)
+	if !ok || re.Deleted || re.Route.Dst.String() != "192.0.2.0/24" || !re.Route.Gateway.Equal(IPv4(198, 51, 100, 1)) ||
+		re.Route.IfIndex != 3 || re.Route.Metric != 100 || re.Route.Table != syscall.RT_TABLE_MAIN {
+		t.Errorf("route event = %#v", ev)
+	}
+
+	if ev = parseEvent(t, netlinkMessage(syscall.RTM_NEWNEIGH, make([]byte, 12))); ev != nil {
+		t.Errorf("neighbor message gave event %#v", ev)
+	}
+}
+
+func TestWatchInterfacesClose(t *testing.T) {
+	w, err := WatchInterfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-w.Events:
+		// Events racing with Close may still be delivered.
+		for ok {
+			_, ok = <-w.Events
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Events not closed")
+	}
+	if err := w.Err(); err != nil {
+		t.Errorf("Err after Close = %v", err)
+	}
+	if err := w.Close(); err == nil {
+		t.Error("second Close succeeded")
+	}
+}
@@ -0,0 +1,16 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin freebsd netbsd openbsd plan9 windows
+
+package net
+
+import "errors"
+
+// WatchInterfaces returns a watcher that delivers the changes to the
+// system's network interfaces, addresses and routes.  It is only
+// implemented on Linux.
+func WatchInterfaces() (*InterfaceWatcher, error) {
+	return nil, errors.New("net: interface watching not supported")
+}
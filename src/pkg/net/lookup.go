@@ -5,6 +5,7 @@
 package net
 
 import (
+	"sync"
 	"time"
 )
 
@@ -57,6 +58,36 @@ func LookupIP(host string) (addrs []IP, err error) {
 	return lookupIP(host)
 }
 
+// lookupIPDeadline is like lookupHostDeadline but for lookupIP.
+func lookupIPDeadline(host string, deadline time.Time) (addrs []IP, err error) {
+	if deadline.IsZero() {
+		return lookupIP(host)
+	}
+	timeout := deadline.Sub(time.Now())
+	if timeout <= 0 {
+		err = errTimeout
+		return
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	type res struct {
+		addrs []IP
+		err   error
+	}
+	resc := make(chan res, 1)
+	go func() {
+		a, err := lookupIP(host)
+		resc <- res{a, err}
+	}()
+	select {
+	case <-t.C:
+		err = errTimeout
+	case r := <-resc:
+		addrs, err = r.addrs, r.err
+	}
+	return
+}
+
 // LookupPort looks up the port for the given network and service.
 func LookupPort(network, service string) (port int, err error) {
 	return lookupPort(network, service)
@@ -103,3 +134,73 @@ func LookupTXT(name string) (txt []string, err error) {
 func LookupAddr(addr string) (name []string, err error) {
 	return lookupAddr(addr)
 }
+
+// A Resolver looks up names by querying DNS servers directly, without
+// consulting /etc/hosts or the C library.  Its zero value uses the
+// servers and options of /etc/resolv.conf, like the pure Go lookups
+// of the package functions.
+//
+// A Resolver caches the answers it receives for as long as their
+// time to live allows.  It is safe for concurrent use by multiple
+// goroutines; its fields should not be changed once it is in use.
+//
+// On Windows and Plan 9, where the package does not query DNS
+// servers itself, the methods of a Resolver return an error.
+type Resolver struct {
+	// Servers lists the addresses of the DNS servers to query,
+	// in order.  Each is an IP address, optionally with a port
+	// as in "192.0.2.1:5353" or "[2001:db8::1]:53"; the default
+	// port is 53.  If empty, the servers in /etc/resolv.conf
+	// are used.
+	Servers []string
+
+	// Timeout is how long to wait for the answer to a query
+	// before sending it again.  If zero, the timeout in
+	// /etc/resolv.conf is used.
+	Timeout time.Duration
+
+	// Attempts is the number of times a query is sent to each
+	// server before trying the next.  If zero, the number in
+	// /etc/resolv.conf is used.
+	Attempts int
+
+	// CacheSize is the maximum number of answers kept in the
+	// cache.  If zero, DefaultResolverCacheSize is used; if
+	// negative, answers are not cached.
+	CacheSize int
+
+	mu    sync.Mutex
+	cache map[dnsCacheKey]*dnsCacheEntry
+}
+
+// DefaultResolverCacheSize is the default value of Resolver.CacheSize.
+const DefaultResolverCacheSize = 512
+
+type dnsCacheKey struct {
+	name  string
+	qtype uint16
+}
+
+type dnsCacheEntry struct {
+	cname   string
+	addrs   []dnsRR
+	expires time.Time
+}
+
+// LookupHost looks up the given host, returning an array of its
+// IPv4 and IPv6 addresses.
+func (r *Resolver) LookupHost(host string) (addrs []string, err error) {
+	return r.lookupHost(host)
+}
+
+// LookupIP looks up the given host, returning an array of its IPv4
+// and IPv6 addresses.
+func (r *Resolver) LookupIP(host string) (addrs []IP, err error) {
+	return r.lookupIP(host)
+}
+
+// LookupSRV tries to resolve an SRV query of the given service,
+// protocol, and domain name, as the LookupSRV function does.
+func (r *Resolver) LookupSRV(service, proto, name string) (cname string, addrs []*SRV, err error) {
+	return r.lookupSRV(service, proto, name)
+}
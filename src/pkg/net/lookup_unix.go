@@ -85,24 +85,7 @@ func lookupCNAME(name string) (cname string, err error) {
 }
 
 func lookupSRV(service, proto, name string) (cname string, addrs []*SRV, err error) {
-	var target string
-	if service == "" && proto == "" {
-		target = name
-	} else {
-		target = "_" + service + "._" + proto + "." + name
-	}
-	var records []dnsRR
-	cname, records, err = lookup(target, dnsTypeSRV)
-	if err != nil {
-		return
-	}
-	addrs = make([]*SRV, len(records))
-	for i, rr := range records {
-		r := rr.(*dnsRR_SRV)
-		addrs[i] = &SRV{r.Target, r.Port, r.Priority, r.Weight}
-	}
-	byPriorityWeight(addrs).sort()
-	return
+	return defaultResolver.lookupSRV(service, proto, name)
 }
 
 func lookupMX(name string) (mx []*MX, err error) {
@@ -374,13 +374,24 @@ type writerOnly struct {
 	io.Writer
 }
 
-// Fallback implementation of io.ReaderFrom's ReadFrom, when sendfile isn't
-// applicable.
+// Fallback implementation of io.ReaderFrom's ReadFrom, when neither
+// sendfile nor splice is applicable.
 func genericReadFrom(w io.Writer, r io.Reader) (n int64, err error) {
 	// Use wrapper to hide existing r.ReadFrom from io.Copy.
 	return io.Copy(writerOnly{w}, r)
 }
 
+type readerOnly struct {
+	io.Reader
+}
+
+// Fallback implementation of io.WriterTo's WriteTo, when splice isn't
+// applicable.
+func genericWriteTo(r io.Reader, w io.Writer) (n int64, err error) {
+	// Use wrapper to hide existing r.WriteTo from io.Copy.
+	return io.Copy(w, readerOnly{r})
+}
+
 // deadline is an atomically-accessed number of nanoseconds since 1970
 // or 0, if no deadline is set.
 type deadline struct {
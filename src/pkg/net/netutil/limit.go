@@ -0,0 +1,84 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package netutil provides wrappers for net.Listener: one that limits
+// the number of simultaneous connections, and one that reads the
+// PROXY protocol header a load balancer sends ahead of each
+// connection it forwards.
+//
+// The wrappers are themselves net.Listeners, so they compose with
+// each other and with servers such as http.Server:
+//
+//	l, err := net.Listen("tcp", ":8080")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	l = netutil.ProxyListener(netutil.LimitListener(l, 1000), 5*time.Second)
+//	log.Fatal(http.Serve(l, nil))
+package netutil
+
+import (
+	"errors"
+	"net"
+	"sync"
+)
+
+var errClosed = errors.New("netutil: use of closed listener")
+
+// LimitListener returns a Listener that accepts at most n
+// simultaneous connections from l.  Once n of its connections are
+// open, Accept waits for one of them to be closed.  n must be
+// positive.
+func LimitListener(l net.Listener, n int) net.Listener {
+	return &limitListener{
+		Listener: l,
+		sem:      make(chan bool, n),
+		done:     make(chan bool),
+	}
+}
+
+type limitListener struct {
+	net.Listener
+	sem  chan bool // holds a value for each open connection
+	done chan bool // closed by Close
+
+	closeOnce sync.Once
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.sem <- true:
+	case <-l.done:
+		return nil, errClosed
+	}
+	c, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	return &limitConn{Conn: c, l: l}, nil
+}
+
+// Close closes the listener.  Any blocked Accept operations will be
+// unblocked and return errors; the connections it accepted stay open
+// and still count towards the limit until they are closed.
+func (l *limitListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// A limitConn gives up its place in the limit when it is first
+// closed.
+type limitConn struct {
+	net.Conn
+	l *limitListener
+
+	releaseOnce sync.Once
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.releaseOnce.Do(func() { <-c.l.sem })
+	return err
+}
@@ -0,0 +1,331 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// PROXY protocol, versions 1 and 2, as specified in
+// http://www.haproxy.org/download/1.5/doc/proxy-protocol.txt
+
+package netutil
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errProxyHeader = errors.New("netutil: invalid PROXY protocol header")
+
+// ProxyListener returns a Listener for connections forwarded by a
+// load balancer or proxy, such as HAProxy, that sends a PROXY
+// protocol header, in either the version 1 text form or the version 2
+// binary form, at the start of each connection.  The connections it
+// accepts report the client's original address as their RemoteAddr,
+// and the address the client connected to as their LocalAddr.  If
+// the header does not carry addresses, as for the proxy's own health
+// checks, they report the addresses of the underlying connection.
+//
+// The header is read in the background, so that a slow client does
+// not hold up Accept, and is not part of the data read from the
+// connection.  A connection whose header is malformed, or does not
+// arrive within timeout, is closed without being returned by Accept.
+// A timeout of zero means no limit.  Every connection must start with
+// a header, so l must accept connections only from trusted proxies.
+//
+// To limit the number of connections, pass ProxyListener a
+// LimitListener, so that the connections still sending their headers
+// count towards the limit.
+func ProxyListener(l net.Listener, timeout time.Duration) net.Listener {
+	pl := &proxyListener{
+		Listener: l,
+		timeout:  timeout,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error),
+		stopped:  make(chan bool),
+	}
+	go pl.run()
+	return pl
+}
+
+type proxyListener struct {
+	net.Listener
+	timeout time.Duration
+	conns   chan net.Conn // connections whose headers have been read
+	errs    chan error    // temporary errors from l's Accept
+	stopped chan bool     // closed once l's Accept fails for good
+	err     error         // the failure; set before stopped is closed
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.stopped:
+		return nil, l.err
+	}
+	panic("unreachable")
+}
+
+// run accepts the connections from the underlying listener and starts
+// reading their headers, until the listener fails or is closed.
+func (l *proxyListener) run() {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				l.errs <- err
+				continue
+			}
+			l.err = err
+			close(l.stopped)
+			return
+		}
+		go l.handshake(c)
+	}
+}
+
+func (l *proxyListener) handshake(c net.Conn) {
+	pc, err := newProxyConn(c, l.timeout)
+	if err != nil {
+		c.Close()
+		return
+	}
+	select {
+	case l.conns <- pc:
+	case <-l.stopped:
+		c.Close()
+	}
+}
+
+// A proxyConn is a connection whose PROXY protocol header has been
+// read.
+type proxyConn struct {
+	net.Conn
+	src, dst net.Addr // the addresses in the header, or nil
+
+	mu  sync.Mutex
+	buf []byte // data read past the header
+}
+
+// newProxyConn reads the PROXY protocol header from c.
+func newProxyConn(c net.Conn, timeout time.Duration) (*proxyConn, error) {
+	if timeout > 0 {
+		if err := c.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+			return nil, err
+		}
+	}
+	br := bufio.NewReaderSize(c, 256)
+	src, dst, err := readProxyHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		if err := c.SetReadDeadline(time.Time{}); err != nil {
+			return nil, err
+		}
+	}
+	pc := &proxyConn{Conn: c, src: src, dst: dst}
+	if n := br.Buffered(); n > 0 {
+		b, _ := br.Peek(n)
+		pc.buf = append([]byte(nil), b...)
+	}
+	return pc, nil
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	if len(c.buf) > 0 {
+		n := copy(b, c.buf)
+		c.buf = c.buf[n:]
+		c.mu.Unlock()
+		return n, nil
+	}
+	c.mu.Unlock()
+	return c.Conn.Read(b)
+}
+
+// RemoteAddr returns the address of the client that connected to the
+// proxy.
+func (c *proxyConn) RemoteAddr() net.Addr {
+	if c.src != nil {
+		return c.src
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the address the client connected to.
+func (c *proxyConn) LocalAddr() net.Addr {
+	if c.dst != nil {
+		return c.dst
+	}
+	return c.Conn.LocalAddr()
+}
+
+// proxySig2 starts a version 2 header.
+var proxySig2 = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// maxProxyHeader1 is the length of the longest version 1 header,
+// including the CRLF.
+const maxProxyHeader1 = 107
+
+// readProxyHeader reads a PROXY protocol header from br and returns
+// the source and destination addresses it carries, or nil addresses
+// if it carries none.
+func readProxyHeader(br *bufio.Reader) (src, dst net.Addr, err error) {
+	b, err := br.Peek(1)
+	if err != nil {
+		return nil, nil, err
+	}
+	if b[0] == proxySig2[0] {
+		return readProxyHeader2(br)
+	}
+	return readProxyHeader1(br)
+}
+
+// readProxyHeader1 reads a version 1 header, such as
+//	PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n
+func readProxyHeader1(br *bufio.Reader) (src, dst net.Addr, err error) {
+	line, err := br.ReadSlice('\n')
+	if err == bufio.ErrBufferFull || len(line) > maxProxyHeader1 {
+		return nil, nil, errProxyHeader
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, nil, errProxyHeader
+	}
+	f := strings.Split(string(line[:len(line)-2]), " ")
+	if len(f) < 2 || f[0] != "PROXY" {
+		return nil, nil, errProxyHeader
+	}
+	if f[1] == "UNKNOWN" {
+		// The proxy does not know the addresses, or cannot
+		// express them; the rest of the line is ignored.
+		return nil, nil, nil
+	}
+	if len(f) != 6 || f[1] != "TCP4" && f[1] != "TCP6" {
+		return nil, nil, errProxyHeader
+	}
+	srcIP, dstIP := parseProxyIP(f[1], f[2]), parseProxyIP(f[1], f[3])
+	srcPort, dstPort := parseProxyPort(f[4]), parseProxyPort(f[5])
+	if srcIP == nil || dstIP == nil || srcPort < 0 || dstPort < 0 {
+		return nil, nil, errProxyHeader
+	}
+	return &net.TCPAddr{IP: srcIP, Port: srcPort}, &net.TCPAddr{IP: dstIP, Port: dstPort}, nil
+}
+
+// parseProxyIP parses s as an address of the family named by proto,
+// TCP4 or TCP6.
+func parseProxyIP(proto, s string) net.IP {
+	ip := net.ParseIP(s)
+	if ip == nil || (proto == "TCP4") != (strings.Index(s, ":") < 0) {
+		return nil
+	}
+	return ip
+}
+
+// parseProxyPort parses s as a port number, which has no leading
+// zeros.  It returns -1 if s is not a valid port.
+func parseProxyPort(s string) int {
+	if len(s) > 1 && s[0] == '0' {
+		return -1
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || s[0] == '+' || s[0] == '-' || n > 65535 {
+		return -1
+	}
+	return n
+}
+
+// Version 2 commands, address families and transport protocols.
+const (
+	proxyLocal = 0x0
+	proxyProxy = 0x1
+
+	proxyAFUnspec = 0x0
+	proxyAFInet   = 0x1
+	proxyAFInet6  = 0x2
+	proxyAFUnix   = 0x3
+
+	proxyStream = 0x1
+	proxyDgram  = 0x2
+)
+
+// readProxyHeader2 reads a version 2 header: the 12-byte signature,
+// the version and command, the address family and transport
+// protocol, the big-endian length of the rest, and the rest, which
+// holds the addresses followed by optional type-length-value fields.
+func readProxyHeader2(br *bufio.Reader) (src, dst net.Addr, err error) {
+	hdr := make([]byte, 16)
+	if _, err := io.ReadFull(br, hdr); err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(hdr[:12], proxySig2) || hdr[12]>>4 != 2 {
+		return nil, nil, errProxyHeader
+	}
+	b := make([]byte, int(hdr[14])<<8|int(hdr[15]))
+	if _, err := io.ReadFull(br, b); err != nil {
+		return nil, nil, err
+	}
+	switch hdr[12] & 0xf {
+	case proxyLocal:
+		// A connection the proxy made on its own account; the
+		// addresses, if any, are ignored.
+		return nil, nil, nil
+	case proxyProxy:
+	default:
+		return nil, nil, errProxyHeader
+	}
+
+	family, proto := hdr[13]>>4, hdr[13]&0xf
+	if family == proxyAFUnspec || proto != proxyStream && proto != proxyDgram {
+		// Addresses the receiver is not expected to understand.
+		return nil, nil, nil
+	}
+	switch family {
+	case proxyAFInet, proxyAFInet6:
+		n := net.IPv4len
+		if family == proxyAFInet6 {
+			n = net.IPv6len
+		}
+		if len(b) < 2*n+4 {
+			return nil, nil, errProxyHeader
+		}
+		srcIP := net.IP(append([]byte(nil), b[:n]...))
+		dstIP := net.IP(append([]byte(nil), b[n:2*n]...))
+		srcPort := int(b[2*n])<<8 | int(b[2*n+1])
+		dstPort := int(b[2*n+2])<<8 | int(b[2*n+3])
+		if proto == proxyDgram {
+			return &net.UDPAddr{IP: srcIP, Port: srcPort}, &net.UDPAddr{IP: dstIP, Port: dstPort}, nil
+		}
+		return &net.TCPAddr{IP: srcIP, Port: srcPort}, &net.TCPAddr{IP: dstIP, Port: dstPort}, nil
+	case proxyAFUnix:
+		const n = 108 // sizeof(sun_path)
+		if len(b) < 2*n {
+			return nil, nil, errProxyHeader
+		}
+		network := "unix"
+		if proto == proxyDgram {
+			network = "unixgram"
+		}
+		return unixAddr(network, b[:n]), unixAddr(network, b[n:2*n]), nil
+	}
+	return nil, nil, errProxyHeader
+}
+
+// unixAddr returns the Unix domain socket address whose path is the
+// NUL-terminated b.
+func unixAddr(network string, b []byte) *net.UnixAddr {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return &net.UnixAddr{Name: string(b), Net: network}
+}
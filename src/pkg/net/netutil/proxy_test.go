@@ -0,0 +1,187 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netutil
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// proxyHeader2 returns a version 2 header with the given version and
+// command, address family and protocol, and body.
+func proxyHeader2(cmd, fam byte, body string) string {
+	return string(proxySig2) + string([]byte{cmd, fam, byte(len(body) >> 8), byte(len(body))}) + body
+}
+
+var unixPaths = "/var/run/src" + strings.Repeat("\x00", 108-12) + "/var/run/dst" + strings.Repeat("\x00", 108-12)
+
+var proxyHeaderTests = []struct {
+	in       string
+	src, dst string // network and address, or empty for none
+	ok       bool
+}{
+	// Version 1.
+	{"PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", "tcp 192.0.2.1:56324", "tcp 198.51.100.1:443", true},
+	{"PROXY TCP6 2001:db8::1 2001:db8::2 1 65535\r\n", "tcp [2001:db8::1]:1", "tcp [2001:db8::2]:65535", true},
+	{"PROXY UNKNOWN\r\n", "", "", true},
+	{"PROXY UNKNOWN ffff:f...f:ffff ffff:f...f:ffff 65535 65535\r\n", "", "", true},
+	{"PROXY TCP4 192.0.2.1 198.51.100.1 56324 443\n", "", "", false},
+	{"PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n", "", "", false},
+	{"PROXY TCP4 2001:db8::1 198.51.100.1 56324 443\r\n", "", "", false},
+	{"PROXY TCP6 192.0.2.1 2001:db8::2 56324 443\r\n", "", "", false},
+	{"PROXY TCP4 192.0.2.1 198.51.100.1 65536 443\r\n", "", "", false},
+	{"PROXY TCP4 192.0.2.1 198.51.100.1 056324 443\r\n", "", "", false},
+	{"PROXY TCP4 192.0.2.1 198.51.100.1 +56324 443\r\n", "", "", false},
+	{"PROXY UDP4 192.0.2.1 198.51.100.1 56324 443\r\n", "", "", false},
+	{"PROXY  TCP4 192.0.2.1 198.51.100.1 56324 443\r\n", "", "", false},
+	{"GET / HTTP/1.1\r\n", "", "", false},
+	{"PROXY UNKNOWN " + strings.Repeat("x", 92) + "\r\n", "", "", false},
+
+	// Version 2.
+	{proxyHeader2(0x21, 0x11, "\xc0\x00\x02\x01\xc6\x33\x64\x01\xdc\x04\x01\xbb"), "tcp 192.0.2.1:56324", "tcp 198.51.100.1:443", true},
+	{proxyHeader2(0x21, 0x12, "\xc0\x00\x02\x01\xc6\x33\x64\x01\x00\x35\x00\x35"), "udp 192.0.2.1:53", "udp 198.51.100.1:53", true},
+	{proxyHeader2(0x21, 0x21, "\x20\x01\x0d\xb8"+strings.Repeat("\x00", 11)+"\x01"+"\x20\x01\x0d\xb8"+strings.Repeat("\x00", 11)+"\x02"+"\x00\x01\xff\xff"), "tcp [2001:db8::1]:1", "tcp [2001:db8::2]:65535", true},
+	{proxyHeader2(0x21, 0x31, unixPaths), "unix /var/run/src", "unix /var/run/dst", true},
+	{proxyHeader2(0x21, 0x32, unixPaths), "unixgram /var/run/src", "unixgram /var/run/dst", true},
+	// Type-length-value fields follow the addresses.
+	{proxyHeader2(0x21, 0x11, "\xc0\x00\x02\x01\xc6\x33\x64\x01\xdc\x04\x01\xbb\x04\x00\x01\x00"), "tcp 192.0.2.1:56324", "tcp 198.51.100.1:443", true},
+	{proxyHeader2(0x20, 0x11, "\xc0\x00\x02\x01\xc6\x33\x64\x01\xdc\x04\x01\xbb"), "", "", true},
+	{proxyHeader2(0x20, 0x00, ""), "", "", true},
+	{proxyHeader2(0x21, 0x00, "\x01\x02"), "", "", true},
+	{proxyHeader2(0x21, 0x11, "\xc0\x00\x02\x01\xc6\x33\x64\x01\xdc\x04\x01"), "", "", false},
+	{proxyHeader2(0x21, 0x41, "\xc0\x00\x02\x01\xc6\x33\x64\x01\xdc\x04\x01\xbb"), "", "", false},
+	{proxyHeader2(0x22, 0x11, "\xc0\x00\x02\x01\xc6\x33\x64\x01\xdc\x04\x01\xbb"), "", "", false},
+	{proxyHeader2(0x11, 0x11, "\xc0\x00\x02\x01\xc6\x33\x64\x01\xdc\x04\x01\xbb"), "", "", false},
+	{"\r\n\r\n\x00\r\nQUIX\n\x21\x11\x00\x0c\xc0\x00\x02\x01\xc6\x33\x64\x01\xdc\x04\x01\xbb", "", "", false},
+	{string(proxySig2) + "\x21\x11\xff\xff\xc0\x00\x02\x01\xc6\x33\x64\x01\xdc\x04\x01\xbb", "", "", false},
+}
+
+func addrString(a net.Addr) string {
+	if a == nil {
+		return ""
+	}
+	return a.Network() + " " + a.String()
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	const data = "GET / HTTP/1.0\r\n\r\n"
+	for _, tt := range proxyHeaderTests {
+		br := bufio.NewReaderSize(strings.NewReader(tt.in+data), 256)
+		src, dst, err := readProxyHeader(br)
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("readProxyHeader(%q) succeeded", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("readProxyHeader(%q): %v", tt.in, err)
+			continue
+		}
+		if s, d := addrString(src), addrString(dst); s != tt.src || d != tt.dst {
+			t.Errorf("readProxyHeader(%q) = %q, %q; want %q, %q", tt.in, s, d, tt.src, tt.dst)
+		}
+		if b, _ := ioutil.ReadAll(br); string(b) != data {
+			t.Errorf("readProxyHeader(%q) left %q; want %q", tt.in, b, data)
+		}
+	}
+}
+
+func TestProxyListenerHTTP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go http.Serve(ProxyListener(ln, time.Second), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.RemoteAddr)
+	}))
+
+	// A client that never sends its header does not hold up the
+	// others.
+	stalled, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+
+	for _, tt := range []struct {
+		header, remote string
+	}{
+		{"PROXY TCP4 192.0.2.1 198.51.100.1 56324 80\r\n", "192.0.2.1:56324"},
+		{proxyHeader2(0x21, 0x21, "\x20\x01\x0d\xb8"+strings.Repeat("\x00", 11)+"\x01"+"\x20\x01\x0d\xb8"+strings.Repeat("\x00", 11)+"\x02"+"\x00\x01\x00\x50"), "[2001:db8::1]:1"},
+		{"PROXY UNKNOWN\r\n", "127.0.0.1:"},
+	} {
+		c, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Send the header and request together, as a proxy might.
+		if _, err := c.Write([]byte(tt.header + "GET / HTTP/1.0\r\n\r\n")); err != nil {
+			t.Fatal(err)
+		}
+		c.SetReadDeadline(time.Now().Add(5 * time.Second))
+		resp, err := http.ReadResponse(bufio.NewReader(c), &http.Request{Method: "GET"})
+		if err != nil {
+			t.Fatalf("%q: %v", tt.header, err)
+		}
+		b, err := ioutil.ReadAll(resp.Body)
+		c.Close()
+		if err != nil || !strings.HasPrefix(string(b), tt.remote) {
+			t.Errorf("%q: RemoteAddr %q, %v; want %q", tt.header, b, err, tt.remote)
+		}
+	}
+
+	// The stalled client is disconnected after the timeout.
+	stalled.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := stalled.Read(make([]byte, 1)); err == nil {
+		t.Error("stalled client got data")
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		t.Error("stalled client not disconnected")
+	}
+
+	// A client with a bad header is disconnected.
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Write([]byte("GET / HTTP/1.0\r\n\r\n"))
+	c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if b, err := ioutil.ReadAll(c); err != nil || len(b) != 0 {
+		t.Errorf("client without header read %q, %v; want disconnection", b, err)
+	}
+}
+
+func TestProxyListenerClose(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := ProxyListener(ln, 0)
+	errc := make(chan error)
+	go func() {
+		_, err := l.Accept()
+		errc <- err
+	}()
+	l.Close()
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("Accept after Close succeeded")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Accept not unblocked by Close")
+	}
+	if _, err := l.Accept(); err == nil {
+		t.Error("second Accept after Close succeeded")
+	}
+}
@@ -0,0 +1,23 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build plan9 windows
+
+package net
+
+import "errors"
+
+var errResolverNotSupported = errors.New("net: Resolver is not supported on this system")
+
+func (r *Resolver) lookupHost(host string) (addrs []string, err error) {
+	return nil, errResolverNotSupported
+}
+
+func (r *Resolver) lookupIP(host string) (addrs []IP, err error) {
+	return nil, errResolverNotSupported
+}
+
+func (r *Resolver) lookupSRV(service, proto, name string) (cname string, addrs []*SRV, err error) {
+	return "", nil, errResolverNotSupported
+}
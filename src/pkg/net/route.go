@@ -0,0 +1,62 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// IP routing table
+
+package net
+
+import "errors"
+
+var errNoRoute = errors.New("net: no route to host")
+
+// A Route is an entry in the system's IP routing table.
+type Route struct {
+	Dst     *IPNet // destination network; 0.0.0.0/0 or ::/0 for a default route
+	Gateway IP     // next hop, or nil for a directly attached network
+	Src     IP     // preferred source address, or nil
+	IfIndex int    // index of the outgoing interface
+	Metric  int    // preference among routes to Dst; lower is preferred
+	Table   int    // routing table holding the route
+
+	typ int // route type
+}
+
+// Route types, as Linux numbers them.
+const (
+	routeUnicast     = 1
+	routeLocal       = 2 // an address of this host
+	routeBlackhole   = 6
+	routeUnreachable = 7
+	routeProhibit    = 8
+	routeThrow       = 9 // go on to the next table
+)
+
+// Routes returns the unicast and local routes in the system's
+// routing tables.
+func Routes() ([]Route, error) {
+	rt, err := routeTable()
+	if err != nil {
+		return nil, err
+	}
+	var routes []Route
+	for _, r := range rt {
+		if r.typ == routeUnicast || r.typ == routeLocal {
+			routes = append(routes, r)
+		}
+	}
+	return routes, nil
+}
+
+// LookupRoute returns the route the system would use, by default,
+// to send a packet to ip.
+func LookupRoute(ip IP) (*Route, error) {
+	rt, err := routeTable()
+	if err != nil {
+		return nil, err
+	}
+	if r := lookupRoute(rt, ip); r != nil {
+		return r, nil
+	}
+	return nil, &OpError{Op: "route", Addr: &IPAddr{IP: ip}, Err: errNoRoute}
+}
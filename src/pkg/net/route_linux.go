@@ -0,0 +1,137 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// IP routing table for Linux
+
+package net
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// routeTable returns the routes in all of the system's routing
+// tables.
+func routeTable() ([]Route, error) {
+	tab, err := syscall.NetlinkRIB(syscall.RTM_GETROUTE, syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, os.NewSyscallError("netlink rib", err)
+	}
+
+	msgs, err := syscall.ParseNetlinkMessage(tab)
+	if err != nil {
+		return nil, os.NewSyscallError("netlink message", err)
+	}
+
+	var rt []Route
+	for _, m := range msgs {
+		switch m.Header.Type {
+		case syscall.NLMSG_DONE:
+			goto done
+		case syscall.RTM_NEWROUTE:
+			if len(m.Data) < syscall.SizeofRtMsg {
+				continue
+			}
+			rtm := (*syscall.RtMsg)(unsafe.Pointer(&m.Data[0]))
+			if rtm.Flags&syscall.RTM_F_CLONED != 0 {
+				continue // a routing cache entry
+			}
+			attrs, err := syscall.ParseNetlinkRouteAttr(&m)
+			if err != nil {
+				return nil, os.NewSyscallError("netlink routeattr", err)
+			}
+			if r := newRoute(rtm, attrs); r != nil {
+				rt = append(rt, *r)
+			}
+		}
+	}
+done:
+	return rt, nil
+}
+
+// newRoute returns the route described by a route message, or nil
+// if it is not an IPv4 or IPv6 route.
+func newRoute(rtm *syscall.RtMsg, attrs []syscall.NetlinkRouteAttr) *Route {
+	var iplen int
+	switch rtm.Family {
+	case syscall.AF_INET:
+		iplen = IPv4len
+	case syscall.AF_INET6:
+		iplen = IPv6len
+	default:
+		return nil
+	}
+	r := &Route{
+		Dst:   &IPNet{IP: make(IP, iplen), Mask: CIDRMask(int(rtm.Dst_len), 8*iplen)},
+		Table: int(rtm.Table),
+		typ:   int(rtm.Type),
+	}
+	ip := func(b []byte) IP {
+		if len(b) < iplen {
+			return nil
+		}
+		ip := make(IP, iplen)
+		copy(ip, b)
+		return ip
+	}
+	for _, a := range attrs {
+		switch a.Attr.Type {
+		case syscall.RTA_DST:
+			if dst := ip(a.Value); dst != nil {
+				r.Dst.IP = dst.Mask(r.Dst.Mask)
+			}
+		case syscall.RTA_GATEWAY:
+			r.Gateway = ip(a.Value)
+		case syscall.RTA_PREFSRC:
+			r.Src = ip(a.Value)
+		case syscall.RTA_OIF:
+			if len(a.Value) >= 4 {
+				r.IfIndex = int(*(*uint32)(unsafe.Pointer(&a.Value[0])))
+			}
+		case syscall.RTA_PRIORITY:
+			if len(a.Value) >= 4 {
+				r.Metric = int(*(*uint32)(unsafe.Pointer(&a.Value[0])))
+			}
+		case syscall.RTA_TABLE:
+			// Tables numbered above 255 are only given here.
+			if len(a.Value) >= 4 {
+				r.Table = int(*(*uint32)(unsafe.Pointer(&a.Value[0])))
+			}
+		}
+	}
+	return r
+}
+
+// lookupRoute returns the route in rt to ip that the kernel chooses
+// under its default policy rules, or nil if there is none.  The
+// local, main and default tables are searched in turn; within a
+// table the longest matching prefix wins, then the lowest metric.
+func lookupRoute(rt []Route, ip IP) *Route {
+	for _, table := range []int{syscall.RT_TABLE_LOCAL, syscall.RT_TABLE_MAIN, syscall.RT_TABLE_DEFAULT} {
+		var best *Route
+		var bestLen int
+		for i := range rt {
+			r := &rt[i]
+			if r.Table != table || !r.Dst.Contains(ip) {
+				continue
+			}
+			n, _ := r.Dst.Mask.Size()
+			if best == nil || n > bestLen || n == bestLen && r.Metric < best.Metric {
+				best, bestLen = r, n
+			}
+		}
+		if best == nil {
+			continue
+		}
+		switch best.typ {
+		case routeThrow:
+			continue
+		case routeBlackhole, routeUnreachable, routeProhibit:
+			return nil
+		}
+		return best
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"syscall"
+	"testing"
+)
+
+var lookupRouteTable = []Route{
+	{Dst: &IPNet{IP: IPv4zero.To4(), Mask: CIDRMask(0, 32)}, Gateway: IPv4(192, 0, 2, 1), IfIndex: 2, Metric: 100, Table: syscall.RT_TABLE_MAIN, typ: routeUnicast},
+	{Dst: &IPNet{IP: IPv4(192, 0, 2, 0).To4(), Mask: CIDRMask(24, 32)}, IfIndex: 2, Table: syscall.RT_TABLE_MAIN, typ: routeUnicast},
+	{Dst: &IPNet{IP: IPv4(192, 0, 2, 0).To4(), Mask: CIDRMask(24, 32)}, IfIndex: 3, Metric: 10, Table: syscall.RT_TABLE_MAIN, typ: routeUnicast},
+	{Dst: &IPNet{IP: IPv4(192, 0, 2, 7).To4(), Mask: CIDRMask(32, 32)}, IfIndex: 2, Table: syscall.RT_TABLE_LOCAL, typ: routeLocal},
+	{Dst: &IPNet{IP: IPv4(198, 51, 100, 0).To4(), Mask: CIDRMask(24, 32)}, Table: syscall.RT_TABLE_MAIN, typ: routeUnreachable},
+	{Dst: &IPNet{IP: IPv4(203, 0, 113, 0).To4(), Mask: CIDRMask(24, 32)}, IfIndex: 4, Table: 100, typ: routeUnicast},
+	{Dst: &IPNet{IP: IPv6zero, Mask: CIDRMask(0, 128)}, IfIndex: 5, Table: syscall.RT_TABLE_MAIN, typ: routeUnicast},
+}
+
+var lookupRouteTests = []struct {
+	ip      IP
+	ifindex int // of the route found, or 0 for none
+	gateway bool
+}{
+	{IPv4(192, 0, 2, 9), 2, false},
+	{IPv4(192, 0, 2, 7), 2, false},
+	{IPv4(8, 8, 8, 8), 2, true},
+	{IPv4(198, 51, 100, 1), 0, false},
+	{IPv4(203, 0, 113, 1), 2, true}, // table 100 is not consulted
+	{ParseIP("2001:db8::1"), 5, false},
+}
+
+func TestLookupRouteTable(t *testing.T) {
+	for _, tt := range lookupRouteTests {
+		r := lookupRoute(lookupRouteTable, tt.ip)
+		switch {
+		case r == nil && tt.ifindex == 0:
+		case r == nil || r.IfIndex != tt.ifindex || (r.Gateway != nil) != tt.gateway:
+			t.Errorf("lookupRoute(%v) = %+v; want interface %d", tt.ip, r, tt.ifindex)
+		}
+	}
+}
+
+func TestLookupRoute(t *testing.T) {
+	ips := []IP{IPv4(127, 0, 0, 1)}
+	if supportsIPv6 {
+		ips = append(ips, IPv6loopback)
+	}
+	for _, ip := range ips {
+		r, err := LookupRoute(ip)
+		if err != nil {
+			t.Errorf("LookupRoute(%v): %v", ip, err)
+			continue
+		}
+		ifi, err := InterfaceByIndex(r.IfIndex)
+		if err != nil || ifi.Flags&FlagLoopback == 0 {
+			t.Errorf("LookupRoute(%v) = %+v, by interface %v; want loopback", ip, r, ifi)
+		}
+	}
+
+	rt, err := Routes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rt {
+		if r.Dst.Contains(IPv4(127, 0, 0, 1)) {
+			return
+		}
+	}
+	t.Errorf("no route to 127.0.0.1 in %+v", rt)
+}
@@ -0,0 +1,17 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin freebsd netbsd openbsd plan9 windows
+
+package net
+
+import "errors"
+
+func routeTable() ([]Route, error) {
+	return nil, errors.New("net: routing table not supported")
+}
+
+func lookupRoute(rt []Route, ip IP) *Route {
+	return nil
+}
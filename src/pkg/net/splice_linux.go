@@ -0,0 +1,259 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"io"
+	"os"
+	"syscall"
+)
+
+// Flags for splice, from <fcntl.h>.
+const (
+	spliceMove     = 0x1 // SPLICE_F_MOVE
+	spliceNonblock = 0x2 // SPLICE_F_NONBLOCK
+)
+
+// maxSpliceSize is the largest chunk size we ask the kernel to move
+// at a time.  It is the default capacity of a pipe, so that a chunk
+// always fits in the pipe between the two descriptors.
+const maxSpliceSize int = 64 << 10
+
+// spliceFrom copies the contents of r to c using the splice system
+// call, through a pipe, if r is a stream socket.
+//
+// if handled == true, spliceFrom returns the number of bytes copied and
+// any non-EOF error.
+//
+// if handled == false, spliceFrom performed no work.
+func spliceFrom(c *netFD, r io.Reader) (written int64, err error, handled bool) {
+	var remain int64 = 1 << 62 // by default, copy until EOF
+
+	lr, ok := r.(*io.LimitedReader)
+	if ok {
+		remain, r = lr.N, lr.R
+		if remain <= 0 {
+			return 0, nil, true
+		}
+	}
+	src := streamFD(r)
+	if src == nil {
+		return 0, nil, false
+	}
+	written, err, handled = splice(c, nil, src, remain)
+	if lr != nil {
+		lr.N = remain - written
+	}
+	return
+}
+
+// spliceTo copies the contents of c to w using the splice system
+// call, through a pipe, if w is a stream socket or a regular file.
+//
+// if handled == true, spliceTo returns the number of bytes copied and
+// any non-EOF error.
+//
+// if handled == false, spliceTo performed no work.
+func spliceTo(w io.Writer, c *netFD) (written int64, err error, handled bool) {
+	if dst := streamFD(w); dst != nil {
+		return splice(dst, nil, c, 1<<62)
+	}
+	f, ok := w.(*os.File)
+	if !ok {
+		return 0, nil, false
+	}
+	// Splicing to other kinds of files could block the thread.
+	if fi, err := f.Stat(); err != nil || !fi.Mode().IsRegular() {
+		return 0, nil, false
+	}
+	return splice(nil, f, c, 1<<62)
+}
+
+// streamFD returns the descriptor of x if it is a stream socket.
+func streamFD(x interface{}) *netFD {
+	var fd *netFD
+	switch c := x.(type) {
+	case *TCPConn:
+		if c.ok() {
+			fd = c.fd
+		}
+	case *UnixConn:
+		if c.ok() {
+			fd = c.fd
+		}
+	}
+	if fd == nil || fd.sotype != syscall.SOCK_STREAM {
+		return nil
+	}
+	return fd
+}
+
+// splice copies up to remain bytes from the socket src to the socket
+// dst, or to the file f if dst is nil, moving them through a pipe so
+// that they are not copied to user space.
+func splice(dst *netFD, f *os.File, src *netFD, remain int64) (written int64, err error, handled bool) {
+	var p [2]int
+	syscall.ForkLock.RLock()
+	err = syscall.Pipe(p[:])
+	if err == nil {
+		syscall.CloseOnExec(p[0])
+		syscall.CloseOnExec(p[1])
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return 0, nil, false
+	}
+	defer syscall.Close(p[0])
+	defer syscall.Close(p[1])
+
+	src.rio.Lock()
+	defer src.rio.Unlock()
+	if err := src.incref(false); err != nil {
+		return 0, err, true
+	}
+	defer src.decref()
+	var dstfd int
+	if dst != nil {
+		dst.wio.Lock()
+		defer dst.wio.Unlock()
+		if err := dst.incref(false); err != nil {
+			return 0, err, true
+		}
+		defer dst.decref()
+		dstfd = dst.sysfd
+	} else {
+		dstfd = int(f.Fd())
+	}
+
+	var buf []byte // for files that cannot be spliced to
+	for remain > 0 {
+		n := maxSpliceSize
+		if int64(n) > remain {
+			n = int(remain)
+		}
+		n, err = spliceRead(p[1], src, n)
+		if err != nil {
+			err = &OpError{"splice", src.net, src.raddr, err}
+			break
+		}
+		if n == 0 {
+			break
+		}
+		remain -= int64(n)
+
+		var m int
+		if dst != nil {
+			m, err = spliceWrite(dst, p[0], n)
+			if err != nil {
+				err = &OpError{"splice", dst.net, dst.raddr, err}
+			}
+		} else {
+			if buf == nil {
+				m, err = spliceWriteFile(dstfd, p[0], n)
+				if m == 0 && err == syscall.EINVAL {
+					// The file was opened for appending, or its
+					// file system does not support splice.
+					buf = make([]byte, maxSpliceSize)
+				} else if err != nil {
+					err = &os.PathError{Op: "splice", Path: f.Name(), Err: err}
+				}
+			}
+			if buf != nil {
+				m, err = copyPipe(f, p[0], n, buf)
+			}
+		}
+		written += int64(m)
+		if err != nil {
+			break
+		}
+	}
+	return written, err, true
+}
+
+// spliceRead moves up to max bytes from the socket src into the
+// empty pipe pw.  It returns 0 at end of file.
+func spliceRead(pw int, src *netFD, max int) (int, error) {
+	for {
+		if err := src.pd.PrepareRead(); err != nil {
+			return 0, err
+		}
+		n, err := syscall.Splice(src.sysfd, nil, pw, nil, max, spliceMove|spliceNonblock)
+		if err == syscall.EAGAIN {
+			if err = src.pd.WaitRead(); err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			return 0, err
+		}
+		return int(n), nil
+	}
+	panic("unreachable")
+}
+
+// spliceWrite moves n bytes from the pipe pr into the socket dst.
+func spliceWrite(dst *netFD, pr int, n int) (written int, err error) {
+	for written < n {
+		if err = dst.pd.PrepareWrite(); err != nil {
+			break
+		}
+		m, err1 := syscall.Splice(pr, nil, dst.sysfd, nil, n-written, spliceMove|spliceNonblock)
+		if m > 0 {
+			written += int(m)
+			continue
+		}
+		if err1 == syscall.EAGAIN {
+			if err = dst.pd.WaitWrite(); err == nil {
+				continue
+			}
+			break
+		}
+		if err1 != nil {
+			err = err1
+			break
+		}
+		err = io.ErrUnexpectedEOF
+		break
+	}
+	return
+}
+
+// spliceWriteFile moves n bytes from the pipe pr into the file fd.
+func spliceWriteFile(fd int, pr int, n int) (written int, err error) {
+	for written < n {
+		m, err1 := syscall.Splice(pr, nil, fd, nil, n-written, spliceMove)
+		if m > 0 {
+			written += int(m)
+			continue
+		}
+		if err1 != nil {
+			err = err1
+			break
+		}
+		err = io.ErrShortWrite
+		break
+	}
+	return
+}
+
+// copyPipe copies n bytes from the pipe pr to f through buf.
+func copyPipe(f *os.File, pr int, n int, buf []byte) (written int, err error) {
+	for written < n {
+		b := buf
+		if len(b) > n-written {
+			b = b[:n-written]
+		}
+		m, err1 := syscall.Read(pr, b)
+		if err1 != nil {
+			return written, os.NewSyscallError("read", err1)
+		}
+		m, err = f.Write(b[:m])
+		written += m
+		if err != nil {
+			break
+		}
+	}
+	return
+}
@@ -0,0 +1,17 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin freebsd netbsd openbsd windows
+
+package net
+
+import "io"
+
+func spliceFrom(c *netFD, r io.Reader) (n int64, err error, handled bool) {
+	return 0, nil, false
+}
+
+func spliceTo(w io.Writer, c *netFD) (n int64, err error, handled bool) {
+	return 0, nil, false
+}
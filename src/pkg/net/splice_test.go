@@ -0,0 +1,179 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"testing"
+)
+
+// newTCPConnPair returns the two ends of a loopback TCP connection.
+func newTCPConnPair() (*TCPConn, *TCPConn, error) {
+	ln, err := Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer ln.Close()
+	c1, err := Dial("tcp", ln.Addr().String())
+	if err != nil {
+		return nil, nil, err
+	}
+	c2, err := ln.Accept()
+	if err != nil {
+		c1.Close()
+		return nil, nil, err
+	}
+	return c1.(*TCPConn), c2.(*TCPConn), nil
+}
+
+func copyTestData(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i * 7)
+	}
+	return b
+}
+
+var tcpCopyTests = []struct {
+	name string
+	copy func(dst, src *TCPConn) (int64, error)
+	n    int // bytes to copy of the 1<<20+123 sent
+}{
+	{"ReadFrom", func(dst, src *TCPConn) (int64, error) { return dst.ReadFrom(src) }, 1<<20 + 123},
+	{"WriteTo", func(dst, src *TCPConn) (int64, error) { return src.WriteTo(dst) }, 1<<20 + 123},
+	{"CopyN", func(dst, src *TCPConn) (int64, error) { return io.CopyN(dst, src, 100000) }, 100000},
+}
+
+func TestTCPCopyTCP(t *testing.T) {
+	if runtime.GOOS == "plan9" {
+		t.Logf("skipping test on %q", runtime.GOOS)
+		return
+	}
+
+	data := copyTestData(1<<20 + 123)
+	for _, tt := range tcpCopyTests {
+		src, srcPeer, err := newTCPConnPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		dst, dstPeer, err := newTCPConnPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			srcPeer.Write(data)
+			srcPeer.Close()
+		}()
+		recv := make(chan []byte)
+		go func() {
+			b, _ := ioutil.ReadAll(dstPeer)
+			recv <- b
+		}()
+
+		n, err := tt.copy(dst, src)
+		dst.Close()
+		if n != int64(tt.n) || err != nil {
+			t.Errorf("%s = %d, %v; want %d, <nil>", tt.name, n, err, tt.n)
+		}
+		if b := <-recv; !bytes.Equal(b, data[:tt.n]) {
+			t.Errorf("%s: received %d bytes, not the %d sent", tt.name, len(b), tt.n)
+		}
+		if b, err := ioutil.ReadAll(src); err != nil || !bytes.Equal(b, data[tt.n:]) {
+			t.Errorf("%s: %d bytes left behind, %v; want %d, <nil>", tt.name, len(b), err, len(data)-tt.n)
+		}
+		src.Close()
+		dstPeer.Close()
+	}
+}
+
+func TestTCPWriteToFile(t *testing.T) {
+	if runtime.GOOS == "plan9" {
+		t.Logf("skipping test on %q", runtime.GOOS)
+		return
+	}
+
+	data := copyTestData(1<<20 + 123)
+	for _, flag := range []int{os.O_TRUNC, os.O_APPEND} {
+		tf, err := ioutil.TempFile("", "go-nettest")
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := tf.Name()
+		tf.Close()
+		defer os.Remove(name)
+		f, err := os.OpenFile(name, os.O_WRONLY|flag, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		src, srcPeer, err := newTCPConnPair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			srcPeer.Write(data)
+			srcPeer.Close()
+		}()
+		n, err := io.Copy(f, src)
+		src.Close()
+		f.Close()
+		if n != int64(len(data)) || err != nil {
+			t.Errorf("Copy with flag %#x = %d, %v; want %d, <nil>", flag, n, err, len(data))
+		}
+		if b, err := ioutil.ReadFile(name); err != nil || !bytes.Equal(b, data) {
+			t.Errorf("file written with flag %#x holds %d bytes, %v; want the %d sent", flag, len(b), err, len(data))
+		}
+	}
+}
+
+func BenchmarkTCPReadFromTCP(b *testing.B) {
+	benchmarkTCPCopy(b, func(dst, src *TCPConn, n int64) (int64, error) {
+		return dst.ReadFrom(io.LimitReader(src, n))
+	})
+}
+
+func BenchmarkTCPGenericReadFromTCP(b *testing.B) {
+	benchmarkTCPCopy(b, func(dst, src *TCPConn, n int64) (int64, error) {
+		return genericReadFrom(dst, io.LimitReader(src, n))
+	})
+}
+
+func benchmarkTCPCopy(b *testing.B, copy func(dst, src *TCPConn, n int64) (int64, error)) {
+	const chunk = 1 << 20
+	b.StopTimer()
+	src, srcPeer, err := newTCPConnPair()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer src.Close()
+	defer srcPeer.Close()
+	dst, dstPeer, err := newTCPConnPair()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer dst.Close()
+	defer dstPeer.Close()
+	go func() {
+		buf := make([]byte, 64<<10)
+		for {
+			if _, err := srcPeer.Write(buf); err != nil {
+				return
+			}
+		}
+	}()
+	go io.Copy(ioutil.Discard, dstPeer)
+	b.SetBytes(chunk)
+	b.StartTimer()
+
+	for i := 0; i < b.N; i++ {
+		if n, err := copy(dst, src, chunk); n != chunk || err != nil {
+			b.Fatalf("copied %d, %v; want %d, <nil>", n, err, chunk)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build freebsd openbsd plan9 windows
+
+package net
+
+import (
+	"errors"
+	"time"
+)
+
+// setKeepAlivePeriod is not supported; the operating system's
+// default period applies.
+func setKeepAlivePeriod(fd *netFD, d time.Duration) error {
+	return errors.New("net: setting the keep-alive period is not supported")
+}
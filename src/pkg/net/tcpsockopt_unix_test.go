@@ -0,0 +1,25 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux netbsd
+
+package net
+
+import (
+	"syscall"
+	"testing"
+)
+
+func testKeepAlive(t *testing.T, c *TCPConn, secs int) {
+	fd := c.fd.sysfd
+	if v, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE); err != nil || v == 0 {
+		t.Errorf("SO_KEEPALIVE = %d, %v; want enabled", v, err)
+	}
+	if v, err := syscall.GetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE); err != nil || v != secs {
+		t.Errorf("TCP_KEEPIDLE = %d, %v; want %d", v, err, secs)
+	}
+	if v, err := syscall.GetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL); err != nil || v != secs {
+		t.Errorf("TCP_KEEPINTVL = %d, %v; want %d", v, err, secs)
+	}
+}
@@ -619,3 +619,49 @@ func TestProlongTimeout(t *testing.T) {
 		c.Write(buf[:])
 	}
 }
+
+// TestDeadlineWhileBlocked tests that a deadline set while a read is
+// blocked applies to that read.
+func TestDeadlineWhileBlocked(t *testing.T) {
+	switch runtime.GOOS {
+	case "linux":
+	default:
+		// The pollServer only looks at deadlines when a read starts.
+		t.Logf("skipping test on %q", runtime.GOOS)
+		return
+	}
+
+	ln := newLocalListener(t)
+	defer ln.Close()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		var buf [1]byte
+		c.Read(buf[:]) // wait for the client to go away
+	}()
+	c, err := Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer c.Close()
+
+	errc := make(chan error, 1)
+	go func() {
+		var buf [1]byte
+		_, err := c.Read(buf[:])
+		errc <- err
+	}()
+	time.Sleep(50 * time.Millisecond) // let the read block
+	c.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	select {
+	case err := <-errc:
+		if !isTimeout(err) {
+			t.Errorf("Read: got %v; want timeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Read did not time out")
+	}
+}
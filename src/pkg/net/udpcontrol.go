@@ -0,0 +1,42 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Per-packet IP control messages for UDP
+
+package net
+
+// ControlFlags selects the control messages a UDPConn receives with
+// each packet; see UDPConn.SetControlMessage.
+type ControlFlags uint
+
+const (
+	FlagTTL       ControlFlags = 1 << iota // time to live, or hop limit for IPv6
+	FlagTOS                                // type of service, or traffic class for IPv6
+	FlagDst                                // destination address of the packet
+	FlagInterface                          // interface the packet arrived on
+)
+
+// A ControlMessage holds the IP-level information that travels with
+// a single UDP packet as ancillary data.
+//
+// When a packet is received, the fields enabled by
+// UDPConn.SetControlMessage are filled in.  When a packet is sent,
+// the non-zero fields override the socket's defaults for that packet
+// alone.  On a host with several addresses, a server can answer from
+// the address a query arrived on by sending with Src set to the Dst
+// and IfIndex set to the IfIndex it received.
+type ControlMessage struct {
+	TTL     int // time to live, or hop limit for IPv6
+	TOS     int // type of service, or traffic class for IPv6
+	Src     IP  // source address; sending only
+	Dst     IP  // destination address; receiving only
+	IfIndex int // interface index
+}
+
+func (cm *ControlMessage) String() string {
+	if cm == nil {
+		return "<nil>"
+	}
+	return "ttl=" + itoa(cm.TTL) + " tos=" + itoa(cm.TOS) + " src=" + cm.Src.String() + " dst=" + cm.Dst.String() + " ifindex=" + itoa(cm.IfIndex)
+}
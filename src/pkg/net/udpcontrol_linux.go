@@ -0,0 +1,222 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// controlMessageSpace is enough ancillary data space for every
+// control message SetControlMessage can enable, in both the IPv4
+// and IPv6 forms that an IPv6 socket may receive for an IPv4 packet.
+var controlMessageSpace = syscall.CmsgSpace(syscall.SizeofInet4Pktinfo) + syscall.CmsgSpace(syscall.SizeofInet6Pktinfo) + 4*syscall.CmsgSpace(4)
+
+// SetControlMessage turns on or off, according to on, the receipt
+// of the control messages selected by cf with each packet read by
+// ReadFromUDPControl.  FlagDst and FlagInterface share a socket
+// option: turning on either turns on both, and turning off either
+// turns off both.
+func (c *UDPConn) SetControlMessage(cf ControlFlags, on bool) error {
+	if !c.ok() {
+		return syscall.EINVAL
+	}
+	if err := c.fd.incref(false); err != nil {
+		return err
+	}
+	defer c.fd.decref()
+	level, ttl, tos, pktinfo := syscall.IPPROTO_IP, syscall.IP_RECVTTL, syscall.IP_RECVTOS, syscall.IP_PKTINFO
+	if c.fd.family == syscall.AF_INET6 {
+		level, ttl, tos, pktinfo = syscall.IPPROTO_IPV6, syscall.IPV6_RECVHOPLIMIT, syscall.IPV6_RECVTCLASS, syscall.IPV6_RECVPKTINFO
+	}
+	opts := []struct {
+		flags ControlFlags
+		name  int
+	}{
+		{FlagTTL, ttl},
+		{FlagTOS, tos},
+		{FlagDst | FlagInterface, pktinfo},
+	}
+	for _, o := range opts {
+		if cf&o.flags == 0 {
+			continue
+		}
+		if err := syscall.SetsockoptInt(c.fd.sysfd, level, o.name, boolint(on)); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	return nil
+}
+
+// ReadFromUDPControl reads a UDP packet from c, copying the payload
+// into b.  It returns the number of bytes copied into b, the control
+// message that came with the packet and the return address that was
+// on the packet.  The control message holds the fields enabled by
+// SetControlMessage.
+func (c *UDPConn) ReadFromUDPControl(b []byte) (n int, cm *ControlMessage, addr *UDPAddr, err error) {
+	if !c.ok() {
+		return 0, nil, nil, syscall.EINVAL
+	}
+	oob := make([]byte, controlMessageSpace)
+	n, oobn, _, addr, err := c.ReadMsgUDP(b, oob)
+	if err != nil {
+		return n, nil, addr, err
+	}
+	cm, err = ParseControlMessage(oob[:oobn])
+	return n, cm, addr, err
+}
+
+// WriteToUDPControl writes a UDP packet to addr via c, copying the
+// payload from b, with the per-packet settings of the control
+// message cm, which may be nil.  On a connected c, addr must be nil.
+func (c *UDPConn) WriteToUDPControl(b []byte, cm *ControlMessage, addr *UDPAddr) (int, error) {
+	if !c.ok() {
+		return 0, syscall.EINVAL
+	}
+	var sa syscall.Sockaddr
+	if c.fd.isConnected {
+		if addr != nil {
+			return 0, &OpError{"write", c.fd.net, addr, ErrWriteToConnected}
+		}
+	} else {
+		if addr == nil {
+			return 0, &OpError{"write", c.fd.net, nil, errMissingAddress}
+		}
+		var err error
+		if sa, err = addr.sockaddr(c.fd.family); err != nil {
+			return 0, &OpError{"write", c.fd.net, addr, err}
+		}
+	}
+	n, _, err := c.fd.WriteMsg(b, marshalControlMessage(c.fd.family, cm), sa)
+	return n, err
+}
+
+// SetTTL sets the time to live, or hop limit for IPv6, of the
+// unicast packets sent on c.
+func (c *UDPConn) SetTTL(ttl int) error {
+	if !c.ok() {
+		return syscall.EINVAL
+	}
+	if c.fd.family == syscall.AF_INET6 {
+		return setIntOpt(c.fd, syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, ttl)
+	}
+	return setIntOpt(c.fd, syscall.IPPROTO_IP, syscall.IP_TTL, ttl)
+}
+
+// SetTOS sets the type of service, or traffic class for IPv6, of the
+// packets sent on c.
+func (c *UDPConn) SetTOS(tos int) error {
+	if !c.ok() {
+		return syscall.EINVAL
+	}
+	if c.fd.family == syscall.AF_INET6 {
+		return setIntOpt(c.fd, syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, tos)
+	}
+	return setIntOpt(c.fd, syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+}
+
+func setIntOpt(fd *netFD, level, name, v int) error {
+	if err := fd.incref(false); err != nil {
+		return err
+	}
+	defer fd.decref()
+	if err := syscall.SetsockoptInt(fd.sysfd, level, name, v); err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	return nil
+}
+
+// ParseControlMessage parses the ancillary data oob, as returned by
+// ReadMsgUDP, for the IP and IPv6 control messages ControlMessage
+// holds.  Other control messages are ignored.
+func ParseControlMessage(oob []byte) (*ControlMessage, error) {
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, os.NewSyscallError("parsesocketcontrolmessage", err)
+	}
+	cm := new(ControlMessage)
+	for _, m := range msgs {
+		switch {
+		case m.Header.Level == syscall.IPPROTO_IP && m.Header.Type == syscall.IP_TTL && len(m.Data) >= 4,
+			m.Header.Level == syscall.IPPROTO_IPV6 && m.Header.Type == syscall.IPV6_HOPLIMIT && len(m.Data) >= 4:
+			cm.TTL = int(*(*int32)(unsafe.Pointer(&m.Data[0])))
+		case m.Header.Level == syscall.IPPROTO_IP && m.Header.Type == syscall.IP_TOS && len(m.Data) >= 1:
+			// Unlike the rest, the IPv4 TOS is a single byte.
+			cm.TOS = int(m.Data[0])
+		case m.Header.Level == syscall.IPPROTO_IPV6 && m.Header.Type == syscall.IPV6_TCLASS && len(m.Data) >= 4:
+			cm.TOS = int(*(*int32)(unsafe.Pointer(&m.Data[0])))
+		case m.Header.Level == syscall.IPPROTO_IP && m.Header.Type == syscall.IP_PKTINFO && len(m.Data) >= syscall.SizeofInet4Pktinfo:
+			pi := (*syscall.Inet4Pktinfo)(unsafe.Pointer(&m.Data[0]))
+			cm.Dst = IPv4(pi.Addr[0], pi.Addr[1], pi.Addr[2], pi.Addr[3])
+			cm.IfIndex = int(pi.Ifindex)
+		case m.Header.Level == syscall.IPPROTO_IPV6 && m.Header.Type == syscall.IPV6_PKTINFO && len(m.Data) >= syscall.SizeofInet6Pktinfo:
+			pi := (*syscall.Inet6Pktinfo)(unsafe.Pointer(&m.Data[0]))
+			cm.Dst = make(IP, IPv6len)
+			copy(cm.Dst, pi.Addr[:])
+			cm.IfIndex = int(pi.Ifindex)
+		}
+	}
+	return cm, nil
+}
+
+// marshalControlMessage returns the ancillary data that applies cm
+// to a packet sent on a socket of the address family family.
+func marshalControlMessage(family int, cm *ControlMessage) []byte {
+	if cm == nil {
+		return nil
+	}
+	pktinfo := cm.Src != nil || cm.IfIndex != 0
+	space := 0
+	if cm.TTL != 0 {
+		space += syscall.CmsgSpace(4)
+	}
+	if cm.TOS != 0 {
+		space += syscall.CmsgSpace(4)
+	}
+	if pktinfo {
+		space += syscall.CmsgSpace(syscall.SizeofInet6Pktinfo)
+	}
+	if space == 0 {
+		return nil
+	}
+	b := make([]byte, space)
+	off := 0
+	// add appends a control message with datalen bytes of data
+	// and returns a pointer to its data.
+	add := func(level, typ, datalen int) unsafe.Pointer {
+		h := (*syscall.Cmsghdr)(unsafe.Pointer(&b[off]))
+		h.Level = int32(level)
+		h.Type = int32(typ)
+		h.SetLen(syscall.CmsgLen(datalen))
+		p := unsafe.Pointer(&b[off+syscall.CmsgLen(0)])
+		off += syscall.CmsgSpace(datalen)
+		return p
+	}
+	level, ttl, tos := syscall.IPPROTO_IP, syscall.IP_TTL, syscall.IP_TOS
+	if family == syscall.AF_INET6 {
+		level, ttl, tos = syscall.IPPROTO_IPV6, syscall.IPV6_HOPLIMIT, syscall.IPV6_TCLASS
+	}
+	if cm.TTL != 0 {
+		*(*int32)(add(level, ttl, 4)) = int32(cm.TTL)
+	}
+	if cm.TOS != 0 {
+		*(*int32)(add(level, tos, 4)) = int32(cm.TOS)
+	}
+	if pktinfo {
+		if family == syscall.AF_INET6 {
+			pi := (*syscall.Inet6Pktinfo)(add(level, syscall.IPV6_PKTINFO, syscall.SizeofInet6Pktinfo))
+			copy(pi.Addr[:], cm.Src.To16())
+			pi.Ifindex = uint32(cm.IfIndex)
+		} else {
+			pi := (*syscall.Inet4Pktinfo)(add(level, syscall.IP_PKTINFO, syscall.SizeofInet4Pktinfo))
+			if ip := cm.Src.To4(); ip != nil {
+				copy(pi.Spec_dst[:], ip)
+			}
+			pi.Ifindex = int32(cm.IfIndex)
+		}
+	}
+	return b[:off]
+}
@@ -0,0 +1,66 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin freebsd netbsd openbsd plan9 windows
+
+package net
+
+import (
+	"errors"
+	"syscall"
+)
+
+var errNoControlMessages = errors.New("net: per-packet control messages not supported")
+
+// SetControlMessage turns on or off, according to on, the receipt
+// of the control messages selected by cf.  It is only implemented on
+// Linux.
+func (c *UDPConn) SetControlMessage(cf ControlFlags, on bool) error {
+	if !c.ok() {
+		return syscall.EINVAL
+	}
+	return errNoControlMessages
+}
+
+// ReadFromUDPControl reads a UDP packet from c with its control
+// message.  It is only implemented on Linux.
+func (c *UDPConn) ReadFromUDPControl(b []byte) (n int, cm *ControlMessage, addr *UDPAddr, err error) {
+	if !c.ok() {
+		return 0, nil, nil, syscall.EINVAL
+	}
+	return 0, nil, nil, errNoControlMessages
+}
+
+// WriteToUDPControl writes a UDP packet to addr via c with the
+// control message cm.  It is only implemented on Linux.
+func (c *UDPConn) WriteToUDPControl(b []byte, cm *ControlMessage, addr *UDPAddr) (int, error) {
+	if !c.ok() {
+		return 0, syscall.EINVAL
+	}
+	return 0, errNoControlMessages
+}
+
+// SetTTL sets the time to live, or hop limit for IPv6, of the
+// unicast packets sent on c.  It is only implemented on Linux.
+func (c *UDPConn) SetTTL(ttl int) error {
+	if !c.ok() {
+		return syscall.EINVAL
+	}
+	return errNoControlMessages
+}
+
+// SetTOS sets the type of service, or traffic class for IPv6, of the
+// packets sent on c.  It is only implemented on Linux.
+func (c *UDPConn) SetTOS(tos int) error {
+	if !c.ok() {
+		return syscall.EINVAL
+	}
+	return errNoControlMessages
+}
+
+// ParseControlMessage parses the ancillary data oob for IP control
+// messages.  It is only implemented on Linux.
+func ParseControlMessage(oob []byte) (*ControlMessage, error) {
+	return nil, errNoControlMessages
+}
@@ -0,0 +1,129 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+var udpControlTests = []struct {
+	net, addr string
+	ipv6      bool
+}{
+	{"udp4", "127.0.0.1:0", false},
+	{"udp6", "[::1]:0", true},
+}
+
+func TestUDPControlMessage(t *testing.T) {
+	switch runtime.GOOS {
+	case "linux":
+	case "plan9":
+		t.Logf("skipping test on %q", runtime.GOOS)
+		return
+	default:
+		c, err := ListenUDP("udp4", &UDPAddr{IP: IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		if err := c.SetControlMessage(FlagDst, true); err == nil {
+			t.Errorf("SetControlMessage succeeded on %s", runtime.GOOS)
+		}
+		return
+	}
+
+	for _, tt := range udpControlTests {
+		if tt.ipv6 && !supportsIPv6 {
+			continue
+		}
+		a, err := ResolveUDPAddr(tt.net, tt.addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := ListenUDP(tt.net, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		c, err := ListenUDP(tt.net, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		s.SetDeadline(time.Now().Add(5 * time.Second))
+		c.SetDeadline(time.Now().Add(5 * time.Second))
+
+		all := FlagTTL | FlagTOS | FlagDst | FlagInterface
+		if err := s.SetControlMessage(all, true); err != nil {
+			t.Fatalf("%s: SetControlMessage: %v", tt.net, err)
+		}
+		if err := c.SetControlMessage(all, true); err != nil {
+			t.Fatalf("%s: SetControlMessage: %v", tt.net, err)
+		}
+
+		// Per-packet settings.
+		saddr := s.LocalAddr().(*UDPAddr)
+		if _, err := c.WriteToUDPControl([]byte("query"), &ControlMessage{TTL: 42, TOS: 0x20}, saddr); err != nil {
+			t.Fatalf("%s: WriteToUDPControl: %v", tt.net, err)
+		}
+		b := make([]byte, 10)
+		n, cm, from, err := s.ReadFromUDPControl(b)
+		if err != nil {
+			t.Fatalf("%s: ReadFromUDPControl: %v", tt.net, err)
+		}
+		if string(b[:n]) != "query" || cm.TTL != 42 || cm.TOS != 0x20 || !cm.Dst.Equal(saddr.IP) {
+			t.Errorf("%s: received %q with %v", tt.net, b[:n], cm)
+		}
+		ifi, err := InterfaceByIndex(cm.IfIndex)
+		if err != nil || ifi.Flags&FlagLoopback == 0 {
+			t.Errorf("%s: packet arrived on interface %d, %v; want loopback", tt.net, cm.IfIndex, ifi)
+		}
+
+		// Replying from the address the query arrived on.
+		if _, err := s.WriteToUDPControl([]byte("reply"), &ControlMessage{Src: cm.Dst, IfIndex: cm.IfIndex}, from); err != nil {
+			t.Fatalf("%s: WriteToUDPControl: %v", tt.net, err)
+		}
+		n, _, from, err = c.ReadFromUDPControl(b)
+		if err != nil {
+			t.Fatalf("%s: ReadFromUDPControl: %v", tt.net, err)
+		}
+		if string(b[:n]) != "reply" || !from.IP.Equal(saddr.IP) || from.Port != saddr.Port {
+			t.Errorf("%s: received %q from %v; want reply from %v", tt.net, b[:n], from, saddr)
+		}
+
+		// Per-socket settings.
+		if err := c.SetTTL(7); err != nil {
+			t.Fatalf("%s: SetTTL: %v", tt.net, err)
+		}
+		if err := c.SetTOS(0x10); err != nil {
+			t.Fatalf("%s: SetTOS: %v", tt.net, err)
+		}
+		if _, err := c.WriteToUDP([]byte("x"), saddr); err != nil {
+			t.Fatal(err)
+		}
+		if _, cm, _, err = s.ReadFromUDPControl(b); err != nil {
+			t.Fatalf("%s: ReadFromUDPControl: %v", tt.net, err)
+		}
+		if cm.TTL != 7 || cm.TOS != 0x10 {
+			t.Errorf("%s: after SetTTL and SetTOS, received %v", tt.net, cm)
+		}
+
+		// Turned off, no control messages come.
+		if err := s.SetControlMessage(all, false); err != nil {
+			t.Fatalf("%s: SetControlMessage: %v", tt.net, err)
+		}
+		if _, err := c.WriteToUDP([]byte("x"), saddr); err != nil {
+			t.Fatal(err)
+		}
+		if _, cm, _, err = s.ReadFromUDPControl(b); err != nil {
+			t.Fatalf("%s: ReadFromUDPControl: %v", tt.net, err)
+		}
+		if cm.TTL != 0 || cm.TOS != 0 || cm.Dst != nil || cm.IfIndex != 0 {
+			t.Errorf("%s: received %v with control messages off", tt.net, cm)
+		}
+	}
+}
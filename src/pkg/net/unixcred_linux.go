@@ -0,0 +1,28 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"os"
+	"syscall"
+)
+
+// PeerCredentials returns the credentials of the process at the other
+// end of c as they were when the connection was established, using
+// the SO_PEERCRED socket option.
+func (c *UnixConn) PeerCredentials() (*UnixCredentials, error) {
+	if !c.ok() {
+		return nil, syscall.EINVAL
+	}
+	if err := c.fd.incref(false); err != nil {
+		return nil, err
+	}
+	defer c.fd.decref()
+	uc, err := syscall.GetsockoptUcred(c.fd.sysfd, syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	if err != nil {
+		return nil, os.NewSyscallError("getsockopt", err)
+	}
+	return &UnixCredentials{Pid: int(uc.Pid), Uid: int(uc.Uid), Gid: int(uc.Gid)}, nil
+}
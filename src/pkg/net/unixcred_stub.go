@@ -0,0 +1,21 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin freebsd netbsd openbsd windows
+
+package net
+
+import (
+	"errors"
+	"syscall"
+)
+
+// PeerCredentials returns the credentials of the process at the other
+// end of c.  It is only implemented on Linux.
+func (c *UnixConn) PeerCredentials() (*UnixCredentials, error) {
+	if !c.ok() {
+		return nil, syscall.EINVAL
+	}
+	return nil, errors.New("net: peer credentials not supported")
+}
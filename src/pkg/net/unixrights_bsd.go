@@ -0,0 +1,40 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin freebsd netbsd openbsd
+
+package net
+
+import "syscall"
+
+// recvmsgCloseOnExec receives a message on the socket s and marks the
+// descriptors received with it close-on-exec.  ForkLock is held
+// throughout, so that no process is started in between.
+func recvmsgCloseOnExec(s int, p, oob []byte) (n, oobn, flags int, err error) {
+	syscall.ForkLock.RLock()
+	defer syscall.ForkLock.RUnlock()
+	n, oobn, flags, _, err = syscall.Recvmsg(s, p, oob, 0)
+	if err != nil {
+		return
+	}
+	msgs, perr := syscall.ParseSocketControlMessage(oob[:oobn])
+	if perr != nil {
+		// The caller parses the messages again and reports this.
+		return
+	}
+	for i := range msgs {
+		m := &msgs[i]
+		if m.Header.Level != syscall.SOL_SOCKET || m.Header.Type != syscall.SCM_RIGHTS {
+			continue
+		}
+		fds, perr := syscall.ParseUnixRights(m)
+		if perr != nil {
+			continue
+		}
+		for _, fd := range fds {
+			syscall.CloseOnExec(fd)
+		}
+	}
+	return
+}
@@ -0,0 +1,14 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import "syscall"
+
+// recvmsgCloseOnExec receives a message on the socket s.  The kernel
+// marks the descriptors received with it close-on-exec.
+func recvmsgCloseOnExec(s int, p, oob []byte) (n, oobn, flags int, err error) {
+	n, oobn, flags, _, err = syscall.Recvmsg(s, p, oob, syscall.MSG_CMSG_CLOEXEC)
+	return
+}
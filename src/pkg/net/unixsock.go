@@ -44,3 +44,11 @@ func ResolveUnixAddr(net, addr string) (*UnixAddr, error) {
 	}
 	return &UnixAddr{addr, net}, nil
 }
+
+// UnixCredentials are the credentials of a process, as reported for
+// the peer of a Unix domain connection.
+type UnixCredentials struct {
+	Pid int
+	Uid int
+	Gid int
+}
@@ -64,6 +64,24 @@ func (c *UnixConn) WriteMsgUnix(b, oob []byte, addr *UnixAddr) (n, oobn int, err
 	return 0, 0, syscall.EPLAN9
 }
 
+// WriteFiles writes b to c along with the open files, which the peer
+// receives as duplicates.
+func (c *UnixConn) WriteFiles(b []byte, files ...*os.File) (int, error) {
+	return 0, syscall.EPLAN9
+}
+
+// ReadFiles reads data into b from c along with up to max open files
+// sent with it, as by WriteFiles.
+func (c *UnixConn) ReadFiles(b []byte, max int) (int, []*os.File, error) {
+	return 0, nil, syscall.EPLAN9
+}
+
+// PeerCredentials returns the credentials of the process at the other
+// end of c.
+func (c *UnixConn) PeerCredentials() (*UnixCredentials, error) {
+	return nil, syscall.EPLAN9
+}
+
 // CloseRead shuts down the reading side of the Unix domain
 // connection.  Most callers should just use Close.
 func (c *UnixConn) CloseRead() error {
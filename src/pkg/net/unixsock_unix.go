@@ -0,0 +1,112 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin freebsd linux netbsd openbsd
+
+// Passing open files over Unix domain sockets
+
+package net
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+var errRightsTruncated = errors.New("more files received than requested")
+
+// WriteFiles writes b to c along with the open files, using an
+// SCM_RIGHTS control message.  The peer receives duplicates of the
+// files' descriptors; the files stay open in this process.  On a
+// stream connection b must not be empty, as the files travel with
+// its first byte.  It returns the number of bytes of b written.
+func (c *UnixConn) WriteFiles(b []byte, files ...*os.File) (n int, err error) {
+	if !c.ok() {
+		return 0, syscall.EINVAL
+	}
+	fds := make([]int, len(files))
+	for i, f := range files {
+		fds[i] = int(f.Fd())
+	}
+	n, _, err = c.WriteMsgUnix(b, syscall.UnixRights(fds...), nil)
+	return
+}
+
+// ReadFiles reads data into b from c along with up to max open files
+// sent with it, as by WriteFiles.  It returns the number of bytes
+// read into b and the files received, which the caller must close.
+// If more than max files were sent, ReadFiles closes the ones it
+// received and returns an error.  The files are close-on-exec from
+// the moment they are received, so a process started concurrently
+// does not inherit them.
+func (c *UnixConn) ReadFiles(b []byte, max int) (n int, files []*os.File, err error) {
+	if !c.ok() {
+		return 0, nil, syscall.EINVAL
+	}
+	oob := make([]byte, syscall.CmsgSpace(max*4))
+	n, oobn, flags, err := c.fd.readMsgRights(b, oob)
+	if err != nil {
+		return
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return n, nil, os.NewSyscallError("parsesocketcontrolmessage", err)
+	}
+	for i := range msgs {
+		m := &msgs[i]
+		if m.Header.Level != syscall.SOL_SOCKET || m.Header.Type != syscall.SCM_RIGHTS {
+			continue
+		}
+		fds, perr := syscall.ParseUnixRights(m)
+		if perr != nil {
+			err = os.NewSyscallError("parseunixrights", perr)
+			break
+		}
+		for _, fd := range fds {
+			files = append(files, os.NewFile(uintptr(fd), "fd"+itoa(fd)))
+		}
+	}
+	if err == nil && flags&syscall.MSG_CTRUNC != 0 {
+		err = &OpError{"read", c.fd.net, c.fd.laddr, errRightsTruncated}
+	}
+	if err != nil {
+		for _, f := range files {
+			f.Close()
+		}
+		files = nil
+	}
+	return
+}
+
+// readMsgRights is like ReadMsg, but the descriptors it receives in
+// SCM_RIGHTS control messages are marked close-on-exec before any
+// process can be started.
+func (fd *netFD) readMsgRights(p []byte, oob []byte) (n, oobn, flags int, err error) {
+	fd.rio.Lock()
+	defer fd.rio.Unlock()
+	if err := fd.incref(false); err != nil {
+		return 0, 0, 0, err
+	}
+	defer fd.decref()
+	for {
+		if err = fd.pd.PrepareRead(); err != nil {
+			break
+		}
+		n, oobn, flags, err = recvmsgCloseOnExec(fd.sysfd, p, oob)
+		if err != nil {
+			if err == syscall.EAGAIN {
+				if err = fd.pd.WaitRead(); err == nil {
+					continue
+				}
+			}
+		}
+		err = chkReadErr(n, err, fd)
+		break
+	}
+	if err != nil && err != io.EOF {
+		err = &OpError{"read", fd.net, fd.laddr, err}
+	}
+	return
+}
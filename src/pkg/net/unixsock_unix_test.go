@@ -0,0 +1,121 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin freebsd linux netbsd openbsd
+
+package net
+
+import (
+	"io/ioutil"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+// unixConnPair returns the two ends of a Unix domain stream
+// connection.
+func unixConnPair(t *testing.T) (*UnixConn, *UnixConn) {
+	f, err := ioutil.TempFile("", "go_net_unixtest")
+	if err != nil {
+		t.Fatalf("TempFile: %s", err)
+	}
+	f.Close()
+	tmpname := f.Name()
+	os.Remove(tmpname)
+	ln, err := Listen("unix", tmpname)
+	if err != nil {
+		t.Fatalf("ListenUnix on %s: %s", tmpname, err)
+	}
+	defer os.Remove(tmpname)
+	defer ln.Close()
+
+	done := make(chan Conn)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			t.Errorf("Accept: %v", err)
+		}
+		done <- c
+	}()
+	c, err := Dial("unix", tmpname)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	s := <-done
+	if s == nil {
+		t.FailNow()
+	}
+	return c.(*UnixConn), s.(*UnixConn)
+}
+
+func TestUnixConnFiles(t *testing.T) {
+	c, s := unixConnPair(t)
+	defer c.Close()
+	defer s.Close()
+
+	f, err := ioutil.TempFile("", "go_net_unixfiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.WriteString("passed"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := c.WriteFiles([]byte("x"), f, f); n != 1 || err != nil {
+		t.Fatalf("WriteFiles = %d, %v", n, err)
+	}
+	var b [10]byte
+	n, files, err := s.ReadFiles(b[:], 2)
+	if err != nil {
+		t.Fatalf("ReadFiles: %v", err)
+	}
+	if n != 1 || b[0] != 'x' || len(files) != 2 {
+		t.Fatalf("ReadFiles = %d, %q, %d files", n, b[:n], len(files))
+	}
+	for _, g := range files {
+		buf := make([]byte, 10)
+		n, err := g.ReadAt(buf, 0)
+		if string(buf[:n]) != "passed" {
+			t.Errorf("received file holds %q, %v", buf[:n], err)
+		}
+		fl, _, e := syscall.Syscall(syscall.SYS_FCNTL, g.Fd(), syscall.F_GETFD, 0)
+		if e != 0 || fl&syscall.FD_CLOEXEC == 0 {
+			t.Errorf("received file is not close-on-exec: flags %#x, %v", fl, e)
+		}
+		g.Close()
+	}
+
+	// Too many files for the reader.
+	if _, err := c.WriteFiles([]byte("y"), f, f, f); err != nil {
+		t.Fatal(err)
+	}
+	n, files, err = s.ReadFiles(b[:], 1)
+	if err == nil || files != nil || n != 1 {
+		t.Errorf("ReadFiles of too many files = %d, %v, %v", n, files, err)
+	}
+}
+
+func TestUnixConnPeerCredentials(t *testing.T) {
+	c, s := unixConnPair(t)
+	defer c.Close()
+	defer s.Close()
+
+	cred, err := s.PeerCredentials()
+	if runtime.GOOS != "linux" {
+		if err == nil {
+			t.Errorf("PeerCredentials succeeded on %s", runtime.GOOS)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := UnixCredentials{os.Getpid(), os.Getuid(), os.Getgid()}
+	if *cred != want {
+		t.Errorf("PeerCredentials = %+v; want %+v", *cred, want)
+	}
+}
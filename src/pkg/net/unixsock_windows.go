@@ -0,0 +1,22 @@
+// Copyright 2012 The Go Authors.  All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package net
+
+import (
+	"os"
+	"syscall"
+)
+
+// WriteFiles writes b to c along with the open files.  It is not
+// implemented on Windows.
+func (c *UnixConn) WriteFiles(b []byte, files ...*os.File) (int, error) {
+	return 0, syscall.EWINDOWS
+}
+
+// ReadFiles reads data into b from c along with up to max open files.
+// It is not implemented on Windows.
+func (c *UnixConn) ReadFiles(b []byte, max int) (int, []*os.File, error) {
+	return 0, nil, syscall.EWINDOWS
+}
@@ -9,6 +9,8 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 	"text/template"
 )
@@ -17,11 +19,8 @@ type crashTest struct {
 	Cgo bool
 }
 
-// This test is a separate program, because it is testing
-// both main (m0) and non-main threads (m).
-
-func testCrashHandler(t *testing.T, ct *crashTest) {
-	st := template.Must(template.New("crashSource").Parse(crashSource))
+func executeTest(t *testing.T, templ string, data interface{}) (string, error) {
+	st := template.Must(template.New("crashSource").Parse(templ))
 
 	dir, err := ioutil.TempDir("", "go-build")
 	if err != nil {
@@ -34,7 +33,7 @@ func testCrashHandler(t *testing.T, ct *crashTest) {
 	if err != nil {
 		t.Fatalf("failed to create %v: %v", src, err)
 	}
-	err = st.Execute(f, ct)
+	err = st.Execute(f, data)
 	if err != nil {
 		f.Close()
 		t.Fatalf("failed to execute template: %v", err)
@@ -42,12 +41,20 @@ func testCrashHandler(t *testing.T, ct *crashTest) {
 	f.Close()
 
 	got, err := exec.Command("go", "run", src).CombinedOutput()
+	return string(got), err
+}
+
+// This test is a separate program, because it is testing
+// both main (m0) and non-main threads (m).
+
+func testCrashHandler(t *testing.T, ct *crashTest) {
+	got, err := executeTest(t, crashSource, ct)
 	if err != nil {
-		t.Fatalf("program exited with error: %v\n%v", err, string(got))
+		t.Fatalf("program exited with error: %v\n%v", err, got)
 	}
 	want := "main: recovered done\nnew-thread: recovered done\nsecond-new-thread: recovered done\nmain-again: recovered done\n"
-	if string(got) != string(want) {
-		t.Fatalf("expected %q, but got %q", string(want), string(got))
+	if got != want {
+		t.Fatalf("expected %q, but got %q", want, got)
 	}
 }
 
@@ -55,6 +62,24 @@ func TestCrashHandler(t *testing.T) {
 	testCrashHandler(t, &crashTest{Cgo: false})
 }
 
+// TestDeadlockAfterNetwork tests that the scheduler still reports a
+// deadlock once no goroutine is waiting for network I/O.
+func TestDeadlockAfterNetwork(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		// A pollServer goroutine sits in a system call forever.
+		t.Logf("skipping test on %q", runtime.GOOS)
+		return
+	}
+	got, err := executeTest(t, deadlockAfterNetworkSource, nil)
+	if err == nil {
+		t.Fatalf("program exited successfully; want a deadlock\n%v", got)
+	}
+	want := "all goroutines are asleep - deadlock!"
+	if !strings.Contains(got, want) {
+		t.Fatalf("output does not contain %q:\n%v", want, got)
+	}
+}
+
 const crashSource = `
 package main
 
@@ -98,3 +123,36 @@ func main() {
 	test("main-again")
 }
 `
+
+const deadlockAfterNetworkSource = `
+package main
+
+import (
+	"fmt"
+	"net"
+)
+
+func main() {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	go func() {
+		c, err := ln.Accept()
+		if err == nil {
+			c.Close()
+		}
+	}()
+	c, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	var buf [1]byte
+	c.Read(buf[:]) // wait in the network poller until the server hangs up
+	c.Close()
+	ln.Close()
+	select {}
+}
+`
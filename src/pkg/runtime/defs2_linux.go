@@ -26,6 +26,8 @@ package runtime
 #include <asm/ucontext.h>
 #include <asm/siginfo.h>
 #include <asm-generic/fcntl.h>
+#include <asm-generic/errno.h>
+#include <linux/eventpoll.h>
 
 // This is the sigaction structure from the Linux 2.1.68 kernel which
 //   is used with the rt_sigaction system call.  For 386 this is not
@@ -41,6 +43,8 @@ struct kernel_sigaction {
 import "C"
 
 const (
+	EINTR = C.EINTR
+
 	PROT_NONE  = C.PROT_NONE
 	PROT_READ  = C.PROT_READ
 	PROT_WRITE = C.PROT_WRITE
@@ -110,6 +114,17 @@ const (
 
 	O_RDONLY  = C.O_RDONLY
 	O_CLOEXEC = C.O_CLOEXEC
+
+	EPOLLIN       = C.EPOLLIN
+	EPOLLOUT      = C.EPOLLOUT
+	EPOLLERR      = C.EPOLLERR
+	EPOLLHUP      = C.EPOLLHUP
+	EPOLLRDHUP    = C.EPOLLRDHUP
+	EPOLLET       = C.EPOLLET
+	EPOLL_CLOEXEC = C.EPOLL_CLOEXEC
+	EPOLL_CTL_ADD = C.EPOLL_CTL_ADD
+	EPOLL_CTL_DEL = C.EPOLL_CTL_DEL
+	EPOLL_CTL_MOD = C.EPOLL_CTL_MOD
 )
 
 type Fpreg C.struct__fpreg
@@ -124,3 +139,4 @@ type Sigaltstack C.struct_sigaltstack
 type Sigcontext C.struct_sigcontext
 type Ucontext C.struct_ucontext
 type Itimerval C.struct_itimerval
+type EpollEvent C.struct_epoll_event
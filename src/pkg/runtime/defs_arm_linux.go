@@ -18,11 +18,13 @@ package runtime
 
 #define __ARCH_SI_UID_T int
 #include <asm/signal.h>
+#include <asm-generic/errno.h>
 #include <asm/mman.h>
 #include <asm/sigcontext.h>
 #include <asm/ucontext.h>
 #include <asm/siginfo.h>
 #include <linux/time.h>
+#include <linux/eventpoll.h>
 
 struct xsiginfo {
 	int si_signo;
@@ -46,6 +48,8 @@ struct xsigaction {
 import "C"
 
 const (
+	EINTR = C.EINTR
+
 	PROT_NONE  = C.PROT_NONE
 	PROT_READ  = C.PROT_READ
 	PROT_WRITE = C.PROT_WRITE
@@ -112,6 +116,17 @@ const (
 	ITIMER_REAL    = C.ITIMER_REAL
 	ITIMER_PROF    = C.ITIMER_PROF
 	ITIMER_VIRTUAL = C.ITIMER_VIRTUAL
+
+	EPOLLIN       = C.EPOLLIN
+	EPOLLOUT      = C.EPOLLOUT
+	EPOLLERR      = C.EPOLLERR
+	EPOLLHUP      = C.EPOLLHUP
+	EPOLLRDHUP    = C.EPOLLRDHUP
+	EPOLLET       = C.EPOLLET
+	EPOLL_CLOEXEC = C.EPOLL_CLOEXEC
+	EPOLL_CTL_ADD = C.EPOLL_CTL_ADD
+	EPOLL_CTL_DEL = C.EPOLL_CTL_DEL
+	EPOLL_CTL_MOD = C.EPOLL_CTL_MOD
 )
 
 type Timespec C.struct_timespec
@@ -122,3 +137,4 @@ type Timeval C.struct_timeval
 type Itimerval C.struct_itimerval
 type Siginfo C.struct_xsiginfo
 type Sigaction C.struct_xsigaction
+type EpollEvent C.struct_epoll_event
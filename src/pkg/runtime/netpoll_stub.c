@@ -0,0 +1,20 @@
+// Copyright 2012 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin freebsd netbsd openbsd plan9 windows
+
+#include "runtime.h"
+
+// The network poller is not integrated into the scheduler on
+// these systems, so no goroutine ever waits in netpollblock.
+uint32 runtime·netpollwaiters;
+
+// Polling for network connections is not supported.
+// Returns list of goroutines that become runnable.
+G*
+runtime·netpoll(bool block)
+{
+	USED(block);
+	return nil;
+}
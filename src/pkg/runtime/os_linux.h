@@ -41,3 +41,10 @@ struct Rlimit {
 	uintptr	rlim_max;
 };
 int32	runtime·getrlimit(int32, Rlimit*);
+
+// Used by the network poller.
+int32	runtime·epollcreate(int32 size);
+int32	runtime·epollcreate1(int32 flags);
+int32	runtime·epollctl(int32 epfd, int32 op, int32 fd, EpollEvent *ev);
+int32	runtime·epollwait(int32 epfd, EpollEvent *ev, int32 nev, int32 timeout);
+void	runtime·closeonexec(int32);
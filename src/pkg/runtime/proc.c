@@ -74,6 +74,10 @@ struct Sched {
 	bool init;  // running initialization
 	bool lockmain;  // init called runtime.LockOSThread
 
+	bool polling;	// an m is polling the network
+	M*	pollwake;	// m being woken to poll the network
+	int64 lastpoll;	// time of the last network poll
+
 	Note	stopped;	// one g can set waitstop and wait here for m's to stop
 };
 
@@ -149,6 +153,9 @@ static void matchmg(void);	// match m's to g's
 static void readylocked(G*);	// ready, but sched is locked
 static void mnextg(M*, G*);
 static void mcommoninit(M*);
+static void pollnetwork(bool);
+static void wakestop(void);
+static void wakepoller(void);
 
 void
 setmcpumax(uint32 n)
@@ -540,12 +547,14 @@ static G*
 nextgandunlock(void)
 {
 	G *gp;
-	uint32 v;
 
 top:
 	if(atomic_mcpu(runtime·sched.atomic) >= maxgomaxprocs)
 		runtime·throw("negative mcpu");
 
+	if(runtime·sched.pollwake == m)
+		runtime·sched.pollwake = nil;
+
 	// If there is a g waiting as m->nextg, the mcpu++
 	// happened before it was passed to mnextg.
 	if(m->nextg != nil) {
@@ -570,6 +579,14 @@ top:
 			}
 		}
 	} else {
+		// Goroutines waiting for network I/O must not starve
+		// behind a run queue that never empties.
+		if(runtime·netpollwaiters > 0 && !runtime·sched.polling && haveg() &&
+		   runtime·nanotime() - runtime·sched.lastpoll > 10*1000*1000) {
+			pollnetwork(false);
+			goto top;
+		}
+
 		// Look for work on global queue.
 		while(haveg() && canaddmcpu()) {
 			gp = gget();
@@ -581,6 +598,10 @@ top:
 				continue;
 			}
 			runtime·sched.grunning++;
+			// The network poller may have made more
+			// than one goroutine runnable.
+			if(haveg())
+				matchmg();
 			schedunlock();
 			return gp;
 		}
@@ -597,6 +618,14 @@ top:
 		// the gwait bit will be set, so entersyscall will take the slow path
 		// and use the sched lock.  So it cannot invalidate our decision.
 		//
+		// If goroutines are waiting for network I/O and no
+		// other m is polling, wait for the network instead.
+		if(runtime·netpollwaiters > 0 && !runtime·sched.polling) {
+			wakestop();
+			pollnetwork(true);
+			goto top;
+		}
+
 		// Wait on global m queue.
 		mput(m);
 	}
@@ -616,9 +645,13 @@ top:
 	// wrong and should include gwait, but that does not happen in
 	// standard Go programs, which all start the scavenger.
 	//
-	if((scvg == nil && runtime·sched.grunning == 0) ||
-	   (scvg != nil && runtime·sched.grunning == 1 && runtime·sched.gwait == 0 &&
-	    (scvg->status == Grunning || scvg->status == Gsyscall))) {
+	// Goroutines waiting for network I/O are not asleep:
+	// the m polling the network will wake them.
+	//
+	if(runtime·netpollwaiters == 0 &&
+	   ((scvg == nil && runtime·sched.grunning == 0) ||
+	    (scvg != nil && runtime·sched.grunning == 1 && runtime·sched.gwait == 0 &&
+	     (scvg->status == Grunning || scvg->status == Gsyscall)))) {
 		runtime·throw("all goroutines are asleep - deadlock!");
 	}
 
@@ -626,16 +659,7 @@ top:
 	m->waitnextg = 1;
 	runtime·noteclear(&m->havenextg);
 
-	// Stoptheworld is waiting for all but its cpu to go to stop.
-	// Entersyscall might have decremented mcpu too, but if so
-	// it will see the waitstop and take the slow path.
-	// Exitsyscall never increments mcpu beyond mcpumax.
-	v = runtime·atomicload(&runtime·sched.atomic);
-	if(atomic_waitstop(v) && atomic_mcpu(v) <= atomic_mcpumax(v)) {
-		// set waitstop = 0 (known to be 1)
-		runtime·xadd(&runtime·sched.atomic, -1<<waitstopShift);
-		runtime·notewakeup(&runtime·sched.stopped);
-	}
+	wakestop();
 	schedunlock();
 
 	runtime·notesleep(&m->havenextg);
@@ -645,12 +669,86 @@ top:
 		runtime·lock(&runtime·sched);
 		goto top;
 	}
-	if((gp = m->nextg) == nil)
-		runtime·throw("bad m->nextg in nextgoroutine");
+	if(m->nextg == nil) {
+		// Woken by wakepoller.
+		schedlock();
+		goto top;
+	}
+	gp = m->nextg;
 	m->nextg = nil;
 	return gp;
 }
 
+// Stoptheworld is waiting for all but its cpu to go to stop.
+// Entersyscall might have decremented mcpu too, but if so
+// it will see the waitstop and take the slow path.
+// Exitsyscall never increments mcpu beyond mcpumax.
+// Sched is locked.
+static void
+wakestop(void)
+{
+	uint32 v;
+
+	v = runtime·atomicload(&runtime·sched.atomic);
+	if(atomic_waitstop(v) && atomic_mcpu(v) <= atomic_mcpumax(v)) {
+		// set waitstop = 0 (known to be 1)
+		runtime·xadd(&runtime·sched.atomic, -1<<waitstopShift);
+		runtime·notewakeup(&runtime·sched.stopped);
+	}
+}
+
+// This m is about to block in a system call.  If goroutines are
+// waiting for network I/O and no other m is polling, wake an idle m,
+// or start a new one, to poll in its place.  Sched is locked.
+static void
+wakepoller(void)
+{
+	M *mp;
+
+	if(runtime·netpollwaiters == 0 || runtime·sched.polling || runtime·sched.pollwake != nil)
+		return;
+	if((mp = mget(nil)) != nil) {
+		mp->waitnextg = 0;
+		if(mwakeup != nil)
+			runtime·notewakeup(&mwakeup->havenextg);
+		mwakeup = mp;
+	} else
+		mp = runtime·newm();
+	runtime·sched.pollwake = mp;
+}
+
+// Poll the network and queue the goroutines that are now ready
+// to run, without handing them to other m's: the caller will look
+// at the run queue next.  If block is set, wait until at least one
+// goroutine is ready.  Sched is locked on entry and on exit, but is
+// unlocked while polling, so that netpoll can ready goroutines.
+static void
+pollnetwork(bool block)
+{
+	G *gp, *next;
+
+	runtime·sched.polling = true;
+	schedunlock();
+	gp = runtime·netpoll(block);
+	schedlock();
+	runtime·sched.polling = false;
+	runtime·sched.lastpoll = runtime·nanotime();
+	for(; gp != nil; gp = next) {
+		next = gp->schedlink;
+		if(gp->m) {
+			// Still on its way to the scheduler.
+			gp->readyonstop = 1;
+			continue;
+		}
+		if(gp->status != Gwaiting) {
+			runtime·printf("goroutine %D has status %d\n", gp->goid, gp->status);
+			runtime·throw("bad g->status in pollnetwork");
+		}
+		gp->status = Grunnable;
+		gput(gp);
+	}
+}
+
 int32
 runtime·gcprocs(void)
 {
@@ -928,6 +1026,8 @@ schedule(G *gp)
 		m->helpgc = 0;
 	} else if(m->nextg != nil) {
 		// New m started by matchmg.
+	} else if(runtime·sched.pollwake == m) {
+		// New m started by wakepoller.
 	} else {
 		runtime·throw("invalid m state in scheduler");
 	}
@@ -1017,10 +1117,12 @@ runtime·entersyscall(void)
 	//	mcpu--
 	//	gwait not true
 	//	waitstop && mcpu <= mcpumax not true
+	//	network waiters && no one polling not true
 	// If we can do the same with a single atomic add,
 	// then we can skip the locks.
 	v = runtime·xadd(&runtime·sched.atomic, -1<<mcpuShift);
-	if(!atomic_gwaiting(v) && (!atomic_waitstop(v) || atomic_mcpu(v) > atomic_mcpumax(v)))
+	if(!atomic_gwaiting(v) && (!atomic_waitstop(v) || atomic_mcpu(v) > atomic_mcpumax(v)) &&
+	   (runtime·netpollwaiters == 0 || runtime·sched.polling || runtime·sched.pollwake != nil))
 		return;
 
 	schedlock();
@@ -1033,6 +1135,7 @@ runtime·entersyscall(void)
 		runtime·xadd(&runtime·sched.atomic, -1<<waitstopShift);
 		runtime·notewakeup(&runtime·sched.stopped);
 	}
+	wakepoller();
 
 	// Re-save sched in case one of the calls
 	// (notewakeup, matchmg) triggered something using it.
@@ -80,6 +80,7 @@ typedef	struct	Timer		Timer;
 typedef struct	GCStats		GCStats;
 typedef struct	LFNode		LFNode;
 typedef struct	ParFor		ParFor;
+typedef struct	PollDesc	PollDesc;
 typedef struct	ParForThread	ParForThread;
 typedef struct	CgoMal		CgoMal;
 
@@ -547,6 +548,7 @@ G*	runtime·lastg;
 M*	runtime·allm;
 extern	int32	runtime·gomaxprocs;
 extern	bool	runtime·singleproc;
+extern	uint32	runtime·netpollwaiters;
 extern	uint32	runtime·panicking;
 extern	int32	runtime·gcwaiting;		// gc is waiting to run
 int8*	runtime·goos;
@@ -651,6 +653,8 @@ void	runtime·breakpoint(void);
 void	runtime·gosched(void);
 void	runtime·park(void(*)(Lock*), Lock*, int8*);
 void	runtime·tsleep(int64, int8*);
+void	runtime·addtimer(Timer*);
+bool	runtime·deltimer(Timer*);
 M*	runtime·newm(void);
 void	runtime·goexit(void);
 void	runtime·asmcgocall(void (*fn)(void*), void*);
@@ -861,6 +865,16 @@ uintptr	runtime·memlimit(void);
 // This is a no-op on other systems.
 void	runtime·setprof(bool);
 
+// Network poller, see netpoll.goc.
+// An implementation (netpoll_epoll.c) provides netpollinit,
+// netpollopen, netpollclose and netpoll, and calls netpollready
+// for each descriptor that becomes ready.
+void	runtime·netpollinit(void);
+int32	runtime·netpollopen(int32, PollDesc*);
+int32	runtime·netpollclose(int32);
+void	runtime·netpollready(G**, PollDesc*, int32);
+G*	runtime·netpoll(bool);
+
 // float.c
 extern float64 runtime·nan;
 extern float64 runtime·posinf;